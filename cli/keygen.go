@@ -0,0 +1,27 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/majiayu000/anywhere-ai/core/encryption"
+)
+
+// runKeygen implements the keygen subcommand, which prints a new encryption key entry
+func runKeygen(args []string) {
+	fs := flag.NewFlagSet("keygen", flag.ExitOnError)
+	id := fs.String("id", time.Now().Format("20060102"), "Key ID")
+	fs.Parse(args)
+
+	key, err := encryption.GenerateKey(*id)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(key.String())
+	fmt.Println("")
+	fmt.Println("🔐 Put this line first in ANYWHERE_KEYFILE (or ANYWHERE_ENCRYPTION_KEYS) to encrypt new data with it.")
+	fmt.Println("   Keep older keys after it until the re-encryption job has finished.")
+}
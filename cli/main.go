@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -12,30 +13,56 @@ import (
 
 	"github.com/majiayu000/anywhere-ai/core/database"
 	"github.com/majiayu000/anywhere-ai/core/output"
+	"github.com/majiayu000/anywhere-ai/core/redact"
+	"github.com/majiayu000/anywhere-ai/core/terminal"
 	"github.com/majiayu000/anywhere-ai/core/tmux"
 	"github.com/majiayu000/anywhere-ai/core/tools"
 )
 
 func main() {
+	// 子命令
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "keygen" {
+		runKeygen(os.Args[2:])
+		return
+	}
+
 	// 命令行参数
 	var (
 		tool       = flag.String("tool", "claude", "AI tool to use (claude/gemini/cursor)")
 		sessionID  = flag.String("session", "", "Session ID to attach/restore")
 		listOnly   = flag.Bool("list", false, "List all sessions")
-		dbPath     = flag.String("db", "anywhere.db", "Database path")
+		dbPath     = flag.String("db", database.DefaultSQLitePath(), "SQLite database path (ignored when DATABASE_URL is set)")
 	)
 	flag.Parse()
 
-	// 初始化数据库
-	db, err := database.NewSQLiteDB(*dbPath)
+	// 初始化数据库（与服务器共享会话存储）
+	db, err := database.OpenGormDB(database.StoreDSN(*dbPath))
 	if err != nil {
 		log.Fatal("Failed to initialize database:", err)
 	}
-	defer db.Close()
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+	// 敏感信息脱敏（与服务器使用相同的配置）
+	redactionConfig, err := redact.ConfigFromEnv()
+	if err != nil {
+		log.Fatal("Failed to load redaction config:", err)
+	}
+	redactor, err := redact.New(redactionConfig)
+	if err != nil {
+		log.Fatal("Failed to create redactor:", err)
+	}
+	store := database.NewSessionRepository(db)
+	store.SetRedactor(redactor)
+	deviceID, deviceName := terminal.LocalDevice()
 
 	// 列出会话
 	if *listOnly {
-		listSessions(db)
+		listSessions(store)
 		return
 	}
 
@@ -43,6 +70,7 @@ func main() {
 	tmuxManager := tmux.NewManager()
 	sessionManager := tools.NewSessionManager(tmuxManager)
 	outputProcessor := output.NewOutputProcessor()
+	outputProcessor.SetRedactor(redactor)
 	ctx := context.Background()
 
 	var session *tools.ToolSession
@@ -50,30 +78,45 @@ func main() {
 	// 恢复或创建会话
 	if *sessionID != "" {
 		// 尝试恢复会话
-		dbSession, err := db.GetSession(*sessionID)
+		state, err := store.LoadSession(*sessionID)
 		if err != nil {
 			log.Fatal("Session not found:", err)
 		}
 
-		fmt.Printf("📱 Restoring session: %s\n", dbSession.ID)
+		// 只有持有租约的设备可以运行会话；其他设备的租约过期后才能接管
+		lease, err := store.AcquireLease(state.ID, deviceID, store.LeaseTTL())
+		if errors.Is(err, terminal.ErrLeaseHeld) {
+			log.Fatalf("Session %s is running on %s until %s; take it over once its lease expires",
+				state.ID, lease.DeviceID, lease.ExpiresAt.Format(time.RFC3339))
+		} else if err != nil {
+			log.Fatal("Failed to lease session:", err)
+		}
+
+		fmt.Printf("📱 Restoring session: %s\n", state.ID)
 		
 		// 恢复tmux会话
 		tmuxSession := &tmux.Session{
-			ID:   dbSession.ID,
-			Name: dbSession.ID,
-			Tool: dbSession.Tool,
+			ID:   state.ID,
+			Name: state.ID,
+			Tool: state.ToolName,
 		}
 		
 		if err := tmuxManager.RestoreSession(ctx, tmuxSession); err != nil {
+			store.ReleaseLease(state.ID, deviceID)
 			log.Fatal("Failed to restore session:", err)
 		}
 
+		state.Status = terminal.SessionStatusRunning
+		if err := store.SaveSession(state); err != nil {
+			log.Printf("Failed to save session: %v", err)
+		}
+
 		// 创建工具会话
 		session = &tools.ToolSession{
-			ID:          dbSession.ID,
-			Tool:        tools.ToolType(dbSession.Tool),
+			ID:          state.ID,
+			Tool:        tools.ToolType(state.ToolName),
 			TmuxSession: tmuxSession,
-			State:       tools.SessionState(dbSession.Status),
+			State:       tools.StateReady,
 		}
 	} else {
 		// 创建新会话
@@ -87,21 +130,39 @@ func main() {
 		}
 
 		// 保存到数据库
-		dbSession := &database.Session{
-			ID:           session.ID,
-			Tool:         *tool,
-			DeviceID:     getDeviceID(),
-			DeviceName:   getDeviceName(),
-			Status:       string(session.State),
-			CreatedAt:    time.Now(),
-			LastActivity: time.Now(),
+		now := time.Now()
+		state := &terminal.SessionState{
+			ID:              session.ID,
+			Name:            sessionName,
+			CreatedAt:       now,
+			UpdatedAt:       now,
+			OwnerDeviceID:   deviceID,
+			OwnerDeviceName: deviceName,
+			CurrentDeviceID: deviceID,
+			LastHeartbeat:   now,
+			LeaseExpiresAt:  now.Add(store.LeaseTTL()),
+			ToolName:        *tool,
+			Status:          terminal.SessionStatusRunning,
 		}
 		
-		if err := db.SaveSession(dbSession); err != nil {
+		if err := store.SaveSession(state); err != nil {
 			log.Printf("Failed to save session: %v", err)
 		}
 	}
 
+	// 定期续租，直到退出
+	go func() {
+		ticker := time.NewTicker(store.LeaseTTL() / 3)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := store.UpdateHeartbeat(session.ID, deviceID); errors.Is(err, terminal.ErrLeaseHeld) {
+				fmt.Printf("\n⚠️  Session %s was taken over by another device, stopping it here: %v\n", session.ID, err)
+				tmuxManager.KillSession(ctx, session.ID)
+				os.Exit(1)
+			}
+		}
+	}()
+
 	fmt.Printf("\n✅ Session ready: %s\n", session.ID)
 	fmt.Println("Commands:")
 	fmt.Println("  Type your message and press Enter to send")
@@ -115,8 +176,7 @@ func main() {
 	outputChan := make(chan string, 100)
 	go func() {
 		err := sessionManager.MonitorSession(ctx, session.ID, func(s *tools.ToolSession, output string) {
-			outputProcessor.ProcessOutput(output)
-			outputChan <- output
+			outputChan <- outputProcessor.ProcessOutput(output)
 			
 			// 检查权限请求
 			if permission := outputProcessor.GetLastPermission(); permission != nil {
@@ -162,7 +222,7 @@ func main() {
 		case "kill":
 			fmt.Println("🔥 Killing session...")
 			sessionManager.StopSession(ctx, session.ID)
-			db.DeleteSession(session.ID)
+			store.DeleteSession(session.ID)
 			return
 			
 		case "status":
@@ -186,8 +246,8 @@ func main() {
 	}
 }
 
-func listSessions(db *database.SQLiteDB) {
-	sessions, err := db.ListSessions("", "")
+func listSessions(store *database.SessionRepository) {
+	sessions, err := store.ListSessions(terminal.SessionFilter{IncludeDead: true})
 	if err != nil {
 		log.Fatal("Failed to list sessions:", err)
 	}
@@ -201,22 +261,12 @@ func listSessions(db *database.SQLiteDB) {
 	fmt.Println("─────────────────────────────────────────────")
 	for _, s := range sessions {
 		fmt.Printf("ID: %s\n", s.ID)
-		fmt.Printf("  Tool: %s | Device: %s\n", s.Tool, s.DeviceName)
-		fmt.Printf("  Status: %s | Last Active: %s\n", s.Status, s.LastActivity.Format("2006-01-02 15:04:05"))
+		fmt.Printf("  Tool: %s | Device: %s\n", s.ToolName, s.OwnerDeviceName)
+		fmt.Printf("  Status: %s | Last Active: %s\n", s.Status, s.UpdatedAt.Format("2006-01-02 15:04:05"))
+		if lease := s.Lease(); lease.DeviceID != "" {
+			fmt.Printf("  Lease: %s by %s (epoch %d)\n", lease.State(time.Now()), lease.DeviceID, lease.Epoch)
+		}
 		fmt.Println("─────────────────────────────────────────────")
 	}
 	fmt.Println("\nTo attach: go run main.go -session <ID>")
 }
-
-func getDeviceID() string {
-	hostname, _ := os.Hostname()
-	return hostname
-}
-
-func getDeviceName() string {
-	hostname, _ := os.Hostname()
-	if hostname != "" {
-		return hostname
-	}
-	return "unknown"
-}
\ No newline at end of file
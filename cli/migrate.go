@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/majiayu000/anywhere-ai/core/database"
+	"github.com/majiayu000/anywhere-ai/core/migrations"
+)
+
+const migrateUsage = `Usage: anywhere migrate [flags] <command>
+
+Commands:
+  status            Show applied and pending migrations
+  up [version]      Apply pending migrations, optionally up to a version
+  down [steps]      Revert the most recent migrations (default 1)
+  force <version>   Mark an existing schema as being at a version without running migrations
+
+Flags:
+`
+
+// runMigrate implements the migrate subcommand
+func runMigrate(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dialect := fs.String("dialect", "sqlite", "Database dialect (sqlite/postgres)")
+	dsn := fs.String("db", database.DefaultSQLitePath(), "Database path (sqlite) or connection string (postgres)")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), migrateUsage)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return
+	}
+
+	db, err := migrations.Open(migrations.Dialect(*dialect), *dsn)
+	if err != nil {
+		log.Fatal("Failed to open database:", err)
+	}
+	defer db.Close()
+
+	runner, err := migrations.NewRunner(db, migrations.Dialect(*dialect))
+	if err != nil {
+		log.Fatal("Failed to load migrations:", err)
+	}
+
+	ctx := context.Background()
+	command := fs.Arg(0)
+	argument := func(defaultValue int) int {
+		if fs.NArg() < 2 {
+			return defaultValue
+		}
+		value, err := strconv.Atoi(fs.Arg(1))
+		if err != nil {
+			log.Fatalf("Invalid number for %s: %s", command, fs.Arg(1))
+		}
+		return value
+	}
+
+	switch command {
+	case "status":
+		if err := runner.Check(ctx); err != nil {
+			fmt.Printf("⚠️  %v\n", err)
+		}
+		status, err := runner.Status(ctx)
+		if err != nil {
+			log.Fatal("Failed to get status:", err)
+		}
+		fmt.Printf("📋 Schema version: %d (latest %d, %s)\n", status.CurrentVersion, status.LatestVersion, status.Dialect)
+		for _, m := range status.Applied {
+			fmt.Printf("  ✅ %04d_%s  applied %s\n", m.Version, m.Name, m.AppliedAt.Format("2006-01-02 15:04:05"))
+		}
+		for _, m := range status.Pending {
+			fmt.Printf("  ⏳ %04d_%s\n", m.Version, m.Name)
+		}
+
+	case "up":
+		applied, err := runner.Up(ctx, argument(0))
+		for _, m := range applied {
+			fmt.Printf("⬆️  Applied %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("Schema is up to date")
+		}
+
+	case "down":
+		reverted, err := runner.Down(ctx, argument(1))
+		for _, m := range reverted {
+			fmt.Printf("⬇️  Reverted %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+
+	case "force":
+		if fs.NArg() < 2 {
+			log.Fatal("force requires a version")
+		}
+		version := argument(0)
+		if err := runner.Force(ctx, version); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("📌 Schema marked as version %d\n", version)
+
+	default:
+		fs.Usage()
+	}
+}
@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrSignupNotAllowed is returned when an OAuth user is not on the allowlist
+var ErrSignupNotAllowed = errors.New("this account is not allowed to sign in to this server")
+
+// Allowlist decides which OAuth accounts may sign in, by email address or by
+// domain. An empty allowlist admits nobody, so a server is invite only until
+// its owner lists who may join.
+type Allowlist struct {
+	emails  map[string]bool
+	domains map[string]bool
+}
+
+// NewAllowlist creates an allowlist of email addresses, e.g. ann@example.com,
+// and domains written with a leading @, e.g. @example.com
+func NewAllowlist(entries []string) *Allowlist {
+	allowlist := &Allowlist{emails: make(map[string]bool), domains: make(map[string]bool)}
+	for _, entry := range entries {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		switch {
+		case strings.HasPrefix(entry, "@") && len(entry) > 1:
+			allowlist.domains[entry[1:]] = true
+		case strings.Contains(entry, "@"):
+			allowlist.emails[entry] = true
+		}
+	}
+	return allowlist
+}
+
+// ParseAllowlist parses a comma separated list of email addresses and
+// domains, as in ANYWHERE_ALLOWED_EMAILS
+func ParseAllowlist(value string) []string {
+	var entries []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// Allowed reports whether an account with a verified email address may sign in
+func (l *Allowlist) Allowed(email string) bool {
+	email = strings.ToLower(strings.TrimSpace(email))
+	at := strings.LastIndex(email, "@")
+	if at <= 0 || at == len(email)-1 {
+		return false
+	}
+	return l.emails[email] || l.domains[email[at+1:]]
+}
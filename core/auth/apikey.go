@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// apiKeyPrefix starts every API key, telling them apart from JWTs
+const apiKeyPrefix = "ak_"
+
+// GenerateAPIKey generates a new API key
+func GenerateAPIKey() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	return apiKeyPrefix + hex.EncodeToString(bytes), nil
+}
+
+// HashAPIKey hashes an API key for storage. Keys are random, so a fast hash
+// cannot be brute forced.
+func HashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+// IsAPIKey reports whether a bearer token is an API key rather than a JWT
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefix)
+}
+
+// APIKeyPrefix returns the start of a key, shown to tell keys apart
+func APIKeyPrefix(key string) string {
+	if len(key) > 11 {
+		return key[:11]
+	}
+	return key
+}
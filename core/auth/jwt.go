@@ -0,0 +1,209 @@
+// Package auth authenticates users of the core API: JWT access and refresh
+// tokens, OAuth login through Google and Apple, and origin checks for browsers.
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	// ErrInvalidToken is returned for a token that is malformed, forged or expired
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+// JWTConfig configures a JWTManager
+type JWTConfig struct {
+	SecretKey         string
+	Issuer            string
+	Expiration        time.Duration
+	RefreshExpiration time.Duration
+}
+
+// DefaultJWTConfig returns the default lifetimes for a secret
+func DefaultJWTConfig(secret string) JWTConfig {
+	return JWTConfig{
+		SecretKey:         secret,
+		Issuer:            "anywhere-core",
+		Expiration:        time.Hour,
+		RefreshExpiration: 30 * 24 * time.Hour,
+	}
+}
+
+// Claims are the claims of an access token
+type Claims struct {
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Role     string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// TokenPair is an access token with the refresh token that renews it
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// JWTManager issues and validates HS256 signed tokens
+type JWTManager struct {
+	config JWTConfig
+}
+
+// NewJWTManager creates a JWT manager
+func NewJWTManager(config JWTConfig) *JWTManager {
+	return &JWTManager{
+		config: config,
+	}
+}
+
+// Config returns the configuration of the manager
+func (j *JWTManager) Config() JWTConfig {
+	return j.config
+}
+
+// GenerateToken issues an access token
+func (j *JWTManager) GenerateToken(userID, username, email, role string) (string, error) {
+	now := time.Now()
+	claims := Claims{
+		UserID:   userID,
+		Username: username,
+		Email:    email,
+		Role:     role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    j.config.Issuer,
+			Subject:   userID,
+			Audience:  jwt.ClaimStrings{"access"},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(j.config.Expiration)),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(j.config.SecretKey))
+}
+
+// GenerateRefreshToken issues a refresh token. It is only accepted by
+// ValidateRefreshToken, never as an access token.
+func (j *JWTManager) GenerateRefreshToken(userID string) (string, error) {
+	now := time.Now()
+	claims := jwt.RegisteredClaims{
+		Subject:   userID,
+		Issuer:    j.config.Issuer,
+		Audience:  jwt.ClaimStrings{"refresh"},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(j.config.RefreshExpiration)),
+		NotBefore: jwt.NewNumericDate(now),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(j.config.SecretKey))
+}
+
+// GenerateTokenPair issues an access token and a refresh token
+func (j *JWTManager) GenerateTokenPair(userID, username, email, role string) (*TokenPair, error) {
+	accessToken, err := j.GenerateToken(userID, username, email, role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign access token: %w", err)
+	}
+
+	refreshToken, err := j.GenerateRefreshToken(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign refresh token: %w", err)
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(j.config.Expiration.Seconds()),
+	}, nil
+}
+
+// ValidateToken validates an access token and returns its claims
+func (j *JWTManager) ValidateToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	if err := j.parse(tokenString, claims, "access"); err != nil {
+		return nil, err
+	}
+	if claims.UserID == "" {
+		return nil, fmt.Errorf("%w: no user", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+// ValidateRefreshToken validates a refresh token and returns the user it was issued to
+func (j *JWTManager) ValidateRefreshToken(tokenString string) (string, error) {
+	claims := &jwt.RegisteredClaims{}
+	if err := j.parse(tokenString, claims, "refresh"); err != nil {
+		return "", err
+	}
+	if claims.Subject == "" {
+		return "", fmt.Errorf("%w: no user", ErrInvalidToken)
+	}
+	return claims.Subject, nil
+}
+
+// parse verifies a token's signature, issuer, lifetime and audience
+func (j *JWTManager) parse(tokenString string, claims jwt.Claims, audience string) error {
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(j.config.SecretKey), nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(j.config.Issuer),
+		jwt.WithAudience(audience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	return nil
+}
+
+// ExtractTokenFromHeader returns the token of a "Bearer" Authorization header
+func ExtractTokenFromHeader(authHeader string) string {
+	if len(authHeader) > 7 && strings.EqualFold(authHeader[:7], "Bearer ") {
+		return strings.TrimSpace(authHeader[7:])
+	}
+	return ""
+}
+
+// LoadOrCreateSecret reads the token signing secret kept at path, generating
+// it on first run
+func LoadOrCreateSecret(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		secret := strings.TrimSpace(string(data))
+		if len(secret) < 32 {
+			return "", fmt.Errorf("secret in %s is too short", path)
+		}
+		return secret, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to read secret: %w", err)
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate secret: %w", err)
+	}
+	secret := hex.EncodeToString(raw)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", fmt.Errorf("failed to create secret directory: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(secret+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("failed to write secret: %w", err)
+	}
+	return secret, nil
+}
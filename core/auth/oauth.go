@@ -0,0 +1,344 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+var (
+	// ErrUnknownProvider is returned for an OAuth provider that is not configured
+	ErrUnknownProvider = errors.New("unknown OAuth provider")
+	// ErrUnverifiedEmail is returned when a provider does not vouch for the user's email
+	ErrUnverifiedEmail = errors.New("email address is not verified")
+)
+
+// UserInfo is the user an OAuth provider signed in
+type UserInfo struct {
+	Subject string // Stable ID of the user at the provider
+	Email   string
+	Name    string
+}
+
+// Provider signs users in through OAuth
+type Provider interface {
+	// Name is the provider's name in login URLs, e.g. google
+	Name() string
+	// AuthURL is where to send the user to sign in
+	AuthURL(state string) string
+	// Exchange trades the code the provider sent back for the signed in user
+	Exchange(ctx context.Context, code string) (*UserInfo, error)
+}
+
+// CallbackPath is the path providers send users back to after they sign in
+func CallbackPath(provider string) string {
+	return "/api/v1/auth/" + provider + "/callback"
+}
+
+// ProvidersFromEnv configures the OAuth providers whose credentials are set.
+// ANYWHERE_PUBLIC_URL is the URL browsers reach this server at, which
+// providers redirect back to. Google takes ANYWHERE_GOOGLE_CLIENT_ID and
+// ANYWHERE_GOOGLE_CLIENT_SECRET; Apple takes ANYWHERE_APPLE_CLIENT_ID (the
+// services ID), ANYWHERE_APPLE_TEAM_ID, ANYWHERE_APPLE_KEY_ID and
+// ANYWHERE_APPLE_PRIVATE_KEY, the path to the .p8 key.
+func ProvidersFromEnv() (map[string]Provider, error) {
+	providers := make(map[string]Provider)
+	publicURL := strings.TrimSuffix(os.Getenv("ANYWHERE_PUBLIC_URL"), "/")
+
+	if clientID := os.Getenv("ANYWHERE_GOOGLE_CLIENT_ID"); clientID != "" {
+		if publicURL == "" {
+			return nil, errors.New("ANYWHERE_PUBLIC_URL is required for Google login")
+		}
+		providers["google"] = NewGoogleProvider(clientID, os.Getenv("ANYWHERE_GOOGLE_CLIENT_SECRET"), publicURL+CallbackPath("google"))
+	}
+
+	if clientID := os.Getenv("ANYWHERE_APPLE_CLIENT_ID"); clientID != "" {
+		if publicURL == "" {
+			return nil, errors.New("ANYWHERE_PUBLIC_URL is required for Apple login")
+		}
+		keyPEM, err := os.ReadFile(os.Getenv("ANYWHERE_APPLE_PRIVATE_KEY"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Apple private key: %w", err)
+		}
+		provider, err := NewAppleProvider(clientID, os.Getenv("ANYWHERE_APPLE_TEAM_ID"), os.Getenv("ANYWHERE_APPLE_KEY_ID"), keyPEM, publicURL+CallbackPath("apple"))
+		if err != nil {
+			return nil, err
+		}
+		providers["apple"] = provider
+	}
+
+	return providers, nil
+}
+
+// GoogleProvider signs users in with their Google account
+type GoogleProvider struct {
+	config *oauth2.Config
+}
+
+// NewGoogleProvider creates a Google provider
+func NewGoogleProvider(clientID, clientSecret, redirectURL string) *GoogleProvider {
+	return &GoogleProvider{
+		config: &oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			RedirectURL:  redirectURL,
+			Scopes:       []string{"openid", "email", "profile"},
+			Endpoint:     google.Endpoint,
+		},
+	}
+}
+
+// Name returns google
+func (p *GoogleProvider) Name() string {
+	return "google"
+}
+
+// AuthURL returns Google's sign in page
+func (p *GoogleProvider) AuthURL(state string) string {
+	return p.config.AuthCodeURL(state)
+}
+
+// Exchange trades a code for the user, read from Google's userinfo endpoint
+func (p *GoogleProvider) Exchange(ctx context.Context, code string) (*UserInfo, error) {
+	token, err := p.config.Exchange(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange Google code: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://openidconnect.googleapis.com/v1/userinfo", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.config.Client(ctx, token).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Google user: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get Google user: %s", resp.Status)
+	}
+
+	var info struct {
+		Sub           string `json:"sub"`
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("failed to decode Google user: %w", err)
+	}
+	if !info.EmailVerified {
+		return nil, ErrUnverifiedEmail
+	}
+	return &UserInfo{Subject: info.Sub, Email: info.Email, Name: info.Name}, nil
+}
+
+const (
+	appleIssuer  = "https://appleid.apple.com"
+	appleKeysURL = "https://appleid.apple.com/auth/keys"
+)
+
+// AppleProvider signs users in with Sign in with Apple. Apple posts the code
+// back as a form, and identifies the user by the ID token of the exchange.
+type AppleProvider struct {
+	config     *oauth2.Config
+	teamID     string
+	keyID      string
+	privateKey *ecdsa.PrivateKey
+
+	keys        map[string]*rsa.PublicKey // Apple's ID token keys, by key ID
+	keysFetched time.Time
+	mu          sync.Mutex
+}
+
+// NewAppleProvider creates an Apple provider from the PEM encoded .p8 key that
+// signs its client secrets
+func NewAppleProvider(clientID, teamID, keyID string, keyPEM []byte, redirectURL string) (*AppleProvider, error) {
+	if teamID == "" || keyID == "" {
+		return nil, errors.New("Apple team ID and key ID are required")
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("Apple private key is not PEM encoded")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Apple private key: %w", err)
+	}
+	privateKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("Apple private key is not an ECDSA key")
+	}
+
+	return &AppleProvider{
+		config: &oauth2.Config{
+			ClientID:    clientID,
+			RedirectURL: redirectURL,
+			Scopes:      []string{"name", "email"},
+			Endpoint: oauth2.Endpoint{
+				AuthURL:   appleIssuer + "/auth/authorize",
+				TokenURL:  appleIssuer + "/auth/token",
+				AuthStyle: oauth2.AuthStyleInParams,
+			},
+		},
+		teamID:     teamID,
+		keyID:      keyID,
+		privateKey: privateKey,
+	}, nil
+}
+
+// Name returns apple
+func (p *AppleProvider) Name() string {
+	return "apple"
+}
+
+// AuthURL returns Apple's sign in page
+func (p *AppleProvider) AuthURL(state string) string {
+	return p.config.AuthCodeURL(state, oauth2.SetAuthURLParam("response_mode", "form_post"))
+}
+
+// Exchange trades a code for the user named in the verified ID token
+func (p *AppleProvider) Exchange(ctx context.Context, code string) (*UserInfo, error) {
+	secret, err := p.clientSecret()
+	if err != nil {
+		return nil, err
+	}
+	token, err := p.config.Exchange(ctx, code, oauth2.SetAuthURLParam("client_secret", secret))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange Apple code: %w", err)
+	}
+	idToken, _ := token.Extra("id_token").(string)
+	if idToken == "" {
+		return nil, errors.New("Apple returned no ID token")
+	}
+
+	var claims struct {
+		Email         string      `json:"email"`
+		EmailVerified interface{} `json:"email_verified"` // true, or "true"
+		jwt.RegisteredClaims
+	}
+	_, err = jwt.ParseWithClaims(idToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.publicKey(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithIssuer(appleIssuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify Apple ID token: %w", err)
+	}
+	if verified := fmt.Sprint(claims.EmailVerified); verified != "true" {
+		return nil, ErrUnverifiedEmail
+	}
+	return &UserInfo{Subject: claims.Subject, Email: claims.Email}, nil
+}
+
+// clientSecret signs the short-lived client secret Apple asks for
+func (p *AppleProvider) clientSecret() (string, error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.RegisteredClaims{
+		Issuer:    p.teamID,
+		Subject:   p.config.ClientID,
+		Audience:  jwt.ClaimStrings{appleIssuer},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(5 * time.Minute)),
+	})
+	token.Header["kid"] = p.keyID
+	secret, err := token.SignedString(p.privateKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign Apple client secret: %w", err)
+	}
+	return secret, nil
+}
+
+// publicKey returns the key Apple signed an ID token with, fetching Apple's
+// keys again when it does not know the key ID
+func (p *AppleProvider) publicKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	// Apple rotates its keys rarely; do not let unknown key IDs hammer it
+	if time.Since(p.keysFetched) < time.Minute {
+		return nil, fmt.Errorf("unknown Apple key %q", kid)
+	}
+
+	keys, err := fetchAppleKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	p.keysFetched = time.Now()
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown Apple key %q", kid)
+}
+
+// fetchAppleKeys downloads the keys Apple signs ID tokens with
+func fetchAppleKeys(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, appleKeysURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch Apple keys: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch Apple keys: %s", resp.Status)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("failed to decode Apple keys: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	return keys, nil
+}
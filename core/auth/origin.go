@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OriginPolicy decides which browser origins may call the API. Requests from
+// the server's own origin, and requests without an Origin header (native apps,
+// the CLI, paired devices), are always allowed.
+type OriginPolicy struct {
+	allowed map[string]bool
+}
+
+// NewOriginPolicy creates a policy allowing the given origins besides the
+// server's own, e.g. https://app.example.com
+func NewOriginPolicy(origins []string) *OriginPolicy {
+	allowed := make(map[string]bool)
+	for _, origin := range origins {
+		if origin = normalizeOrigin(origin); origin != "" {
+			allowed[origin] = true
+		}
+	}
+	return &OriginPolicy{allowed: allowed}
+}
+
+// ParseOrigins parses a comma separated list of origins, as in ANYWHERE_ALLOWED_ORIGINS
+func ParseOrigins(value string) []string {
+	var origins []string
+	for _, origin := range strings.Split(value, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// Allowed reports whether a request may be served given its Origin header
+func (p *OriginPolicy) Allowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	normalized := normalizeOrigin(origin)
+	if normalized == "" {
+		return false
+	}
+	if p.allowed[normalized] {
+		return true
+	}
+	// Same origin: the page was served by this server
+	u, _ := url.Parse(normalized)
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// Listed reports whether an origin was allowed explicitly, so cross-origin
+// responses may be shared with it
+func (p *OriginPolicy) Listed(origin string) bool {
+	return p.allowed[normalizeOrigin(origin)]
+}
+
+// Middleware refuses requests from origins that are not allowed, and answers
+// CORS preflights. Responses are only shared with listed origins, with
+// credentials, never with any origin.
+func (p *OriginPolicy) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !p.Allowed(c.Request) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Origin not allowed"})
+			return
+		}
+
+		c.Header("Vary", "Origin")
+		if origin := c.GetHeader("Origin"); origin != "" && p.Listed(origin) {
+			c.Header("Access-Control-Allow-Origin", origin)
+			c.Header("Access-Control-Allow-Credentials", "true")
+			c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Device-ID, X-Device-Name, X-Device-Type, X-Share-Token")
+		}
+
+		if c.Request.Method == http.MethodOptions {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// normalizeOrigin reduces an origin to lower case scheme://host[:port], or ""
+// when it is not one
+func normalizeOrigin(origin string) string {
+	u, err := url.Parse(strings.TrimSpace(origin))
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host)
+}
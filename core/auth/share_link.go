@@ -0,0 +1,20 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+)
+
+// shareTokenPrefix starts every share link token
+const shareTokenPrefix = "sl_"
+
+// GenerateShareToken generates the token of a share link. Like API keys,
+// tokens are stored hashed with HashAPIKey.
+func GenerateShareToken() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate share token: %w", err)
+	}
+	return shareTokenPrefix + hex.EncodeToString(bytes), nil
+}
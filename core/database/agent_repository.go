@@ -0,0 +1,131 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrAgentInstanceNotFound is returned for an agent instance that does not exist
+	ErrAgentInstanceNotFound = errors.New("agent instance not found")
+	// ErrAgentInstanceEnded is returned when messaging an agent instance that ended
+	ErrAgentInstanceEnded = errors.New("agent instance has ended")
+	// ErrAgentInstanceConflict is returned when starting an agent instance with
+	// the ID of a terminal session
+	ErrAgentInstanceConflict = errors.New("ID is already used by a session")
+)
+
+// AgentRepository stores the agent instances scripts and agents report
+// through the SDK. Their messages are terminal messages keyed by instance ID.
+type AgentRepository struct {
+	db *gorm.DB
+}
+
+// NewAgentRepository creates an agent repository on a migrated database
+func NewAgentRepository(db *gorm.DB) *AgentRepository {
+	return &AgentRepository{db: db}
+}
+
+// StartAgentInstance creates an active agent instance of a user, under the
+// agent named agentType, which is created on first use
+func (r *AgentRepository) StartAgentInstance(id uuid.UUID, userID uuid.UUID, agentType string) (*AgentInstance, error) {
+	// Instance IDs key messages like session IDs do, so they must not be one
+	var used int64
+	if err := r.db.Model(&TerminalSession{}).Where("id = ?", id.String()).Count(&used).Error; err != nil {
+		return nil, fmt.Errorf("failed to check session IDs: %w", err)
+	}
+	if used == 0 {
+		if err := r.db.Model(&TerminalMessage{}).Where("session_id = ?", id.String()).Count(&used).Error; err != nil {
+			return nil, fmt.Errorf("failed to check session IDs: %w", err)
+		}
+	}
+	if used > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrAgentInstanceConflict, id)
+	}
+
+	instance := &AgentInstance{
+		ID:        id,
+		UserID:    userID,
+		Status:    AgentStatusActive,
+		StartedAt: time.Now(),
+	}
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var agent UserAgent
+		err := tx.Where("user_id = ? AND name = ? AND is_deleted = ?", userID, agentType, false).First(&agent).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			agent = UserAgent{UserID: userID, Name: agentType, IsActive: true}
+			err = tx.Create(&agent).Error
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get agent %s: %w", agentType, err)
+		}
+
+		instance.UserAgentID = agent.ID
+		if err := tx.Create(instance).Error; err != nil {
+			return fmt.Errorf("failed to create agent instance: %w", err)
+		}
+		instance.UserAgent = agent
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return instance, nil
+}
+
+// GetAgentInstance returns an agent instance
+func (r *AgentRepository) GetAgentInstance(id uuid.UUID) (*AgentInstance, error) {
+	var instance AgentInstance
+	if err := r.db.Preload("UserAgent").First(&instance, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrAgentInstanceNotFound, id)
+		}
+		return nil, fmt.Errorf("failed to load agent instance: %w", err)
+	}
+	return &instance, nil
+}
+
+// ListAgentInstances returns the agent instances of a user, newest first
+func (r *AgentRepository) ListAgentInstances(userID uuid.UUID) ([]AgentInstance, error) {
+	var instances []AgentInstance
+	if err := r.db.Preload("UserAgent").Where("user_id = ?", userID).Order("started_at DESC").Find(&instances).Error; err != nil {
+		return nil, fmt.Errorf("failed to list agent instances: %w", err)
+	}
+	return instances, nil
+}
+
+// UpdateAgentInstance sets the status of an agent instance, and its working
+// tree changes when gitDiff is not empty
+func (r *AgentRepository) UpdateAgentInstance(id uuid.UUID, status string, gitDiff string) error {
+	updates := map[string]interface{}{"status": status}
+	if gitDiff != "" {
+		updates["git_diff"] = gitDiff
+	}
+	if err := r.db.Model(&AgentInstance{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to update agent instance %s: %w", id, err)
+	}
+	return nil
+}
+
+// EndAgentInstance marks an agent instance completed; ending it again changes nothing
+func (r *AgentRepository) EndAgentInstance(id uuid.UUID) (*AgentInstance, error) {
+	instance, err := r.GetAgentInstance(id)
+	if err != nil {
+		return nil, err
+	}
+	if instance.EndedAt != nil {
+		return instance, nil
+	}
+
+	now := time.Now()
+	if err := r.db.Model(instance).Updates(map[string]interface{}{"status": AgentStatusCompleted, "ended_at": now}).Error; err != nil {
+		return nil, fmt.Errorf("failed to end agent instance %s: %w", id, err)
+	}
+	instance.Status = AgentStatusCompleted
+	instance.EndedAt = &now
+	return instance, nil
+}
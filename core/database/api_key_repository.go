@@ -0,0 +1,94 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrAPIKeyNotFound is returned for an API key that does not exist
+	ErrAPIKeyNotFound = errors.New("API key not found")
+	// ErrAPIKeyRevoked is returned for an API key that was revoked
+	ErrAPIKeyRevoked = errors.New("API key revoked")
+	// ErrAPIKeyExpired is returned for an API key past its expiry
+	ErrAPIKeyExpired = errors.New("API key expired")
+)
+
+// APIKeyRepository stores the API keys users issue to the SDK and automation
+type APIKeyRepository struct {
+	db *gorm.DB
+}
+
+// NewAPIKeyRepository creates an API key repository on a migrated database
+func NewAPIKeyRepository(db *gorm.DB) *APIKeyRepository {
+	return &APIKeyRepository{db: db}
+}
+
+// CreateAPIKey stores a new API key
+func (r *APIKeyRepository) CreateAPIKey(key *APIKey) error {
+	if err := r.db.Create(key).Error; err != nil {
+		return fmt.Errorf("failed to create API key: %w", err)
+	}
+	return nil
+}
+
+// ListAPIKeys returns the API keys of a user, newest first
+func (r *APIKeyRepository) ListAPIKeys(userID uuid.UUID) ([]APIKey, error) {
+	var keys []APIKey
+	if err := r.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey revokes an API key of a user; it stops working at once
+func (r *APIKeyRepository) RevokeAPIKey(userID uuid.UUID, keyID uuid.UUID) (*APIKey, error) {
+	var key APIKey
+	if err := r.db.First(&key, "id = ? AND user_id = ?", keyID, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrAPIKeyNotFound, keyID)
+		}
+		return nil, fmt.Errorf("failed to load API key: %w", err)
+	}
+	if key.RevokedAt != nil {
+		return &key, nil
+	}
+
+	now := time.Now()
+	if err := r.db.Model(&key).Updates(map[string]interface{}{"is_active": false, "revoked_at": now}).Error; err != nil {
+		return nil, fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	key.IsActive = false
+	key.RevokedAt = &now
+	return &key, nil
+}
+
+// FindAPIKey returns the usable API key with a hash
+func (r *APIKeyRepository) FindAPIKey(hash string) (*APIKey, error) {
+	var key APIKey
+	if err := r.db.First(&key, "api_key_hash = ?", hash).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, fmt.Errorf("failed to load API key: %w", err)
+	}
+	if key.RevokedAt != nil || !key.IsActive {
+		return nil, fmt.Errorf("%w: %s", ErrAPIKeyRevoked, key.ID)
+	}
+	if key.ExpiresAt != nil && !time.Now().Before(*key.ExpiresAt) {
+		return nil, fmt.Errorf("%w: %s", ErrAPIKeyExpired, key.ID)
+	}
+	return &key, nil
+}
+
+// TouchAPIKey records that an API key was used
+func (r *APIKeyRepository) TouchAPIKey(keyID uuid.UUID, usedAt time.Time) error {
+	if err := r.db.Model(&APIKey{}).Where("id = ?", keyID).Update("last_used_at", usedAt).Error; err != nil {
+		return fmt.Errorf("failed to record API key use: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Attachment represents a file uploaded for a session and stored in the local blob store
+type Attachment struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	SessionID   string     `gorm:"not null;index" json:"session_id"`
+	MessageID   *uuid.UUID `gorm:"type:uuid;index" json:"message_id,omitempty"` // Set once sent with a message
+	FileName    string     `gorm:"not null" json:"file_name"`
+	ContentType string     `gorm:"not null" json:"content_type"`
+	Size        int64      `json:"size"`
+	SHA256      string     `gorm:"type:varchar(64)" json:"sha256"`
+	StoragePath string     `gorm:"not null" json:"-"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// AttachmentRef is the reference to an attachment kept in TerminalMessage metadata
+type AttachmentRef struct {
+	ID          uuid.UUID `json:"id"`
+	FileName    string    `json:"file_name"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+}
+
+// MessageMetadata is the structure stored as JSON in TerminalMessage.Metadata
+type MessageMetadata struct {
+	Attachments []AttachmentRef `json:"attachments,omitempty"`
+}
+
+// TableName sets the table name for Attachment
+func (Attachment) TableName() string {
+	return "attachments"
+}
+
+// BeforeCreate hook for Attachment
+func (a *Attachment) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = time.Now()
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Identity providers users sign in with besides OAuth ones
+const (
+	IdentityProviderLocal = "local" // The password of the server's owner
+)
+
+// UserIdentity links a user to an account they sign in with, identified by a
+// stable subject at its provider
+type UserIdentity struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	UserID      uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	Provider    string     `gorm:"type:varchar(20);not null" json:"provider"`
+	Subject     string     `gorm:"not null" json:"-"`
+	Email       string     `json:"email"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// TableName sets the table name for UserIdentity
+func (UserIdentity) TableName() string {
+	return "user_identities"
+}
+
+// BeforeCreate hook for UserIdentity
+func (i *UserIdentity) BeforeCreate(tx *gorm.DB) error {
+	if i.ID == uuid.Nil {
+		i.ID = uuid.New()
+	}
+	return nil
+}
+
+// Scopes an API key may grant
+const (
+	ScopeReadSessions       = "sessions:read"       // List sessions and read their output and messages
+	ScopeSendInput          = "sessions:input"      // Send messages and input to sessions
+	ScopeApprovePermissions = "permissions:approve" // Answer permission prompts
+	ScopeAdmin              = "admin"               // Everything, including managing sessions, devices and keys
+)
+
+// APIKeyScopes are the scopes an API key may grant
+var APIKeyScopes = []string{ScopeReadSessions, ScopeSendInput, ScopeApprovePermissions, ScopeAdmin}
+
+// HasScope reports whether the key grants a scope; admin grants all
+func (ak *APIKey) HasScope(scope string) bool {
+	for _, granted := range ak.Scopes {
+		if granted == scope || granted == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsSession reports whether the key may reach a session
+func (ak *APIKey) AllowsSession(sessionID string) bool {
+	if len(ak.SessionIDs) == 0 {
+		return true
+	}
+	for _, allowed := range ak.SessionIDs {
+		if allowed == sessionID {
+			return true
+		}
+	}
+	return false
+}
@@ -1,10 +1,12 @@
 package database
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
 
+	"github.com/majiayu000/anywhere-ai/core/migrations"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -53,25 +55,18 @@ func InitDatabase() error {
 	return nil
 }
 
-// AutoMigrate runs auto migration for all models
-func AutoMigrate() error {
+// Migrate applies pending schema migrations to the database
+func Migrate() error {
 	if DB == nil {
 		return fmt.Errorf("database not initialized")
 	}
 
-	err := DB.AutoMigrate(
-		&User{},
-		&UserAgent{},
-		&AgentInstance{},
-		&Message{},
-		&APIKey{},
-		&PushToken{},
-		&TerminalSession{},
-		&SessionCheckpoint{},
-		&SessionLog{},
-	)
-
+	sqlDB, err := DB.DB()
 	if err != nil {
+		return fmt.Errorf("failed to get database instance: %w", err)
+	}
+
+	if err := migrations.Migrate(context.Background(), sqlDB, migrations.Postgres); err != nil {
 		return fmt.Errorf("failed to migrate database: %w", err)
 	}
 
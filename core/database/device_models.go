@@ -0,0 +1,59 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Device is a device paired with this one through an invite. Its certificate
+// fingerprint is pinned at pairing. The shared secret is encrypted at rest and
+// never serialized. A revoked device is kept so its certificate stays refused.
+// UserID is the user of this server the device acts for; a device bound to
+// nobody may not reach any session.
+type Device struct {
+	ID              string     `gorm:"primaryKey" json:"id"`
+	Name            string     `json:"name"`
+	Type            string     `gorm:"type:varchar(20)" json:"type"`
+	URL             string     `gorm:"not null" json:"url"`
+	Secret          string     `gorm:"type:text;serializer:encrypted" json:"-"`
+	CertFingerprint string     `gorm:"type:varchar(64);index" json:"cert_fingerprint"`
+	UserID          *uuid.UUID `gorm:"type:uuid" json:"user_id,omitempty"`
+	PairedAt        time.Time  `json:"paired_at"`
+	LastSeenAt      *time.Time `json:"last_seen_at,omitempty"`
+	RevokedAt       *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// TableName sets the table name for Device
+func (Device) TableName() string {
+	return "devices"
+}
+
+// DeviceInvite is a one-time pairing invite issued by this device. Only a hash
+// of the token is stored. The device that redeems it acts for the user who
+// created it.
+type DeviceInvite struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	TokenHash      string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	ExpiresAt      time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt         *time.Time `json:"used_at,omitempty"`
+	UsedByDeviceID string     `json:"used_by_device_id,omitempty"`
+	CreatedBy      *uuid.UUID `gorm:"type:uuid" json:"created_by,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// TableName sets the table name for DeviceInvite
+func (DeviceInvite) TableName() string {
+	return "device_invites"
+}
+
+// BeforeCreate hook for DeviceInvite
+func (i *DeviceInvite) BeforeCreate(tx *gorm.DB) error {
+	if i.ID == uuid.Nil {
+		i.ID = uuid.New()
+	}
+	return nil
+}
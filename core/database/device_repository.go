@@ -0,0 +1,160 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/majiayu000/anywhere-ai/core/terminal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrDeviceNotFound is returned when a device is not paired
+	ErrDeviceNotFound = errors.New("device not found")
+	// ErrDeviceRevoked is returned for a device, or a certificate, that was revoked
+	ErrDeviceRevoked = errors.New("device revoked")
+)
+
+// DeviceRepository stores paired devices. It implements terminal.DeviceStore.
+type DeviceRepository struct {
+	db *gorm.DB
+}
+
+var _ terminal.DeviceStore = (*DeviceRepository)(nil)
+
+// NewDeviceRepository creates a device repository on a migrated database
+func NewDeviceRepository(db *gorm.DB) *DeviceRepository {
+	return &DeviceRepository{db: db}
+}
+
+// SaveDevice inserts a paired device or replaces an earlier pairing with it. A
+// revoked device, or its certificate, cannot be paired again until the revoked
+// device is deleted.
+func (r *DeviceRepository) SaveDevice(device *Device) error {
+	if device.CertFingerprint != "" && r.FingerprintRevoked(device.CertFingerprint) {
+		return fmt.Errorf("%w: certificate %s", ErrDeviceRevoked, device.CertFingerprint)
+	}
+	var revoked int64
+	r.db.Model(&Device{}).Where("id = ? AND revoked_at IS NOT NULL", device.ID).Count(&revoked)
+	if revoked > 0 {
+		return fmt.Errorf("%w: %s", ErrDeviceRevoked, device.ID)
+	}
+
+	err := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "type", "url", "secret", "cert_fingerprint", "user_id", "paired_at", "revoked_at", "updated_at"}),
+	}).Create(device).Error
+	if err != nil {
+		return fmt.Errorf("failed to save device: %w", err)
+	}
+	return nil
+}
+
+// GetDevice loads a paired device
+func (r *DeviceRepository) GetDevice(deviceID string) (*Device, error) {
+	var device Device
+	if err := r.db.First(&device, "id = ?", deviceID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrDeviceNotFound, deviceID)
+		}
+		return nil, fmt.Errorf("failed to load device: %w", err)
+	}
+	return &device, nil
+}
+
+// GetDeviceByFingerprint loads the device a client certificate is pinned to
+func (r *DeviceRepository) GetDeviceByFingerprint(fingerprint string) (*Device, error) {
+	if fingerprint == "" {
+		return nil, ErrDeviceNotFound
+	}
+
+	var device Device
+	if err := r.db.First(&device, "cert_fingerprint = ?", fingerprint).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: certificate %s", ErrDeviceNotFound, fingerprint)
+		}
+		return nil, fmt.Errorf("failed to load device: %w", err)
+	}
+	if device.RevokedAt != nil {
+		return nil, fmt.Errorf("%w: %s", ErrDeviceRevoked, device.ID)
+	}
+	return &device, nil
+}
+
+// FingerprintRevoked reports whether a certificate belongs to a revoked device
+func (r *DeviceRepository) FingerprintRevoked(fingerprint string) bool {
+	var count int64
+	r.db.Model(&Device{}).Where("cert_fingerprint = ? AND revoked_at IS NOT NULL", fingerprint).Count(&count)
+	return count > 0
+}
+
+// RevokeDevice stops trusting a device, for example a lost one. Its shared
+// secret is dropped and its certificate is refused until the device is deleted.
+func (r *DeviceRepository) RevokeDevice(deviceID string) (*Device, error) {
+	now := time.Now()
+	result := r.db.Model(&Device{}).Where("id = ?", deviceID).Updates(map[string]interface{}{
+		"revoked_at": now,
+		"secret":     "",
+		"updated_at": now,
+	})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to revoke device: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrDeviceNotFound, deviceID)
+	}
+	return r.GetDevice(deviceID)
+}
+
+// AllDevices lists paired devices by name
+func (r *DeviceRepository) AllDevices() ([]Device, error) {
+	var devices []Device
+	if err := r.db.Order("name").Find(&devices).Error; err != nil {
+		return nil, fmt.Errorf("failed to list devices: %w", err)
+	}
+	return devices, nil
+}
+
+// DeleteDevice forgets a paired device, or a revoked one so it can be paired again
+func (r *DeviceRepository) DeleteDevice(deviceID string) error {
+	result := r.db.Delete(&Device{}, "id = ?", deviceID)
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete device: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: %s", ErrDeviceNotFound, deviceID)
+	}
+	return nil
+}
+
+// ListDevices lists the devices that are paired and not revoked, for discovery
+func (r *DeviceRepository) ListDevices() ([]*terminal.PairedDevice, error) {
+	var devices []Device
+	if err := r.db.Where("revoked_at IS NULL").Order("name").Find(&devices).Error; err != nil {
+		return nil, fmt.Errorf("failed to list devices: %w", err)
+	}
+
+	paired := make([]*terminal.PairedDevice, 0, len(devices))
+	for _, device := range devices {
+		paired = append(paired, &terminal.PairedDevice{
+			ID:              device.ID,
+			Name:            device.Name,
+			Type:            device.Type,
+			URL:             device.URL,
+			Secret:          device.Secret,
+			CertFingerprint: device.CertFingerprint,
+		})
+	}
+	return paired, nil
+}
+
+// MarkDeviceSeen records that a paired device answered a probe
+func (r *DeviceRepository) MarkDeviceSeen(deviceID string, seen time.Time) error {
+	err := r.db.Model(&Device{}).Where("id = ?", deviceID).Update("last_seen_at", seen).Error
+	if err != nil {
+		return fmt.Errorf("failed to update device: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SessionGitState records the repository a session works in and where it started
+type SessionGitState struct {
+	SessionID       string    `gorm:"primary_key" json:"session_id"`
+	RepoDir         string    `gorm:"not null" json:"repo_dir"`
+	InitialGitHash  string    `gorm:"type:varchar(40)" json:"initial_git_hash"`  // HEAD when the session started
+	InitialTreeHash string    `gorm:"type:varchar(40)" json:"initial_tree_hash"` // Working tree when the session started
+	LastGitHash     string    `gorm:"type:varchar(40)" json:"last_git_hash"`     // HEAD at the last captured turn
+	LastTreeHash    string    `gorm:"type:varchar(40)" json:"last_tree_hash"`    // Working tree at the last captured turn
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// GitTurnSnapshot captures the repository changes made during one agent turn
+type GitTurnSnapshot struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	SessionID      string     `gorm:"not null;index:idx_git_turn_snapshots_session_created" json:"session_id"`
+	MessageID      *uuid.UUID `gorm:"type:uuid" json:"message_id,omitempty"`
+	GitHash        string     `gorm:"type:varchar(40)" json:"git_hash"`
+	TreeHash       string     `gorm:"type:varchar(40)" json:"tree_hash"`
+	TurnDiff       string     `gorm:"type:text;serializer:encrypted" json:"turn_diff"`       // Changes since the previous turn
+	CumulativeDiff string     `gorm:"type:text;serializer:encrypted" json:"cumulative_diff"` // Changes since the session started
+	NewCommits     string     `gorm:"type:text;serializer:encrypted" json:"new_commits"`     // JSON array of commits made during the turn
+	CreatedAt      time.Time  `gorm:"index:idx_git_turn_snapshots_session_created" json:"created_at"`
+
+	// Set when secrets were masked in the diffs; the originals are only kept
+	// when redaction is configured to retain them
+	Redacted                 bool   `gorm:"default:false" json:"redacted,omitempty"`
+	UnredactedTurnDiff       string `gorm:"type:text;serializer:encrypted" json:"-"`
+	UnredactedCumulativeDiff string `gorm:"type:text;serializer:encrypted" json:"-"`
+}
+
+// TableName sets the table name for SessionGitState
+func (SessionGitState) TableName() string {
+	return "session_git_states"
+}
+
+// TableName sets the table name for GitTurnSnapshot
+func (GitTurnSnapshot) TableName() string {
+	return "git_turn_snapshots"
+}
+
+// BeforeCreate hook for GitTurnSnapshot
+func (s *GitTurnSnapshot) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	if s.CreatedAt.IsZero() {
+		s.CreatedAt = time.Now()
+	}
+	return nil
+}
@@ -1,67 +1,113 @@
 package database
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/majiayu000/anywhere-ai/core/migrations"
+	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
-// InitGormDB initializes GORM with SQLite
+// DataDir is the directory holding the database and other local state. The CLI
+// and the server default to the same directory so they share one session store;
+// ANYWHERE_DATA_DIR overrides it.
+var DataDir = defaultDataDir()
+
+// defaultDataDir returns ANYWHERE_DATA_DIR, ~/.anywhere or ./data
+func defaultDataDir() string {
+	if dir := os.Getenv("ANYWHERE_DATA_DIR"); dir != "" {
+		return dir
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".anywhere")
+	}
+	return "./data"
+}
+
+// DefaultSQLitePath returns the SQLite database inside DataDir
+func DefaultSQLitePath() string {
+	return filepath.Join(DataDir, "anywhere.db")
+}
+
+// StoreDSN returns the dialect and DSN of the shared store. DATABASE_URL selects
+// PostgreSQL; otherwise the SQLite database at sqlitePath is used.
+func StoreDSN(sqlitePath string) (migrations.Dialect, string) {
+	if url := os.Getenv("DATABASE_URL"); url != "" {
+		return migrations.Postgres, url
+	}
+	return migrations.SQLite, sqlitePath
+}
+
+// InitGormDB initializes GORM with the shared store selected by StoreDSN
 func InitGormDB() (*gorm.DB, error) {
 	// Create data directory if it doesn't exist
-	dataDir := "./data"
-	if err := os.MkdirAll(dataDir, 0755); err != nil {
+	if err := os.MkdirAll(DataDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create data directory: %w", err)
 	}
 
-	dbPath := filepath.Join(dataDir, "anywhere.db")
-	
+	return OpenGormDB(StoreDSN(DefaultSQLitePath()))
+}
+
+// OpenGormDB opens a SQLite or PostgreSQL database and applies pending migrations
+func OpenGormDB(dialect migrations.Dialect, dsn string) (*gorm.DB, error) {
 	// Configure GORM
 	config := &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Silent),
 	}
-	
+
 	// Enable logging in development
 	if os.Getenv("DEBUG") == "true" {
 		config.Logger = logger.Default.LogMode(logger.Info)
 	}
 
+	if err := configureEncryption(); err != nil {
+		return nil, err
+	}
+
+	var dialector gorm.Dialector
+	switch dialect {
+	case migrations.SQLite:
+		if err := os.MkdirAll(filepath.Dir(dsn), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create database directory: %w", err)
+		}
+		// The CLI and the server may write to the same file concurrently
+		if !strings.Contains(dsn, "?") {
+			dsn += "?_busy_timeout=5000&_journal_mode=WAL"
+		}
+		dialector = sqlite.Open(dsn)
+	case migrations.Postgres:
+		dialector = postgres.Open(dsn)
+	default:
+		return nil, fmt.Errorf("unsupported dialect %q", dialect)
+	}
+
 	// Open database connection
-	db, err := gorm.Open(sqlite.Open(dbPath), config)
+	db, err := gorm.Open(dialector, config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
 
-	// Auto migrate schemas
-	if err := migrateSchemas(db); err != nil {
-		return nil, fmt.Errorf("failed to migrate schemas: %w", err)
+	// Apply pending migrations; refuses schemas it does not know
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database instance: %w", err)
 	}
-
-	log.Printf("✅ Database initialized at %s", dbPath)
-	return db, nil
-}
-
-// migrateSchemas runs auto-migration for all models
-func migrateSchemas(db *gorm.DB) error {
-	models := []interface{}{
-		&User{},
-		&AgentInstance{},
-		&TerminalSession{},
-		&Message{},              // Original Message model from Omnara
-		&TerminalMessage{},      // Terminal-specific message model
-		&MessageSession{},
+	if err := migrations.Migrate(context.Background(), sqlDB, dialect); err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("failed to migrate %s database: %w", dialect, err)
 	}
 
-	for _, model := range models {
-		if err := db.AutoMigrate(model); err != nil {
-			return fmt.Errorf("failed to migrate %T: %w", model, err)
-		}
+	if dialect == migrations.SQLite {
+		log.Printf("✅ Database initialized at %s", strings.SplitN(dsn, "?", 2)[0])
+	} else {
+		log.Printf("✅ Database initialized (%s)", dialect)
 	}
-
-	return nil
-}
\ No newline at end of file
+	return db, nil
+}
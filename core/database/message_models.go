@@ -15,27 +15,50 @@ const (
 	SenderTypeUser  SenderType = "USER"
 )
 
+// DeliveryStatus represents how far a user message has travelled towards the tool
+type DeliveryStatus string
+
+const (
+	DeliveryStatusQueued       DeliveryStatus = "queued"       // Waiting for the tool to accept input
+	DeliveryStatusSent         DeliveryStatus = "sent"         // Typed into the tmux pane
+	DeliveryStatusAcknowledged DeliveryStatus = "acknowledged" // Tool started working on it
+	DeliveryStatusFailed       DeliveryStatus = "failed"       // Could not be delivered
+)
+
 // TerminalMessage represents a message in terminal conversation
 // This extends the base Message model with terminal-specific fields
 type TerminalMessage struct {
 	ID                uuid.UUID      `gorm:"type:uuid;primary_key" json:"id"`
 	SessionID         string         `gorm:"not null;index:idx_terminal_messages_session_created" json:"session_id"`
 	SenderType        SenderType     `gorm:"type:varchar(10);not null" json:"sender_type"`
-	Content           string         `gorm:"type:text;not null" json:"content"`
+	Content           string         `gorm:"type:text;not null;serializer:encrypted" json:"content"`
 	RequiresUserInput bool           `gorm:"default:false" json:"requires_user_input"`
 	Metadata          string         `gorm:"type:text" json:"metadata,omitempty"` // Store as JSON string for SQLite
 	CreatedAt         time.Time      `gorm:"default:current_timestamp" json:"created_at"`
 	
+	// Working tree changes made during the turn that produced this message
+	GitDiff           string         `gorm:"type:text;serializer:encrypted" json:"git_diff,omitempty"`
+	
+	// Set when secrets were masked in Content or GitDiff; the originals are only
+	// kept when redaction is configured to retain them
+	Redacted          bool           `gorm:"default:false" json:"redacted,omitempty"`
+	UnredactedContent string         `gorm:"type:text;serializer:encrypted" json:"-"`
+	UnredactedGitDiff string         `gorm:"type:text;serializer:encrypted" json:"-"`
+	
+	// Delivery tracking for queued user messages (empty for agent messages)
+	DeliveryStatus    DeliveryStatus `gorm:"type:varchar(20);index" json:"delivery_status,omitempty"`
+	DeliveredAt       *time.Time     `json:"delivered_at,omitempty"`
+	
 	// Foreign key to TerminalSession
 	Session           *TerminalSession `gorm:"foreignKey:SessionID;references:ID" json:"-"`
 }
 
-// MessageSession tracks the reading progress for a session
+// MessageSession tracks the agent's reading progress for a session.
+// Human read state is kept per reader in ReadCursor.
 type MessageSession struct {
 	ID                 uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
 	SessionID          string     `gorm:"unique;not null" json:"session_id"`
 	LastReadMessageID  *uuid.UUID `gorm:"type:uuid" json:"last_read_message_id,omitempty"`
-	UnreadCount        int        `gorm:"default:0" json:"unread_count"`
 	UpdatedAt          time.Time  `gorm:"default:current_timestamp" json:"updated_at"`
 	
 	// Foreign keys
@@ -82,7 +105,8 @@ func (ms *MessageSession) BeforeCreate(tx *gorm.DB) error {
 type MessageStatus struct {
 	SessionID         string     `json:"session_id"`
 	TotalMessages     int64      `json:"total_messages"`
-	UnreadMessages    int        `json:"unread_messages"`
+	UnreadMessages    int64      `json:"unread_messages"`
 	LastMessageTime   *time.Time `json:"last_message_time,omitempty"`
 	RequiresUserInput bool       `json:"requires_user_input"`
+	QueuedMessages    int64      `json:"queued_messages"`
 }
\ No newline at end of file
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// MigrationDirection tells whether this host hands a session over or receives it
+type MigrationDirection string
+
+const (
+	MigrationOutgoing MigrationDirection = "outgoing"
+	MigrationIncoming MigrationDirection = "incoming"
+)
+
+// MigrationStatus represents the progress of a session migration
+type MigrationStatus string
+
+const (
+	MigrationStatusPreparing  MigrationStatus = "preparing"   // Checkpoint being built or sent
+	MigrationStatusPrepared   MigrationStatus = "prepared"    // Target holds the checkpoint and the lease
+	MigrationStatusCommitted  MigrationStatus = "committed"   // Session runs on the target
+	MigrationStatusAborted    MigrationStatus = "aborted"     // Target discarded the checkpoint
+	MigrationStatusRolledBack MigrationStatus = "rolled_back" // Source resumed the session after a failure
+	MigrationStatusFailed     MigrationStatus = "failed"      // Failed before the source stopped the session
+)
+
+// SessionMigration records one handover of a session between devices, on both
+// the source and the target. Only a hash of the lease token is stored.
+type SessionMigration struct {
+	ID             uuid.UUID          `gorm:"type:uuid;primary_key" json:"id"`
+	SessionID      string             `gorm:"not null;index" json:"session_id"`
+	Direction      MigrationDirection `gorm:"type:varchar(10);not null" json:"direction"`
+	SourceDeviceID string             `gorm:"not null" json:"source_device_id"`
+	TargetDeviceID string             `json:"target_device_id"`
+	PeerURL        string             `json:"peer_url,omitempty"`
+	LeaseTokenHash string             `gorm:"type:varchar(64)" json:"-"`
+	LeaseExpiresAt time.Time          `json:"lease_expires_at"`
+	Status         MigrationStatus    `gorm:"type:varchar(20);not null" json:"status"`
+	Error          string             `gorm:"type:text" json:"error,omitempty"`
+	CreatedAt      time.Time          `json:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at"`
+}
+
+// TableName sets the table name for SessionMigration
+func (SessionMigration) TableName() string {
+	return "session_migrations"
+}
+
+// BeforeCreate hook for SessionMigration
+func (m *SessionMigration) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == uuid.Nil {
+		m.ID = uuid.New()
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/majiayu000/anywhere-ai/core/terminal"
 	"gorm.io/gorm"
 )
 
@@ -47,6 +48,13 @@ type UserAgent struct {
 	Instances []AgentInstance `gorm:"foreignKey:UserAgentID" json:"instances,omitempty"`
 }
 
+// Statuses of agent instances
+const (
+	AgentStatusActive        = "active"         // Working, or waiting for nothing
+	AgentStatusAwaitingInput = "awaiting_input" // Asked the user a question
+	AgentStatusCompleted     = "completed"      // Ended by the agent
+)
+
 // AgentInstance represents a running AI agent session (from Omnara)
 type AgentInstance struct {
 	ID               uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
@@ -80,17 +88,22 @@ type Message struct {
 	Instance AgentInstance `gorm:"foreignKey:AgentInstanceID" json:"instance,omitempty"`
 }
 
-// APIKey represents API keys for agent authentication (from Omnara)
+// APIKey represents API keys for agent authentication (from Omnara). Only a
+// hash of the key is stored; the key itself is shown once, when issued.
 type APIKey struct {
 	ID         uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
 	UserID     uuid.UUID  `gorm:"type:uuid;not null" json:"user_id"`
 	Name       string     `gorm:"not null" json:"name"`
-	APIKeyHash string     `gorm:"not null" json:"api_key_hash"`
-	APIKey     string     `gorm:"type:text" json:"api_key"` // Store JWT for viewing
+	APIKeyHash string     `gorm:"not null;uniqueIndex" json:"-"`
+	APIKey     string     `gorm:"type:text" json:"-"` // No longer stored
+	KeyPrefix  string     `gorm:"type:varchar(16)" json:"key_prefix"` // Tells keys apart in listings
+	Scopes     []string   `gorm:"type:text;serializer:json" json:"scopes"`
+	SessionIDs []string   `gorm:"type:text;serializer:json" json:"session_ids,omitempty"` // Sessions the key is restricted to; all when empty
 	IsActive   bool       `gorm:"default:true" json:"is_active"`
 	CreatedAt  time.Time  `json:"created_at"`
 	ExpiresAt  *time.Time `json:"expires_at"`
 	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
 
 	// Relationships
 	User User `gorm:"foreignKey:UserID" json:"user,omitempty"`
@@ -102,6 +115,7 @@ type PushToken struct {
 	UserID     uuid.UUID  `gorm:"type:uuid;not null" json:"user_id"`
 	Token      string     `gorm:"unique;not null" json:"token"`
 	Platform   string     `gorm:"not null" json:"platform"` // 'ios' or 'android'
+	DeviceID   string     `gorm:"type:text" json:"device_id,omitempty"` // X-Device-ID of the app that registered it
 	IsActive   bool       `gorm:"default:true" json:"is_active"`
 	CreatedAt  time.Time  `json:"created_at"`
 	UpdatedAt  time.Time  `json:"updated_at"`
@@ -111,75 +125,109 @@ type PushToken struct {
 	User User `gorm:"foreignKey:UserID" json:"user,omitempty"`
 }
 
-// TerminalSession represents a persistent terminal session (our new addition)
+// TerminalSession represents a persistent terminal session (our new addition).
+// It is the shared session record used by the CLI, the core server and the
+// persistent manager; see SessionRepository.
 type TerminalSession struct {
-	ID        uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
-	UserID    uuid.UUID `gorm:"type:uuid;not null" json:"user_id"`
-	Name      string    `gorm:"not null" json:"name"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        string     `gorm:"primaryKey" json:"id"`
+	UserID    *uuid.UUID `json:"user_id,omitempty"`
+	Name      string     `json:"name"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
 
 	// Device info
-	OwnerDeviceID   string    `gorm:"not null" json:"owner_device_id"`
-	OwnerDeviceName string    `json:"owner_device_name"`
-	CurrentDeviceID string    `json:"current_device_id"`
-	LastHeartbeat   time.Time `json:"last_heartbeat"`
+	OwnerDeviceID   string     `gorm:"not null" json:"owner_device_id"`
+	OwnerDeviceName string     `json:"owner_device_name"`
+	CurrentDeviceID string     `json:"current_device_id"` // Lease holder
+	LastHeartbeat   time.Time  `json:"last_heartbeat"`
+	LeaseExpiresAt  *time.Time `json:"lease_expires_at"`
+	LeaseEpoch      int64      `gorm:"not null;default:0" json:"lease_epoch"`
 
 	// Terminal state
-	Command     string                 `json:"command"`
-	Args        []string               `gorm:"type:jsonb" json:"args"`
-	Environment map[string]string      `gorm:"type:jsonb" json:"environment"`
-	WorkingDir  string                 `json:"working_dir"`
+	Command     string            `json:"command"`
+	Args        []string          `gorm:"serializer:json" json:"args"`
+	Environment map[string]string `gorm:"type:text;serializer:encryptedjson" json:"environment"`
+	WorkingDir  string            `json:"working_dir"`
 
 	// Buffer state
-	BufferContent []byte `json:"buffer_content"`
+	BufferContent []byte `gorm:"serializer:encrypted" json:"buffer_content"`
 	CursorRow     int    `json:"cursor_row"`
 	CursorCol     int    `json:"cursor_col"`
 	ScrollOffset  int    `json:"scroll_offset"`
 
+	// Recent input and output of the session
+	InputHistory  []terminal.InputRecord  `gorm:"type:text;serializer:encryptedjson" json:"input_history,omitempty"`
+	OutputHistory []terminal.OutputRecord `gorm:"type:text;serializer:encryptedjson" json:"output_history,omitempty"`
+
 	// Tool state
 	ToolName  string                 `json:"tool_name"`
-	ToolState map[string]interface{} `gorm:"type:jsonb" json:"tool_state"`
+	ToolState map[string]interface{} `gorm:"serializer:json" json:"tool_state"`
 
 	// Metadata
 	Status   string                 `gorm:"default:'created'" json:"status"`
-	Tags     []string               `gorm:"type:jsonb" json:"tags"`
-	Metadata map[string]interface{} `gorm:"type:jsonb" json:"metadata"`
+	Tags     []string               `gorm:"serializer:json" json:"tags"`
+	Metadata map[string]interface{} `gorm:"serializer:json" json:"metadata"`
 
 	// Relationships
-	User        User                 `gorm:"foreignKey:UserID" json:"user,omitempty"`
-	Checkpoints []SessionCheckpoint  `gorm:"foreignKey:SessionID" json:"checkpoints,omitempty"`
-	Logs        []SessionLog         `gorm:"foreignKey:SessionID" json:"logs,omitempty"`
+	User        *User               `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Checkpoints []SessionCheckpoint `gorm:"foreignKey:SessionID" json:"checkpoints,omitempty"`
+	Logs        []SessionLog        `gorm:"foreignKey:SessionID" json:"logs,omitempty"`
 }
 
 // SessionCheckpoint represents a session checkpoint for recovery
 type SessionCheckpoint struct {
-	ID        uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
-	SessionID uuid.UUID `gorm:"type:uuid;not null" json:"session_id"`
+	ID        string    `gorm:"primaryKey" json:"id"`
+	SessionID string    `gorm:"not null" json:"session_id"`
 	Timestamp time.Time `json:"timestamp"`
 
 	// History
-	InputHistory  []map[string]interface{} `gorm:"type:jsonb" json:"input_history"`
-	OutputHistory []map[string]interface{} `gorm:"type:jsonb" json:"output_history"`
+	InputHistory  []map[string]interface{} `gorm:"serializer:encryptedjson" json:"input_history"`
+	OutputHistory []map[string]interface{} `gorm:"serializer:encryptedjson" json:"output_history"`
 
 	// State snapshot
-	StateSnapshot map[string]interface{} `gorm:"type:jsonb" json:"state_snapshot"`
+	StateSnapshot map[string]interface{} `gorm:"serializer:encryptedjson" json:"state_snapshot"`
+
+	// Why and by whom the checkpoint was taken
+	Trigger CheckpointTrigger `gorm:"column:trigger_type;type:varchar(20)" json:"trigger,omitempty"`
+	Label   string            `json:"label,omitempty"`
+
+	// Conversation position: the last message, and how far Claude's transcript went
+	MessageID        *uuid.UUID `gorm:"type:uuid" json:"message_id,omitempty"`
+	ClaudeSessionID  string     `json:"claude_session_id,omitempty"`
+	TranscriptPath   string     `json:"transcript_path,omitempty"`
+	TranscriptOffset int64      `json:"transcript_offset,omitempty"`
+
+	// Working tree, committed outside any branch and kept under refs/anywhere/checkpoints
+	RepoDir   string `json:"repo_dir,omitempty"`
+	GitBranch string `json:"git_branch,omitempty"`
+	GitHead   string `gorm:"type:varchar(40)" json:"git_head,omitempty"`
+	GitCommit string `gorm:"type:varchar(40)" json:"git_commit,omitempty"`
 
 	// Relationships
-	Session TerminalSession `gorm:"foreignKey:SessionID" json:"session,omitempty"`
+	Session *TerminalSession `gorm:"foreignKey:SessionID" json:"session,omitempty"`
 }
 
+// CheckpointTrigger tells why a checkpoint was taken
+type CheckpointTrigger string
+
+const (
+	CheckpointTriggerTurns      CheckpointTrigger = "turns"      // Every N agent turns
+	CheckpointTriggerPermission CheckpointTrigger = "permission" // Before a permission prompt was approved
+	CheckpointTriggerManual     CheckpointTrigger = "manual"     // Requested through the API
+	CheckpointTriggerRestore    CheckpointTrigger = "restore"    // State replaced by a restore
+)
+
 // SessionLog represents session event logs
 type SessionLog struct {
 	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
-	SessionID uuid.UUID `gorm:"type:uuid;not null" json:"session_id"`
+	SessionID string    `gorm:"not null" json:"session_id"`
 	Timestamp time.Time `json:"timestamp"`
 	Type      string    `json:"type"` // 'input', 'output', 'error', 'event'
 	Content   string    `gorm:"type:text" json:"content"`
-	Metadata  map[string]interface{} `gorm:"type:jsonb" json:"metadata"`
+	Metadata  map[string]interface{} `gorm:"serializer:json" json:"metadata"`
 
 	// Relationships
-	Session TerminalSession `gorm:"foreignKey:SessionID" json:"session,omitempty"`
+	Session *TerminalSession `gorm:"foreignKey:SessionID" json:"session,omitempty"`
 }
 
 // BeforeCreate hooks
@@ -226,15 +274,15 @@ func (pt *PushToken) BeforeCreate(tx *gorm.DB) error {
 }
 
 func (ts *TerminalSession) BeforeCreate(tx *gorm.DB) error {
-	if ts.ID == uuid.Nil {
-		ts.ID = uuid.New()
+	if ts.ID == "" {
+		ts.ID = uuid.New().String()
 	}
 	return nil
 }
 
 func (sc *SessionCheckpoint) BeforeCreate(tx *gorm.DB) error {
-	if sc.ID == uuid.Nil {
-		sc.ID = uuid.New()
+	if sc.ID == "" {
+		sc.ID = uuid.New().String()
 	}
 	return nil
 }
\ No newline at end of file
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Reader identifies who is reading a session: a user on a specific device
+type Reader struct {
+	UserID   string `json:"user_id"`
+	DeviceID string `json:"device_id"`
+}
+
+// ReadCursor tracks how far a reader has read in a session
+type ReadCursor struct {
+	ID                uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	SessionID         string     `gorm:"not null;uniqueIndex:idx_read_cursors_reader" json:"session_id"`
+	UserID            string     `gorm:"not null;uniqueIndex:idx_read_cursors_reader;index" json:"user_id"`
+	DeviceID          string     `gorm:"not null;uniqueIndex:idx_read_cursors_reader" json:"device_id"`
+	LastReadMessageID *uuid.UUID `gorm:"type:uuid" json:"last_read_message_id,omitempty"`
+	LastReadAt        time.Time  `json:"last_read_at"` // CreatedAt of the last read message
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+// SessionReadSummary summarizes the read state of one session for a reader
+type SessionReadSummary struct {
+	SessionID         string     `json:"session_id"`
+	UnreadMessages    int64      `json:"unread_messages"`
+	RequiresUserInput bool       `json:"requires_user_input"`
+	LastMessageTime   *time.Time `json:"last_message_time,omitempty"`
+}
+
+// InboxSummary is the badge summary across all sessions of a reader
+type InboxSummary struct {
+	UserID                 string               `json:"user_id"`
+	DeviceID               string               `json:"device_id"`
+	TotalUnread            int64                `json:"total_unread"`
+	SessionsRequiringInput int                  `json:"sessions_requiring_input"`
+	Sessions               []SessionReadSummary `json:"sessions"`
+}
+
+// TableName sets the table name for ReadCursor
+func (ReadCursor) TableName() string {
+	return "read_cursors"
+}
+
+// BeforeCreate hook for ReadCursor
+func (rc *ReadCursor) BeforeCreate(tx *gorm.DB) error {
+	if rc.ID == uuid.Nil {
+		rc.ID = uuid.New()
+	}
+	if rc.UpdatedAt.IsZero() {
+		rc.UpdatedAt = time.Now()
+	}
+	return nil
+}
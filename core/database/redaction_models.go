@@ -0,0 +1,58 @@
+package database
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/majiayu000/anywhere-ai/core/redact"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Sources of redacted content recorded in RedactionCount
+const (
+	RedactionSourceOutput  = "output"  // Terminal output sent to clients
+	RedactionSourceMessage = "message" // Stored conversation messages
+	RedactionSourceLog     = "log"     // Session event logs
+	RedactionSourceBuffer  = "buffer"  // Saved session scrollback
+	RedactionSourceEnv     = "env"     // Saved session environment
+	RedactionSourceDiff    = "diff"    // Git diffs of agent turns
+)
+
+// RedactionCount is the audit count of values a redaction rule masked in one
+// session. Only counts are kept, never the masked values.
+type RedactionCount struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"-"`
+	SessionID string    `gorm:"not null;uniqueIndex:idx_redaction_counts_key" json:"session_id"`
+	Source    string    `gorm:"type:varchar(20);not null;uniqueIndex:idx_redaction_counts_key" json:"source"`
+	Rule      string    `gorm:"type:varchar(100);not null;uniqueIndex:idx_redaction_counts_key" json:"rule"`
+	Count     int64     `gorm:"not null;default:0" json:"count"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TableName sets the table name for RedactionCount
+func (RedactionCount) TableName() string {
+	return "redaction_counts"
+}
+
+// RecordRedactions adds counts to the audit totals of a session
+func RecordRedactions(db *gorm.DB, sessionID string, source string, counts redact.Counts) error {
+	now := time.Now()
+	for rule, n := range counts {
+		if n == 0 {
+			continue
+		}
+		row := RedactionCount{SessionID: sessionID, Source: source, Rule: rule, Count: int64(n), UpdatedAt: now}
+		err := db.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "session_id"}, {Name: "source"}, {Name: "rule"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"count":      gorm.Expr("redaction_counts.count + excluded.count"),
+				"updated_at": now,
+			}),
+		}).Create(&row).Error
+		if err != nil {
+			return fmt.Errorf("failed to record redactions: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+	"github.com/majiayu000/anywhere-ai/core/encryption"
+	"gorm.io/gorm"
+)
+
+// MessageSearchToken is one blinded search term of an encrypted message. Terms are
+// stored as keyed hashes, so the index answers "which messages contain these
+// words" without storing the words themselves.
+type MessageSearchToken struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"-"`
+	MessageID uuid.UUID `gorm:"type:uuid;not null;index" json:"message_id"`
+	SessionID string    `gorm:"not null" json:"session_id"`
+	Token     string    `gorm:"not null;index" json:"-"`
+	KeyID     string    `gorm:"not null" json:"key_id"` // Key the token was derived from
+}
+
+// TableName sets the table name for MessageSearchToken
+func (MessageSearchToken) TableName() string {
+	return "message_search_tokens"
+}
+
+var searchIndexEnabled atomic.Bool
+
+// SearchIndexEnabled reports whether encrypted messages are indexed for search.
+// The index is opt-in (ANYWHERE_SEARCH_INDEX=true) and only used with encryption;
+// plaintext messages are searched directly.
+func SearchIndexEnabled() bool {
+	return searchIndexEnabled.Load() && encryption.Active() != nil
+}
+
+// configureEncryption installs the keyring and search index settings from the
+// environment, so every entry point reads and writes the same encrypted fields
+func configureEncryption() error {
+	keyring, err := encryption.LoadKeyring()
+	if err != nil {
+		return fmt.Errorf("failed to load encryption keys: %w", err)
+	}
+	encryption.Install(keyring)
+	searchIndexEnabled.Store(os.Getenv("ANYWHERE_SEARCH_INDEX") == "true")
+
+	if keyring != nil {
+		log.Printf("🔐 Encryption at rest enabled (active key %s, search index %v)", keyring.ActiveKeyID(), SearchIndexEnabled())
+	}
+	return nil
+}
+
+// AfterCreate indexes new messages when the search index is enabled
+func (m *TerminalMessage) AfterCreate(tx *gorm.DB) error {
+	if !SearchIndexEnabled() {
+		return nil
+	}
+	return IndexMessage(tx, m)
+}
+
+// IndexMessage replaces the search tokens of a message with tokens derived from
+// the active key
+func IndexMessage(tx *gorm.DB, message *TerminalMessage) error {
+	keyring := encryption.Active()
+	if keyring == nil {
+		return nil
+	}
+
+	if err := tx.Where("message_id = ?", message.ID).Delete(&MessageSearchToken{}).Error; err != nil {
+		return fmt.Errorf("failed to clear search tokens: %w", err)
+	}
+
+	terms := encryption.SearchTerms(message.Content)
+	if len(terms) == 0 {
+		return nil
+	}
+
+	tokens := make([]MessageSearchToken, 0, len(terms))
+	for _, term := range terms {
+		tokens = append(tokens, MessageSearchToken{
+			MessageID: message.ID,
+			SessionID: message.SessionID,
+			Token:     keyring.SearchToken(term),
+			KeyID:     keyring.ActiveKeyID(),
+		})
+	}
+	if err := tx.CreateInBatches(tokens, 100).Error; err != nil {
+		return fmt.Errorf("failed to index message: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,631 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/majiayu000/anywhere-ai/core/redact"
+	"github.com/majiayu000/anywhere-ai/core/terminal"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// sessionDeadAfter is how long a session may go without a heartbeat before
+// ListSessions treats it as dead
+const sessionDeadAfter = 5 * time.Minute
+
+// ErrSessionNotFound is returned when a session does not exist in the store
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionRepository is the session store shared by the CLI, the core server and
+// the persistent manager. It implements terminal.SessionStore over GORM, so the
+// same code runs against SQLite and PostgreSQL.
+type SessionRepository struct {
+	db       *gorm.DB
+	redactor *redact.Redactor
+	seen     *redact.Seen
+	leaseTTL time.Duration
+}
+
+var _ terminal.SessionStore = (*SessionRepository)(nil)
+
+// NewSessionRepository creates a session repository on a migrated database
+func NewSessionRepository(db *gorm.DB) *SessionRepository {
+	return &SessionRepository{db: db, leaseTTL: terminal.DefaultLeaseTTL}
+}
+
+// SetLeaseTTL sets how long the leases renewed by UpdateHeartbeat last
+func (r *SessionRepository) SetLeaseTTL(ttl time.Duration) {
+	r.leaseTTL = ttl
+}
+
+// LeaseTTL returns how long the leases renewed by UpdateHeartbeat last
+func (r *SessionRepository) LeaseTTL() time.Duration {
+	return r.leaseTTL
+}
+
+// SetRedactor sets the redactor applied to buffers and logs before they are stored
+func (r *SessionRepository) SetRedactor(redactor *redact.Redactor) {
+	r.redactor = redactor
+	r.seen = redact.NewSeen()
+}
+
+// redact masks secrets in content and records what was masked. Buffers are saved
+// over and over, so only secrets not seen before in the session are counted.
+func (r *SessionRepository) redact(sessionID string, source string, content string) string {
+	if r.redactor == nil {
+		return content
+	}
+	redacted, matches := r.redactor.RedactMatches(content)
+	counts := r.seen.Count(sessionID, matches)
+	if err := RecordRedactions(r.db, sessionID, source, counts); err != nil {
+		log.Printf("Failed to record redactions for session %s: %v", sessionID, err)
+	}
+	return redacted
+}
+
+// redactEnvironment masks secrets in environment values. Each variable is
+// redacted as NAME=value so secrets recognized only by their name are caught too.
+func (r *SessionRepository) redactEnvironment(sessionID string, env map[string]string) map[string]string {
+	if r.redactor == nil {
+		return env
+	}
+	redacted := make(map[string]string, len(env))
+	for name, value := range env {
+		prefix := name + "="
+		masked := r.redact(sessionID, RedactionSourceEnv, prefix+value)
+		if !strings.HasPrefix(masked, prefix) {
+			// The name itself matched a rule; fall back to the value alone
+			masked = prefix + r.redact(sessionID, RedactionSourceEnv, value)
+		}
+		redacted[name] = strings.TrimPrefix(masked, prefix)
+	}
+	return redacted
+}
+
+// SaveSession inserts a session or updates its mutable state. The lease is
+// only set on insert; afterwards it changes through AcquireLease, ReleaseLease
+// and HandOver, so a device that lost a session cannot take it back by saving.
+func (r *SessionRepository) SaveSession(state *terminal.SessionState) error {
+	row := sessionRow(state)
+	if len(row.Environment) > 0 {
+		row.Environment = r.redactEnvironment(state.ID, row.Environment)
+	}
+	if len(row.BufferContent) > 0 {
+		row.BufferContent = []byte(r.redact(state.ID, RedactionSourceBuffer, string(row.BufferContent)))
+	}
+	if len(row.OutputHistory) > 0 {
+		history := make([]terminal.OutputRecord, len(row.OutputHistory))
+		for i, record := range row.OutputHistory {
+			record.Content = []byte(r.redact(state.ID, RedactionSourceBuffer, string(record.Content)))
+			history[i] = record
+		}
+		row.OutputHistory = history
+	}
+	if row.UpdatedAt.IsZero() {
+		row.UpdatedAt = time.Now()
+	}
+	if row.CreatedAt.IsZero() {
+		row.CreatedAt = row.UpdatedAt
+	}
+
+	err := r.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"name", "updated_at", "last_heartbeat",
+			"command", "args", "environment", "working_dir",
+			"buffer_content", "cursor_row", "cursor_col", "scroll_offset",
+			"input_history", "output_history",
+			"tool_name", "tool_state", "status", "tags", "metadata",
+		}),
+	}).Create(row).Error
+	if err != nil {
+		return fmt.Errorf("failed to save session %s: %w", state.ID, err)
+	}
+	return nil
+}
+
+// LoadSession loads a session by ID
+func (r *SessionRepository) LoadSession(sessionID string) (*terminal.SessionState, error) {
+	var row TerminalSession
+	if err := r.db.First(&row, "id = ?", sessionID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+		}
+		return nil, fmt.Errorf("failed to load session %s: %w", sessionID, err)
+	}
+	return row.State(), nil
+}
+
+// ListSessions lists sessions matching filter, most recently updated first
+func (r *SessionRepository) ListSessions(filter terminal.SessionFilter) ([]*terminal.SessionState, error) {
+	query := r.db.Model(&TerminalSession{})
+
+	if filter.DeviceID != "" {
+		query = query.Where("owner_device_id = ? OR current_device_id = ?", filter.DeviceID, filter.DeviceID)
+	}
+	if filter.ToolName != "" {
+		query = query.Where("tool_name = ?", filter.ToolName)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if !filter.CreatedAfter.IsZero() {
+		query = query.Where("created_at > ?", filter.CreatedAfter)
+	}
+	if !filter.CreatedBefore.IsZero() {
+		query = query.Where("created_at < ?", filter.CreatedBefore)
+	}
+	if !filter.IncludeDead {
+		query = query.Where("last_heartbeat > ?", time.Now().Add(-sessionDeadAfter))
+	}
+
+	var rows []TerminalSession
+	if err := query.Order("updated_at DESC").Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	// Tags are stored as JSON, so they are matched here rather than in SQL
+	sessions := make([]*terminal.SessionState, 0, len(rows))
+	for i := range rows {
+		if !hasTags(rows[i].Tags, filter.Tags) {
+			continue
+		}
+		sessions = append(sessions, rows[i].State())
+	}
+	return sessions, nil
+}
+
+// DeleteSession deletes a session with its checkpoints and logs
+func (r *SessionRepository) DeleteSession(sessionID string) error {
+	if r.seen != nil {
+		r.seen.Forget(sessionID)
+	}
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("session_id = ?", sessionID).Delete(&SessionLog{}).Error; err != nil {
+			return fmt.Errorf("failed to delete session logs: %w", err)
+		}
+		if err := tx.Where("session_id = ?", sessionID).Delete(&SessionCheckpoint{}).Error; err != nil {
+			return fmt.Errorf("failed to delete session checkpoints: %w", err)
+		}
+		if err := tx.Where("session_id = ?", sessionID).Delete(&SessionShare{}).Error; err != nil {
+			return fmt.Errorf("failed to delete session shares: %w", err)
+		}
+		if err := tx.Where("session_id = ?", sessionID).Delete(&ShareLink{}).Error; err != nil {
+			return fmt.Errorf("failed to delete share links: %w", err)
+		}
+		if err := tx.Delete(&TerminalSession{}, "id = ?", sessionID).Error; err != nil {
+			return fmt.Errorf("failed to delete session: %w", err)
+		}
+		return nil
+	})
+}
+
+// UpdateHeartbeat renews the lease deviceID holds on a session, taking it if it
+// is free or expired. It fails with terminal.ErrLeaseHeld while another device
+// holds the lease.
+func (r *SessionRepository) UpdateHeartbeat(sessionID string, deviceID string) error {
+	_, err := r.AcquireLease(sessionID, deviceID, r.leaseTTL)
+	return err
+}
+
+// AcquireLease takes or renews the lease of a session for ttl. Only the holder
+// may renew a lease; once it expires, or is released, any device may take it.
+func (r *SessionRepository) AcquireLease(sessionID string, deviceID string, ttl time.Duration) (*terminal.SessionLease, error) {
+	now := time.Now()
+	result := r.db.Model(&TerminalSession{}).
+		Where("id = ?", sessionID).
+		Where("current_device_id = ? OR current_device_id IS NULL OR current_device_id = '' OR lease_expires_at IS NULL OR lease_expires_at <= ?", deviceID, now).
+		Updates(map[string]interface{}{
+			"lease_epoch":       gorm.Expr("CASE WHEN current_device_id = ? AND lease_expires_at > ? THEN lease_epoch ELSE lease_epoch + 1 END", deviceID, now),
+			"current_device_id": deviceID,
+			"lease_expires_at":  now.Add(ttl),
+			"last_heartbeat":    now,
+			"updated_at":        now,
+		})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to acquire lease: %w", result.Error)
+	}
+
+	lease, err := r.Lease(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if result.RowsAffected == 0 || lease.DeviceID != deviceID {
+		return lease, fmt.Errorf("%w: %s holds session %s until %s", terminal.ErrLeaseHeld,
+			lease.DeviceID, sessionID, lease.ExpiresAt.Format(time.RFC3339))
+	}
+	return lease, nil
+}
+
+// ReleaseLease gives up the lease deviceID holds on a session, so another
+// device can take it over without waiting for it to expire
+func (r *SessionRepository) ReleaseLease(sessionID string, deviceID string) error {
+	err := r.db.Model(&TerminalSession{}).
+		Where("id = ? AND current_device_id = ?", sessionID, deviceID).
+		Updates(map[string]interface{}{
+			"lease_expires_at": nil,
+			"updated_at":       time.Now(),
+		}).Error
+	if err != nil {
+		return fmt.Errorf("failed to release lease: %w", err)
+	}
+	return nil
+}
+
+// Lease returns the lease of a session
+func (r *SessionRepository) Lease(sessionID string) (*terminal.SessionLease, error) {
+	leases, err := r.Leases([]string{sessionID})
+	if err != nil {
+		return nil, err
+	}
+	lease, exists := leases[sessionID]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+	return lease, nil
+}
+
+// Leases returns the leases of the given sessions that are stored, by session ID
+func (r *SessionRepository) Leases(sessionIDs []string) (map[string]*terminal.SessionLease, error) {
+	leases := make(map[string]*terminal.SessionLease, len(sessionIDs))
+	if len(sessionIDs) == 0 {
+		return leases, nil
+	}
+
+	var rows []TerminalSession
+	err := r.db.Select("id", "current_device_id", "lease_expires_at", "lease_epoch").
+		Where("id IN ?", sessionIDs).
+		Find(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load leases: %w", err)
+	}
+	for i := range rows {
+		leases[rows[i].ID] = rows[i].lease()
+	}
+	return leases, nil
+}
+
+// SetOwner records the user who owns a session
+func (r *SessionRepository) SetOwner(sessionID string, userID uuid.UUID) error {
+	err := r.db.Model(&TerminalSession{}).Where("id = ?", sessionID).Update("user_id", userID).Error
+	if err != nil {
+		return fmt.Errorf("failed to set owner of session %s: %w", sessionID, err)
+	}
+	return nil
+}
+
+// OwnedSessionIDs returns the IDs of the sessions and agent instances a user owns
+func (r *SessionRepository) OwnedSessionIDs(userID uuid.UUID) ([]string, error) {
+	var ids []string
+	if err := r.db.Model(&TerminalSession{}).Where("user_id = ?", userID).Pluck("id", &ids).Error; err != nil {
+		return nil, fmt.Errorf("failed to list sessions of user %s: %w", userID, err)
+	}
+	var instanceIDs []uuid.UUID
+	if err := r.db.Model(&AgentInstance{}).Where("user_id = ?", userID).Pluck("id", &instanceIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list agent instances of user %s: %w", userID, err)
+	}
+	for _, id := range instanceIDs {
+		ids = append(ids, id.String())
+	}
+	return ids, nil
+}
+
+// UnownedSessionIDs returns the IDs of the sessions nobody owns: stored
+// sessions without a user, and sessions only known from their messages or
+// usage, such as ones started from the CLI
+func (r *SessionRepository) UnownedSessionIDs() ([]string, error) {
+	var ids []string
+	if err := r.db.Model(&TerminalSession{}).Where("user_id IS NULL").Pluck("id", &ids).Error; err != nil {
+		return nil, fmt.Errorf("failed to list unowned sessions: %w", err)
+	}
+
+	var owned []string
+	if err := r.db.Model(&TerminalSession{}).Where("user_id IS NOT NULL").Pluck("id", &owned).Error; err != nil {
+		return nil, fmt.Errorf("failed to list owned sessions: %w", err)
+	}
+	var instanceIDs []uuid.UUID
+	if err := r.db.Model(&AgentInstance{}).Pluck("id", &instanceIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list agent instances: %w", err)
+	}
+	known := make(map[string]bool, len(ids)+len(owned)+len(instanceIDs))
+	for _, id := range ids {
+		known[id] = true
+	}
+	for _, id := range owned {
+		known[id] = true
+	}
+	for _, id := range instanceIDs {
+		known[id.String()] = true
+	}
+
+	for _, model := range []interface{}{&TerminalMessage{}, &TokenUsage{}} {
+		var sessionIDs []string
+		if err := r.db.Model(model).Distinct("session_id").Pluck("session_id", &sessionIDs).Error; err != nil {
+			return nil, fmt.Errorf("failed to list sessions of stored records: %w", err)
+		}
+		for _, id := range sessionIDs {
+			if !known[id] {
+				known[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// Owners returns the owners of the stored sessions and agent instances among
+// sessionIDs; sessions without an owner are left out
+func (r *SessionRepository) Owners(sessionIDs []string) (map[string]uuid.UUID, error) {
+	owners := make(map[string]uuid.UUID, len(sessionIDs))
+	if len(sessionIDs) == 0 {
+		return owners, nil
+	}
+
+	var rows []TerminalSession
+	err := r.db.Select("id", "user_id").
+		Where("id IN ? AND user_id IS NOT NULL", sessionIDs).
+		Find(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session owners: %w", err)
+	}
+	for _, row := range rows {
+		if row.UserID != nil {
+			owners[row.ID] = *row.UserID
+		}
+	}
+
+	// Agent instances are sessions of the user who started them
+	instanceIDs := make([]uuid.UUID, 0, len(sessionIDs))
+	for _, sessionID := range sessionIDs {
+		if id, err := uuid.Parse(sessionID); err == nil {
+			instanceIDs = append(instanceIDs, id)
+		}
+	}
+	if len(instanceIDs) == 0 {
+		return owners, nil
+	}
+	var instances []AgentInstance
+	if err := r.db.Select("id", "user_id").Where("id IN ?", instanceIDs).Find(&instances).Error; err != nil {
+		return nil, fmt.Errorf("failed to load agent instance owners: %w", err)
+	}
+	for _, instance := range instances {
+		owners[instance.ID.String()] = instance.UserID
+	}
+	return owners, nil
+}
+
+// UpdateStatus sets the status of a session
+func (r *SessionRepository) UpdateStatus(sessionID string, status terminal.SessionStatus) error {
+	err := r.db.Model(&TerminalSession{}).Where("id = ?", sessionID).Updates(map[string]interface{}{
+		"status":     string(status),
+		"updated_at": time.Now(),
+	}).Error
+	if err != nil {
+		return fmt.Errorf("failed to update session status: %w", err)
+	}
+	return nil
+}
+
+// HandOver records that deviceID now runs a session, with the given status,
+// moving the lease to it whoever held it. It is for handovers both devices
+// agreed to, such as migrations.
+func (r *SessionRepository) HandOver(sessionID string, deviceID string, status terminal.SessionStatus) error {
+	now := time.Now()
+	result := r.db.Model(&TerminalSession{}).Where("id = ?", sessionID).Updates(map[string]interface{}{
+		"lease_epoch":       gorm.Expr("CASE WHEN current_device_id = ? THEN lease_epoch ELSE lease_epoch + 1 END", deviceID),
+		"current_device_id": deviceID,
+		"lease_expires_at":  now.Add(r.leaseTTL),
+		"status":            string(status),
+		"last_heartbeat":    now,
+		"updated_at":        now,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to hand over session: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+	return nil
+}
+
+// SaveCheckpoint saves a session checkpoint
+func (r *SessionRepository) SaveCheckpoint(checkpoint *terminal.SessionCheckpoint) error {
+	row := SessionCheckpoint{
+		ID:        checkpoint.ID,
+		SessionID: checkpoint.SessionID,
+		Timestamp: checkpoint.Timestamp,
+	}
+	if err := remarshal(checkpoint.InputHistory, &row.InputHistory); err != nil {
+		return err
+	}
+	if err := remarshal(checkpoint.OutputHistory, &row.OutputHistory); err != nil {
+		return err
+	}
+	if err := remarshal(checkpoint.StateSnapshot, &row.StateSnapshot); err != nil {
+		return err
+	}
+
+	if err := r.db.Create(&row).Error; err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	checkpoint.ID = row.ID
+	return nil
+}
+
+// LoadCheckpoint loads a session checkpoint
+func (r *SessionRepository) LoadCheckpoint(checkpointID string) (*terminal.SessionCheckpoint, error) {
+	var row SessionCheckpoint
+	if err := r.db.First(&row, "id = ?", checkpointID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load checkpoint %s: %w", checkpointID, err)
+	}
+
+	checkpoint := &terminal.SessionCheckpoint{
+		ID:        row.ID,
+		SessionID: row.SessionID,
+		Timestamp: row.Timestamp,
+	}
+	if err := remarshal(row.InputHistory, &checkpoint.InputHistory); err != nil {
+		return nil, err
+	}
+	if err := remarshal(row.OutputHistory, &checkpoint.OutputHistory); err != nil {
+		return nil, err
+	}
+	if err := remarshal(row.StateSnapshot, &checkpoint.StateSnapshot); err != nil {
+		return nil, err
+	}
+	return checkpoint, nil
+}
+
+// LogSessionEvent logs a session event
+func (r *SessionRepository) LogSessionEvent(sessionID string, eventType string, content string, metadata map[string]interface{}) error {
+	row := SessionLog{
+		SessionID: sessionID,
+		Timestamp: time.Now(),
+		Type:      eventType,
+		Content:   r.redact(sessionID, RedactionSourceLog, content),
+		Metadata:  metadata,
+	}
+	if err := r.db.Create(&row).Error; err != nil {
+		return fmt.Errorf("failed to log session event: %w", err)
+	}
+	return nil
+}
+
+// GetSessionLogs gets the most recent session logs
+func (r *SessionRepository) GetSessionLogs(sessionID string, limit int) ([]terminal.SessionLog, error) {
+	var rows []SessionLog
+	err := r.db.Where("session_id = ?", sessionID).
+		Order("timestamp DESC").
+		Limit(limit).
+		Find(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session logs: %w", err)
+	}
+
+	logs := make([]terminal.SessionLog, 0, len(rows))
+	for _, row := range rows {
+		logs = append(logs, terminal.SessionLog{
+			Timestamp: row.Timestamp,
+			Type:      row.Type,
+			Content:   row.Content,
+			Metadata:  row.Metadata,
+		})
+	}
+	return logs, nil
+}
+
+// lease returns the lease recorded in the row
+func (ts *TerminalSession) lease() *terminal.SessionLease {
+	lease := &terminal.SessionLease{
+		SessionID: ts.ID,
+		DeviceID:  ts.CurrentDeviceID,
+		Epoch:     ts.LeaseEpoch,
+	}
+	if ts.LeaseExpiresAt != nil {
+		lease.ExpiresAt = *ts.LeaseExpiresAt
+	}
+	return lease
+}
+
+// State converts the stored row to the state used by the terminal package
+func (ts *TerminalSession) State() *terminal.SessionState {
+	lease := ts.lease()
+	return &terminal.SessionState{
+		ID:              ts.ID,
+		Name:            ts.Name,
+		CreatedAt:       ts.CreatedAt,
+		UpdatedAt:       ts.UpdatedAt,
+		OwnerDeviceID:   ts.OwnerDeviceID,
+		OwnerDeviceName: ts.OwnerDeviceName,
+		CurrentDeviceID: ts.CurrentDeviceID,
+		LastHeartbeat:   ts.LastHeartbeat,
+		LeaseExpiresAt:  lease.ExpiresAt,
+		LeaseEpoch:      lease.Epoch,
+		Command:         ts.Command,
+		Args:            ts.Args,
+		Environment:     ts.Environment,
+		WorkingDir:      ts.WorkingDir,
+		BufferContent:   ts.BufferContent,
+		CursorRow:       ts.CursorRow,
+		CursorCol:       ts.CursorCol,
+		ScrollOffset:    ts.ScrollOffset,
+		InputHistory:    ts.InputHistory,
+		OutputHistory:   ts.OutputHistory,
+		ToolName:        ts.ToolName,
+		ToolState:       ts.ToolState,
+		Status:          terminal.SessionStatus(ts.Status),
+		Tags:            ts.Tags,
+		Metadata:        ts.Metadata,
+	}
+}
+
+// sessionRow converts terminal state to its stored row
+func sessionRow(state *terminal.SessionState) *TerminalSession {
+	var leaseExpiresAt *time.Time
+	if !state.LeaseExpiresAt.IsZero() {
+		expires := state.LeaseExpiresAt
+		leaseExpiresAt = &expires
+	}
+	return &TerminalSession{
+		ID:              state.ID,
+		Name:            state.Name,
+		CreatedAt:       state.CreatedAt,
+		UpdatedAt:       state.UpdatedAt,
+		OwnerDeviceID:   state.OwnerDeviceID,
+		OwnerDeviceName: state.OwnerDeviceName,
+		CurrentDeviceID: state.CurrentDeviceID,
+		LastHeartbeat:   state.LastHeartbeat,
+		LeaseExpiresAt:  leaseExpiresAt,
+		LeaseEpoch:      state.LeaseEpoch,
+		Command:         state.Command,
+		Args:            state.Args,
+		Environment:     state.Environment,
+		WorkingDir:      state.WorkingDir,
+		BufferContent:   state.BufferContent,
+		CursorRow:       state.CursorRow,
+		CursorCol:       state.CursorCol,
+		ScrollOffset:    state.ScrollOffset,
+		InputHistory:    state.InputHistory,
+		OutputHistory:   state.OutputHistory,
+		ToolName:        state.ToolName,
+		ToolState:       state.ToolState,
+		Status:          string(state.Status),
+		Tags:            state.Tags,
+		Metadata:        state.Metadata,
+	}
+}
+
+// hasTags reports whether tags contains every wanted tag
+func hasTags(tags, wanted []string) bool {
+	for _, w := range wanted {
+		found := false
+		for _, t := range tags {
+			if t == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// remarshal converts between the terminal checkpoint types and their JSON columns
+func remarshal(src, dst interface{}) error {
+	data, err := json.Marshal(src)
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+	if err := json.Unmarshal(data, dst); err != nil {
+		return fmt.Errorf("failed to decode checkpoint: %w", err)
+	}
+	return nil
+}
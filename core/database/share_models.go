@@ -0,0 +1,116 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Roles users have in a session. Each role may do everything the ones before
+// it may.
+const (
+	SessionRoleViewer    = "viewer"    // Watch output and read messages
+	SessionRoleCommenter = "commenter" // Also send messages
+	SessionRoleOperator  = "operator"  // Also send raw input and answer permission prompts
+	SessionRoleOwner     = "owner"     // Also share, delete and manage the session
+)
+
+// SessionShareRoles are the roles a session may be shared with
+var SessionShareRoles = []string{SessionRoleViewer, SessionRoleCommenter, SessionRoleOperator}
+
+// sessionRoleRanks orders the roles
+var sessionRoleRanks = map[string]int{
+	SessionRoleViewer:    1,
+	SessionRoleCommenter: 2,
+	SessionRoleOperator:  3,
+	SessionRoleOwner:     4,
+}
+
+// RoleAtLeast reports whether role may do everything required may; no role
+// satisfies nothing
+func RoleAtLeast(role, required string) bool {
+	rank, known := sessionRoleRanks[role]
+	return known && rank >= sessionRoleRanks[required]
+}
+
+// ValidShareRole reports whether a session may be shared with a role
+func ValidShareRole(role string) bool {
+	for _, valid := range SessionShareRoles {
+		if role == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// SessionShare gives a user a role in a session they do not own
+type SessionShare struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	SessionID string     `gorm:"not null" json:"session_id"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	Role      string     `gorm:"type:varchar(20);not null" json:"role"`
+	GrantedBy *uuid.UUID `gorm:"type:uuid" json:"granted_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+
+	// Relationships
+	User User `gorm:"foreignKey:UserID" json:"user,omitempty"`
+}
+
+// TableName sets the table name for SessionShare
+func (SessionShare) TableName() string {
+	return "session_shares"
+}
+
+// BeforeCreate hook for SessionShare
+func (s *SessionShare) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
+
+// Redaction levels of share links. Secrets are masked for everyone; share
+// links may hide more from viewers outside the team.
+const (
+	ShareRedactionSecrets      = "secrets"      // Secrets, as for every viewer
+	ShareRedactionStrict       = "strict"       // Also personal details such as emails, IP addresses and user names
+	ShareRedactionConversation = "conversation" // Strict, and the conversation only, without terminal output
+)
+
+// ShareRedactionLevels are the redaction levels of share links
+var ShareRedactionLevels = []string{ShareRedactionSecrets, ShareRedactionStrict, ShareRedactionConversation}
+
+// ShareLink lets anyone with its token watch a session, read-only, until it
+// expires or is revoked. Only a hash of the token is stored.
+type ShareLink struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	SessionID      string     `gorm:"not null;index" json:"session_id"`
+	TokenHash      string     `gorm:"not null;uniqueIndex" json:"-"`
+	TokenPrefix    string     `gorm:"type:varchar(16)" json:"token_prefix"` // Tells links apart in listings
+	CreatedBy      *uuid.UUID `gorm:"type:uuid" json:"created_by,omitempty"`
+	RedactionLevel string     `gorm:"type:varchar(20);not null" json:"redaction_level"`
+	ExpiresAt      time.Time  `gorm:"not null" json:"expires_at"`
+	RevokedAt      *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt     *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// TableName sets the table name for ShareLink
+func (ShareLink) TableName() string {
+	return "share_links"
+}
+
+// BeforeCreate hook for ShareLink
+func (l *ShareLink) BeforeCreate(tx *gorm.DB) error {
+	if l.ID == uuid.Nil {
+		l.ID = uuid.New()
+	}
+	return nil
+}
+
+// Usable reports whether the link still grants access at t
+func (l *ShareLink) Usable(t time.Time) bool {
+	return l.RevokedAt == nil && t.Before(l.ExpiresAt)
+}
@@ -0,0 +1,162 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrShareNotFound is returned when a session is not shared with a user
+var ErrShareNotFound = errors.New("session is not shared with this user")
+
+// ShareRepository stores who sessions are shared with, and their share links
+type ShareRepository struct {
+	db *gorm.DB
+}
+
+// NewShareRepository creates a share repository on a migrated database
+func NewShareRepository(db *gorm.DB) *ShareRepository {
+	return &ShareRepository{db: db}
+}
+
+// ShareSession gives a user a role in a session, replacing any role they had
+func (r *ShareRepository) ShareSession(sessionID string, userID uuid.UUID, role string, grantedBy *uuid.UUID) (*SessionShare, error) {
+	share := &SessionShare{
+		SessionID: sessionID,
+		UserID:    userID,
+		Role:      role,
+		GrantedBy: grantedBy,
+	}
+	err := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "session_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"role", "granted_by", "updated_at"}),
+	}).Create(share).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to share session %s: %w", sessionID, err)
+	}
+
+	// On conflict the row keeps its ID; load it back
+	if err := r.db.Preload("User").First(share, "session_id = ? AND user_id = ?", sessionID, userID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load share: %w", err)
+	}
+	return share, nil
+}
+
+// UnshareSession takes a user's role in a session away
+func (r *ShareRepository) UnshareSession(sessionID string, userID uuid.UUID) error {
+	result := r.db.Where("session_id = ? AND user_id = ?", sessionID, userID).Delete(&SessionShare{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to unshare session %s: %w", sessionID, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: %s", ErrShareNotFound, userID)
+	}
+	return nil
+}
+
+// ListShares returns who a session is shared with, oldest first
+func (r *ShareRepository) ListShares(sessionID string) ([]SessionShare, error) {
+	var shares []SessionShare
+	err := r.db.Preload("User").Where("session_id = ?", sessionID).Order("created_at").Find(&shares).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list shares of session %s: %w", sessionID, err)
+	}
+	return shares, nil
+}
+
+// SharedSessionIDs returns the IDs of the sessions shared with a user
+func (r *ShareRepository) SharedSessionIDs(userID uuid.UUID) ([]string, error) {
+	var ids []string
+	if err := r.db.Model(&SessionShare{}).Where("user_id = ?", userID).Pluck("session_id", &ids).Error; err != nil {
+		return nil, fmt.Errorf("failed to list sessions shared with user %s: %w", userID, err)
+	}
+	return ids, nil
+}
+
+// SessionRoles returns the role of each user a session is shared with
+func (r *ShareRepository) SessionRoles(sessionID string) (map[uuid.UUID]string, error) {
+	var shares []SessionShare
+	if err := r.db.Select("user_id", "role").Where("session_id = ?", sessionID).Find(&shares).Error; err != nil {
+		return nil, fmt.Errorf("failed to load shares of session %s: %w", sessionID, err)
+	}
+	roles := make(map[uuid.UUID]string, len(shares))
+	for _, share := range shares {
+		roles[share.UserID] = share.Role
+	}
+	return roles, nil
+}
+
+var (
+	// ErrShareLinkNotFound is returned for a share link that does not exist
+	ErrShareLinkNotFound = errors.New("share link not found")
+	// ErrShareLinkRevoked is returned for a share link that was revoked
+	ErrShareLinkRevoked = errors.New("share link revoked")
+	// ErrShareLinkExpired is returned for a share link past its expiry
+	ErrShareLinkExpired = errors.New("share link expired")
+)
+
+// CreateShareLink stores a new share link
+func (r *ShareRepository) CreateShareLink(link *ShareLink) error {
+	if err := r.db.Create(link).Error; err != nil {
+		return fmt.Errorf("failed to create share link: %w", err)
+	}
+	return nil
+}
+
+// ListShareLinks returns the share links of a session, newest first
+func (r *ShareRepository) ListShareLinks(sessionID string) ([]ShareLink, error) {
+	var links []ShareLink
+	if err := r.db.Where("session_id = ?", sessionID).Order("created_at DESC").Find(&links).Error; err != nil {
+		return nil, fmt.Errorf("failed to list share links: %w", err)
+	}
+	return links, nil
+}
+
+// RevokeShareLink revokes a share link of a session
+func (r *ShareRepository) RevokeShareLink(sessionID string, linkID uuid.UUID) (*ShareLink, error) {
+	var link ShareLink
+	if err := r.db.First(&link, "id = ? AND session_id = ?", linkID, sessionID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrShareLinkNotFound, linkID)
+		}
+		return nil, fmt.Errorf("failed to load share link: %w", err)
+	}
+	if link.RevokedAt != nil {
+		return &link, nil
+	}
+
+	now := time.Now()
+	if err := r.db.Model(&link).Update("revoked_at", now).Error; err != nil {
+		return nil, fmt.Errorf("failed to revoke share link: %w", err)
+	}
+	link.RevokedAt = &now
+	return &link, nil
+}
+
+// FindShareLink returns the usable share link with a token hash, recording its use
+func (r *ShareRepository) FindShareLink(hash string) (*ShareLink, error) {
+	var link ShareLink
+	if err := r.db.First(&link, "token_hash = ?", hash).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrShareLinkNotFound
+		}
+		return nil, fmt.Errorf("failed to load share link: %w", err)
+	}
+
+	now := time.Now()
+	switch {
+	case link.RevokedAt != nil:
+		return nil, ErrShareLinkRevoked
+	case !now.Before(link.ExpiresAt):
+		return nil, ErrShareLinkExpired
+	}
+	if err := r.db.Model(&link).Update("last_used_at", now).Error; err != nil {
+		return nil, fmt.Errorf("failed to record use of share link: %w", err)
+	}
+	link.LastUsedAt = &now
+	return &link, nil
+}
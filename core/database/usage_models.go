@@ -0,0 +1,101 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// BudgetAction is what happens when a session exceeds its budget
+type BudgetAction string
+
+const (
+	BudgetActionWarn      BudgetAction = "warn"
+	BudgetActionInterrupt BudgetAction = "interrupt"
+)
+
+// TokenUsage records the tokens consumed by one model response
+type TokenUsage struct {
+	ID                  uuid.UUID  `gorm:"type:uuid;primary_key" json:"id"`
+	SessionID           string     `gorm:"not null;index" json:"session_id"`
+	MessageID           *uuid.UUID `gorm:"type:uuid;index" json:"message_id,omitempty"`
+	ExternalID          string     `gorm:"uniqueIndex" json:"external_id"` // Response ID reported by the tool
+	Tool                string     `gorm:"type:varchar(50);index" json:"tool"`
+	Model               string     `gorm:"type:varchar(100)" json:"model"`
+	InputTokens         int64      `json:"input_tokens"`
+	OutputTokens        int64      `json:"output_tokens"`
+	CacheCreationTokens int64      `json:"cache_creation_tokens"`
+	CacheReadTokens     int64      `json:"cache_read_tokens"`
+	Cost                float64    `json:"cost"`
+	CreatedAt           time.Time  `gorm:"index" json:"created_at"`
+}
+
+// SessionBudget limits the spend of a session
+type SessionBudget struct {
+	SessionID  string       `gorm:"primaryKey" json:"session_id"`
+	LimitUSD   float64      `json:"limit_usd"`
+	Action     BudgetAction `gorm:"type:varchar(20)" json:"action"`
+	ExceededAt *time.Time   `json:"exceeded_at,omitempty"`
+	UpdatedAt  time.Time    `json:"updated_at"`
+}
+
+// UsageTotals sums token usage and cost
+type UsageTotals struct {
+	Responses           int64   `json:"responses"`
+	InputTokens         int64   `json:"input_tokens"`
+	OutputTokens        int64   `json:"output_tokens"`
+	CacheCreationTokens int64   `json:"cache_creation_tokens"`
+	CacheReadTokens     int64   `json:"cache_read_tokens"`
+	TotalTokens         int64   `json:"total_tokens"`
+	Cost                float64 `json:"cost"`
+}
+
+// UsageGroup is the usage of one session, tool, model or day
+type UsageGroup struct {
+	Key string `json:"key"`
+	UsageTotals
+}
+
+// UsageReport aggregates token usage over a period
+type UsageReport struct {
+	From      *time.Time   `json:"from,omitempty"`
+	To        *time.Time   `json:"to,omitempty"`
+	Totals    UsageTotals  `json:"totals"`
+	BySession []UsageGroup `json:"by_session"`
+	ByTool    []UsageGroup `json:"by_tool"`
+	ByModel   []UsageGroup `json:"by_model"`
+	ByDay     []UsageGroup `json:"by_day"`
+}
+
+// TableName sets the table name for TokenUsage
+func (TokenUsage) TableName() string {
+	return "token_usage"
+}
+
+// TableName sets the table name for SessionBudget
+func (SessionBudget) TableName() string {
+	return "session_budgets"
+}
+
+// BeforeCreate hook for TokenUsage
+func (u *TokenUsage) BeforeCreate(tx *gorm.DB) error {
+	if u.ID == uuid.Nil {
+		u.ID = uuid.New()
+	}
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = time.Now()
+	}
+	return nil
+}
+
+// Add accumulates a usage record into the totals
+func (t *UsageTotals) Add(usage *TokenUsage) {
+	t.Responses++
+	t.InputTokens += usage.InputTokens
+	t.OutputTokens += usage.OutputTokens
+	t.CacheCreationTokens += usage.CacheCreationTokens
+	t.CacheReadTokens += usage.CacheReadTokens
+	t.TotalTokens += usage.InputTokens + usage.OutputTokens + usage.CacheCreationTokens + usage.CacheReadTokens
+	t.Cost += usage.Cost
+}
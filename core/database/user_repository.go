@@ -0,0 +1,108 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrUserNotFound is returned for a user that does not exist
+var ErrUserNotFound = errors.New("user not found")
+
+// UserRepository stores users and the accounts they sign in with
+type UserRepository struct {
+	db *gorm.DB
+}
+
+// NewUserRepository creates a user repository on a migrated database
+func NewUserRepository(db *gorm.DB) *UserRepository {
+	return &UserRepository{db: db}
+}
+
+// GetUser loads a user
+func (r *UserRepository) GetUser(userID string) (*User, error) {
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUserNotFound, userID)
+	}
+
+	var user User
+	if err := r.db.First(&user, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrUserNotFound, userID)
+		}
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+	return &user, nil
+}
+
+// FindUserByEmail loads the user with an email address
+func (r *UserRepository) FindUserByEmail(email string) (*User, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	var user User
+	if err := r.db.First(&user, "email = ?", email).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrUserNotFound, email)
+		}
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+	return &user, nil
+}
+
+// SignIn returns the user behind an account at a provider, recording the
+// login. An account seen for the first time is linked to the user with the
+// same, provider verified, email address, or to a new user.
+func (r *UserRepository) SignIn(provider, subject, email, name string) (*User, error) {
+	if subject == "" {
+		return nil, errors.New("account has no subject")
+	}
+	email = strings.ToLower(strings.TrimSpace(email))
+	now := time.Now()
+
+	var user User
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var identity UserIdentity
+		err := tx.First(&identity, "provider = ? AND subject = ?", provider, subject).Error
+		switch {
+		case err == nil:
+			if err := tx.Model(&identity).Update("last_login_at", now).Error; err != nil {
+				return err
+			}
+			return tx.First(&user, "id = ?", identity.UserID).Error
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+
+		if email == "" {
+			return errors.New("account has no email address")
+		}
+		err = tx.First(&user, "email = ?", email).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			user = User{Email: email}
+			if name != "" {
+				user.DisplayName = &name
+			}
+			err = tx.Create(&user).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&UserIdentity{
+			UserID:      user.ID,
+			Provider:    provider,
+			Subject:     subject,
+			Email:       email,
+			LastLoginAt: &now,
+		}).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign in: %w", err)
+	}
+	return &user, nil
+}
@@ -0,0 +1,154 @@
+// Package deviceauth holds the keypair each device authenticates to its peers
+// with. Devices use self-signed certificates and trust each other by pinning
+// certificate fingerprints exchanged at pairing, so no CA is involved.
+package deviceauth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// certificateLifetime is how long a device certificate is valid. Peers pin the
+// fingerprint, so expiry only matters to TLS libraries that check it.
+const certificateLifetime = 20 * 365 * 24 * time.Hour
+
+// ErrUnpinned is returned when a peer presents a certificate other than the pinned one
+var ErrUnpinned = errors.New("peer certificate does not match the pinned fingerprint")
+
+// Identity is the keypair and self-signed certificate of this device
+type Identity struct {
+	Certificate tls.Certificate
+	Fingerprint string // SHA-256 of the certificate, hex encoded
+}
+
+// LoadOrCreate loads the identity stored in dir, generating a keypair and
+// certificate for deviceID on first run
+func LoadOrCreate(dir string, deviceID string) (*Identity, error) {
+	keyPath := filepath.Join(dir, "device.key")
+	certPath := filepath.Join(dir, "device.crt")
+
+	if _, err := os.Stat(keyPath); errors.Is(err, os.ErrNotExist) {
+		if err := generate(dir, keyPath, certPath, deviceID); err != nil {
+			return nil, err
+		}
+	}
+
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load device identity: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse device certificate: %w", err)
+	}
+	cert.Leaf = leaf
+
+	return &Identity{Certificate: cert, Fingerprint: Fingerprint(leaf)}, nil
+}
+
+// generate writes a new Ed25519 key and self-signed certificate
+func generate(dir, keyPath, certPath, deviceID string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create identity directory: %w", err)
+	}
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate device key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: deviceID, Organization: []string{"anywhere"}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(certificateLifetime),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, public, private)
+	if err != nil {
+		return fmt.Errorf("failed to create device certificate: %w", err)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return fmt.Errorf("failed to write device key: %w", err)
+	}
+	if err := os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return fmt.Errorf("failed to write device certificate: %w", err)
+	}
+	return nil
+}
+
+// Fingerprint returns the pinned form of a certificate
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// PeerFingerprint returns the fingerprint of the certificate a TLS peer
+// presented, or an empty string if it presented none
+func PeerFingerprint(state *tls.ConnectionState) string {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return ""
+	}
+	return Fingerprint(state.PeerCertificates[0])
+}
+
+// ServerTLSConfig serves this device's certificate and requires every client to
+// present one. Which client certificates are trusted is up to the handlers.
+func (id *Identity) ServerTLSConfig() *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{id.Certificate},
+		ClientAuth:   tls.RequireAnyClientCert,
+		MinVersion:   tls.VersionTLS13,
+	}
+}
+
+// Client returns an HTTP client that presents this device's certificate and
+// only talks to a server presenting the certificate with fingerprint. An empty
+// fingerprint accepts any server, for peers that are not paired yet.
+func (id *Identity) Client(fingerprint string, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &http.Transport{TLSClientConfig: id.ClientTLSConfig(fingerprint)},
+	}
+}
+
+// ClientTLSConfig is the TLS configuration of Client, for connections other
+// than HTTP requests such as WebSockets
+func (id *Identity) ClientTLSConfig(fingerprint string) *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{id.Certificate},
+		MinVersion:   tls.VersionTLS13,
+		// Peers are trusted by pinned fingerprint rather than by a CA
+		InsecureSkipVerify: true,
+		VerifyConnection: func(state tls.ConnectionState) error {
+			if fingerprint != "" && PeerFingerprint(&state) != fingerprint {
+				return ErrUnpinned
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,243 @@
+// Package encryption provides field-level encryption at rest for conversation
+// content, session buffers and checkpoints.
+//
+// Keys are configured as "id:base64key" entries, either in ANYWHERE_ENCRYPTION_KEYS
+// (comma separated) or in the file named by ANYWHERE_KEYFILE (one per line). The
+// first entry encrypts new data; the others are only used to decrypt. To rotate,
+// put a new key first, restart, and let the re-encryption job move existing rows
+// to it before removing the old key.
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// prefix marks an encrypted value: enc:v1:<key id>:<base64(nonce || ciphertext)>
+const prefix = "enc:v1:"
+
+// keySize is the AES-256 key length
+const keySize = 32
+
+// ErrNoKey is returned when an encrypted value is read without a configured key
+var ErrNoKey = errors.New("value is encrypted but no encryption key is configured")
+
+// Key is a named data encryption key
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// String formats the key as a keyfile entry
+func (k Key) String() string {
+	return k.ID + ":" + base64.StdEncoding.EncodeToString(k.Secret)
+}
+
+// Keyring holds the keys able to decrypt stored data; the first one encrypts
+type Keyring struct {
+	activeID string
+	aeads    map[string]cipher.AEAD
+	indexKey []byte
+}
+
+var active atomic.Pointer[Keyring]
+
+// Install makes k the keyring used by the database serializers; nil disables encryption
+func Install(k *Keyring) {
+	active.Store(k)
+}
+
+// Active returns the installed keyring, or nil when encryption is disabled
+func Active() *Keyring {
+	return active.Load()
+}
+
+// GenerateKey creates a random key with the given ID
+func GenerateKey(id string) (Key, error) {
+	secret := make([]byte, keySize)
+	if _, err := rand.Read(secret); err != nil {
+		return Key{}, fmt.Errorf("failed to generate key: %w", err)
+	}
+	return Key{ID: id, Secret: secret}, nil
+}
+
+// ParseKeys parses "id:base64key" entries separated by newlines or commas.
+// Blank lines and lines starting with # are ignored.
+func ParseKeys(s string) ([]Key, error) {
+	var keys []Key
+	for _, entry := range strings.FieldsFunc(s, func(r rune) bool { return r == '\n' || r == ',' }) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("invalid key entry %q: want id:base64key", entry)
+		}
+		if strings.Contains(id, ":") {
+			return nil, fmt.Errorf("invalid key id %q", id)
+		}
+		secret, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %s: %w", id, err)
+		}
+		if len(secret) != keySize {
+			return nil, fmt.Errorf("invalid key %s: want %d bytes, got %d", id, keySize, len(secret))
+		}
+		keys = append(keys, Key{ID: id, Secret: secret})
+	}
+	return keys, nil
+}
+
+// LoadKeyring builds a keyring from ANYWHERE_ENCRYPTION_KEYS or ANYWHERE_KEYFILE.
+// It returns nil when neither is set.
+func LoadKeyring() (*Keyring, error) {
+	source := os.Getenv("ANYWHERE_ENCRYPTION_KEYS")
+	if source == "" {
+		path := os.Getenv("ANYWHERE_KEYFILE")
+		if path == "" {
+			return nil, nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read keyfile: %w", err)
+		}
+		source = string(data)
+	}
+
+	keys, err := ParseKeys(source)
+	if err != nil {
+		return nil, err
+	}
+	return NewKeyring(keys...)
+}
+
+// NewKeyring creates a keyring; keys[0] encrypts new data
+func NewKeyring(keys ...Key) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("keyring needs at least one key")
+	}
+
+	k := &Keyring{
+		activeID: keys[0].ID,
+		aeads:    make(map[string]cipher.AEAD, len(keys)),
+	}
+	for _, key := range keys {
+		if _, exists := k.aeads[key.ID]; exists {
+			return nil, fmt.Errorf("duplicate key id %s", key.ID)
+		}
+		block, err := aes.NewCipher(key.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %s: %w", key.ID, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %s: %w", key.ID, err)
+		}
+		k.aeads[key.ID] = aead
+	}
+
+	// Search tokens use a key derived from, but distinct from, the active key
+	mac := hmac.New(sha256.New, keys[0].Secret)
+	mac.Write([]byte("anywhere search index"))
+	k.indexKey = mac.Sum(nil)
+
+	return k, nil
+}
+
+// ActiveKeyID returns the ID of the key used for new data
+func (k *Keyring) ActiveKeyID() string {
+	return k.activeID
+}
+
+// Encrypt encrypts plaintext with the active key
+func (k *Keyring) Encrypt(plaintext []byte) ([]byte, error) {
+	aead := k.aeads[k.activeID]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	// The key ID is authenticated so a value cannot be moved under another key
+	sealed := aead.Seal(nonce, nonce, plaintext, []byte(k.activeID))
+
+	out := make([]byte, 0, len(prefix)+len(k.activeID)+1+base64.StdEncoding.EncodedLen(len(sealed)))
+	out = append(out, prefix...)
+	out = append(out, k.activeID...)
+	out = append(out, ':')
+	return base64.StdEncoding.AppendEncode(out, sealed), nil
+}
+
+// Decrypt decrypts a value produced by Encrypt. Values without the encryption
+// prefix were written before encryption was enabled and are returned unchanged.
+func (k *Keyring) Decrypt(data []byte) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return data, nil
+	}
+
+	keyID, encoded, ok := bytes.Cut(data[len(prefix):], []byte(":"))
+	if !ok {
+		return nil, errors.New("malformed encrypted value")
+	}
+	aead, ok := k.aeads[string(keyID)]
+	if !ok {
+		return nil, fmt.Errorf("value is encrypted with unknown key %s", keyID)
+	}
+
+	sealed, err := base64.StdEncoding.AppendDecode(nil, encoded)
+	if err != nil {
+		return nil, fmt.Errorf("malformed encrypted value: %w", err)
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("malformed encrypted value")
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, keyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt value: %w", err)
+	}
+	return plaintext, nil
+}
+
+// NeedsRotation reports whether a stored value is plaintext or encrypted with a
+// key other than the active one
+func (k *Keyring) NeedsRotation(data []byte) bool {
+	if len(data) == 0 {
+		return false
+	}
+	return KeyID(data) != k.activeID
+}
+
+// SearchToken returns the blinded index token for a normalized search term
+func (k *Keyring) SearchToken(term string) string {
+	mac := hmac.New(sha256.New, k.indexKey)
+	mac.Write([]byte(term))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// IsEncrypted reports whether data carries the encryption prefix
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(prefix))
+}
+
+// KeyID returns the ID of the key data was encrypted with, or "" for plaintext
+func KeyID(data []byte) string {
+	if !IsEncrypted(data) {
+		return ""
+	}
+	keyID, _, _ := bytes.Cut(data[len(prefix):], []byte(":"))
+	return string(keyID)
+}
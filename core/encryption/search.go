@@ -0,0 +1,29 @@
+package encryption
+
+import (
+	"strings"
+	"unicode"
+)
+
+// maxSearchTerms caps how many distinct terms are indexed per value
+const maxSearchTerms = 512
+
+// SearchTerms splits text into the distinct lower-case words used by the
+// search index. Words shorter than two characters are skipped.
+func SearchTerms(text string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	}) {
+		if len([]rune(word)) < 2 || seen[word] {
+			continue
+		}
+		seen[word] = true
+		terms = append(terms, word)
+		if len(terms) == maxSearchTerms {
+			break
+		}
+	}
+	return terms
+}
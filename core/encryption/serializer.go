@@ -0,0 +1,121 @@
+package encryption
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm/schema"
+)
+
+func init() {
+	schema.RegisterSerializer("encrypted", Serializer{})
+	schema.RegisterSerializer("encryptedjson", JSONSerializer{})
+}
+
+// Serializer encrypts string and []byte fields with the installed keyring.
+// Use it with `gorm:"serializer:encrypted"`.
+type Serializer struct{}
+
+// Scan implements schema.SerializerInterface
+func (Serializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	data, err := decryptDBValue(dbValue)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", field.DBName, err)
+	}
+
+	fieldValue := reflect.New(field.FieldType).Elem()
+	switch field.FieldType.Kind() {
+	case reflect.String:
+		fieldValue.SetString(string(data))
+	case reflect.Slice:
+		if data != nil {
+			fieldValue.SetBytes(data)
+		}
+	default:
+		return fmt.Errorf("encrypted serializer does not support %s", field.FieldType)
+	}
+	field.ReflectValueOf(ctx, dst).Set(fieldValue)
+	return nil
+}
+
+// Value implements schema.SerializerValuerInterface
+func (Serializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	switch v := fieldValue.(type) {
+	case string:
+		if v == "" || Active() == nil {
+			return v, nil
+		}
+		data, err := Active().Encrypt([]byte(v))
+		return string(data), err
+	case []byte:
+		if len(v) == 0 || Active() == nil {
+			return v, nil
+		}
+		return Active().Encrypt(v)
+	default:
+		return nil, fmt.Errorf("encrypted serializer does not support %T", fieldValue)
+	}
+}
+
+// JSONSerializer stores a field as JSON and encrypts it with the installed keyring.
+// Use it with `gorm:"serializer:encryptedjson"` on TEXT columns.
+type JSONSerializer struct{}
+
+// Scan implements schema.SerializerInterface
+func (JSONSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	data, err := decryptDBValue(dbValue)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", field.DBName, err)
+	}
+
+	fieldValue := reflect.New(field.FieldType)
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, fieldValue.Interface()); err != nil {
+			return fmt.Errorf("failed to decode %s: %w", field.DBName, err)
+		}
+	}
+	field.ReflectValueOf(ctx, dst).Set(fieldValue.Elem())
+	return nil
+}
+
+// Value implements schema.SerializerValuerInterface
+func (JSONSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	data, err := json.Marshal(fieldValue)
+	if err != nil {
+		return nil, err
+	}
+	if string(data) == "null" {
+		return nil, nil
+	}
+	if Active() == nil {
+		return string(data), nil
+	}
+	sealed, err := Active().Encrypt(data)
+	return string(sealed), err
+}
+
+// decryptDBValue normalizes a column value to bytes and decrypts it if needed
+func decryptDBValue(dbValue interface{}) ([]byte, error) {
+	var data []byte
+	switch v := dbValue.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return nil, fmt.Errorf("unsupported column type %T", dbValue)
+	}
+
+	if !IsEncrypted(data) {
+		return data, nil
+	}
+	k := Active()
+	if k == nil {
+		return nil, ErrNoKey
+	}
+	return k.Decrypt(data)
+}
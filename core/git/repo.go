@@ -0,0 +1,238 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EmptyTreeHash is the object ID of git's empty tree, used as the base of
+// repositories without any commit
+const EmptyTreeHash = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// MaxDiffBytes caps the size of a captured diff
+const MaxDiffBytes = 1 << 20
+
+// Repo wraps the git CLI for a working directory
+type Repo struct {
+	Dir string // Repository top-level directory
+}
+
+// Commit represents a commit in the repository history
+type Commit struct {
+	Hash    string    `json:"hash"`
+	Author  string    `json:"author"`
+	Subject string    `json:"subject"`
+	Time    time.Time `json:"time"`
+}
+
+// Open opens the repository containing dir
+func Open(ctx context.Context, dir string) (*Repo, error) {
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "rev-parse", "--show-toplevel")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a git repository: %w", dir, err)
+	}
+
+	return &Repo{Dir: strings.TrimSpace(string(output))}, nil
+}
+
+// Head returns the current HEAD commit, or an empty string for a repository without commits
+func (r *Repo) Head(ctx context.Context) (string, error) {
+	output, err := r.run(ctx, nil, "rev-parse", "--verify", "--quiet", "HEAD")
+	if err != nil {
+		// No commits yet
+		return "", nil
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// Branch returns the checked out branch, or an empty string on a detached HEAD
+func (r *Repo) Branch(ctx context.Context) (string, error) {
+	output, err := r.run(ctx, nil, "symbolic-ref", "--quiet", "--short", "HEAD")
+	if err != nil {
+		// Detached HEAD
+		return "", nil
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// HasCommit reports whether the repository contains a commit
+func (r *Repo) HasCommit(ctx context.Context, hash string) bool {
+	_, err := r.run(ctx, nil, "cat-file", "-e", hash+"^{commit}")
+	return err == nil
+}
+
+// SnapshotTree writes the working tree, including untracked files that are
+// not ignored, as a tree object and returns its hash. The real index is left
+// untouched by staging into a temporary index file.
+func (r *Repo) SnapshotTree(ctx context.Context) (string, error) {
+	indexFile, err := os.CreateTemp("", "anywhere-index-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary index: %w", err)
+	}
+	indexPath := indexFile.Name()
+	indexFile.Close()
+	os.Remove(indexPath) // git creates the index itself
+	defer os.Remove(indexPath)
+
+	env := []string{"GIT_INDEX_FILE=" + indexPath}
+
+	head, err := r.Head(ctx)
+	if err != nil {
+		return "", err
+	}
+	if head != "" {
+		if _, err := r.run(ctx, env, "read-tree", head); err != nil {
+			return "", err
+		}
+	}
+
+	if _, err := r.run(ctx, env, "add", "-A"); err != nil {
+		return "", err
+	}
+
+	output, err := r.run(ctx, env, "write-tree")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// CommitTree records tree as a commit with an optional parent and returns its
+// hash. The commit is not put on any branch.
+func (r *Repo) CommitTree(ctx context.Context, tree, parent, message string) (string, error) {
+	args := []string{"commit-tree", tree, "-m", message}
+	if parent != "" {
+		args = append(args, "-p", parent)
+	}
+	env := []string{
+		"GIT_AUTHOR_NAME=anywhere", "GIT_AUTHOR_EMAIL=anywhere@localhost",
+		"GIT_COMMITTER_NAME=anywhere", "GIT_COMMITTER_EMAIL=anywhere@localhost",
+	}
+
+	output, err := r.run(ctx, env, args...)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// UpdateRef points ref at hash, keeping the object from garbage collection
+func (r *Repo) UpdateRef(ctx context.Context, ref, hash string) error {
+	_, err := r.run(ctx, nil, "update-ref", ref, hash)
+	return err
+}
+
+// DeleteRef deletes ref
+func (r *Repo) DeleteRef(ctx context.Context, ref string) error {
+	_, err := r.run(ctx, nil, "update-ref", "-d", ref)
+	return err
+}
+
+// RestoreSnapshot moves the working tree from the snapshot current to the
+// snapshot target, both as taken by SnapshotTree, and moves the checked out
+// branch to head with a soft reset. Files added since target are removed and
+// ignored files are left alone. The index ends up matching head, so restored
+// changes show as unstaged.
+func (r *Repo) RestoreSnapshot(ctx context.Context, current, target, head string) error {
+	if head != "" {
+		if _, err := r.run(ctx, nil, "reset", "-q", "--soft", head); err != nil {
+			return err
+		}
+	}
+
+	if _, err := r.run(ctx, nil, "read-tree", current); err != nil {
+		return err
+	}
+	// The working tree matches current; record that so the merge may update it
+	if _, err := r.run(ctx, nil, "update-index", "-q", "--refresh"); err != nil {
+		return err
+	}
+	if _, err := r.run(ctx, nil, "read-tree", "-u", "-m", current, target); err != nil {
+		return err
+	}
+
+	if head == "" {
+		// No commits yet: leave everything untracked
+		_, err := r.run(ctx, nil, "read-tree", "--empty")
+		return err
+	}
+	_, err := r.run(ctx, nil, "reset", "-q")
+	return err
+}
+
+// Diff returns the diff between two tree-ish objects, truncated to MaxDiffBytes
+func (r *Repo) Diff(ctx context.Context, from, to string) (string, error) {
+	if from == "" {
+		from = EmptyTreeHash
+	}
+
+	output, err := r.run(ctx, nil, "diff", "--no-color", "--no-ext-diff", from, to)
+	if err != nil {
+		return "", err
+	}
+
+	if len(output) > MaxDiffBytes {
+		output = output[:MaxDiffBytes] + "\n... diff truncated ...\n"
+	}
+	return output, nil
+}
+
+// CommitsBetween lists commits reachable from to but not from from, newest first
+func (r *Repo) CommitsBetween(ctx context.Context, from, to string) ([]Commit, error) {
+	if to == "" || from == to {
+		return []Commit{}, nil
+	}
+
+	revRange := to
+	if from != "" {
+		revRange = from + ".." + to
+	}
+
+	output, err := r.run(ctx, nil, "log", "--format=%H%x00%an%x00%ct%x00%s", revRange)
+	if err != nil {
+		return nil, err
+	}
+
+	commits := []Commit{}
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		fields := strings.SplitN(line, "\x00", 4)
+		if len(fields) != 4 {
+			continue
+		}
+
+		unix, _ := strconv.ParseInt(fields[2], 10, 64)
+		commits = append(commits, Commit{
+			Hash:    fields[0],
+			Author:  fields[1],
+			Time:    time.Unix(unix, 0),
+			Subject: fields[3],
+		})
+	}
+
+	return commits, nil
+}
+
+// run runs a git command in the repository and returns its stdout
+func (r *Repo) run(ctx context.Context, env []string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", r.Dir}, args...)...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.String(), nil
+}
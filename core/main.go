@@ -1,14 +1,24 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	
+	"github.com/majiayu000/anywhere-ai/core/auth"
 	"github.com/majiayu000/anywhere-ai/core/database"
+	"github.com/majiayu000/anywhere-ai/core/deviceauth"
+	"github.com/majiayu000/anywhere-ai/core/redact"
 	"github.com/majiayu000/anywhere-ai/core/services"
+	"github.com/majiayu000/anywhere-ai/core/terminal"
 	"github.com/majiayu000/anywhere-ai/core/tmux"
 )
 
@@ -22,25 +32,48 @@ func main() {
 	// Initialize Gin router
 	router := gin.Default()
 
-	// CORS middleware
-	router.Use(func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
+	// Browsers may only call the API from this server's own origin and from
+	// ANYWHERE_ALLOWED_ORIGINS, a comma separated list
+	origins := auth.NewOriginPolicy(auth.ParseOrigins(os.Getenv("ANYWHERE_ALLOWED_ORIGINS")))
+	router.Use(origins.Middleware())
+
+	// Authentication: every route but login and the web interface needs a token
+	// issued at login, or a scoped API key. Tokens are signed with ANYWHERE_JWT_SECRET, or a secret
+	// generated on first run. ANYWHERE_OWNER_EMAIL and ANYWHERE_OWNER_PASSWORD
+	// enable password login, and auth.ProvidersFromEnv configures OAuth login.
+	// Only the owner and ANYWHERE_ALLOWED_EMAILS, a comma separated list of
+	// addresses and @domains, may sign in with OAuth.
+	// ANYWHERE_AUTH=off turns authentication off, for development only.
+	jwtSecret := os.Getenv("ANYWHERE_JWT_SECRET")
+	if jwtSecret == "" {
+		if jwtSecret, err = auth.LoadOrCreateSecret(filepath.Join(database.DataDir, "jwt_secret")); err != nil {
+			log.Fatalf("Failed to load JWT secret: %v", err)
 		}
-		
-		c.Next()
-	})
+	}
+	users := database.NewUserRepository(db)
+	authService := services.NewAuthService(auth.NewJWTManager(auth.DefaultJWTConfig(jwtSecret)), users, database.NewAPIKeyRepository(db))
+	providers, err := auth.ProvidersFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to configure OAuth login: %v", err)
+	}
+	authService.SetProviders(providers)
+	authService.SetAllowlist(auth.NewAllowlist(auth.ParseAllowlist(os.Getenv("ANYWHERE_ALLOWED_EMAILS"))))
+	authService.SetOwnerLogin(os.Getenv("ANYWHERE_OWNER_EMAIL"), os.Getenv("ANYWHERE_OWNER_PASSWORD"))
+	authService.SetSecureCookies(strings.HasPrefix(os.Getenv("ANYWHERE_PUBLIC_URL"), "https://"))
+	if os.Getenv("ANYWHERE_AUTH") == "off" {
+		log.Printf("⚠️  Authentication is off: anyone who can reach this server can control its sessions")
+		authService.Disable()
+	}
+	authService.AllowAnonymous("/health", "/", "/chat", "/simple", "/share", "/static/*filepath")
+	router.Use(authService.AuthRequired())
+	authAPIService := services.NewAuthAPIService(authService)
 
 	// Serve static files (web interface)
 	router.Static("/static", "../web")
 	router.StaticFile("/", "../web/index.html")
 	router.StaticFile("/chat", "../web/chat.html")
 	router.StaticFile("/simple", "../web/simple-chat.html")
+	router.StaticFile("/share", "../web/share.html")
 
 	// Health check endpoint
 	router.GET("/health", func(c *gin.Context) {
@@ -51,28 +84,240 @@ func main() {
 		})
 	})
 
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+
 	// Initialize core managers
 	tmuxManager := tmux.NewManager()
 
+	// Secret redaction; ANYWHERE_REDACTION_CONFIG points to a JSON config with extra patterns
+	redactionConfig, err := redact.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load redaction config: %v", err)
+	}
+	redactor, err := redact.New(redactionConfig)
+	if err != nil {
+		log.Fatalf("Failed to create redactor: %v", err)
+	}
+	redactionService := services.NewRedactionService(db, redactor, redactionConfig.RetainUnredacted)
+
 	// Initialize services
+	sessionStore := database.NewSessionRepository(db)
+	sessionStore.SetRedactor(redactor)
 	messageService := services.NewMessageService(db)
+	messageService.SetRedactionService(redactionService)
 	wsService := services.NewTerminalWebSocketService(tmuxManager, messageService)
+	wsService.SetRedactionService(redactionService)
+	wsService.SetOriginPolicy(origins)
+	attachmentStore := services.NewAttachmentStore(db, filepath.Join(database.DataDir, "attachments"))
+	inputQueue := services.NewInputQueue(tmuxManager, messageService, attachmentStore, wsService)
+	wsService.SetInputQueue(inputQueue)
+	if err := inputQueue.Restore(context.Background()); err != nil {
+		log.Printf("Failed to restore queued input: %v", err)
+	}
+	gitTracker := services.NewGitTracker(db, tmuxManager, wsService)
+	gitTracker.SetRedactionService(redactionService)
 	claudeMonitor := services.NewClaudeMonitor(tmuxManager, messageService, wsService)
+	claudeMonitor.SetGitTracker(gitTracker)
 	jsonlMonitor := services.NewJSONLMonitor(messageService, wsService)
-	apiService := services.NewTerminalAPIService(tmuxManager, wsService, claudeMonitor, jsonlMonitor, messageService)
+	jsonlMonitor.SetInputQueue(inputQueue)
+	jsonlMonitor.SetGitTracker(gitTracker)
+
+	// Token usage accounting; ANYWHERE_PRICE_TABLE points to a JSON price table
+	prices := services.DefaultPriceTable
+	if path := os.Getenv("ANYWHERE_PRICE_TABLE"); path != "" {
+		if prices, err = services.LoadPriceTable(path); err != nil {
+			log.Fatalf("Failed to load price table: %v", err)
+		}
+	}
+	usageTracker := services.NewUsageTracker(db, tmuxManager, wsService, prices)
+	jsonlMonitor.SetUsageTracker(usageTracker)
+	usageAPIService := services.NewUsageAPIService(usageTracker)
+	// Move rows written before encryption was enabled, or under rotated keys, to the active key
+	reencryptor := services.NewReencryptor(db)
+	if err := reencryptor.Start(); err != nil && !errors.Is(err, services.ErrEncryptionDisabled) {
+		log.Printf("Failed to start re-encryption: %v", err)
+	}
+	encryptionAPIService := services.NewEncryptionAPIService(reencryptor)
+	redactionAPIService := services.NewRedactionAPIService(redactionService)
+	apiService := services.NewTerminalAPIService(tmuxManager, wsService, claudeMonitor, jsonlMonitor, messageService, inputQueue, gitTracker, attachmentStore, sessionStore)
+
+	// Device identity and pairing across networks mDNS does not reach. Devices
+	// talk to each other over mutual TLS on ANYWHERE_PEER_PORT, presenting the
+	// certificate generated on first run; ANYWHERE_PEER_URL is how peers reach
+	// it. ANYWHERE_PEERS lists peer URLs, optionally as device_id=URL.
+	//
+	// Federation: a device with ANYWHERE_HUB set to a paired hub (device ID or
+	// URL) runs as its agent, dialing out to it and serving the peer API through
+	// that tunnel; it only listens for peers when ANYWHERE_PEER_PORT is set.
+	hubTarget := os.Getenv("ANYWHERE_HUB")
+	deviceID, deviceName := terminal.LocalDevice()
+	identity, err := deviceauth.LoadOrCreate(filepath.Join(database.DataDir, "device"), deviceID)
+	if err != nil {
+		log.Fatalf("Failed to load device certificate: %v", err)
+	}
+	peers, err := terminal.ParseStaticPeers(os.Getenv("ANYWHERE_PEERS"))
+	if err != nil {
+		log.Fatalf("Failed to parse ANYWHERE_PEERS: %v", err)
+	}
+	peerPort := os.Getenv("ANYWHERE_PEER_PORT")
+	listenForPeers := peerPort != "" || hubTarget == ""
+	if peerPort == "" {
+		peerPort = "8443"
+	}
+	peerURL := os.Getenv("ANYWHERE_PEER_URL")
+	if peerURL == "" {
+		hostname, _ := os.Hostname()
+		peerURL = "https://" + hostname + ":" + peerPort
+	}
+	deviceStore := database.NewDeviceRepository(db)
+	deviceClients := services.NewDeviceClients(deviceStore, identity)
+	pairingService := services.NewPairingService(db, deviceStore, identity, peerURL)
+	discovery := terminal.NewPeerDiscoveryService(deviceID, deviceName, runtime.GOOS, peers, deviceStore)
+	discovery.SetIdentity(identity)
+	discovery.Announce(terminal.DeviceInfo{ID: deviceID, Name: deviceName, Type: runtime.GOOS}, nil)
+	defer discovery.Close()
+	deviceAPIService := services.NewDeviceAPIService(pairingService, discovery, tmuxManager)
+
+	// Sessions of paired devices, and of agents connected to this device as
+	// their hub, are listed and driven through this server
+	hubService := services.NewHubService()
+	defer hubService.Close()
+	deviceClients.SetHubService(hubService)
+	discovery.SetDialer(deviceClients.DialDevice)
+	deviceAPIService.SetHubService(hubService)
+	hubAPIService := services.NewHubAPIService(hubService)
+	remoteSessions := services.NewRemoteSessionService(deviceStore, deviceClients, tmuxManager)
+	hubService.SetRemoteSessionService(remoteSessions)
+	apiService.SetRemoteSessionService(remoteSessions)
+	wsService.SetRemoteSessionService(remoteSessions)
+
+	// Session migration between hosts; ANYWHERE_DEVICE_ID tells hosts apart
+	launcher := services.NewToolLauncher(tmuxManager, claudeMonitor, jsonlMonitor)
+	migrationService := services.NewMigrationService(db, tmuxManager, sessionStore, launcher, jsonlMonitor, inputQueue, gitTracker, wsService, deviceClients)
+	apiService.SetMigrationService(migrationService)
+	wsService.SetMigrationService(migrationService)
+	migrationAPIService := services.NewMigrationAPIService(migrationService)
+
+	// Ownership leases: this device renews the leases of the sessions it runs and
+	// may take over sessions whose lease expired. ANYWHERE_LEASE_TTL sets how
+	// long a lease outlives its last heartbeat.
+	if v := os.Getenv("ANYWHERE_LEASE_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil || ttl <= 0 {
+			log.Fatalf("Invalid ANYWHERE_LEASE_TTL %q", v)
+		}
+		sessionStore.SetLeaseTTL(ttl)
+	}
+	leaseService := services.NewLeaseService(sessionStore, tmuxManager, launcher, wsService)
+	leaseService.SetGitTracker(gitTracker)
+	leaseService.SetInputQueue(inputQueue)
+	leaseService.Start()
+	defer leaseService.Close()
+	apiService.SetLeaseService(leaseService)
+	wsService.SetLeaseService(leaseService)
+	leaseAPIService := services.NewLeaseAPIService(leaseService)
+
+	// Checkpoints; ANYWHERE_CHECKPOINT_TURNS and ANYWHERE_CHECKPOINT_ON_PERMISSION pick the triggers
+	checkpointConfig, err := services.CheckpointConfigFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to load checkpoint config: %v", err)
+	}
+	checkpointService := services.NewCheckpointService(db, tmuxManager, sessionStore, launcher, jsonlMonitor, inputQueue, wsService, checkpointConfig)
+	claudeMonitor.SetCheckpointService(checkpointService)
+	jsonlMonitor.SetCheckpointService(checkpointService)
+	apiService.SetCheckpointService(checkpointService)
+	wsService.SetCheckpointService(checkpointService)
+	checkpointAPIService := services.NewCheckpointAPIService(checkpointService)
+	checkpointAPIService.SetMigrationService(migrationService)
+
+	// Sessions belong to the user who started them, who may share them with
+	// others. Sessions started without a user belong to the owner, ANYWHERE_OWNER_EMAIL.
+	shares := database.NewShareRepository(db)
+	sessionAccess := services.NewSessionAccessService(sessionStore, shares, users)
+	sessionAccess.SetAdmin(os.Getenv("ANYWHERE_OWNER_EMAIL"))
+	apiService.SetSessionAccess(sessionAccess)
+	wsService.SetSessionAccess(sessionAccess)
+	redactionAPIService.SetSessionAccess(sessionAccess)
+	migrationAPIService.SetSessionAccess(sessionAccess)
+	usageAPIService.SetSessionAccess(sessionAccess)
+	deviceAPIService.SetSessionAccess(sessionAccess)
+	encryptionAPIService.SetSessionAccess(sessionAccess)
+	hubAPIService.SetSessionAccess(sessionAccess)
+	sessionAccessAPIService := services.NewSessionAccessAPIService(sessionAccess)
+	router.Use(sessionAccess.Authorize())
+
+	// Expiring read-only links to watch a session without an account
+	shareLinkAPIService := services.NewShareLinkAPIService(services.NewShareLinkService(shares, sessionStore, wsService), authService)
+	shareLinkAPIService.SetPublicURL(os.Getenv("ANYWHERE_PUBLIC_URL"))
+
+	// Scripts and agents outside tmux report to their user through the SDK
+	agentMessageService := services.NewAgentMessageService(database.NewAgentRepository(db), messageService, wsService)
+	agentMessageService.SetSessionAccess(sessionAccess)
+	agentMessageAPIService := services.NewAgentMessageAPIService(agentMessageService)
+	agentMessageAPIService.SetSessionAccess(sessionAccess)
+
+	// Push notifications go through a gateway that talks to APNs and FCM
+	var notifierAPIService *services.NotifierAPIService
+	if gatewayURL := os.Getenv("ANYWHERE_PUSH_GATEWAY_URL"); gatewayURL != "" {
+		notifier := services.NewNotifier(db, services.NewWebhookPushSender(gatewayURL), wsService)
+		agentMessageService.SetNotifier(notifier)
+		notifierAPIService = services.NewNotifierAPIService(notifier)
+	}
 
 	// Register routes
+	authAPIService.RegisterRoutes(router)
 	apiService.RegisterRoutes(router)
+	usageAPIService.RegisterRoutes(router)
+	encryptionAPIService.RegisterRoutes(router)
+	redactionAPIService.RegisterRoutes(router)
+	migrationAPIService.RegisterRoutes(router)
+	leaseAPIService.RegisterRoutes(router)
+	checkpointAPIService.RegisterRoutes(router)
+	deviceAPIService.RegisterRoutes(router)
+	hubAPIService.RegisterRoutes(router)
+	sessionAccessAPIService.RegisterRoutes(router)
+	shareLinkAPIService.RegisterRoutes(router)
+	agentMessageAPIService.RegisterRoutes(router)
+	if notifierAPIService != nil {
+		notifierAPIService.RegisterRoutes(router)
+	}
 	
 	// WebSocket endpoint
 	router.GET("/api/v1/ws", wsService.HandleWebSocket)
 
-	// Start server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	// Inter-device endpoints, only on the mutual TLS listener
+	peerRouter := gin.New()
+	peerRouter.Use(gin.Logger(), gin.Recovery())
+	deviceAPIService.RegisterPeerRoutes(peerRouter)
+	peerAPI := peerRouter.Group("", services.RequirePairedDevice(deviceStore), sessionAccess.Authorize())
+	migrationAPIService.RegisterPeerRoutes(peerAPI)
+	apiService.RegisterPeerRoutes(peerAPI)
+	peerAPI.GET("/api/v1/ws", wsService.HandleWebSocket)
+	hubAPIService.RegisterPeerRoutes(peerAPI)
+	if listenForPeers {
+		peerServer := &http.Server{
+			Addr:      ":" + peerPort,
+			Handler:   peerRouter,
+			TLSConfig: identity.ServerTLSConfig(),
+		}
+		go func() {
+			log.Printf("🔐 Peer API (mutual TLS): %s, certificate %s", peerURL, identity.Fingerprint)
+			if err := peerServer.ListenAndServeTLS("", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Printf("Peer API stopped: %v", err)
+			}
+		}()
+	}
+	if hubTarget != "" {
+		hubAgent := services.NewHubAgent(hubTarget, deviceClients, identity, peerRouter)
+		hubAgent.Start()
+		defer hubAgent.Close()
+		log.Printf("🛰️  Agent of hub %s, certificate %s", hubTarget, identity.Fingerprint)
 	}
 
+	// Start server
 	log.Printf("🚀 Anywhere Core server starting on port %s", port)
 	log.Printf("💻 Terminal API: http://localhost:%s/api/v1/terminal", port)
 	log.Printf("🔗 WebSocket: ws://localhost:%s/api/v1/ws", port)
@@ -0,0 +1,467 @@
+// Package migrations applies the versioned database schema for SQLite and PostgreSQL.
+//
+// Migrations live in one directory per dialect and are named
+// NNNN_description.up.sql / NNNN_description.down.sql. Applied versions are
+// recorded in the schema_version table.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	_ "github.com/lib/pq"           // PostgreSQL driver
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
+)
+
+// Dialect is a supported SQL dialect
+type Dialect string
+
+const (
+	SQLite   Dialect = "sqlite"
+	Postgres Dialect = "postgres"
+)
+
+// versionTable records applied migrations
+const versionTable = "schema_version"
+
+//go:embed sqlite/*.sql postgres/*.sql
+var files embed.FS
+
+var fileNamePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// ErrUnmanagedSchema is returned when a database has tables but no schema_version table
+var ErrUnmanagedSchema = errors.New("database has tables that were not created by migrations")
+
+// ErrUnknownSchema is returned when a database has migrations this build does not know
+var ErrUnknownSchema = errors.New("database schema is newer than this build")
+
+// Migration is a single schema change
+type Migration struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	Up      string `json:"-"`
+	Down    string `json:"-"`
+}
+
+// AppliedMigration is a migration recorded in schema_version
+type AppliedMigration struct {
+	Version   int       `json:"version"`
+	Name      string    `json:"name"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+// Status describes the schema state of a database
+type Status struct {
+	Dialect        Dialect            `json:"dialect"`
+	CurrentVersion int                `json:"current_version"`
+	LatestVersion  int                `json:"latest_version"`
+	Applied        []AppliedMigration `json:"applied"`
+	Pending        []Migration        `json:"pending"`
+}
+
+// Runner applies migrations of one dialect to a database
+type Runner struct {
+	db         *sql.DB
+	dialect    Dialect
+	migrations []Migration
+}
+
+// NewRunner creates a runner for the migrations of a dialect
+func NewRunner(db *sql.DB, dialect Dialect) (*Runner, error) {
+	migrations, err := Load(dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Runner{
+		db:         db,
+		dialect:    dialect,
+		migrations: migrations,
+	}, nil
+}
+
+// Migrate checks that a database is managed by known migrations and applies
+// any pending ones. It is run on startup.
+func Migrate(ctx context.Context, db *sql.DB, dialect Dialect) error {
+	runner, err := NewRunner(db, dialect)
+	if err != nil {
+		return err
+	}
+
+	applied, err := runner.Up(ctx, 0)
+	if err != nil {
+		return err
+	}
+	for _, migration := range applied {
+		log.Printf("Applied migration %04d_%s", migration.Version, migration.Name)
+	}
+
+	return nil
+}
+
+// Open opens a database of a dialect; dsn is a file path for SQLite
+// and a connection string for PostgreSQL
+func Open(dialect Dialect, dsn string) (*sql.DB, error) {
+	var driver string
+	switch dialect {
+	case SQLite:
+		driver = "sqlite3"
+	case Postgres:
+		driver = "postgres"
+	default:
+		return nil, fmt.Errorf("unsupported dialect %q", dialect)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	return db, nil
+}
+
+// Load reads the embedded migrations of a dialect, ordered by version
+func Load(dialect Dialect) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, string(dialect))
+	if err != nil {
+		return nil, fmt.Errorf("unsupported dialect %q: %w", dialect, err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name: %s", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		content, err := fs.ReadFile(files, string(dialect)+"/"+entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		migration, exists := byVersion[version]
+		if !exists {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has conflicting names %s and %s", version, migration.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both up and down files", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Check refuses databases whose schema was not created by these migrations
+func (r *Runner) Check(ctx context.Context) error {
+	managed, err := r.tableExists(ctx, versionTable)
+	if err != nil {
+		return err
+	}
+
+	if !managed {
+		tables, err := r.countTables(ctx)
+		if err != nil {
+			return err
+		}
+		if tables > 0 {
+			return fmt.Errorf("%w; back it up and run `migrate force <version>` once it matches a known version", ErrUnmanagedSchema)
+		}
+		return nil
+	}
+
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return err
+	}
+
+	known := make(map[int]bool, len(r.migrations))
+	for _, migration := range r.migrations {
+		known[migration.Version] = true
+	}
+	for _, migration := range applied {
+		if !known[migration.Version] {
+			return fmt.Errorf("%w: version %d (%s) is not known, latest is %d",
+				ErrUnknownSchema, migration.Version, migration.Name, r.latestVersion())
+		}
+	}
+
+	return nil
+}
+
+// Status reports the applied and pending migrations
+func (r *Runner) Status(ctx context.Context) (*Status, error) {
+	status := &Status{
+		Dialect:       r.dialect,
+		LatestVersion: r.latestVersion(),
+		Applied:       []AppliedMigration{},
+		Pending:       []Migration{},
+	}
+
+	managed, err := r.tableExists(ctx, versionTable)
+	if err != nil {
+		return nil, err
+	}
+	if managed {
+		if status.Applied, err = r.applied(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	done := make(map[int]bool, len(status.Applied))
+	for _, migration := range status.Applied {
+		done[migration.Version] = true
+		if migration.Version > status.CurrentVersion {
+			status.CurrentVersion = migration.Version
+		}
+	}
+	for _, migration := range r.migrations {
+		if !done[migration.Version] {
+			status.Pending = append(status.Pending, migration)
+		}
+	}
+
+	return status, nil
+}
+
+// Up applies pending migrations up to and including target, or all when target is 0
+func (r *Runner) Up(ctx context.Context, target int) ([]Migration, error) {
+	if err := r.Check(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := r.ensureVersionTable(ctx); err != nil {
+		return nil, err
+	}
+
+	status, err := r.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, migration := range status.Pending {
+		if target > 0 && migration.Version > target {
+			break
+		}
+
+		err := r.inTx(ctx, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, migration.Up); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, r.rebind("INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)"),
+				migration.Version, migration.Name, time.Now().UTC())
+			return err
+		})
+		if err != nil {
+			return applied, fmt.Errorf("failed to apply migration %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+		applied = append(applied, migration)
+	}
+
+	return applied, nil
+}
+
+// Down rolls back the given number of most recently applied migrations
+func (r *Runner) Down(ctx context.Context, steps int) ([]Migration, error) {
+	if err := r.Check(ctx); err != nil {
+		return nil, err
+	}
+
+	status, err := r.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]Migration, len(r.migrations))
+	for _, migration := range r.migrations {
+		byVersion[migration.Version] = migration
+	}
+
+	var reverted []Migration
+	for i := len(status.Applied) - 1; i >= 0 && len(reverted) < steps; i-- {
+		migration := byVersion[status.Applied[i].Version]
+
+		err := r.inTx(ctx, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, migration.Down); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, r.rebind("DELETE FROM schema_version WHERE version = ?"), migration.Version)
+			return err
+		})
+		if err != nil {
+			return reverted, fmt.Errorf("failed to revert migration %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+		reverted = append(reverted, migration)
+	}
+
+	return reverted, nil
+}
+
+// Force records the schema as being at a version without running any
+// migration, for adopting databases created before migrations existed
+func (r *Runner) Force(ctx context.Context, version int) error {
+	if version < 0 || version > r.latestVersion() {
+		return fmt.Errorf("unknown version %d, latest is %d", version, r.latestVersion())
+	}
+
+	if err := r.ensureVersionTable(ctx); err != nil {
+		return err
+	}
+
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM schema_version"); err != nil {
+			return err
+		}
+		for _, migration := range r.migrations {
+			if migration.Version > version {
+				break
+			}
+			if _, err := tx.ExecContext(ctx, r.rebind("INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)"),
+				migration.Version, migration.Name, time.Now().UTC()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// applied lists the migrations recorded in schema_version, oldest first
+func (r *Runner) applied(ctx context.Context) ([]AppliedMigration, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT version, name, applied_at FROM schema_version ORDER BY version")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	defer rows.Close()
+
+	applied := []AppliedMigration{}
+	for rows.Next() {
+		var migration AppliedMigration
+		if err := rows.Scan(&migration.Version, &migration.Name, &migration.AppliedAt); err != nil {
+			return nil, fmt.Errorf("failed to read schema version: %w", err)
+		}
+		applied = append(applied, migration)
+	}
+
+	return applied, rows.Err()
+}
+
+// ensureVersionTable creates the schema_version table if needed
+func (r *Runner) ensureVersionTable(ctx context.Context) error {
+	_, err := r.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema version table: %w", err)
+	}
+	return nil
+}
+
+// tableExists reports whether a table exists
+func (r *Runner) tableExists(ctx context.Context, name string) (bool, error) {
+	var query string
+	switch r.dialect {
+	case SQLite:
+		query = "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?"
+	case Postgres:
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = $1"
+	}
+
+	var count int
+	if err := r.db.QueryRowContext(ctx, query, name).Scan(&count); err != nil {
+		return false, fmt.Errorf("failed to inspect schema: %w", err)
+	}
+	return count > 0, nil
+}
+
+// countTables counts the user tables in the database
+func (r *Runner) countTables(ctx context.Context) (int, error) {
+	var query string
+	switch r.dialect {
+	case SQLite:
+		query = "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'"
+	case Postgres:
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema()"
+	}
+
+	var count int
+	if err := r.db.QueryRowContext(ctx, query).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to inspect schema: %w", err)
+	}
+	return count, nil
+}
+
+// inTx runs fn in a transaction; both dialects support transactional DDL
+func (r *Runner) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// rebind converts ? placeholders to the dialect's placeholder style
+func (r *Runner) rebind(query string) string {
+	if r.dialect != Postgres {
+		return query
+	}
+
+	result := make([]byte, 0, len(query)+8)
+	n := 0
+	for i := 0; i < len(query); i++ {
+		if query[i] == '?' {
+			n++
+			result = append(result, '$')
+			result = strconv.AppendInt(result, int64(n), 10)
+			continue
+		}
+		result = append(result, query[i])
+	}
+	return string(result)
+}
+
+// latestVersion returns the highest known migration version
+func (r *Runner) latestVersion() int {
+	if len(r.migrations) == 0 {
+		return 0
+	}
+	return r.migrations[len(r.migrations)-1].Version
+}
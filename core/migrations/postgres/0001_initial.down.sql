@@ -0,0 +1,18 @@
+DROP TABLE IF EXISTS session_budgets;
+DROP TABLE IF EXISTS token_usage;
+DROP TABLE IF EXISTS attachments;
+DROP TABLE IF EXISTS git_turn_snapshots;
+DROP TABLE IF EXISTS session_git_states;
+DROP TABLE IF EXISTS read_cursors;
+DROP TABLE IF EXISTS message_sessions;
+DROP TABLE IF EXISTS terminal_messages;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS session_logs;
+DROP TABLE IF EXISTS session_checkpoints;
+DROP TABLE IF EXISTS terminal_sessions;
+DROP TABLE IF EXISTS push_tokens;
+DROP TABLE IF EXISTS api_keys;
+DROP TABLE IF EXISTS messages;
+DROP TABLE IF EXISTS agent_instances;
+DROP TABLE IF EXISTS user_agents;
+DROP TABLE IF EXISTS users;
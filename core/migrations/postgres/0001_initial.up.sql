@@ -0,0 +1,251 @@
+-- Initial schema
+
+-- Users and agents (from Omnara)
+CREATE TABLE users (
+    id UUID PRIMARY KEY,
+    email VARCHAR(255) NOT NULL UNIQUE,
+    display_name TEXT,
+    created_at TIMESTAMP,
+    updated_at TIMESTAMP,
+    push_notifications_enabled BOOLEAN DEFAULT TRUE,
+    email_notifications_enabled BOOLEAN DEFAULT FALSE,
+    sms_notifications_enabled BOOLEAN DEFAULT FALSE,
+    phone_number TEXT,
+    notification_email TEXT
+);
+
+CREATE TABLE user_agents (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    webhook_url TEXT,
+    webhook_api_key TEXT,
+    is_active BOOLEAN DEFAULT TRUE,
+    is_deleted BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMP,
+    updated_at TIMESTAMP
+);
+
+CREATE TABLE agent_instances (
+    id UUID PRIMARY KEY,
+    user_agent_id UUID NOT NULL REFERENCES user_agents(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status VARCHAR(255) DEFAULT 'active',
+    started_at TIMESTAMP,
+    ended_at TIMESTAMP,
+    git_diff TEXT,
+    name VARCHAR(255),
+    last_read_message_id UUID
+);
+
+CREATE TABLE messages (
+    id UUID PRIMARY KEY,
+    agent_instance_id UUID NOT NULL REFERENCES agent_instances(id) ON DELETE CASCADE,
+    sender_type VARCHAR(255) NOT NULL,
+    content TEXT NOT NULL,
+    created_at TIMESTAMP,
+    requires_user_input BOOLEAN DEFAULT FALSE,
+    message_metadata JSONB
+);
+
+CREATE INDEX idx_messages_instance_created ON messages(agent_instance_id, created_at);
+
+CREATE TABLE api_keys (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    api_key_hash TEXT NOT NULL,
+    api_key TEXT,
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMP,
+    expires_at TIMESTAMP,
+    last_used_at TIMESTAMP
+);
+
+CREATE TABLE push_tokens (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token TEXT NOT NULL UNIQUE,
+    platform VARCHAR(255) NOT NULL,
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMP,
+    updated_at TIMESTAMP,
+    last_used_at TIMESTAMP
+);
+
+-- Persistent terminal sessions
+CREATE TABLE terminal_sessions (
+    id VARCHAR(255) PRIMARY KEY,
+    user_id VARCHAR(255),
+    name VARCHAR(255),
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    owner_device_id VARCHAR(255) NOT NULL,
+    owner_device_name VARCHAR(255),
+    current_device_id VARCHAR(255),
+    last_heartbeat TIMESTAMP,
+    command TEXT,
+    args JSONB,
+    environment JSONB,
+    working_dir TEXT,
+    buffer_content BYTEA,
+    cursor_row INTEGER,
+    cursor_col INTEGER,
+    scroll_offset INTEGER,
+    tool_name VARCHAR(255),
+    tool_state JSONB,
+    status VARCHAR(255) DEFAULT 'created',
+    tags JSONB,
+    metadata JSONB
+);
+
+CREATE INDEX idx_terminal_sessions_owner_device ON terminal_sessions(owner_device_id);
+CREATE INDEX idx_terminal_sessions_current_device ON terminal_sessions(current_device_id);
+CREATE INDEX idx_terminal_sessions_last_heartbeat ON terminal_sessions(last_heartbeat);
+CREATE INDEX idx_terminal_sessions_status ON terminal_sessions(status);
+
+CREATE TABLE session_checkpoints (
+    id VARCHAR(255) PRIMARY KEY,
+    session_id VARCHAR(255) NOT NULL REFERENCES terminal_sessions(id) ON DELETE CASCADE,
+    timestamp TIMESTAMP NOT NULL,
+    input_history JSONB,
+    output_history JSONB,
+    state_snapshot JSONB
+);
+
+CREATE INDEX idx_session_checkpoints_session ON session_checkpoints(session_id, timestamp);
+
+CREATE TABLE session_logs (
+    id SERIAL PRIMARY KEY,
+    session_id VARCHAR(255) NOT NULL REFERENCES terminal_sessions(id) ON DELETE CASCADE,
+    timestamp TIMESTAMP NOT NULL,
+    type VARCHAR(255),
+    content TEXT,
+    metadata JSONB
+);
+
+CREATE INDEX idx_session_logs_session ON session_logs(session_id, timestamp);
+
+-- Sessions started from the CLI
+CREATE TABLE sessions (
+    id VARCHAR(255) PRIMARY KEY,
+    tool VARCHAR(255) NOT NULL,
+    device_id VARCHAR(255) NOT NULL,
+    device_name VARCHAR(255) NOT NULL,
+    status VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    last_activity TIMESTAMP NOT NULL,
+    metadata TEXT
+);
+
+CREATE INDEX idx_sessions_device ON sessions(device_id);
+CREATE INDEX idx_sessions_status ON sessions(status);
+
+-- Terminal conversation messages
+CREATE TABLE terminal_messages (
+    id UUID PRIMARY KEY,
+    session_id VARCHAR(255) NOT NULL,
+    sender_type VARCHAR(10) NOT NULL,
+    content TEXT NOT NULL,
+    requires_user_input BOOLEAN DEFAULT FALSE,
+    metadata TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    git_diff TEXT,
+    delivery_status VARCHAR(20),
+    delivered_at TIMESTAMP
+);
+
+CREATE INDEX idx_terminal_messages_session_created ON terminal_messages(session_id, created_at);
+CREATE INDEX idx_terminal_messages_delivery_status ON terminal_messages(delivery_status);
+
+CREATE TABLE message_sessions (
+    id UUID PRIMARY KEY,
+    session_id VARCHAR(255) NOT NULL UNIQUE,
+    last_read_message_id UUID,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE read_cursors (
+    id UUID PRIMARY KEY,
+    session_id VARCHAR(255) NOT NULL,
+    user_id VARCHAR(255) NOT NULL,
+    device_id VARCHAR(255) NOT NULL,
+    last_read_message_id UUID,
+    last_read_at TIMESTAMP,
+    updated_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_read_cursors_reader ON read_cursors(session_id, user_id, device_id);
+CREATE INDEX idx_read_cursors_user_id ON read_cursors(user_id);
+
+-- Git tracking per agent turn
+CREATE TABLE session_git_states (
+    session_id VARCHAR(255) PRIMARY KEY,
+    repo_dir TEXT NOT NULL,
+    initial_git_hash VARCHAR(40),
+    initial_tree_hash VARCHAR(40),
+    last_git_hash VARCHAR(40),
+    last_tree_hash VARCHAR(40),
+    created_at TIMESTAMP,
+    updated_at TIMESTAMP
+);
+
+CREATE TABLE git_turn_snapshots (
+    id UUID PRIMARY KEY,
+    session_id VARCHAR(255) NOT NULL,
+    message_id UUID,
+    git_hash VARCHAR(40),
+    tree_hash VARCHAR(40),
+    turn_diff TEXT,
+    cumulative_diff TEXT,
+    new_commits TEXT,
+    created_at TIMESTAMP
+);
+
+CREATE INDEX idx_git_turn_snapshots_session_created ON git_turn_snapshots(session_id, created_at);
+
+-- Uploaded attachments
+CREATE TABLE attachments (
+    id UUID PRIMARY KEY,
+    session_id VARCHAR(255) NOT NULL,
+    message_id UUID,
+    file_name TEXT NOT NULL,
+    content_type VARCHAR(255) NOT NULL,
+    size BIGINT,
+    sha256 VARCHAR(64),
+    storage_path TEXT NOT NULL,
+    created_at TIMESTAMP
+);
+
+CREATE INDEX idx_attachments_session_id ON attachments(session_id);
+CREATE INDEX idx_attachments_message_id ON attachments(message_id);
+
+-- Token usage accounting
+CREATE TABLE token_usage (
+    id UUID PRIMARY KEY,
+    session_id VARCHAR(255) NOT NULL,
+    message_id UUID,
+    external_id VARCHAR(255),
+    tool VARCHAR(50),
+    model VARCHAR(100),
+    input_tokens BIGINT,
+    output_tokens BIGINT,
+    cache_creation_tokens BIGINT,
+    cache_read_tokens BIGINT,
+    cost DOUBLE PRECISION,
+    created_at TIMESTAMP
+);
+
+CREATE INDEX idx_token_usage_session_id ON token_usage(session_id);
+CREATE INDEX idx_token_usage_message_id ON token_usage(message_id);
+CREATE UNIQUE INDEX idx_token_usage_external_id ON token_usage(external_id);
+CREATE INDEX idx_token_usage_tool ON token_usage(tool);
+CREATE INDEX idx_token_usage_created_at ON token_usage(created_at);
+
+CREATE TABLE session_budgets (
+    session_id VARCHAR(255) PRIMARY KEY,
+    limit_usd DOUBLE PRECISION,
+    action VARCHAR(20),
+    exceeded_at TIMESTAMP,
+    updated_at TIMESTAMP
+);
@@ -0,0 +1,20 @@
+DROP INDEX IF EXISTS idx_terminal_sessions_updated;
+
+CREATE TABLE sessions (
+    id VARCHAR(255) PRIMARY KEY,
+    tool VARCHAR(255) NOT NULL,
+    device_id VARCHAR(255) NOT NULL,
+    device_name VARCHAR(255) NOT NULL,
+    status VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    last_activity TIMESTAMP NOT NULL,
+    metadata TEXT
+);
+
+CREATE INDEX idx_sessions_device ON sessions(device_id);
+CREATE INDEX idx_sessions_status ON sessions(status);
+
+INSERT INTO sessions (id, tool, device_id, device_name, status, created_at, last_activity, metadata)
+SELECT id, COALESCE(tool_name, ''), owner_device_id, COALESCE(owner_device_name, ''),
+       COALESCE(status, 'created'), created_at, COALESCE(last_heartbeat, updated_at), metadata::text
+FROM terminal_sessions;
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS message_search_tokens;
+
+-- Fails while checkpoints are still encrypted; decrypt them first
+ALTER TABLE session_checkpoints ALTER COLUMN input_history TYPE JSONB USING input_history::jsonb;
+ALTER TABLE session_checkpoints ALTER COLUMN output_history TYPE JSONB USING output_history::jsonb;
+ALTER TABLE session_checkpoints ALTER COLUMN state_snapshot TYPE JSONB USING state_snapshot::jsonb;
@@ -0,0 +1,16 @@
+-- Encrypted checkpoint history is no longer valid JSON
+ALTER TABLE session_checkpoints ALTER COLUMN input_history TYPE TEXT USING input_history::text;
+ALTER TABLE session_checkpoints ALTER COLUMN output_history TYPE TEXT USING output_history::text;
+ALTER TABLE session_checkpoints ALTER COLUMN state_snapshot TYPE TEXT USING state_snapshot::text;
+
+-- Blinded search index for encrypted messages (opt-in, see database.SearchIndexEnabled)
+CREATE TABLE message_search_tokens (
+    id SERIAL PRIMARY KEY,
+    message_id UUID NOT NULL REFERENCES terminal_messages(id) ON DELETE CASCADE,
+    session_id VARCHAR(255) NOT NULL,
+    token VARCHAR(64) NOT NULL,
+    key_id VARCHAR(255) NOT NULL
+);
+
+CREATE INDEX idx_message_search_tokens_token ON message_search_tokens(token, session_id);
+CREATE INDEX idx_message_search_tokens_message ON message_search_tokens(message_id);
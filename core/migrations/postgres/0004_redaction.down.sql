@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS redaction_counts;
+
+ALTER TABLE terminal_messages DROP COLUMN IF EXISTS redacted;
+ALTER TABLE terminal_messages DROP COLUMN IF EXISTS unredacted_content;
@@ -0,0 +1,2 @@
+ALTER TABLE terminal_sessions DROP COLUMN IF EXISTS output_history;
+ALTER TABLE terminal_sessions DROP COLUMN IF EXISTS input_history;
@@ -0,0 +1,3 @@
+-- Recent input and output captured from the session's terminal
+ALTER TABLE terminal_sessions ADD COLUMN input_history TEXT;
+ALTER TABLE terminal_sessions ADD COLUMN output_history TEXT;
@@ -0,0 +1,17 @@
+-- Handovers of sessions between devices
+CREATE TABLE session_migrations (
+    id UUID PRIMARY KEY,
+    session_id VARCHAR(255) NOT NULL,
+    direction VARCHAR(10) NOT NULL,
+    source_device_id VARCHAR(255) NOT NULL,
+    target_device_id VARCHAR(255),
+    peer_url TEXT,
+    lease_token_hash VARCHAR(64),
+    lease_expires_at TIMESTAMP,
+    status VARCHAR(20) NOT NULL,
+    error TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_session_migrations_session_id ON session_migrations(session_id);
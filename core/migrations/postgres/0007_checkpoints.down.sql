@@ -0,0 +1,10 @@
+ALTER TABLE session_checkpoints DROP COLUMN IF EXISTS git_commit;
+ALTER TABLE session_checkpoints DROP COLUMN IF EXISTS git_head;
+ALTER TABLE session_checkpoints DROP COLUMN IF EXISTS git_branch;
+ALTER TABLE session_checkpoints DROP COLUMN IF EXISTS repo_dir;
+ALTER TABLE session_checkpoints DROP COLUMN IF EXISTS transcript_offset;
+ALTER TABLE session_checkpoints DROP COLUMN IF EXISTS transcript_path;
+ALTER TABLE session_checkpoints DROP COLUMN IF EXISTS claude_session_id;
+ALTER TABLE session_checkpoints DROP COLUMN IF EXISTS message_id;
+ALTER TABLE session_checkpoints DROP COLUMN IF EXISTS label;
+ALTER TABLE session_checkpoints DROP COLUMN IF EXISTS trigger_type;
@@ -0,0 +1,11 @@
+-- Why a checkpoint was taken, the conversation position and the working tree commit
+ALTER TABLE session_checkpoints ADD COLUMN trigger_type VARCHAR(20);
+ALTER TABLE session_checkpoints ADD COLUMN label TEXT;
+ALTER TABLE session_checkpoints ADD COLUMN message_id UUID;
+ALTER TABLE session_checkpoints ADD COLUMN claude_session_id TEXT;
+ALTER TABLE session_checkpoints ADD COLUMN transcript_path TEXT;
+ALTER TABLE session_checkpoints ADD COLUMN transcript_offset BIGINT;
+ALTER TABLE session_checkpoints ADD COLUMN repo_dir TEXT;
+ALTER TABLE session_checkpoints ADD COLUMN git_branch TEXT;
+ALTER TABLE session_checkpoints ADD COLUMN git_head VARCHAR(40);
+ALTER TABLE session_checkpoints ADD COLUMN git_commit VARCHAR(40);
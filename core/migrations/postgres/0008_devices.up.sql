@@ -0,0 +1,22 @@
+-- Devices paired with this one through an invite
+CREATE TABLE devices (
+    id VARCHAR(255) PRIMARY KEY,
+    name VARCHAR(255),
+    type VARCHAR(20),
+    url TEXT NOT NULL,
+    secret TEXT,
+    paired_at TIMESTAMP,
+    last_seen_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One-time pairing invites issued by this device
+CREATE TABLE device_invites (
+    id UUID PRIMARY KEY,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    used_by_device_id VARCHAR(255),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_devices_cert_fingerprint;
+ALTER TABLE devices DROP COLUMN IF EXISTS revoked_at;
+ALTER TABLE devices DROP COLUMN IF EXISTS cert_fingerprint;
@@ -0,0 +1,2 @@
+ALTER TABLE terminal_sessions DROP COLUMN IF EXISTS lease_epoch;
+ALTER TABLE terminal_sessions DROP COLUMN IF EXISTS lease_expires_at;
@@ -0,0 +1,4 @@
+-- Ownership leases: current_device_id runs the session until lease_expires_at,
+-- and lease_epoch grows each time the lease changes hands
+ALTER TABLE terminal_sessions ADD COLUMN lease_expires_at TIMESTAMP;
+ALTER TABLE terminal_sessions ADD COLUMN lease_epoch BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_api_keys_api_key_hash;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS revoked_at;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS session_ids;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS scopes;
+ALTER TABLE api_keys DROP COLUMN IF EXISTS key_prefix;
@@ -0,0 +1,8 @@
+-- Scoped API keys: only a hash of each key is kept, with a prefix to tell keys
+-- apart, the scopes it grants and the sessions it is restricted to
+ALTER TABLE api_keys ADD COLUMN key_prefix VARCHAR(16);
+ALTER TABLE api_keys ADD COLUMN scopes TEXT;
+ALTER TABLE api_keys ADD COLUMN session_ids TEXT;
+ALTER TABLE api_keys ADD COLUMN revoked_at TIMESTAMP;
+UPDATE api_keys SET api_key = NULL;
+CREATE UNIQUE INDEX idx_api_keys_api_key_hash ON api_keys(api_key_hash);
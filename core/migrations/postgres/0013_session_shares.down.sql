@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_terminal_sessions_user_id;
+DROP INDEX IF EXISTS idx_session_shares_user_id;
+DROP TABLE IF EXISTS session_shares;
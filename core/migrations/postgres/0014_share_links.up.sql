@@ -0,0 +1,15 @@
+-- Expiring read-only links to watch a session without an account
+CREATE TABLE share_links (
+    id UUID PRIMARY KEY,
+    session_id VARCHAR(255) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL,
+    token_prefix VARCHAR(16),
+    created_by UUID,
+    redaction_level VARCHAR(20) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP,
+    last_used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX idx_share_links_token_hash ON share_links(token_hash);
+CREATE INDEX idx_share_links_session_id ON share_links(session_id);
@@ -0,0 +1,2 @@
+-- Fails while sessions are still encrypted; decrypt them first
+ALTER TABLE terminal_sessions ALTER COLUMN environment TYPE JSONB USING environment::jsonb;
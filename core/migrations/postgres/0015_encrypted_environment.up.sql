@@ -0,0 +1,2 @@
+-- The session environment is encrypted at rest and no longer valid JSON
+ALTER TABLE terminal_sessions ALTER COLUMN environment TYPE TEXT USING environment::text;
@@ -0,0 +1,2 @@
+ALTER TABLE device_invites DROP COLUMN IF EXISTS created_by;
+ALTER TABLE devices DROP COLUMN IF EXISTS user_id;
@@ -0,0 +1,3 @@
+-- The user a paired device acts for, bound at pairing from the invite or the redeemer
+ALTER TABLE devices ADD COLUMN user_id UUID;
+ALTER TABLE device_invites ADD COLUMN created_by UUID;
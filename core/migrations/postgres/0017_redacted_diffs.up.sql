@@ -0,0 +1,5 @@
+-- Original git diffs whose secrets were masked, kept only when configured
+ALTER TABLE terminal_messages ADD COLUMN unredacted_git_diff TEXT;
+ALTER TABLE git_turn_snapshots ADD COLUMN redacted BOOLEAN DEFAULT FALSE;
+ALTER TABLE git_turn_snapshots ADD COLUMN unredacted_turn_diff TEXT;
+ALTER TABLE git_turn_snapshots ADD COLUMN unredacted_cumulative_diff TEXT;
@@ -0,0 +1 @@
+ALTER TABLE push_tokens DROP COLUMN IF EXISTS device_id;
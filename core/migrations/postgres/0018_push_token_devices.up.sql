@@ -0,0 +1,2 @@
+-- The device a push token belongs to, so devices viewing a session are not notified
+ALTER TABLE push_tokens ADD COLUMN device_id TEXT;
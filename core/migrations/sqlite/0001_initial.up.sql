@@ -0,0 +1,251 @@
+-- Initial schema
+
+-- Users and agents (from Omnara)
+CREATE TABLE users (
+    id TEXT PRIMARY KEY,
+    email TEXT NOT NULL UNIQUE,
+    display_name TEXT,
+    created_at DATETIME,
+    updated_at DATETIME,
+    push_notifications_enabled BOOLEAN DEFAULT TRUE,
+    email_notifications_enabled BOOLEAN DEFAULT FALSE,
+    sms_notifications_enabled BOOLEAN DEFAULT FALSE,
+    phone_number TEXT,
+    notification_email TEXT
+);
+
+CREATE TABLE user_agents (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    webhook_url TEXT,
+    webhook_api_key TEXT,
+    is_active BOOLEAN DEFAULT TRUE,
+    is_deleted BOOLEAN DEFAULT FALSE,
+    created_at DATETIME,
+    updated_at DATETIME
+);
+
+CREATE TABLE agent_instances (
+    id TEXT PRIMARY KEY,
+    user_agent_id TEXT NOT NULL REFERENCES user_agents(id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status TEXT DEFAULT 'active',
+    started_at DATETIME,
+    ended_at DATETIME,
+    git_diff TEXT,
+    name TEXT,
+    last_read_message_id TEXT
+);
+
+CREATE TABLE messages (
+    id TEXT PRIMARY KEY,
+    agent_instance_id TEXT NOT NULL REFERENCES agent_instances(id) ON DELETE CASCADE,
+    sender_type TEXT NOT NULL,
+    content TEXT NOT NULL,
+    created_at DATETIME,
+    requires_user_input BOOLEAN DEFAULT FALSE,
+    message_metadata TEXT
+);
+
+CREATE INDEX idx_messages_instance_created ON messages(agent_instance_id, created_at);
+
+CREATE TABLE api_keys (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    api_key_hash TEXT NOT NULL,
+    api_key TEXT,
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at DATETIME,
+    expires_at DATETIME,
+    last_used_at DATETIME
+);
+
+CREATE TABLE push_tokens (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token TEXT NOT NULL UNIQUE,
+    platform TEXT NOT NULL,
+    is_active BOOLEAN DEFAULT TRUE,
+    created_at DATETIME,
+    updated_at DATETIME,
+    last_used_at DATETIME
+);
+
+-- Persistent terminal sessions
+CREATE TABLE terminal_sessions (
+    id TEXT PRIMARY KEY,
+    user_id TEXT,
+    name TEXT,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL,
+    owner_device_id TEXT NOT NULL,
+    owner_device_name TEXT,
+    current_device_id TEXT,
+    last_heartbeat DATETIME,
+    command TEXT,
+    args TEXT,
+    environment TEXT,
+    working_dir TEXT,
+    buffer_content BLOB,
+    cursor_row INTEGER,
+    cursor_col INTEGER,
+    scroll_offset INTEGER,
+    tool_name TEXT,
+    tool_state TEXT,
+    status TEXT DEFAULT 'created',
+    tags TEXT,
+    metadata TEXT
+);
+
+CREATE INDEX idx_terminal_sessions_owner_device ON terminal_sessions(owner_device_id);
+CREATE INDEX idx_terminal_sessions_current_device ON terminal_sessions(current_device_id);
+CREATE INDEX idx_terminal_sessions_last_heartbeat ON terminal_sessions(last_heartbeat);
+CREATE INDEX idx_terminal_sessions_status ON terminal_sessions(status);
+
+CREATE TABLE session_checkpoints (
+    id TEXT PRIMARY KEY,
+    session_id TEXT NOT NULL REFERENCES terminal_sessions(id) ON DELETE CASCADE,
+    timestamp DATETIME NOT NULL,
+    input_history TEXT,
+    output_history TEXT,
+    state_snapshot TEXT
+);
+
+CREATE INDEX idx_session_checkpoints_session ON session_checkpoints(session_id, timestamp);
+
+CREATE TABLE session_logs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    session_id TEXT NOT NULL REFERENCES terminal_sessions(id) ON DELETE CASCADE,
+    timestamp DATETIME NOT NULL,
+    type TEXT,
+    content TEXT,
+    metadata TEXT
+);
+
+CREATE INDEX idx_session_logs_session ON session_logs(session_id, timestamp);
+
+-- Sessions started from the CLI
+CREATE TABLE sessions (
+    id TEXT PRIMARY KEY,
+    tool TEXT NOT NULL,
+    device_id TEXT NOT NULL,
+    device_name TEXT NOT NULL,
+    status TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    last_activity DATETIME NOT NULL,
+    metadata TEXT
+);
+
+CREATE INDEX idx_sessions_device ON sessions(device_id);
+CREATE INDEX idx_sessions_status ON sessions(status);
+
+-- Terminal conversation messages
+CREATE TABLE terminal_messages (
+    id TEXT PRIMARY KEY,
+    session_id TEXT NOT NULL,
+    sender_type VARCHAR(10) NOT NULL,
+    content TEXT NOT NULL,
+    requires_user_input BOOLEAN DEFAULT FALSE,
+    metadata TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    git_diff TEXT,
+    delivery_status VARCHAR(20),
+    delivered_at DATETIME
+);
+
+CREATE INDEX idx_terminal_messages_session_created ON terminal_messages(session_id, created_at);
+CREATE INDEX idx_terminal_messages_delivery_status ON terminal_messages(delivery_status);
+
+CREATE TABLE message_sessions (
+    id TEXT PRIMARY KEY,
+    session_id TEXT NOT NULL UNIQUE,
+    last_read_message_id TEXT,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE read_cursors (
+    id TEXT PRIMARY KEY,
+    session_id TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    device_id TEXT NOT NULL,
+    last_read_message_id TEXT,
+    last_read_at DATETIME,
+    updated_at DATETIME
+);
+
+CREATE UNIQUE INDEX idx_read_cursors_reader ON read_cursors(session_id, user_id, device_id);
+CREATE INDEX idx_read_cursors_user_id ON read_cursors(user_id);
+
+-- Git tracking per agent turn
+CREATE TABLE session_git_states (
+    session_id TEXT PRIMARY KEY,
+    repo_dir TEXT NOT NULL,
+    initial_git_hash VARCHAR(40),
+    initial_tree_hash VARCHAR(40),
+    last_git_hash VARCHAR(40),
+    last_tree_hash VARCHAR(40),
+    created_at DATETIME,
+    updated_at DATETIME
+);
+
+CREATE TABLE git_turn_snapshots (
+    id TEXT PRIMARY KEY,
+    session_id TEXT NOT NULL,
+    message_id TEXT,
+    git_hash VARCHAR(40),
+    tree_hash VARCHAR(40),
+    turn_diff TEXT,
+    cumulative_diff TEXT,
+    new_commits TEXT,
+    created_at DATETIME
+);
+
+CREATE INDEX idx_git_turn_snapshots_session_created ON git_turn_snapshots(session_id, created_at);
+
+-- Uploaded attachments
+CREATE TABLE attachments (
+    id TEXT PRIMARY KEY,
+    session_id TEXT NOT NULL,
+    message_id TEXT,
+    file_name TEXT NOT NULL,
+    content_type TEXT NOT NULL,
+    size INTEGER,
+    sha256 VARCHAR(64),
+    storage_path TEXT NOT NULL,
+    created_at DATETIME
+);
+
+CREATE INDEX idx_attachments_session_id ON attachments(session_id);
+CREATE INDEX idx_attachments_message_id ON attachments(message_id);
+
+-- Token usage accounting
+CREATE TABLE token_usage (
+    id TEXT PRIMARY KEY,
+    session_id TEXT NOT NULL,
+    message_id TEXT,
+    external_id TEXT,
+    tool VARCHAR(50),
+    model VARCHAR(100),
+    input_tokens INTEGER,
+    output_tokens INTEGER,
+    cache_creation_tokens INTEGER,
+    cache_read_tokens INTEGER,
+    cost REAL,
+    created_at DATETIME
+);
+
+CREATE INDEX idx_token_usage_session_id ON token_usage(session_id);
+CREATE INDEX idx_token_usage_message_id ON token_usage(message_id);
+CREATE UNIQUE INDEX idx_token_usage_external_id ON token_usage(external_id);
+CREATE INDEX idx_token_usage_tool ON token_usage(tool);
+CREATE INDEX idx_token_usage_created_at ON token_usage(created_at);
+
+CREATE TABLE session_budgets (
+    session_id TEXT PRIMARY KEY,
+    limit_usd REAL,
+    action VARCHAR(20),
+    exceeded_at DATETIME,
+    updated_at DATETIME
+);
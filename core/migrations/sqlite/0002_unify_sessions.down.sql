@@ -0,0 +1,20 @@
+DROP INDEX IF EXISTS idx_terminal_sessions_updated;
+
+CREATE TABLE sessions (
+    id TEXT PRIMARY KEY,
+    tool TEXT NOT NULL,
+    device_id TEXT NOT NULL,
+    device_name TEXT NOT NULL,
+    status TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    last_activity DATETIME NOT NULL,
+    metadata TEXT
+);
+
+CREATE INDEX idx_sessions_device ON sessions(device_id);
+CREATE INDEX idx_sessions_status ON sessions(status);
+
+INSERT INTO sessions (id, tool, device_id, device_name, status, created_at, last_activity, metadata)
+SELECT id, COALESCE(tool_name, ''), owner_device_id, COALESCE(owner_device_name, ''),
+       COALESCE(status, 'created'), created_at, COALESCE(last_heartbeat, updated_at), metadata
+FROM terminal_sessions;
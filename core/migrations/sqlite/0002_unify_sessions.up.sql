@@ -0,0 +1,17 @@
+-- Fold the CLI sessions table into terminal_sessions so the CLI, the server
+-- and the persistent manager share one session store
+
+INSERT INTO terminal_sessions (
+    id, name, created_at, updated_at,
+    owner_device_id, owner_device_name, current_device_id, last_heartbeat,
+    tool_name, status, metadata
+)
+SELECT id, id, created_at, last_activity,
+       device_id, device_name, device_id, last_activity,
+       tool, status, NULLIF(metadata, '')
+FROM sessions
+WHERE id NOT IN (SELECT id FROM terminal_sessions);
+
+DROP TABLE sessions;
+
+CREATE INDEX idx_terminal_sessions_updated ON terminal_sessions(updated_at);
@@ -0,0 +1,11 @@
+-- Blinded search index for encrypted messages (opt-in, see database.SearchIndexEnabled)
+CREATE TABLE message_search_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    message_id TEXT NOT NULL REFERENCES terminal_messages(id) ON DELETE CASCADE,
+    session_id TEXT NOT NULL,
+    token TEXT NOT NULL,
+    key_id TEXT NOT NULL
+);
+
+CREATE INDEX idx_message_search_tokens_token ON message_search_tokens(token, session_id);
+CREATE INDEX idx_message_search_tokens_message ON message_search_tokens(message_id);
@@ -0,0 +1,15 @@
+-- Original content of messages whose secrets were masked, kept only when configured
+ALTER TABLE terminal_messages ADD COLUMN unredacted_content TEXT;
+ALTER TABLE terminal_messages ADD COLUMN redacted BOOLEAN DEFAULT FALSE;
+
+-- How many values each redaction rule masked, per session and source
+CREATE TABLE redaction_counts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    session_id TEXT NOT NULL,
+    source VARCHAR(20) NOT NULL,
+    rule VARCHAR(100) NOT NULL,
+    count INTEGER NOT NULL DEFAULT 0,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX idx_redaction_counts_key ON redaction_counts(session_id, source, rule);
@@ -0,0 +1,2 @@
+ALTER TABLE terminal_sessions DROP COLUMN output_history;
+ALTER TABLE terminal_sessions DROP COLUMN input_history;
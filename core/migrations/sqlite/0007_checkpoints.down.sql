@@ -0,0 +1,10 @@
+ALTER TABLE session_checkpoints DROP COLUMN git_commit;
+ALTER TABLE session_checkpoints DROP COLUMN git_head;
+ALTER TABLE session_checkpoints DROP COLUMN git_branch;
+ALTER TABLE session_checkpoints DROP COLUMN repo_dir;
+ALTER TABLE session_checkpoints DROP COLUMN transcript_offset;
+ALTER TABLE session_checkpoints DROP COLUMN transcript_path;
+ALTER TABLE session_checkpoints DROP COLUMN claude_session_id;
+ALTER TABLE session_checkpoints DROP COLUMN message_id;
+ALTER TABLE session_checkpoints DROP COLUMN label;
+ALTER TABLE session_checkpoints DROP COLUMN trigger_type;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS device_invites;
+DROP TABLE IF EXISTS devices;
@@ -0,0 +1,22 @@
+-- Devices paired with this one through an invite
+CREATE TABLE devices (
+    id TEXT PRIMARY KEY,
+    name TEXT,
+    type VARCHAR(20),
+    url TEXT NOT NULL,
+    secret TEXT,
+    paired_at DATETIME,
+    last_seen_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One-time pairing invites issued by this device
+CREATE TABLE device_invites (
+    id TEXT PRIMARY KEY,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME,
+    used_by_device_id TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
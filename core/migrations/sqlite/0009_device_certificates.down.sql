@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_devices_cert_fingerprint;
+ALTER TABLE devices DROP COLUMN revoked_at;
+ALTER TABLE devices DROP COLUMN cert_fingerprint;
@@ -0,0 +1,5 @@
+-- Certificates pinned at pairing, and revocation of lost devices
+ALTER TABLE devices ADD COLUMN cert_fingerprint VARCHAR(64);
+ALTER TABLE devices ADD COLUMN revoked_at DATETIME;
+
+CREATE INDEX idx_devices_cert_fingerprint ON devices(cert_fingerprint);
@@ -0,0 +1,2 @@
+ALTER TABLE terminal_sessions DROP COLUMN lease_epoch;
+ALTER TABLE terminal_sessions DROP COLUMN lease_expires_at;
@@ -0,0 +1,12 @@
+-- Accounts users sign in with, at an OAuth provider or locally
+CREATE TABLE user_identities (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(20) NOT NULL,
+    subject TEXT NOT NULL,
+    email TEXT,
+    last_login_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (provider, subject)
+);
+CREATE INDEX idx_user_identities_user_id ON user_identities(user_id);
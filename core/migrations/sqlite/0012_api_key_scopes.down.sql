@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_api_keys_api_key_hash;
+ALTER TABLE api_keys DROP COLUMN revoked_at;
+ALTER TABLE api_keys DROP COLUMN session_ids;
+ALTER TABLE api_keys DROP COLUMN scopes;
+ALTER TABLE api_keys DROP COLUMN key_prefix;
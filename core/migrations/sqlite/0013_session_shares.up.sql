@@ -0,0 +1,13 @@
+-- Users a session's owner shared it with, and what they may do in it
+CREATE TABLE session_shares (
+    id TEXT PRIMARY KEY,
+    session_id TEXT NOT NULL,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL,
+    granted_by TEXT,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (session_id, user_id)
+);
+CREATE INDEX idx_session_shares_user_id ON session_shares(user_id);
+CREATE INDEX idx_terminal_sessions_user_id ON terminal_sessions(user_id);
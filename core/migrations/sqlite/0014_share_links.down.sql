@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_share_links_session_id;
+DROP INDEX IF EXISTS idx_share_links_token_hash;
+DROP TABLE IF EXISTS share_links;
@@ -0,0 +1,15 @@
+-- Expiring read-only links to watch a session without an account
+CREATE TABLE share_links (
+    id TEXT PRIMARY KEY,
+    session_id TEXT NOT NULL,
+    token_hash TEXT NOT NULL,
+    token_prefix VARCHAR(16),
+    created_by TEXT,
+    redaction_level VARCHAR(20) NOT NULL,
+    expires_at DATETIME NOT NULL,
+    revoked_at DATETIME,
+    last_used_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX idx_share_links_token_hash ON share_links(token_hash);
+CREATE INDEX idx_share_links_session_id ON share_links(session_id);
@@ -0,0 +1 @@
+-- Nothing to undo, see 0015_encrypted_environment.up.sql
@@ -0,0 +1,2 @@
+-- The session environment is encrypted at rest. SQLite already stores it as
+-- TEXT, so only the schema version moves to stay in step with PostgreSQL.
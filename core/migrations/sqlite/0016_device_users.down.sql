@@ -0,0 +1,2 @@
+ALTER TABLE device_invites DROP COLUMN created_by;
+ALTER TABLE devices DROP COLUMN user_id;
@@ -0,0 +1,4 @@
+ALTER TABLE git_turn_snapshots DROP COLUMN unredacted_cumulative_diff;
+ALTER TABLE git_turn_snapshots DROP COLUMN unredacted_turn_diff;
+ALTER TABLE git_turn_snapshots DROP COLUMN redacted;
+ALTER TABLE terminal_messages DROP COLUMN unredacted_git_diff;
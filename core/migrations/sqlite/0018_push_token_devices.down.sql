@@ -0,0 +1 @@
+ALTER TABLE push_tokens DROP COLUMN device_id;
@@ -5,6 +5,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/majiayu000/anywhere-ai/core/redact"
 )
 
 // OutputProcessor processes and analyzes tool output
@@ -13,6 +15,8 @@ type OutputProcessor struct {
 	patterns       map[string]*regexp.Regexp
 	buffer         *OutputBuffer
 	lastPermission *PermissionRequest
+	redactor       *redact.Redactor
+	redacted       redact.Counts
 	mu             sync.RWMutex
 }
 
@@ -47,6 +51,8 @@ func NewOutputProcessor() *OutputProcessor {
 			lines:    []string{},
 			maxLines: 1000,
 		},
+		redactor: redact.Default(),
+		redacted: redact.Counts{},
 	}
 	
 	// Initialize common patterns
@@ -80,10 +86,24 @@ func (p *OutputProcessor) RegisterDetector(detector PermissionDetector) {
 	}
 }
 
-// ProcessOutput processes new output from a tool
-func (p *OutputProcessor) ProcessOutput(output string) {
+// SetRedactor sets the redactor applied to output before it is buffered.
+// A nil redactor disables redaction.
+func (p *OutputProcessor) SetRedactor(redactor *redact.Redactor) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	p.redactor = redactor
+}
+
+// ProcessOutput processes new output from a tool and returns it with secrets masked
+func (p *OutputProcessor) ProcessOutput(output string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	
+	// Mask secrets before the output is kept or shown anywhere
+	output, counts := p.redactor.Redact(output)
+	for rule, n := range counts {
+		p.redacted[rule] += n
+	}
 	
 	// Add to buffer
 	lines := strings.Split(output, "\n")
@@ -103,6 +123,20 @@ func (p *OutputProcessor) ProcessOutput(output string) {
 			break
 		}
 	}
+	
+	return output
+}
+
+// GetRedactionCounts returns how many values each redaction rule has masked
+func (p *OutputProcessor) GetRedactionCounts() redact.Counts {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	
+	counts := make(redact.Counts, len(p.redacted))
+	for rule, n := range p.redacted {
+		counts[rule] = n
+	}
+	return counts
 }
 
 // GetLastPermission returns the last detected permission request
@@ -0,0 +1,323 @@
+// Package redact masks secrets such as API keys, tokens and private keys in tool
+// output before it is stored or sent to clients.
+package redact
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Rule masks every match of a pattern. When Group is set only that capture group
+// is masked, so "API_KEY=abc" keeps its name.
+type Rule struct {
+	Name    string
+	Pattern *regexp.Regexp
+	Group   int
+}
+
+// builtinRules detect common key and token formats
+var builtinRules = []Rule{
+	{Name: "private_key", Pattern: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?(-----END [A-Z ]*PRIVATE KEY-----|$)`)},
+	{Name: "anthropic_key", Pattern: regexp.MustCompile(`\bsk-ant-[A-Za-z0-9_-]{20,}`)},
+	{Name: "openai_key", Pattern: regexp.MustCompile(`\bsk-(?:proj-)?[A-Za-z0-9_-]{20,}`)},
+	{Name: "aws_access_key", Pattern: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{Name: "github_token", Pattern: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})`)},
+	{Name: "gitlab_token", Pattern: regexp.MustCompile(`\bglpat-[A-Za-z0-9_-]{20,}`)},
+	{Name: "slack_token", Pattern: regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`)},
+	{Name: "stripe_key", Pattern: regexp.MustCompile(`\b(?:sk|rk)_(?:live|test)_[A-Za-z0-9]{20,}`)},
+	{Name: "google_api_key", Pattern: regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}`)},
+	{Name: "jwt", Pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`)},
+	{Name: "bearer_token", Pattern: regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9._~+/=-]{16,})`), Group: 1},
+	{Name: "url_credentials", Pattern: regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://[^\s:/@]+:([^\s@/]+)@`), Group: 1},
+	{Name: "assignment", Pattern: regexp.MustCompile(`(?i)\b[A-Z0-9_]*(?:api[_-]?key|secret|token|passw(?:or)?d|credential)[A-Z0-9_]*\s*[=:]\s*["']?([^\s"']{8,})`), Group: 1},
+}
+
+// personalRules detect personal details, masked on top of secrets for
+// audiences outside the team
+var personalRules = []Rule{
+	{Name: "email", Pattern: regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`)},
+	{Name: "ip_address", Pattern: regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)},
+	{Name: "home_path", Pattern: regexp.MustCompile(`(?:/home/|/Users/)([^/\s]+)`), Group: 1},
+}
+
+// entropyCandidate matches long runs of key-like characters checked for entropy
+var entropyCandidate = regexp.MustCompile(`[A-Za-z0-9+/=_-]{24,}`)
+
+// Config configures a Redactor
+type Config struct {
+	// Disabled turns redaction off entirely
+	Disabled bool `json:"disabled"`
+
+	// Patterns are extra regular expressions to mask, keyed by rule name
+	Patterns map[string]string `json:"patterns"`
+
+	// EntropyThreshold is the Shannon entropy, in bits per character, above which
+	// a long token is treated as a secret. Zero uses the default; negative disables it.
+	EntropyThreshold float64 `json:"entropy_threshold"`
+
+	// RetainUnredacted keeps the original content, encrypted at rest, for the
+	// privileged unredacted view
+	RetainUnredacted bool `json:"retain_unredacted"`
+}
+
+// defaultEntropyThreshold catches random keys but not words, paths or hex hashes
+const defaultEntropyThreshold = 4.5
+
+// LoadConfig reads a JSON redaction config
+func LoadConfig(path string) (Config, error) {
+	var config Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("failed to read redaction config: %w", err)
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("failed to parse redaction config: %w", err)
+	}
+	return config, nil
+}
+
+// ConfigFromEnv loads the config named by ANYWHERE_REDACTION_CONFIG. Without it
+// only the built-in rules are used.
+func ConfigFromEnv() (Config, error) {
+	path := os.Getenv("ANYWHERE_REDACTION_CONFIG")
+	if path == "" {
+		return Config{}, nil
+	}
+	return LoadConfig(path)
+}
+
+// Counts is how many values each rule masked
+type Counts map[string]int
+
+// Total returns the number of masked values
+func (c Counts) Total() int {
+	total := 0
+	for _, n := range c {
+		total += n
+	}
+	return total
+}
+
+// Match is a single masked value
+type Match struct {
+	Rule  string
+	Value string
+}
+
+// Redactor masks secrets in text
+type Redactor struct {
+	rules            []Rule
+	entropyThreshold float64
+	disabled         bool
+}
+
+// New creates a redactor with the built-in rules and those in config
+func New(config Config) (*Redactor, error) {
+	r := &Redactor{
+		rules:            append([]Rule{}, builtinRules...),
+		entropyThreshold: config.EntropyThreshold,
+		disabled:         config.Disabled,
+	}
+	if r.entropyThreshold == 0 {
+		r.entropyThreshold = defaultEntropyThreshold
+	}
+
+	names := make([]string, 0, len(config.Patterns))
+	for name := range config.Patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pattern, err := regexp.Compile(config.Patterns[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %s: %w", name, err)
+		}
+		r.rules = append(r.rules, Rule{Name: name, Pattern: pattern})
+	}
+
+	return r, nil
+}
+
+// Strict returns a redactor with the built-in rules that also masks personal
+// details: email addresses, IP addresses and user names in home paths
+func Strict() *Redactor {
+	r := Default()
+	r.rules = append(r.rules, personalRules...)
+	return r
+}
+
+// Default returns a redactor with only the built-in rules
+func Default() *Redactor {
+	r, _ := New(Config{})
+	return r
+}
+
+// Redact masks secrets in text and counts what was masked
+func (r *Redactor) Redact(text string) (string, Counts) {
+	redacted, matches := r.RedactMatches(text)
+	counts := Counts{}
+	for _, m := range matches {
+		counts[m.Rule]++
+	}
+	return redacted, counts
+}
+
+// RedactMatches masks secrets in text and returns each masked value
+func (r *Redactor) RedactMatches(text string) (string, []Match) {
+	if r == nil || r.disabled || text == "" {
+		return text, nil
+	}
+
+	var matches []Match
+	for _, rule := range r.rules {
+		text = replaceRule(text, rule, &matches)
+	}
+	if r.entropyThreshold > 0 {
+		text = r.replaceRandom(text, &matches)
+	}
+	return text, matches
+}
+
+// replaceRandom masks long tokens that look random. The payload of a base64
+// data URI, such as an inline image, is random too but not a secret.
+func (r *Redactor) replaceRandom(text string, matches *[]Match) string {
+	indexes := entropyCandidate.FindAllStringIndex(text, -1)
+	if len(indexes) == 0 {
+		return text
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, idx := range indexes {
+		start, end := idx[0], idx[1]
+		token := text[start:end]
+		if strings.HasSuffix(text[:start], ";base64,") || !looksRandom(token, r.entropyThreshold) {
+			continue
+		}
+
+		b.WriteString(text[last:start])
+		b.WriteString(mask("high_entropy"))
+		last = end
+		*matches = append(*matches, Match{Rule: "high_entropy", Value: token})
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// replaceRule masks the matches of one rule
+func replaceRule(text string, rule Rule, matches *[]Match) string {
+	indexes := rule.Pattern.FindAllStringSubmatchIndex(text, -1)
+	if len(indexes) == 0 {
+		return text
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, idx := range indexes {
+		start, end := idx[0], idx[1]
+		if rule.Group > 0 && len(idx) > 2*rule.Group+1 && idx[2*rule.Group] >= 0 {
+			start, end = idx[2*rule.Group], idx[2*rule.Group+1]
+		}
+		value := text[start:end]
+		if strings.HasPrefix(value, "[REDACTED:") {
+			continue
+		}
+
+		b.WriteString(text[last:start])
+		b.WriteString(mask(rule.Name))
+		last = end
+		*matches = append(*matches, Match{Rule: rule.Name, Value: value})
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// mask is the placeholder written in place of a secret
+func mask(rule string) string {
+	return "[REDACTED:" + rule + "]"
+}
+
+// looksRandom reports whether token has the entropy and character mix of a key
+func looksRandom(token string, threshold float64) bool {
+	var upper, lower, digit bool
+	for _, c := range token {
+		switch {
+		case c >= 'A' && c <= 'Z':
+			upper = true
+		case c >= 'a' && c <= 'z':
+			lower = true
+		case c >= '0' && c <= '9':
+			digit = true
+		}
+	}
+	if !(upper && lower && digit) {
+		return false
+	}
+	return shannonEntropy(token) >= threshold
+}
+
+// shannonEntropy returns the entropy of s in bits per character
+func shannonEntropy(s string) float64 {
+	freq := make(map[rune]float64)
+	n := 0.0
+	for _, c := range s {
+		freq[c]++
+		n++
+	}
+	entropy := 0.0
+	for _, count := range freq {
+		p := count / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// Seen remembers which values were already masked in each session, so screens
+// and buffers that are captured repeatedly are only counted once
+type Seen struct {
+	mu     sync.Mutex
+	values map[string]map[[sha256.Size]byte]struct{}
+}
+
+// NewSeen creates an empty set of masked values
+func NewSeen() *Seen {
+	return &Seen{values: make(map[string]map[[sha256.Size]byte]struct{})}
+}
+
+// Count returns the counts of matches not seen before in the session
+func (s *Seen) Count(sessionID string, matches []Match) Counts {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen, ok := s.values[sessionID]
+	if !ok {
+		seen = make(map[[sha256.Size]byte]struct{})
+		s.values[sessionID] = seen
+	}
+
+	counts := Counts{}
+	for _, m := range matches {
+		// Only a hash is kept so the set does not hold secrets
+		sum := sha256.Sum256([]byte(m.Rule + "\x00" + m.Value))
+		if _, ok := seen[sum]; ok {
+			continue
+		}
+		seen[sum] = struct{}{}
+		counts[m.Rule]++
+	}
+	return counts
+}
+
+// Forget drops what was seen in a session
+func (s *Seen) Forget(sessionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, sessionID)
+}
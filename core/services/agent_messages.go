@@ -0,0 +1,241 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/majiayu000/anywhere-ai/core/database"
+)
+
+var (
+	// ErrInvalidAgentMessage is returned when an agent message cannot be sent as asked
+	ErrInvalidAgentMessage = errors.New("invalid agent message")
+	// ErrAgentUserRequired is returned when starting an agent instance without a user to own it
+	ErrAgentUserRequired = errors.New("agent instances need a signed in user or an API key")
+)
+
+// AgentMessageService lets scripts and agents outside tmux report to users
+// through the SDK: they post updates, ask questions and read the replies. Each
+// agent instance keeps its messages like a session, keyed by its ID, so users
+// read and answer them as they do any session's.
+type AgentMessageService struct {
+	agents    *database.AgentRepository
+	messages  *MessageService
+	wsService *TerminalWebSocketService
+	access    *SessionAccessService
+	notifier  *Notifier
+}
+
+// NewAgentMessageService creates a new agent message service
+func NewAgentMessageService(agents *database.AgentRepository, messageService *MessageService, wsService *TerminalWebSocketService) *AgentMessageService {
+	return &AgentMessageService{
+		agents:    agents,
+		messages:  messageService,
+		wsService: wsService,
+	}
+}
+
+// SetSessionAccess sets the service that decides who may see agent instances
+func (s *AgentMessageService) SetSessionAccess(access *SessionAccessService) {
+	s.access = access
+}
+
+// SetNotifier sets the notifier that pushes agent messages to the user's devices
+func (s *AgentMessageService) SetNotifier(notifier *Notifier) {
+	s.notifier = notifier
+}
+
+// Send posts an agent message, starting the agent instance under agentType if
+// it does not exist yet, and pushes it to the user's devices when push is set.
+// It returns the user messages the agent had not read.
+func (s *AgentMessageService) Send(ctx context.Context, userID string, instanceID uuid.UUID, agentType string, content string, requiresInput bool, gitDiff string, push bool) (*database.TerminalMessage, []database.TerminalMessage, error) {
+	if content == "" {
+		return nil, nil, fmt.Errorf("%w: content is required", ErrInvalidAgentMessage)
+	}
+
+	instance, err := s.agents.GetAgentInstance(instanceID)
+	if errors.Is(err, database.ErrAgentInstanceNotFound) {
+		instance, err = s.start(userID, instanceID, agentType)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if instance.EndedAt != nil {
+		return nil, nil, fmt.Errorf("%w: %s", database.ErrAgentInstanceEnded, instanceID)
+	}
+
+	message, queued, err := s.messages.SendAgentMessageWithQueue(ctx, instanceID.String(), content, requiresInput, gitDiff)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Queued replies answer earlier messages, not this one
+	status := database.AgentStatusActive
+	if requiresInput {
+		status = database.AgentStatusAwaitingInput
+	}
+	// The stored message carries the diff with its secrets masked
+	if err := s.agents.UpdateAgentInstance(instanceID, status, message.GitDiff); err != nil {
+		return nil, nil, err
+	}
+
+	s.wsService.BroadcastMessage(instanceID.String(), message)
+	if push && s.notifier != nil {
+		s.notifier.NotifyAsync(instance.UserID, agentNotification(instance, agentType, message))
+	}
+	return message, queued, nil
+}
+
+// maxNotificationBody is how much of a message a notification shows
+const maxNotificationBody = 200
+
+// agentNotification describes an agent message as a push notification
+func agentNotification(instance *database.AgentInstance, agentType string, message *database.TerminalMessage) Notification {
+	title := instance.UserAgent.Name
+	if title == "" {
+		title = agentType
+	}
+	if message.RequiresUserInput {
+		title += " needs your input"
+	}
+
+	body := []rune(message.Content)
+	if len(body) > maxNotificationBody {
+		body = append(body[:maxNotificationBody-1], '…')
+	}
+	return Notification{SessionID: message.SessionID, Title: title, Body: string(body)}
+}
+
+// start starts an agent instance owned by a user
+func (s *AgentMessageService) start(userID string, instanceID uuid.UUID, agentType string) (*database.AgentInstance, error) {
+	if agentType == "" {
+		return nil, fmt.Errorf("%w: agent_type is required to start an agent instance", ErrInvalidAgentMessage)
+	}
+	owner, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, ErrAgentUserRequired
+	}
+
+	instance, err := s.agents.StartAgentInstance(instanceID, owner, agentType)
+	if err != nil {
+		return nil, err
+	}
+	if s.access != nil {
+		s.access.forget(instanceID.String())
+	}
+	return instance, nil
+}
+
+// Pending returns the user messages the agent has not read, marking them
+// read. lastReadMessageID is the last message the caller read, if any; when
+// another process read past it since, ErrStaleRead is returned.
+func (s *AgentMessageService) Pending(ctx context.Context, instanceID uuid.UUID, lastReadMessageID *uuid.UUID) ([]database.TerminalMessage, error) {
+	instance, err := s.agents.GetAgentInstance(instanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	messages, err := s.messages.TakeQueuedUserMessages(ctx, instanceID.String(), lastReadMessageID)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) > 0 && instance.Status == database.AgentStatusAwaitingInput {
+		if err := s.agents.UpdateAgentInstance(instanceID, database.AgentStatusActive, ""); err != nil {
+			return nil, err
+		}
+	}
+	return messages, nil
+}
+
+// Message returns an agent message with the instance that sent it
+func (s *AgentMessageService) Message(ctx context.Context, messageID uuid.UUID) (*database.TerminalMessage, *database.AgentInstance, error) {
+	message, err := s.messages.GetMessage(ctx, messageID)
+	if err != nil {
+		return nil, nil, err
+	}
+	instanceID, err := uuid.Parse(message.SessionID)
+	if err != nil || message.SenderType != database.SenderTypeAgent {
+		return nil, nil, fmt.Errorf("%w: %s", ErrMessageNotFound, messageID)
+	}
+
+	instance, err := s.agents.GetAgentInstance(instanceID)
+	if err != nil {
+		if errors.Is(err, database.ErrAgentInstanceNotFound) {
+			return nil, nil, fmt.Errorf("%w: %s", ErrMessageNotFound, messageID)
+		}
+		return nil, nil, err
+	}
+	return message, instance, nil
+}
+
+// RequestInput turns an agent message into a question for the user. It
+// returns the replies already queued; when there are none, the agent polls
+// Pending for them.
+func (s *AgentMessageService) RequestInput(ctx context.Context, message *database.TerminalMessage, instance *database.AgentInstance) ([]database.TerminalMessage, error) {
+	if instance.EndedAt != nil {
+		return nil, fmt.Errorf("%w: %s", database.ErrAgentInstanceEnded, instance.ID)
+	}
+	if err := s.messages.RequestUserInput(ctx, message); err != nil {
+		return nil, err
+	}
+
+	queued, err := s.messages.TakeQueuedUserMessages(ctx, message.SessionID, nil)
+	if err != nil {
+		return nil, err
+	}
+	status := database.AgentStatusActive
+	if len(queued) == 0 {
+		status = database.AgentStatusAwaitingInput
+	}
+	if err := s.agents.UpdateAgentInstance(instance.ID, status, ""); err != nil {
+		return nil, err
+	}
+
+	s.wsService.BroadcastMessage(message.SessionID, message)
+	return queued, nil
+}
+
+// Reply posts a user message to an agent instance. Messages marked read are
+// recorded without being handed to the agent.
+func (s *AgentMessageService) Reply(ctx context.Context, instanceID uuid.UUID, content string, markAsRead bool) (*database.TerminalMessage, error) {
+	if content == "" {
+		return nil, fmt.Errorf("%w: content is required", ErrInvalidAgentMessage)
+	}
+	instance, err := s.agents.GetAgentInstance(instanceID)
+	if err != nil {
+		return nil, err
+	}
+	if instance.EndedAt != nil {
+		return nil, fmt.Errorf("%w: %s", database.ErrAgentInstanceEnded, instanceID)
+	}
+
+	message, err := s.messages.CreateUserMessage(ctx, instanceID.String(), content, markAsRead)
+	if err != nil {
+		return nil, err
+	}
+	if instance.Status == database.AgentStatusAwaitingInput && !markAsRead {
+		if err := s.agents.UpdateAgentInstance(instanceID, database.AgentStatusActive, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	s.wsService.BroadcastMessage(instanceID.String(), message)
+	return message, nil
+}
+
+// Instance returns an agent instance
+func (s *AgentMessageService) Instance(instanceID uuid.UUID) (*database.AgentInstance, error) {
+	return s.agents.GetAgentInstance(instanceID)
+}
+
+// Instances returns the agent instances of a user
+func (s *AgentMessageService) Instances(userID uuid.UUID) ([]database.AgentInstance, error) {
+	return s.agents.ListAgentInstances(userID)
+}
+
+// End marks an agent instance completed
+func (s *AgentMessageService) End(instanceID uuid.UUID) (*database.AgentInstance, error) {
+	return s.agents.EndAgentInstance(instanceID)
+}
@@ -0,0 +1,331 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/majiayu000/anywhere-ai/core/database"
+)
+
+// Statuses of a pending messages read
+const (
+	pendingStatusOK    = "ok"
+	pendingStatusStale = "stale" // Another process read the messages first
+)
+
+// AgentMessageAPIService provides the REST API pkg/sdk.AnywhereClient talks
+// to. Agents post messages and poll for replies; users answer them.
+type AgentMessageAPIService struct {
+	agents *AgentMessageService
+	access *SessionAccessService
+}
+
+// NewAgentMessageAPIService creates a new agent message API service
+func NewAgentMessageAPIService(agents *AgentMessageService) *AgentMessageAPIService {
+	return &AgentMessageAPIService{agents: agents}
+}
+
+// SetSessionAccess sets the service that decides who may reach agent instances
+func (s *AgentMessageAPIService) SetSessionAccess(access *SessionAccessService) {
+	s.access = access
+}
+
+// agentMessageResponse is a message as the SDK reads it
+type agentMessageResponse struct {
+	ID                string                 `json:"id"`
+	Content           string                 `json:"content"`
+	SenderType        database.SenderType    `json:"sender_type"`
+	RequiresUserInput bool                   `json:"requires_user_input"`
+	GitDiff           string                 `json:"git_diff,omitempty"`
+	Metadata          map[string]interface{} `json:"metadata,omitempty"`
+	CreatedAt         time.Time              `json:"created_at"`
+}
+
+// newAgentMessageResponses converts messages for the SDK; metadata that is
+// not a JSON object is left out
+func newAgentMessageResponses(messages []database.TerminalMessage) []agentMessageResponse {
+	responses := make([]agentMessageResponse, 0, len(messages))
+	for _, message := range messages {
+		response := agentMessageResponse{
+			ID:                message.ID.String(),
+			Content:           message.Content,
+			SenderType:        message.SenderType,
+			RequiresUserInput: message.RequiresUserInput,
+			GitDiff:           message.GitDiff,
+			CreatedAt:         message.CreatedAt,
+		}
+		if message.Metadata != "" {
+			json.Unmarshal([]byte(message.Metadata), &response.Metadata)
+		}
+		responses = append(responses, response)
+	}
+	return responses
+}
+
+// role returns the role of the caller in an agent instance, or "" when it may
+// not see it
+func (s *AgentMessageAPIService) role(c *gin.Context, instanceID uuid.UUID) string {
+	if !sessionVisible(c, instanceID.String()) {
+		return ""
+	}
+	if s.access == nil {
+		return database.SessionRoleOwner
+	}
+	return s.access.RequestRole(c, instanceID.String())
+}
+
+// instanceID parses an agent instance ID and checks the caller's role in it,
+// answering the request itself when either fails
+func (s *AgentMessageAPIService) instanceID(c *gin.Context, raw string, required string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid agent_instance_id"})
+		return uuid.Nil, false
+	}
+	if err := checkRole(s.role(c, id), required); err != nil {
+		c.JSON(accessErrorStatus(err), gin.H{"error": err.Error()})
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// SendAgentMessage posts an agent message, starting the agent instance on
+// its first message, and returns the user messages the agent had not read.
+// Messages are pushed to the user's devices when send_push is set, by default
+// when they ask for input; email and SMS flags are accepted but not sent yet.
+func (s *AgentMessageAPIService) SendAgentMessage(c *gin.Context) {
+	var req struct {
+		Content           string `json:"content" binding:"required"`
+		AgentInstanceID   string `json:"agent_instance_id" binding:"required"`
+		AgentType         string `json:"agent_type"`
+		RequiresUserInput bool   `json:"requires_user_input"`
+		GitDiff           string `json:"git_diff"`
+		SendPush          *bool  `json:"send_push"`
+		SendEmail         *bool  `json:"send_email"`
+		SendSMS           *bool  `json:"send_sms"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	id, ok := s.instanceID(c, req.AgentInstanceID, database.SessionRoleOwner)
+	if !ok {
+		return
+	}
+
+	push := req.RequiresUserInput
+	if req.SendPush != nil {
+		push = *req.SendPush
+	}
+
+	message, queued, err := s.agents.Send(c.Request.Context(), requestUserID(c), id, req.AgentType, req.Content, req.RequiresUserInput, req.GitDiff, push)
+	if err != nil {
+		c.JSON(agentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	contents := make([]string, 0, len(queued))
+	for _, queuedMessage := range queued {
+		contents = append(contents, queuedMessage.Content)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success":              true,
+		"agent_instance_id":    id.String(),
+		"message_id":           message.ID.String(),
+		"queued_user_messages": contents,
+	})
+}
+
+// GetPendingMessages returns the user messages an agent has not read, marking
+// them read. An agent that passes the last message it read learns, through
+// the stale status, that another process read the messages first.
+func (s *AgentMessageAPIService) GetPendingMessages(c *gin.Context) {
+	id, ok := s.instanceID(c, c.Query("agent_instance_id"), database.SessionRoleOwner)
+	if !ok {
+		return
+	}
+	var lastRead *uuid.UUID
+	if raw := c.Query("last_read_message_id"); raw != "" {
+		parsed, err := uuid.Parse(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid last_read_message_id"})
+			return
+		}
+		lastRead = &parsed
+	}
+
+	status := pendingStatusOK
+	messages, err := s.agents.Pending(c.Request.Context(), id, lastRead)
+	if errors.Is(err, ErrStaleRead) {
+		status = pendingStatusStale
+	} else if err != nil {
+		c.JSON(agentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"agent_instance_id": id.String(),
+		"status":            status,
+		"messages":          newAgentMessageResponses(messages),
+	})
+}
+
+// RequestUserInput turns an agent message into a question for the user and
+// returns any replies already queued
+func (s *AgentMessageAPIService) RequestUserInput(c *gin.Context) {
+	messageID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+	message, instance, err := s.agents.Message(c.Request.Context(), messageID)
+	if err != nil {
+		c.JSON(agentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	// Messages of instances the caller may not see read as missing
+	if checkRole(s.role(c, instance.ID), database.SessionRoleOwner) != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": ErrMessageNotFound.Error()})
+		return
+	}
+
+	queued, err := s.agents.RequestInput(c.Request.Context(), message, instance)
+	if err != nil {
+		c.JSON(agentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success":           true,
+		"agent_instance_id": instance.ID.String(),
+		"message_id":        message.ID.String(),
+		"messages":          newAgentMessageResponses(queued),
+	})
+}
+
+// SendUserMessage posts a user message to an agent instance
+func (s *AgentMessageAPIService) SendUserMessage(c *gin.Context) {
+	var req struct {
+		AgentInstanceID string `json:"agent_instance_id" binding:"required"`
+		Content         string `json:"content" binding:"required"`
+		MarkAsRead      bool   `json:"mark_as_read"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	id, ok := s.instanceID(c, req.AgentInstanceID, database.SessionRoleCommenter)
+	if !ok {
+		return
+	}
+
+	message, err := s.agents.Reply(c.Request.Context(), id, req.Content, req.MarkAsRead)
+	if err != nil {
+		c.JSON(agentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success":        true,
+		"message_id":     message.ID.String(),
+		"marked_as_read": req.MarkAsRead,
+	})
+}
+
+// EndSession marks an agent instance completed
+func (s *AgentMessageAPIService) EndSession(c *gin.Context) {
+	var req struct {
+		AgentInstanceID string `json:"agent_instance_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	id, ok := s.instanceID(c, req.AgentInstanceID, database.SessionRoleOwner)
+	if !ok {
+		return
+	}
+
+	instance, err := s.agents.End(id)
+	if err != nil {
+		c.JSON(agentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success":           true,
+		"agent_instance_id": instance.ID.String(),
+		"final_status":      instance.Status,
+	})
+}
+
+// ListAgentInstances lists the agent instances of the caller, newest first.
+// Their messages are read and answered through the session message routes.
+func (s *AgentMessageAPIService) ListAgentInstances(c *gin.Context) {
+	userID, err := uuid.Parse(requestUserID(c))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": ErrAgentUserRequired.Error()})
+		return
+	}
+	instances, err := s.agents.Instances(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	visible := make([]database.AgentInstance, 0, len(instances))
+	for _, instance := range instances {
+		if sessionVisible(c, instance.ID.String()) {
+			visible = append(visible, instance)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"instances": visible})
+}
+
+// GetAgentInstance describes one agent instance
+func (s *AgentMessageAPIService) GetAgentInstance(c *gin.Context) {
+	id, ok := s.instanceID(c, c.Param("id"), database.SessionRoleViewer)
+	if !ok {
+		return
+	}
+	instance, err := s.agents.Instance(id)
+	if err != nil {
+		c.JSON(agentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, instance)
+}
+
+// agentErrorStatus maps agent message errors to HTTP status codes
+func agentErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidAgentMessage):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrAgentUserRequired):
+		return http.StatusUnauthorized
+	case errors.Is(err, database.ErrAgentInstanceNotFound), errors.Is(err, ErrMessageNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, database.ErrAgentInstanceEnded), errors.Is(err, database.ErrAgentInstanceConflict):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// RegisterRoutes registers agent message API routes
+func (s *AgentMessageAPIService) RegisterRoutes(router *gin.Engine) {
+	messages := router.Group("/api/v1/messages")
+	{
+		messages.POST("/agent", s.SendAgentMessage)
+		messages.GET("/pending", s.GetPendingMessages)
+		messages.PATCH("/:id/request-input", s.RequestUserInput)
+		messages.POST("/user", s.SendUserMessage)
+	}
+	router.POST("/api/v1/sessions/end", s.EndSession)
+
+	instances := router.Group("/api/v1/agent-instances")
+	{
+		instances.GET("", s.ListAgentInstances)
+		instances.GET("/:id", s.GetAgentInstance)
+	}
+}
@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/majiayu000/anywhere-ai/core/auth"
+	"github.com/majiayu000/anywhere-ai/core/database"
+	"github.com/majiayu000/anywhere-ai/core/tmux"
+)
+
+// apiKeyContextKey is the context key of the API key of an authenticated request
+const apiKeyContextKey = "auth_api_key"
+
+// apiKeyTouchInterval is how stale the last use of an API key may get before
+// it is recorded again, sparing a write per request
+const apiKeyTouchInterval = time.Minute
+
+var (
+	// ErrScopeRequired is returned when an API key lacks the scope a request needs
+	ErrScopeRequired = errors.New("API key lacks the required scope")
+	// ErrSessionNotAllowed is returned when an API key is restricted to other sessions
+	ErrSessionNotAllowed = errors.New("API key is not allowed to reach this session")
+	// ErrInvalidScope is returned when issuing a key with an unknown scope
+	ErrInvalidScope = errors.New("invalid scope")
+)
+
+// apiKeyRouteScopes are the scopes API keys need, by method and route; every
+// other route needs admin. An empty scope takes any key.
+var apiKeyRouteScopes = map[string]string{
+	"GET /api/v1/auth/me":           "",
+	"GET /api/v1/ws":                database.ScopeReadSessions,
+	"GET /api/v1/claude-commands":   database.ScopeReadSessions,
+	"GET /api/v1/terminal/sessions": database.ScopeReadSessions,
+	"GET /api/v1/terminal/inbox":    database.ScopeReadSessions,
+	"GET /api/v1/terminal/search":   database.ScopeReadSessions,
+
+	"GET /api/v1/terminal/sessions/:id/output":                    database.ScopeReadSessions,
+	"GET /api/v1/terminal/sessions/:id/control":                   database.ScopeReadSessions,
+	"GET /api/v1/terminal/sessions/:id/presence":                  database.ScopeReadSessions,
+	"GET /api/v1/terminal/sessions/:id/lease":                     database.ScopeReadSessions,
+	"GET /api/v1/terminal/sessions/:id/usage":                     database.ScopeReadSessions,
+	"GET /api/v1/terminal/sessions/:id/checkpoints":               database.ScopeReadSessions,
+	"GET /api/v1/terminal/sessions/:id/messages":                  database.ScopeReadSessions,
+	"GET /api/v1/terminal/sessions/:id/messages/status":           database.ScopeReadSessions,
+	"GET /api/v1/terminal/sessions/:id/messages/queue":            database.ScopeReadSessions,
+	"GET /api/v1/terminal/sessions/:id/messages/unread":           database.ScopeReadSessions,
+	"GET /api/v1/terminal/sessions/:id/messages/cursors":          database.ScopeReadSessions,
+	"POST /api/v1/terminal/sessions/:id/messages/read":            database.ScopeReadSessions,
+	"GET /api/v1/terminal/sessions/:id/attachments/:attachmentId": database.ScopeReadSessions,
+	"GET /api/v1/terminal/sessions/:id/git/turns":                 database.ScopeReadSessions,
+	"GET /api/v1/terminal/sessions/:id/git/diff":                  database.ScopeReadSessions,
+
+	// Raw input or keys answering a permission prompt also need permissions:approve
+	"POST /api/v1/terminal/sessions/:id/input":       database.ScopeSendInput,
+	"POST /api/v1/terminal/sessions/:id/keys":        database.ScopeSendInput,
+	"POST /api/v1/terminal/sessions/:id/messages":    database.ScopeSendInput,
+	"POST /api/v1/terminal/sessions/:id/attachments": database.ScopeSendInput,
+
+	// Agents reporting through the SDK
+	"POST /api/v1/messages/agent":              database.ScopeSendInput,
+	"GET /api/v1/messages/pending":             database.ScopeReadSessions,
+	"PATCH /api/v1/messages/:id/request-input": database.ScopeSendInput,
+	"POST /api/v1/messages/user":               database.ScopeSendInput,
+	"POST /api/v1/sessions/end":                database.ScopeSendInput,
+	"GET /api/v1/agent-instances":              database.ScopeReadSessions,
+	"GET /api/v1/agent-instances/:id":          database.ScopeReadSessions,
+}
+
+// authorizeKey checks that an API key may make a request: it grants the scope
+// of the route, and any session the request names is one the key may reach
+func authorizeKey(c *gin.Context, key *database.APIKey) error {
+	route := c.FullPath()
+	scope, listed := apiKeyRouteScopes[c.Request.Method+" "+route]
+	if !listed {
+		scope = database.ScopeAdmin
+	}
+	if scope != "" && !key.HasScope(scope) {
+		return fmt.Errorf("%w: %s", ErrScopeRequired, scope)
+	}
+
+	if len(key.SessionIDs) == 0 {
+		return nil
+	}
+	switch {
+	case strings.HasPrefix(route, "/api/v1/terminal/sessions/:id"):
+		if !key.AllowsSession(c.Param("id")) {
+			return fmt.Errorf("%w: %s", ErrSessionNotAllowed, c.Param("id"))
+		}
+	case route == "/api/v1/terminal/search":
+		if !key.AllowsSession(c.Query("session_id")) {
+			return fmt.Errorf("%w: search one of its sessions with session_id", ErrSessionNotAllowed)
+		}
+	case strings.HasPrefix(route, "/api/v1/auth/keys"):
+		// A key restricted to some sessions must not mint keys for others
+		return fmt.Errorf("%w: keys restricted to sessions cannot manage keys", ErrScopeRequired)
+	}
+	return nil
+}
+
+// requestAPIKey returns the API key a request was authenticated with, or nil
+func requestAPIKey(c *gin.Context) *database.APIKey {
+	if value, exists := c.Get(apiKeyContextKey); exists {
+		if key, ok := value.(*database.APIKey); ok {
+			return key
+		}
+	}
+	return nil
+}
+
+// requestUserID returns the user an authenticated request acts for, or ""
+func requestUserID(c *gin.Context) string {
+	if claims := authClaims(c); claims != nil {
+		return claims.UserID
+	}
+	if key := requestAPIKey(c); key != nil {
+		return key.UserID.String()
+	}
+	return ""
+}
+
+// sessionVisible reports whether a request may see a session: it was not made
+// with an API key restricted to other sessions
+func sessionVisible(c *gin.Context, sessionID string) bool {
+	key := requestAPIKey(c)
+	return key == nil || key.AllowsSession(sessionID)
+}
+
+// checkInputKey checks that an API key may send raw input or keys to a
+// session. Input answering a permission prompt needs permissions:approve;
+// prompts of sessions on other devices cannot be seen from here, so keys
+// without it may only send raw input to sessions running here.
+func checkInputKey(ctx context.Context, tmuxManager *tmux.Manager, key *database.APIKey, sessionID string) error {
+	if key == nil || key.HasScope(database.ScopeApprovePermissions) {
+		return nil
+	}
+	if !key.HasScope(database.ScopeSendInput) {
+		return fmt.Errorf("%w: %s", ErrScopeRequired, database.ScopeSendInput)
+	}
+	if _, err := tmuxManager.GetSession(sessionID); err != nil || permissionPending(ctx, tmuxManager, sessionID) {
+		return fmt.Errorf("%w: %s", ErrScopeRequired, database.ScopeApprovePermissions)
+	}
+	return nil
+}
+
+// authenticateKey returns the usable API key behind a bearer token, recording its use
+func (s *AuthService) authenticateKey(token string) (*database.APIKey, error) {
+	key, err := s.apiKeys.FindAPIKey(auth.HashAPIKey(token))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > apiKeyTouchInterval {
+		if err := s.apiKeys.TouchAPIKey(key.ID, now); err != nil {
+			log.Printf("Failed to record use of API key %s: %v", key.ID, err)
+		}
+		key.LastUsedAt = &now
+	}
+	return key, nil
+}
+
+// IssueAPIKey issues an API key to a user. The key is returned only here;
+// only its hash is stored.
+func (s *AuthService) IssueAPIKey(userID string, name string, scopes []string, sessionIDs []string, expiresAt *time.Time) (*database.APIKey, string, error) {
+	owner, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %s", database.ErrUserNotFound, userID)
+	}
+	if len(scopes) == 0 {
+		return nil, "", fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+	for _, scope := range scopes {
+		if !validScope(scope) {
+			return nil, "", fmt.Errorf("%w: %s", ErrInvalidScope, scope)
+		}
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, "", fmt.Errorf("%w: expiry is in the past", ErrInvalidScope)
+	}
+
+	secret, err := auth.GenerateAPIKey()
+	if err != nil {
+		return nil, "", err
+	}
+	key := &database.APIKey{
+		UserID:     owner,
+		Name:       name,
+		APIKeyHash: auth.HashAPIKey(secret),
+		KeyPrefix:  auth.APIKeyPrefix(secret),
+		Scopes:     scopes,
+		SessionIDs: sessionIDs,
+		IsActive:   true,
+		ExpiresAt:  expiresAt,
+	}
+	if err := s.apiKeys.CreateAPIKey(key); err != nil {
+		return nil, "", err
+	}
+	return key, secret, nil
+}
+
+// validScope reports whether a scope exists
+func validScope(scope string) bool {
+	for _, known := range database.APIKeyScopes {
+		if scope == known {
+			return true
+		}
+	}
+	return false
+}
+
+// keyErrorStatus maps API key errors to HTTP status codes
+func keyErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidScope):
+		return http.StatusBadRequest
+	case errors.Is(err, database.ErrAPIKeyNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, database.ErrUserNotFound):
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
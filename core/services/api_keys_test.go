@@ -0,0 +1,85 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/majiayu000/anywhere-ai/core/database"
+)
+
+func TestAPIKeyRestrictedToSessions(t *testing.T) {
+	s := newTestServer(t)
+	s.handle(http.MethodGet, "/api/v1/terminal/sessions/:id/messages")
+	s.handle(http.MethodPost, "/api/v1/terminal/sessions/:id/input")
+	s.handle(http.MethodGet, "/api/v1/terminal/search")
+	s.handle(http.MethodPost, "/api/v1/auth/keys")
+	user, _ := s.user(t, "owner@example.com")
+	s.session(t, "allowed", user.ID)
+	s.session(t, "other", user.ID)
+
+	_, key, err := s.auth.IssueAPIKey(user.ID.String(), "ci", []string{database.ScopeReadSessions}, []string{"allowed"}, nil)
+	if err != nil {
+		t.Fatalf("issue key: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		want   int
+	}{
+		{"its session", http.MethodGet, "/api/v1/terminal/sessions/allowed/messages", http.StatusOK},
+		{"another session of its user", http.MethodGet, "/api/v1/terminal/sessions/other/messages", http.StatusForbidden},
+		{"search of its session", http.MethodGet, "/api/v1/terminal/search?session_id=allowed&q=x", http.StatusOK},
+		{"search of every session", http.MethodGet, "/api/v1/terminal/search?q=x", http.StatusForbidden},
+		{"search of another session", http.MethodGet, "/api/v1/terminal/search?session_id=other&q=x", http.StatusForbidden},
+		{"missing scope", http.MethodPost, "/api/v1/terminal/sessions/allowed/input", http.StatusForbidden},
+		{"minting keys", http.MethodPost, "/api/v1/auth/keys", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.do(tt.method, tt.path, key); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIKeyRejected(t *testing.T) {
+	s := newTestServer(t)
+	s.handle(http.MethodGet, "/api/v1/terminal/sessions")
+	user, _ := s.user(t, "owner@example.com")
+
+	expiring := time.Now().Add(time.Hour)
+	expired, expiredKey, err := s.auth.IssueAPIKey(user.ID.String(), "expired", []string{database.ScopeReadSessions}, nil, &expiring)
+	if err != nil {
+		t.Fatalf("issue key: %v", err)
+	}
+	if err := s.db.Model(expired).Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatalf("expire key: %v", err)
+	}
+	revoked, revokedKey, err := s.auth.IssueAPIKey(user.ID.String(), "revoked", []string{database.ScopeReadSessions}, nil, nil)
+	if err != nil {
+		t.Fatalf("issue key: %v", err)
+	}
+	if _, err := s.auth.apiKeys.RevokeAPIKey(user.ID, revoked.ID); err != nil {
+		t.Fatalf("revoke key: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{"expired", expiredKey},
+		{"revoked", revokedKey},
+		{"unknown", expiredKey[:len(expiredKey)-4] + "0000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.do(http.MethodGet, "/api/v1/terminal/sessions", tt.key); got != http.StatusUnauthorized {
+				t.Errorf("status = %d, want %d", got, http.StatusUnauthorized)
+			}
+		})
+	}
+}
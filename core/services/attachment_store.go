@@ -0,0 +1,243 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/majiayu000/anywhere-ai/core/database"
+	"gorm.io/gorm"
+)
+
+const (
+	// MaxAttachmentSize is the largest file accepted for upload
+	MaxAttachmentSize = 10 << 20
+	// attachmentWorkDir is where attachments are written inside a session working directory
+	attachmentWorkDir = ".anywhere/attachments"
+)
+
+// allowedAttachmentTypes lists the content types accepted for upload
+var allowedAttachmentTypes = map[string]bool{
+	"image/png":        true,
+	"image/jpeg":       true,
+	"image/gif":        true,
+	"image/webp":       true,
+	"text/plain":       true,
+	"text/csv":         true,
+	"text/markdown":    true,
+	"application/json": true,
+	"application/pdf":  true,
+}
+
+// ErrAttachmentTooLarge is returned when an upload exceeds MaxAttachmentSize
+var ErrAttachmentTooLarge = errors.New("attachment exceeds maximum size")
+
+// ErrAttachmentType is returned when an upload has a content type that is not allowed
+var ErrAttachmentType = errors.New("attachment content type not allowed")
+
+var unsafeFileNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// AttachmentStore stores uploaded files in a local blob store under each session
+type AttachmentStore struct {
+	db      *gorm.DB
+	baseDir string
+}
+
+// NewAttachmentStore creates a new attachment store rooted at baseDir
+func NewAttachmentStore(db *gorm.DB, baseDir string) *AttachmentStore {
+	return &AttachmentStore{
+		db:      db,
+		baseDir: baseDir,
+	}
+}
+
+// Save validates and stores an uploaded file for a session
+func (s *AttachmentStore) Save(ctx context.Context, sessionID string, fileName string, declaredType string, r io.Reader) (*database.Attachment, error) {
+	// Read one byte past the limit to detect oversized uploads
+	data, err := io.ReadAll(io.LimitReader(r, MaxAttachmentSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read attachment: %w", err)
+	}
+	if len(data) > MaxAttachmentSize {
+		return nil, ErrAttachmentTooLarge
+	}
+
+	contentType, err := detectAttachmentType(fileName, declaredType, data)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	attachment := &database.Attachment{
+		ID:          uuid.New(),
+		SessionID:   sessionID,
+		FileName:    sanitizeFileName(fileName),
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		SHA256:      hex.EncodeToString(sum[:]),
+		CreatedAt:   time.Now(),
+	}
+
+	sessionDir := filepath.Join(s.baseDir, sanitizeFileName(sessionID))
+	if err := os.MkdirAll(sessionDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create attachment directory: %w", err)
+	}
+	attachment.StoragePath = filepath.Join(sessionDir, attachment.ID.String())
+
+	if err := os.WriteFile(attachment.StoragePath, data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write attachment: %w", err)
+	}
+
+	if err := s.db.WithContext(ctx).Create(attachment).Error; err != nil {
+		os.Remove(attachment.StoragePath)
+		return nil, fmt.Errorf("failed to save attachment: %w", err)
+	}
+
+	return attachment, nil
+}
+
+// Get retrieves an attachment of a session by ID
+func (s *AttachmentStore) Get(ctx context.Context, sessionID string, id uuid.UUID) (*database.Attachment, error) {
+	var attachment database.Attachment
+	if err := s.db.WithContext(ctx).
+		Where("id = ? AND session_id = ?", id, sessionID).
+		First(&attachment).Error; err != nil {
+		return nil, fmt.Errorf("attachment %s not found: %w", id, err)
+	}
+
+	return &attachment, nil
+}
+
+// Link attaches stored uploads to the message they were sent with
+func (s *AttachmentStore) Link(ctx context.Context, messageID uuid.UUID, attachments []*database.Attachment) error {
+	for _, attachment := range attachments {
+		if err := s.db.WithContext(ctx).
+			Model(&database.Attachment{}).
+			Where("id = ?", attachment.ID).
+			Update("message_id", messageID).Error; err != nil {
+			return fmt.Errorf("failed to link attachment: %w", err)
+		}
+		attachment.MessageID = &messageID
+	}
+
+	return nil
+}
+
+// ForMessage retrieves the attachments sent with a message
+func (s *AttachmentStore) ForMessage(ctx context.Context, messageID uuid.UUID) ([]*database.Attachment, error) {
+	var attachments []*database.Attachment
+	if err := s.db.WithContext(ctx).
+		Where("message_id = ?", messageID).
+		Order("created_at ASC").
+		Find(&attachments).Error; err != nil {
+		return nil, fmt.Errorf("failed to get attachments: %w", err)
+	}
+
+	return attachments, nil
+}
+
+// Materialize copies an attachment into a session working directory and
+// returns its path relative to that directory
+func (s *AttachmentStore) Materialize(attachment *database.Attachment, workDir string) (string, error) {
+	dir := filepath.Join(workDir, attachmentWorkDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create attachment directory: %w", err)
+	}
+
+	// Keep attachments out of git status and the per-turn diffs
+	ignoreFile := filepath.Join(workDir, ".anywhere", ".gitignore")
+	if _, err := os.Stat(ignoreFile); os.IsNotExist(err) {
+		os.WriteFile(ignoreFile, []byte("*\n"), 0644)
+	}
+
+	data, err := os.ReadFile(attachment.StoragePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read attachment: %w", err)
+	}
+
+	relPath := filepath.Join(attachmentWorkDir, attachment.ID.String()[:8]+"-"+attachment.FileName)
+	if err := os.WriteFile(filepath.Join(workDir, relPath), data, 0644); err != nil {
+		return "", fmt.Errorf("failed to write attachment: %w", err)
+	}
+
+	return relPath, nil
+}
+
+// MessageMetadata builds the TerminalMessage metadata referencing attachments
+func (s *AttachmentStore) MessageMetadata(attachments []*database.Attachment) string {
+	if len(attachments) == 0 {
+		return ""
+	}
+
+	metadata := database.MessageMetadata{}
+	for _, attachment := range attachments {
+		metadata.Attachments = append(metadata.Attachments, database.AttachmentRef{
+			ID:          attachment.ID,
+			FileName:    attachment.FileName,
+			ContentType: attachment.ContentType,
+			Size:        attachment.Size,
+		})
+	}
+
+	data, _ := json.Marshal(metadata)
+	return string(data)
+}
+
+// detectAttachmentType determines the content type of an upload from its
+// content, falling back to the declared type or file extension for text formats
+func detectAttachmentType(fileName string, declaredType string, data []byte) (string, error) {
+	sniffed := baseContentType(http.DetectContentType(data))
+	if sniffed != "text/plain" && sniffed != "application/octet-stream" {
+		// Binary formats must be recognizable from their content
+		if !allowedAttachmentTypes[sniffed] {
+			return "", fmt.Errorf("%w: %s", ErrAttachmentType, sniffed)
+		}
+		return sniffed, nil
+	}
+
+	// Text content: refine using the declared type or extension
+	candidates := []string{baseContentType(declaredType), baseContentType(mime.TypeByExtension(filepath.Ext(fileName)))}
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, "text/") || candidate == "application/json" {
+			if allowedAttachmentTypes[candidate] {
+				return candidate, nil
+			}
+		}
+	}
+
+	if sniffed == "text/plain" {
+		return sniffed, nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrAttachmentType, sniffed)
+}
+
+// baseContentType strips parameters such as charset from a content type
+func baseContentType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
+// sanitizeFileName makes a name safe to use as a single path component
+func sanitizeFileName(name string) string {
+	name = unsafeFileNameChars.ReplaceAllString(filepath.Base(name), "_")
+	name = strings.Trim(name, "._")
+	if name == "" {
+		return "attachment"
+	}
+	return name
+}
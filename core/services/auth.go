@@ -0,0 +1,269 @@
+package services
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/majiayu000/anywhere-ai/core/auth"
+	"github.com/majiayu000/anywhere-ai/core/database"
+)
+
+// Cookies holding the tokens of browser sessions
+const (
+	AccessTokenCookie  = "anywhere_session"
+	RefreshTokenCookie = "anywhere_refresh"
+)
+
+// authClaimsKey is the context key of the claims of an authenticated request
+const authClaimsKey = "auth_claims"
+
+var (
+	// ErrNotAuthenticated is returned for a request without valid credentials
+	ErrNotAuthenticated = errors.New("authentication required")
+	// ErrInvalidLogin is returned for a wrong email address or password
+	ErrInvalidLogin = errors.New("invalid email or password")
+)
+
+// AuthService authenticates requests to the core API with the JWTs issued at
+// login, sent as a Bearer token or in the session cookie, or with scoped API
+// keys sent as a Bearer token
+type AuthService struct {
+	jwt     *auth.JWTManager
+	users   *database.UserRepository
+	apiKeys *database.APIKeyRepository
+
+	providers map[string]auth.Provider
+	allowlist *auth.Allowlist // OAuth accounts that may sign in
+
+	// Password login of the server's owner, when set
+	ownerEmail    string
+	ownerPassword string
+
+	anonymous     map[string]bool // Route paths served without authentication
+	secureCookies bool
+	disabled      bool
+}
+
+// NewAuthService creates a new auth service
+func NewAuthService(jwt *auth.JWTManager, users *database.UserRepository, apiKeys *database.APIKeyRepository) *AuthService {
+	return &AuthService{
+		jwt:       jwt,
+		users:     users,
+		apiKeys:   apiKeys,
+		providers: make(map[string]auth.Provider),
+		allowlist: auth.NewAllowlist(nil),
+		anonymous: make(map[string]bool),
+	}
+}
+
+// SetProviders sets the OAuth providers users may sign in with, by name
+func (s *AuthService) SetProviders(providers map[string]auth.Provider) {
+	s.providers = providers
+}
+
+// SetAllowlist sets the OAuth accounts that may sign in. The owner may always
+// sign in; everyone else is refused before a user is created for them.
+func (s *AuthService) SetAllowlist(allowlist *auth.Allowlist) {
+	s.allowlist = allowlist
+}
+
+// SetOwnerLogin lets the server's owner sign in with an email address and password
+func (s *AuthService) SetOwnerLogin(email, password string) {
+	s.ownerEmail = strings.ToLower(strings.TrimSpace(email))
+	s.ownerPassword = password
+}
+
+// SetSecureCookies marks cookies Secure, for servers reached over HTTPS
+func (s *AuthService) SetSecureCookies(secure bool) {
+	s.secureCookies = secure
+}
+
+// Disable turns authentication off, for development on a trusted machine only
+func (s *AuthService) Disable() {
+	s.disabled = true
+}
+
+// AllowAnonymous serves routes, by their registered path, without authentication
+func (s *AuthService) AllowAnonymous(paths ...string) {
+	for _, path := range paths {
+		s.anonymous[path] = true
+	}
+}
+
+// AuthRequired rejects requests without a valid access token or API key,
+// except to routes allowed anonymously, and requests an API key's scopes do
+// not cover. WebSocket upgrades are authenticated too.
+func (s *AuthService) AuthRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.disabled || s.anonymous[c.FullPath()] {
+			c.Next()
+			return
+		}
+
+		token := requestToken(c)
+		if auth.IsAPIKey(token) {
+			key, err := s.authenticateKey(token)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+				return
+			}
+			if err := authorizeKey(c, key); err != nil {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+				return
+			}
+			c.Set(apiKeyContextKey, key)
+			c.Next()
+			return
+		}
+
+		claims, err := s.Authenticate(token)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+		c.Set(authClaimsKey, claims)
+		c.Next()
+	}
+}
+
+// Authenticate validates an access token
+func (s *AuthService) Authenticate(token string) (*auth.Claims, error) {
+	if token == "" {
+		return nil, ErrNotAuthenticated
+	}
+	return s.jwt.ValidateToken(token)
+}
+
+// requestToken returns the access token or API key of a request, taken from
+// the Authorization header or the session cookie. Browsers cannot set headers
+// on WebSocket upgrades from other origins, so those may pass it as
+// access_token.
+func requestToken(c *gin.Context) string {
+	token := auth.ExtractTokenFromHeader(c.GetHeader("Authorization"))
+	if token == "" {
+		token, _ = c.Cookie(AccessTokenCookie)
+	}
+	if token == "" && websocket.IsWebSocketUpgrade(c.Request) {
+		token = c.Query("access_token")
+	}
+	return token
+}
+
+// authClaims returns the claims of an authenticated request, or nil
+func authClaims(c *gin.Context) *auth.Claims {
+	if value, exists := c.Get(authClaimsKey); exists {
+		if claims, ok := value.(*auth.Claims); ok {
+			return claims
+		}
+	}
+	return nil
+}
+
+// LoginOwner signs the server's owner in with their password
+func (s *AuthService) LoginOwner(email, password string) (*database.User, *auth.TokenPair, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if s.ownerPassword == "" ||
+		subtle.ConstantTimeCompare([]byte(email), []byte(s.ownerEmail)) != 1 ||
+		subtle.ConstantTimeCompare([]byte(password), []byte(s.ownerPassword)) != 1 {
+		return nil, nil, ErrInvalidLogin
+	}
+	user, err := s.users.SignIn(database.IdentityProviderLocal, email, email, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	tokens, err := s.issue(user)
+	return user, tokens, err
+}
+
+// LoginOAuth signs in the user a provider sent back with a code
+func (s *AuthService) LoginOAuth(c *gin.Context, providerName, code string) (*database.User, *auth.TokenPair, error) {
+	provider, exists := s.providers[providerName]
+	if !exists {
+		return nil, nil, auth.ErrUnknownProvider
+	}
+	info, err := provider.Exchange(c.Request.Context(), code)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !s.signInAllowed(info.Email) {
+		return nil, nil, fmt.Errorf("%w: %s", auth.ErrSignupNotAllowed, info.Email)
+	}
+	user, err := s.users.SignIn(provider.Name(), info.Subject, info.Email, info.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	tokens, err := s.issue(user)
+	return user, tokens, err
+}
+
+// signInAllowed reports whether an OAuth account may sign in
+func (s *AuthService) signInAllowed(email string) bool {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if s.ownerEmail != "" && email == s.ownerEmail {
+		return true
+	}
+	return s.allowlist.Allowed(email)
+}
+
+// Refresh issues new tokens for a refresh token, to a user that still exists
+func (s *AuthService) Refresh(refreshToken string) (*auth.TokenPair, error) {
+	userID, err := s.jwt.ValidateRefreshToken(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.users.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.issue(user)
+}
+
+// issue issues the tokens of a user
+func (s *AuthService) issue(user *database.User) (*auth.TokenPair, error) {
+	name := user.Email
+	if user.DisplayName != nil {
+		name = *user.DisplayName
+	}
+	return s.jwt.GenerateTokenPair(user.ID.String(), name, user.Email, "user")
+}
+
+// setTokenCookies keeps the tokens of a browser session in HttpOnly cookies
+func (s *AuthService) setTokenCookies(c *gin.Context, tokens *auth.TokenPair) {
+	config := s.jwt.Config()
+	s.setCookie(c, AccessTokenCookie, tokens.AccessToken, config.Expiration)
+	s.setCookie(c, RefreshTokenCookie, tokens.RefreshToken, config.RefreshExpiration)
+}
+
+// clearTokenCookies ends a browser session
+func (s *AuthService) clearTokenCookies(c *gin.Context) {
+	s.setCookie(c, AccessTokenCookie, "", -1)
+	s.setCookie(c, RefreshTokenCookie, "", -1)
+}
+
+// setCookie sets an HttpOnly cookie on the whole site; a negative maxAge deletes it
+func (s *AuthService) setCookie(c *gin.Context, name, value string, maxAge time.Duration) {
+	seconds := int(maxAge.Seconds())
+	if maxAge < 0 {
+		seconds = -1
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   seconds,
+		HttpOnly: true,
+		Secure:   s.secure(c),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// secure reports whether cookies set on a request should be Secure
+func (s *AuthService) secure(c *gin.Context) bool {
+	return s.secureCookies || c.Request.TLS != nil
+}
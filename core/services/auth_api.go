@@ -0,0 +1,306 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/majiayu000/anywhere-ai/core/auth"
+	"github.com/majiayu000/anywhere-ai/core/database"
+)
+
+// Cookies carrying an OAuth login from its start to the provider's callback
+const (
+	oauthStateCookie  = "anywhere_oauth_state"
+	oauthReturnCookie = "anywhere_oauth_return"
+)
+
+// AuthAPIService handles login and the tokens of signed in users
+type AuthAPIService struct {
+	auth *AuthService
+}
+
+// NewAuthAPIService creates a new auth API service
+func NewAuthAPIService(authService *AuthService) *AuthAPIService {
+	return &AuthAPIService{
+		auth: authService,
+	}
+}
+
+// RegisterRoutes registers the auth routes; all but /me and the API key routes
+// are served anonymously
+func (s *AuthAPIService) RegisterRoutes(router *gin.Engine) {
+	api := router.Group("/api/v1/auth")
+	{
+		api.GET("/providers", s.ListProviders)
+		api.POST("/login", s.Login)
+		api.POST("/refresh", s.Refresh)
+		api.POST("/logout", s.Logout)
+		api.GET("/me", s.Me)
+		api.GET("/keys", s.ListAPIKeys)
+		api.POST("/keys", s.CreateAPIKey)
+		api.DELETE("/keys/:keyId", s.RevokeAPIKey)
+		api.GET("/:provider/login", s.StartOAuth)
+		// Apple posts the code back as a form
+		api.GET("/:provider/callback", s.OAuthCallback)
+		api.POST("/:provider/callback", s.OAuthCallback)
+	}
+	s.auth.AllowAnonymous(
+		"/api/v1/auth/providers",
+		"/api/v1/auth/login",
+		"/api/v1/auth/refresh",
+		"/api/v1/auth/logout",
+		"/api/v1/auth/:provider/login",
+		"/api/v1/auth/:provider/callback",
+	)
+}
+
+// ListProviders lists the ways to sign in
+func (s *AuthAPIService) ListProviders(c *gin.Context) {
+	providers := make([]string, 0, len(s.auth.providers))
+	for name := range s.auth.providers {
+		providers = append(providers, name)
+	}
+	sort.Strings(providers)
+
+	c.JSON(http.StatusOK, gin.H{
+		"providers": providers,
+		"password":  s.auth.ownerPassword != "",
+	})
+}
+
+// Login signs the server's owner in with their email address and password
+func (s *AuthAPIService) Login(c *gin.Context) {
+	var req struct {
+		Email    string `json:"email" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, tokens, err := s.auth.LoginOwner(req.Email, req.Password)
+	if err != nil {
+		if errors.Is(err, ErrInvalidLogin) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.auth.setTokenCookies(c, tokens)
+	c.JSON(http.StatusOK, gin.H{"user": user, "tokens": tokens})
+}
+
+// Refresh issues new tokens for the refresh token in the body or cookie
+func (s *AuthAPIService) Refresh(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	c.ShouldBindJSON(&req)
+	if req.RefreshToken == "" {
+		req.RefreshToken, _ = c.Cookie(RefreshTokenCookie)
+	}
+	if req.RefreshToken == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "refresh_token is required"})
+		return
+	}
+
+	tokens, err := s.auth.Refresh(req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) || errors.Is(err, database.ErrUserNotFound) {
+			s.auth.clearTokenCookies(c)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	s.auth.setTokenCookies(c, tokens)
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Logout ends the browser session
+func (s *AuthAPIService) Logout(c *gin.Context) {
+	s.auth.clearTokenCookies(c)
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+// Me returns the signed in user
+func (s *AuthAPIService) Me(c *gin.Context) {
+	userID := requestUserID(c)
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	user, err := s.auth.users.GetUser(userID)
+	if err != nil {
+		if errors.Is(err, database.ErrUserNotFound) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// ListAPIKeys lists the API keys of the signed in user; keys are never shown again
+func (s *AuthAPIService) ListAPIKeys(c *gin.Context) {
+	userID, err := uuid.Parse(requestUserID(c))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	keys, err := s.auth.apiKeys.ListAPIKeys(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"keys": keys, "scopes": database.APIKeyScopes})
+}
+
+// CreateAPIKey issues an API key to the signed in user. The response is the
+// only time the key is shown.
+func (s *AuthAPIService) CreateAPIKey(c *gin.Context) {
+	var req struct {
+		Name       string     `json:"name" binding:"required"`
+		Scopes     []string   `json:"scopes" binding:"required"`
+		SessionIDs []string   `json:"session_ids"`
+		ExpiresAt  *time.Time `json:"expires_at"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	key, secret, err := s.auth.IssueAPIKey(requestUserID(c), req.Name, req.Scopes, req.SessionIDs, req.ExpiresAt)
+	if err != nil {
+		c.JSON(keyErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"key": key, "api_key": secret})
+}
+
+// RevokeAPIKey revokes an API key of the signed in user
+func (s *AuthAPIService) RevokeAPIKey(c *gin.Context) {
+	userID, err := uuid.Parse(requestUserID(c))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	keyID, err := uuid.Parse(c.Param("keyId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid key ID"})
+		return
+	}
+
+	key, err := s.auth.apiKeys.RevokeAPIKey(userID, keyID)
+	if err != nil {
+		c.JSON(keyErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, key)
+}
+
+// StartOAuth sends the browser to a provider to sign in. The redirect query
+// parameter is the local path to return to afterwards.
+func (s *AuthAPIService) StartOAuth(c *gin.Context) {
+	provider, exists := s.auth.providers[c.Param("provider")]
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": auth.ErrUnknownProvider.Error()})
+		return
+	}
+
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+	state := base64.RawURLEncoding.EncodeToString(raw)
+
+	s.setOAuthCookie(c, oauthStateCookie, state, 600)
+	s.setOAuthCookie(c, oauthReturnCookie, localPath(c.Query("redirect")), 600)
+	c.Redirect(http.StatusFound, provider.AuthURL(state))
+}
+
+// OAuthCallback finishes a login when the provider sends the browser back
+func (s *AuthAPIService) OAuthCallback(c *gin.Context) {
+	providerName := c.Param("provider")
+	state := c.Query("state")
+	code := c.Query("code")
+	if c.Request.Method == http.MethodPost {
+		state = c.PostForm("state")
+		code = c.PostForm("code")
+	}
+
+	expected, _ := c.Cookie(oauthStateCookie)
+	returnPath, _ := c.Cookie(oauthReturnCookie)
+	s.setOAuthCookie(c, oauthStateCookie, "", -1)
+	s.setOAuthCookie(c, oauthReturnCookie, "", -1)
+	if expected == "" || subtle.ConstantTimeCompare([]byte(state), []byte(expected)) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid login state"})
+		return
+	}
+	if code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Login was cancelled"})
+		return
+	}
+
+	user, tokens, err := s.auth.LoginOAuth(c, providerName, code)
+	if err != nil {
+		log.Printf("Failed %s login: %v", providerName, err)
+		switch {
+		case errors.Is(err, auth.ErrUnknownProvider):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, auth.ErrUnverifiedEmail), errors.Is(err, auth.ErrSignupNotAllowed):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Login failed"})
+		}
+		return
+	}
+
+	log.Printf("User %s signed in with %s", user.Email, providerName)
+	s.auth.setTokenCookies(c, tokens)
+	c.Redirect(http.StatusFound, localPath(returnPath))
+}
+
+// setOAuthCookie sets a cookie read back by the callback. Apple posts the
+// callback from its own site, which only carries SameSite=None cookies.
+func (s *AuthAPIService) setOAuthCookie(c *gin.Context, name, value string, maxAge int) {
+	sameSite := http.SameSiteLaxMode
+	if s.auth.secure(c) {
+		sameSite = http.SameSiteNoneMode
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/api/v1/auth",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   s.auth.secure(c),
+		SameSite: sameSite,
+	})
+}
+
+// localPath returns path if it stays on this server, or /
+func localPath(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.Contains(path, "\\") {
+		return "/"
+	}
+	return path
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/majiayu000/anywhere-ai/core/auth"
+	"github.com/majiayu000/anywhere-ai/core/database"
+	"github.com/majiayu000/anywhere-ai/core/migrations"
+	"gorm.io/gorm"
+)
+
+// testServer is a server's access control in front of handlers that only answer 200
+type testServer struct {
+	db     *gorm.DB
+	jwt    *auth.JWTManager
+	auth   *AuthService
+	access *SessionAccessService
+	router *gin.Engine
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	db, err := database.OpenGormDB(migrations.SQLite, filepath.Join(t.TempDir(), "anywhere.db"))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	users := database.NewUserRepository(db)
+	jwt := auth.NewJWTManager(auth.DefaultJWTConfig("test-secret"))
+
+	s := &testServer{
+		db:     db,
+		jwt:    jwt,
+		auth:   NewAuthService(jwt, users, database.NewAPIKeyRepository(db)),
+		access: NewSessionAccessService(database.NewSessionRepository(db), database.NewShareRepository(db), users),
+		router: gin.New(),
+	}
+	s.router.Use(s.auth.AuthRequired(), s.access.Authorize())
+	return s
+}
+
+// handle answers a route with 200 once access control let the request through
+func (s *testServer) handle(method, route string) {
+	s.router.Handle(method, route, func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+}
+
+// user signs a user in and returns it with an access token
+func (s *testServer) user(t *testing.T, email string) (*database.User, string) {
+	t.Helper()
+	user, err := s.auth.users.SignIn("test", email, email, "")
+	if err != nil {
+		t.Fatalf("sign in %s: %v", email, err)
+	}
+	token, err := s.jwt.GenerateToken(user.ID.String(), email, email, "user")
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+	return user, token
+}
+
+// session creates a session owned by a user
+func (s *testServer) session(t *testing.T, id string, owner uuid.UUID) {
+	t.Helper()
+	session := &database.TerminalSession{ID: id, UserID: &owner, Name: id, OwnerDeviceID: "test"}
+	if err := s.db.Create(session).Error; err != nil {
+		t.Fatalf("create session %s: %v", id, err)
+	}
+}
+
+// do sends a request with a bearer token, if any, and returns its status
+func (s *testServer) do(method, path, token string) int {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestAuthRequired(t *testing.T) {
+	s := newTestServer(t)
+	s.handle(http.MethodGet, "/api/v1/auth/me")
+	user, access := s.user(t, "owner@example.com")
+	refresh, err := s.jwt.GenerateRefreshToken(user.ID.String())
+	if err != nil {
+		t.Fatalf("generate refresh token: %v", err)
+	}
+	other := auth.NewJWTManager(auth.DefaultJWTConfig("other-secret"))
+	forged, err := other.GenerateToken(user.ID.String(), "owner", "owner@example.com", "user")
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"access token", access, http.StatusOK},
+		{"no token", "", http.StatusUnauthorized},
+		{"refresh token", refresh, http.StatusUnauthorized},
+		{"token of another server", forged, http.StatusUnauthorized},
+		{"garbage", "not-a-token", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.do(http.MethodGet, "/api/v1/auth/me", tt.token); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthRequiredAllowsAnonymousRoutes(t *testing.T) {
+	s := newTestServer(t)
+	s.handle(http.MethodGet, "/api/v1/auth/providers")
+	s.auth.AllowAnonymous("/api/v1/auth/providers")
+
+	if got := s.do(http.MethodGet, "/api/v1/auth/providers", ""); got != http.StatusOK {
+		t.Errorf("status = %d, want %d", got, http.StatusOK)
+	}
+}
@@ -0,0 +1,544 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/majiayu000/anywhere-ai/core/database"
+	"github.com/majiayu000/anywhere-ai/core/git"
+	"github.com/majiayu000/anywhere-ai/core/terminal"
+	"github.com/majiayu000/anywhere-ai/core/tmux"
+	"github.com/majiayu000/anywhere-ai/core/tools"
+	"gorm.io/gorm"
+)
+
+const (
+	// checkpointRefPrefix holds the working tree commits of checkpoints
+	checkpointRefPrefix = "refs/anywhere/checkpoints/"
+	// maxAutoCheckpoints is how many automatic checkpoints are kept per session
+	maxAutoCheckpoints = 50
+)
+
+var (
+	// ErrCheckpointNotFound is returned for an unknown checkpoint
+	ErrCheckpointNotFound = errors.New("checkpoint not found")
+	// ErrCheckpointConflict is returned when the repository has moved on in a
+	// way a restore would silently undo
+	ErrCheckpointConflict = errors.New("checkpoint conflicts with the repository")
+)
+
+// CheckpointConfig selects when checkpoints are taken automatically
+type CheckpointConfig struct {
+	EveryTurns       int  // Take one every N agent turns; 0 disables
+	BeforePermission bool // Take one before a permission prompt is approved
+}
+
+// DefaultCheckpointConfig is used when nothing is configured
+var DefaultCheckpointConfig = CheckpointConfig{EveryTurns: 5, BeforePermission: true}
+
+// CheckpointConfigFromEnv reads ANYWHERE_CHECKPOINT_TURNS and
+// ANYWHERE_CHECKPOINT_ON_PERMISSION over the defaults
+func CheckpointConfigFromEnv() (CheckpointConfig, error) {
+	config := DefaultCheckpointConfig
+	if value := os.Getenv("ANYWHERE_CHECKPOINT_TURNS"); value != "" {
+		turns, err := strconv.Atoi(value)
+		if err != nil || turns < 0 {
+			return config, fmt.Errorf("invalid ANYWHERE_CHECKPOINT_TURNS: %q", value)
+		}
+		config.EveryTurns = turns
+	}
+	if value := os.Getenv("ANYWHERE_CHECKPOINT_ON_PERMISSION"); value != "" {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return config, fmt.Errorf("invalid ANYWHERE_CHECKPOINT_ON_PERMISSION: %q", value)
+		}
+		config.BeforePermission = enabled
+	}
+	return config, nil
+}
+
+// CheckpointService takes checkpoints of sessions and restores them. A
+// checkpoint records the conversation position, the terminal state and a commit
+// of the working tree; restoring one rolls the files back, drops the messages
+// that came after it and resumes Claude from a copy of its transcript cut at
+// the same point.
+type CheckpointService struct {
+	db           *gorm.DB
+	tmuxManager  *tmux.Manager
+	sessionStore *database.SessionRepository
+	launcher     *ToolLauncher
+	jsonlMonitor *JSONLMonitor
+	inputQueue   *InputQueue
+	wsService    *TerminalWebSocketService
+	config       CheckpointConfig
+
+	deviceID   string
+	deviceName string
+
+	turns map[string]int // Agent turns per session since the server started
+	locks map[string]*sync.Mutex
+	mu    sync.Mutex
+}
+
+// NewCheckpointService creates a new checkpoint service
+func NewCheckpointService(db *gorm.DB, tmuxManager *tmux.Manager, sessionStore *database.SessionRepository, launcher *ToolLauncher, jsonlMonitor *JSONLMonitor, inputQueue *InputQueue, wsService *TerminalWebSocketService, config CheckpointConfig) *CheckpointService {
+	deviceID, deviceName := terminal.LocalDevice()
+	return &CheckpointService{
+		db:           db,
+		tmuxManager:  tmuxManager,
+		sessionStore: sessionStore,
+		launcher:     launcher,
+		jsonlMonitor: jsonlMonitor,
+		inputQueue:   inputQueue,
+		wsService:    wsService,
+		config:       config,
+		deviceID:     deviceID,
+		deviceName:   deviceName,
+		turns:        make(map[string]int),
+		locks:        make(map[string]*sync.Mutex),
+	}
+}
+
+// TurnCompleted counts an agent turn and takes a checkpoint every EveryTurns turns
+func (s *CheckpointService) TurnCompleted(sessionID string) {
+	if s.config.EveryTurns <= 0 {
+		return
+	}
+
+	s.mu.Lock()
+	s.turns[sessionID]++
+	due := s.turns[sessionID]%s.config.EveryTurns == 0
+	s.mu.Unlock()
+
+	if due {
+		go func() {
+			label := fmt.Sprintf("Every %d turns", s.config.EveryTurns)
+			if _, err := s.Create(context.Background(), sessionID, database.CheckpointTriggerTurns, label); err != nil {
+				log.Printf("Failed to checkpoint session %s: %v", sessionID, err)
+			}
+		}()
+	}
+}
+
+// BeforeInput takes a checkpoint when input is about to answer a permission
+// prompt with anything but a refusal. Failures are logged and never hold the
+// input back.
+func (s *CheckpointService) BeforeInput(ctx context.Context, sessionID string, input string) {
+	if !s.config.BeforePermission || declinesPermission(input) {
+		return
+	}
+
+	if !permissionPending(ctx, s.tmuxManager, sessionID) {
+		return
+	}
+
+	if _, err := s.Create(ctx, sessionID, database.CheckpointTriggerPermission, "Before approving a permission prompt"); err != nil {
+		log.Printf("Failed to checkpoint session %s before approval: %v", sessionID, err)
+	}
+}
+
+// permissionPending reports whether a session running here shows a permission
+// prompt, so input to it would answer the prompt
+func permissionPending(ctx context.Context, tmuxManager *tmux.Manager, sessionID string) bool {
+	session, err := tmuxManager.GetSession(sessionID)
+	if err != nil {
+		return false
+	}
+	adapter, err := tools.NewAdapter(tools.ToolType(session.Tool))
+	if err != nil {
+		return false
+	}
+	output, err := tmuxManager.CaptureOutput(ctx, sessionID)
+	return err == nil && adapter.IsPermissionPrompt(output)
+}
+
+// declinesPermission reports whether input refuses a permission prompt. "3" is
+// Claude's "No" option.
+func declinesPermission(input string) bool {
+	switch strings.ToLower(strings.TrimSpace(input)) {
+	case "n", "no", "3", "esc", "escape":
+		return true
+	}
+	return false
+}
+
+// ListCheckpoints returns the checkpoints of a session, newest first
+func (s *CheckpointService) ListCheckpoints(ctx context.Context, sessionID string) ([]database.SessionCheckpoint, error) {
+	var checkpoints []database.SessionCheckpoint
+	err := s.db.WithContext(ctx).Where("session_id = ?", sessionID).Order("timestamp DESC").Find(&checkpoints).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list checkpoints: %w", err)
+	}
+	return checkpoints, nil
+}
+
+// Create takes a checkpoint of a session running on this host
+func (s *CheckpointService) Create(ctx context.Context, sessionID string, trigger database.CheckpointTrigger, label string) (*database.SessionCheckpoint, error) {
+	lock := s.sessionLock(sessionID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	checkpoint, err := s.create(ctx, sessionID, trigger, label)
+	if err != nil {
+		return nil, err
+	}
+
+	if trigger == database.CheckpointTriggerTurns || trigger == database.CheckpointTriggerPermission {
+		s.prune(ctx, sessionID)
+	}
+	s.wsService.BroadcastCheckpoint(sessionID, checkpoint)
+	return checkpoint, nil
+}
+
+// create takes a checkpoint; callers hold the session lock
+func (s *CheckpointService) create(ctx context.Context, sessionID string, trigger database.CheckpointTrigger, label string) (*database.SessionCheckpoint, error) {
+	state, err := storedSession(s.sessionStore, s.tmuxManager, sessionID, s.deviceID, s.deviceName)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", database.ErrSessionNotFound, sessionID)
+	}
+
+	checkpoint := &database.SessionCheckpoint{
+		ID:        uuid.New().String(),
+		SessionID: sessionID,
+		Trigger:   trigger,
+		Label:     label,
+	}
+
+	// Conversation position
+	var last database.TerminalMessage
+	err = s.db.WithContext(ctx).Where("session_id = ?", sessionID).Order("created_at DESC").Limit(1).Find(&last).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load messages: %w", err)
+	}
+	if last.ID != uuid.Nil {
+		checkpoint.MessageID = &last.ID
+	}
+	if transcriptPath := s.jsonlMonitor.LogFile(sessionID); transcriptPath != "" {
+		transcript, err := os.ReadFile(transcriptPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Claude transcript: %w", err)
+		}
+		checkpoint.ClaudeSessionID = strings.TrimSuffix(filepath.Base(transcriptPath), ".jsonl")
+		checkpoint.TranscriptPath = transcriptPath
+		// Only complete entries belong to the checkpoint
+		checkpoint.TranscriptOffset = int64(bytes.LastIndexByte(transcript, '\n') + 1)
+	}
+
+	// Terminal state
+	if workingDir, err := s.tmuxManager.GetWorkingDir(ctx, sessionID); err == nil {
+		state.WorkingDir = workingDir
+	}
+	if scrollback, err := s.tmuxManager.CaptureScrollback(ctx, sessionID, migrationScrollback); err == nil {
+		state.BufferContent = []byte(s.wsService.RedactOutput(ctx, sessionID, scrollback))
+	}
+	if err := convertJSON(state, &checkpoint.StateSnapshot); err != nil {
+		return nil, err
+	}
+	if err := convertJSON(state.InputHistory, &checkpoint.InputHistory); err != nil {
+		return nil, err
+	}
+	if err := convertJSON(state.OutputHistory, &checkpoint.OutputHistory); err != nil {
+		return nil, err
+	}
+
+	// Working tree
+	if state.WorkingDir != "" {
+		if repo, err := git.Open(ctx, state.WorkingDir); err == nil {
+			if err := s.commitWorkingTree(ctx, repo, checkpoint); err != nil {
+				return nil, fmt.Errorf("failed to snapshot working tree: %w", err)
+			}
+		}
+	}
+
+	checkpoint.Timestamp = time.Now()
+	if err := s.db.WithContext(ctx).Create(checkpoint).Error; err != nil {
+		if checkpoint.GitCommit != "" {
+			if repo, err := git.Open(ctx, checkpoint.RepoDir); err == nil {
+				repo.DeleteRef(ctx, checkpointRefPrefix+checkpoint.ID)
+			}
+		}
+		return nil, fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	return checkpoint, nil
+}
+
+// commitWorkingTree commits the working tree of repo, untracked files included,
+// on top of HEAD without touching the index, the stash or any branch
+func (s *CheckpointService) commitWorkingTree(ctx context.Context, repo *git.Repo, checkpoint *database.SessionCheckpoint) error {
+	head, err := repo.Head(ctx)
+	if err != nil {
+		return err
+	}
+	branch, err := repo.Branch(ctx)
+	if err != nil {
+		return err
+	}
+	tree, err := repo.SnapshotTree(ctx)
+	if err != nil {
+		return err
+	}
+	commit, err := repo.CommitTree(ctx, tree, head, "anywhere checkpoint "+checkpoint.ID)
+	if err != nil {
+		return err
+	}
+	if err := repo.UpdateRef(ctx, checkpointRefPrefix+checkpoint.ID, commit); err != nil {
+		return err
+	}
+
+	checkpoint.RepoDir = repo.Dir
+	checkpoint.GitBranch = branch
+	checkpoint.GitHead = head
+	checkpoint.GitCommit = commit
+	return nil
+}
+
+// Restore rolls a session back to a checkpoint. The current state is saved as
+// a checkpoint first, so the restore itself can be undone for the files; the
+// messages after the checkpoint are deleted.
+func (s *CheckpointService) Restore(ctx context.Context, sessionID string, checkpointID string) (*database.SessionCheckpoint, error) {
+	var checkpoint database.SessionCheckpoint
+	if err := s.db.WithContext(ctx).First(&checkpoint, "id = ? AND session_id = ?", checkpointID, sessionID).Error; err != nil {
+		return nil, ErrCheckpointNotFound
+	}
+
+	lock := s.sessionLock(sessionID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	session, err := s.tmuxManager.GetSession(sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", database.ErrSessionNotFound, sessionID)
+	}
+	tool := session.Tool
+
+	var snapshot terminal.SessionState
+	if err := convertJSON(checkpoint.StateSnapshot, &snapshot); err != nil {
+		return nil, err
+	}
+
+	var repo *git.Repo
+	if checkpoint.GitCommit != "" {
+		if repo, err = git.Open(ctx, checkpoint.RepoDir); err != nil {
+			return nil, err
+		}
+		if branch, _ := repo.Branch(ctx); branch != checkpoint.GitBranch {
+			return nil, fmt.Errorf("%w: %s is on branch %q but the checkpoint was taken on %q", ErrCheckpointConflict, repo.Dir, branch, checkpoint.GitBranch)
+		}
+	}
+
+	// Only the lease holder may restart the session
+	if err := s.sessionStore.UpdateHeartbeat(sessionID, s.deviceID); err != nil && !errors.Is(err, database.ErrSessionNotFound) {
+		return nil, err
+	}
+
+	current, err := s.create(ctx, sessionID, database.CheckpointTriggerRestore, "Before restoring "+checkpoint.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to checkpoint current state: %w", err)
+	}
+
+	// Stop the tool so it does not write while the files are rolled back
+	currentTranscript := s.jsonlMonitor.LogFile(sessionID)
+	s.launcher.Stop(sessionID)
+	if err := s.tmuxManager.KillSession(ctx, sessionID); err != nil {
+		return nil, fmt.Errorf("failed to stop session: %w", err)
+	}
+	s.inputQueue.Clear(sessionID)
+
+	if repo != nil {
+		if err := repo.RestoreSnapshot(ctx, current.GitCommit, checkpoint.GitCommit, checkpoint.GitHead); err != nil {
+			err = fmt.Errorf("failed to restore files: %w", err)
+			if restartErr := s.restart(ctx, sessionID, tool, snapshot.WorkingDir, current.ClaudeSessionID, currentTranscript); restartErr != nil {
+				log.Printf("Failed to restart session %s: %v", sessionID, restartErr)
+			}
+			return nil, err
+		}
+	}
+
+	if err := s.rewindMessages(ctx, &checkpoint); err != nil {
+		log.Printf("Failed to rewind messages of session %s: %v", sessionID, err)
+	}
+
+	claudeSessionID, transcriptPath := "", ""
+	if checkpoint.ClaudeSessionID != "" {
+		claudeSessionID, transcriptPath, err = forkTranscript(checkpoint.TranscriptPath, checkpoint.TranscriptOffset)
+		if err != nil {
+			log.Printf("Failed to fork Claude transcript of session %s: %v", sessionID, err)
+		}
+	}
+
+	if err := s.restart(ctx, sessionID, tool, snapshot.WorkingDir, claudeSessionID, transcriptPath); err != nil {
+		return nil, fmt.Errorf("failed to restart session: %w", err)
+	}
+
+	s.wsService.BroadcastCheckpointRestored(sessionID, &checkpoint)
+	log.Printf("Restored session %s to checkpoint %s", sessionID, checkpoint.ID)
+	return &checkpoint, nil
+}
+
+// restart starts a stopped session again, resuming Claude when a transcript is known
+func (s *CheckpointService) restart(ctx context.Context, sessionID, tool, workingDir, claudeSessionID, transcriptPath string) error {
+	if _, err := s.tmuxManager.CreateSessionInDir(ctx, tool, sessionID, workingDir); err != nil {
+		return err
+	}
+	if claudeSessionID == "" || transcriptPath == "" {
+		return s.launcher.Launch(ctx, sessionID, tool)
+	}
+	return s.launcher.Resume(ctx, sessionID, tool, claudeSessionID, transcriptPath, time.Now())
+}
+
+// rewindMessages deletes the messages created after a checkpoint and moves read
+// positions that pointed at them back to the checkpoint
+func (s *CheckpointService) rewindMessages(ctx context.Context, checkpoint *database.SessionCheckpoint) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		after := tx.Model(&database.TerminalMessage{}).
+			Where("session_id = ? AND created_at > ?", checkpoint.SessionID, checkpoint.Timestamp).
+			Select("id")
+
+		lastReadAt := checkpoint.Timestamp
+		if checkpoint.MessageID != nil {
+			var last database.TerminalMessage
+			if err := tx.First(&last, "id = ?", *checkpoint.MessageID).Error; err == nil {
+				lastReadAt = last.CreatedAt
+			}
+		}
+		if err := tx.Model(&database.ReadCursor{}).
+			Where("session_id = ? AND last_read_message_id IN (?)", checkpoint.SessionID, after).
+			Updates(map[string]interface{}{
+				"last_read_message_id": checkpoint.MessageID,
+				"last_read_at":         lastReadAt,
+				"updated_at":           time.Now(),
+			}).Error; err != nil {
+			return fmt.Errorf("failed to rewind read cursors: %w", err)
+		}
+		if err := tx.Model(&database.MessageSession{}).
+			Where("session_id = ? AND last_read_message_id IN (?)", checkpoint.SessionID, after).
+			Update("last_read_message_id", checkpoint.MessageID).Error; err != nil {
+			return fmt.Errorf("failed to rewind agent read state: %w", err)
+		}
+
+		if err := tx.Where("session_id = ? AND created_at > ?", checkpoint.SessionID, checkpoint.Timestamp).
+			Delete(&database.TerminalMessage{}).Error; err != nil {
+			return fmt.Errorf("failed to delete messages: %w", err)
+		}
+		return nil
+	})
+}
+
+// forkTranscript copies the first offset bytes of a Claude transcript into a
+// new conversation next to it and returns the new conversation ID and path.
+// The original is left as is so later checkpoints of it stay valid.
+func forkTranscript(path string, offset int64) (string, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+
+	head, err := io.ReadAll(io.LimitReader(file, offset))
+	if err != nil {
+		return "", "", err
+	}
+
+	id := uuid.New().String()
+	var out bytes.Buffer
+	for _, line := range bytes.Split(head, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var entry map[string]interface{}
+		if err := json.Unmarshal(line, &entry); err == nil {
+			if _, ok := entry["sessionId"]; ok {
+				entry["sessionId"] = id
+				if rewritten, err := json.Marshal(entry); err == nil {
+					line = rewritten
+				}
+			}
+		}
+		out.Write(line)
+		out.WriteByte('\n')
+	}
+
+	forkPath := filepath.Join(filepath.Dir(path), id+".jsonl")
+	if err := os.WriteFile(forkPath, out.Bytes(), 0600); err != nil {
+		return "", "", err
+	}
+	return id, forkPath, nil
+}
+
+// prune deletes the oldest automatic checkpoints of a session beyond maxAutoCheckpoints
+func (s *CheckpointService) prune(ctx context.Context, sessionID string) {
+	var old []database.SessionCheckpoint
+	err := s.db.WithContext(ctx).
+		Where("session_id = ? AND trigger_type IN ?", sessionID, []database.CheckpointTrigger{database.CheckpointTriggerTurns, database.CheckpointTriggerPermission}).
+		Order("timestamp DESC").Offset(maxAutoCheckpoints).Find(&old).Error
+	if err != nil {
+		log.Printf("Failed to list checkpoints of session %s: %v", sessionID, err)
+		return
+	}
+	for i := range old {
+		s.delete(ctx, &old[i])
+	}
+}
+
+// Forget deletes the checkpoints of a session with their working tree commits
+func (s *CheckpointService) Forget(ctx context.Context, sessionID string) {
+	checkpoints, err := s.ListCheckpoints(ctx, sessionID)
+	if err != nil {
+		log.Printf("Failed to list checkpoints of session %s: %v", sessionID, err)
+	}
+	for i := range checkpoints {
+		s.delete(ctx, &checkpoints[i])
+	}
+
+	s.mu.Lock()
+	delete(s.turns, sessionID)
+	s.mu.Unlock()
+}
+
+// delete deletes a checkpoint and releases its working tree commit
+func (s *CheckpointService) delete(ctx context.Context, checkpoint *database.SessionCheckpoint) {
+	if checkpoint.GitCommit != "" {
+		if repo, err := git.Open(ctx, checkpoint.RepoDir); err == nil {
+			if err := repo.DeleteRef(ctx, checkpointRefPrefix+checkpoint.ID); err != nil {
+				log.Printf("Failed to delete ref of checkpoint %s: %v", checkpoint.ID, err)
+			}
+		}
+	}
+	if err := s.db.WithContext(ctx).Delete(&database.SessionCheckpoint{}, "id = ?", checkpoint.ID).Error; err != nil {
+		log.Printf("Failed to delete checkpoint %s: %v", checkpoint.ID, err)
+	}
+}
+
+// sessionLock returns the mutex serializing checkpoints of a session
+func (s *CheckpointService) sessionLock(sessionID string) *sync.Mutex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lock, exists := s.locks[sessionID]
+	if !exists {
+		lock = &sync.Mutex{}
+		s.locks[sessionID] = lock
+	}
+	return lock
+}
+
+// convertJSON copies src into dst through their JSON encoding
+func convertJSON(src, dst interface{}) error {
+	data, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/majiayu000/anywhere-ai/core/database"
+	"github.com/majiayu000/anywhere-ai/core/terminal"
+)
+
+// CheckpointAPIService exposes listing, taking and restoring session checkpoints
+type CheckpointAPIService struct {
+	checkpoints *CheckpointService
+	migrations  *MigrationService
+}
+
+// NewCheckpointAPIService creates a new checkpoint API service
+func NewCheckpointAPIService(checkpoints *CheckpointService) *CheckpointAPIService {
+	return &CheckpointAPIService{checkpoints: checkpoints}
+}
+
+// SetMigrationService sets the service whose handovers block checkpoints of a session
+func (s *CheckpointAPIService) SetMigrationService(migrations *MigrationService) {
+	s.migrations = migrations
+}
+
+// ListCheckpoints lists the checkpoints of a session, newest first
+func (s *CheckpointAPIService) ListCheckpoints(c *gin.Context) {
+	checkpoints, err := s.checkpoints.ListCheckpoints(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, checkpoints)
+}
+
+// CreateCheckpoint takes a checkpoint on demand
+func (s *CheckpointAPIService) CreateCheckpoint(c *gin.Context) {
+	sessionID := c.Param("id")
+
+	var req struct {
+		Label string `json:"label"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+	}
+	if s.migrations != nil && s.migrations.InProgress(sessionID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Session is being migrated"})
+		return
+	}
+
+	checkpoint, err := s.checkpoints.Create(c.Request.Context(), sessionID, database.CheckpointTriggerManual, req.Label)
+	if err != nil {
+		c.JSON(checkpointErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, checkpoint)
+}
+
+// RestoreCheckpoint rolls the files and the conversation of a session back to a checkpoint
+func (s *CheckpointAPIService) RestoreCheckpoint(c *gin.Context) {
+	sessionID := c.Param("id")
+	if s.migrations != nil && s.migrations.InProgress(sessionID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Session is being migrated"})
+		return
+	}
+
+	checkpoint, err := s.checkpoints.Restore(c.Request.Context(), sessionID, c.Param("checkpointId"))
+	if err != nil {
+		c.JSON(checkpointErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, checkpoint)
+}
+
+// checkpointErrorStatus maps checkpoint errors to HTTP status codes
+func checkpointErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, database.ErrSessionNotFound), errors.Is(err, ErrCheckpointNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrCheckpointConflict), errors.Is(err, terminal.ErrLeaseHeld):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// RegisterRoutes registers checkpoint API routes
+func (s *CheckpointAPIService) RegisterRoutes(router *gin.Engine) {
+	api := router.Group("/api/v1/terminal/sessions/:id/checkpoints")
+	{
+		api.GET("", s.ListCheckpoints)
+		api.POST("", s.CreateCheckpoint)
+		api.POST("/:checkpointId/restore", s.RestoreCheckpoint)
+	}
+}
@@ -19,6 +19,8 @@ type ClaudeMonitor struct {
 	messageService *MessageService
 	wsService      *TerminalWebSocketService
 	adapter        *tools.ClaudeAdapter
+	gitTracker     *GitTracker
+	checkpoints    *CheckpointService
 	sessions       map[string]*ClaudeSessionState
 	mu             sync.RWMutex
 }
@@ -47,6 +49,16 @@ func NewClaudeMonitor(tmuxManager *tmux.Manager, messageService *MessageService,
 	}
 }
 
+// SetGitTracker sets the tracker that captures repository changes per turn
+func (m *ClaudeMonitor) SetGitTracker(gitTracker *GitTracker) {
+	m.gitTracker = gitTracker
+}
+
+// SetCheckpointService sets the service that checkpoints sessions every few turns
+func (m *ClaudeMonitor) SetCheckpointService(checkpoints *CheckpointService) {
+	m.checkpoints = checkpoints
+}
+
 // StartMonitoring starts monitoring a Claude session
 func (m *ClaudeMonitor) StartMonitoring(sessionID string) {
 	m.mu.Lock()
@@ -102,8 +114,9 @@ func (m *ClaudeMonitor) monitorSession(state *ClaudeSessionState) {
 
 // processSessionOutput processes new output from a Claude session
 func (m *ClaudeMonitor) processSessionOutput(state *ClaudeSessionState) {
-	// Capture current output
-	output, err := m.tmuxManager.CaptureOutput(state.Context, state.SessionID)
+	// Capture current output with secrets masked, so nothing derived from it
+	// (prompts, user input, responses) carries them
+	output, err := m.wsService.CaptureOutput(state.Context, state.SessionID)
 	if err != nil {
 		log.Printf("Failed to capture output for session %s: %v", state.SessionID, err)
 		return
@@ -335,6 +348,14 @@ func (m *ClaudeMonitor) createClaudeMessage(state *ClaudeSessionState, content s
 	
 	// Broadcast to WebSocket clients
 	m.wsService.BroadcastMessage(state.SessionID, message)
+	
+	// Claude waiting for input marks the end of a turn
+	if requiresInput && m.gitTracker != nil {
+		m.gitTracker.CaptureTurnAsync(state.SessionID, message)
+	}
+	if requiresInput && m.checkpoints != nil {
+		m.checkpoints.TurnCompleted(state.SessionID)
+	}
 }
 
 // BroadcastMessage is a helper for WebSocket service to broadcast messages
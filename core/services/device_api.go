@@ -0,0 +1,213 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/majiayu000/anywhere-ai/core/database"
+	"github.com/majiayu000/anywhere-ai/core/deviceauth"
+	"github.com/majiayu000/anywhere-ai/core/terminal"
+	"github.com/majiayu000/anywhere-ai/core/tmux"
+)
+
+// DeviceAPIService exposes device pairing and peer discovery. The endpoints
+// other devices call are served separately on the mutual TLS listener.
+type DeviceAPIService struct {
+	pairing     *PairingService
+	discovery   *terminal.PeerDiscoveryService
+	tmuxManager *tmux.Manager
+	hub         *HubService
+	access      *SessionAccessService
+}
+
+// NewDeviceAPIService creates a new device API service
+func NewDeviceAPIService(pairing *PairingService, discovery *terminal.PeerDiscoveryService, tmuxManager *tmux.Manager) *DeviceAPIService {
+	return &DeviceAPIService{
+		pairing:     pairing,
+		discovery:   discovery,
+		tmuxManager: tmuxManager,
+	}
+}
+
+// SetSessionAccess sets the service that decides who administers the server
+func (s *DeviceAPIService) SetSessionAccess(access *SessionAccessService) {
+	s.access = access
+}
+
+// SetHubService sets the hub whose tunnels are closed when their agent is
+// unpaired or revoked
+func (s *DeviceAPIService) SetHubService(hub *HubService) {
+	s.hub = hub
+}
+
+// disconnect closes the tunnel of a device connected to this hub, if any
+func (s *DeviceAPIService) disconnect(deviceID string) {
+	if s.hub != nil {
+		s.hub.Disconnect(deviceID)
+	}
+}
+
+// ListDevices lists paired devices and the peers that answered the last probe
+func (s *DeviceAPIService) ListDevices(c *gin.Context) {
+	devices, err := s.pairing.ListDevices()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"paired":     devices,
+		"discovered": s.discovery.Devices(),
+	})
+}
+
+// Discover probes the paired devices and static peers now
+func (s *DeviceAPIService) Discover(c *gin.Context) {
+	devices, err := s.discovery.Discover()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, devices)
+}
+
+// Identity answers a peer probe with this device, and its sessions if the peer is paired
+func (s *DeviceAPIService) Identity(c *gin.Context) {
+	sessions := []string{}
+	if list, err := s.tmuxManager.ListSessions(c.Request.Context()); err == nil {
+		for _, session := range list {
+			sessions = append(sessions, session.ID)
+		}
+	}
+
+	c.JSON(http.StatusOK, s.pairing.Identity(deviceauth.PeerFingerprint(c.Request.TLS), c.Query("nonce"), sessions))
+}
+
+// CreateInvite issues a one-time pairing invite
+func (s *DeviceAPIService) CreateInvite(c *gin.Context) {
+	var req struct {
+		TTLSeconds int `json:"ttl_seconds"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+	}
+
+	invite, err := s.pairing.CreateInvite(c.Request.Context(), requestUserID(c), time.Duration(req.TTLSeconds)*time.Second)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, invite)
+}
+
+// Pair redeems an invite code issued by another device
+func (s *DeviceAPIService) Pair(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	device, err := s.pairing.Redeem(c.Request.Context(), requestUserID(c), req.Code)
+	if err != nil {
+		c.JSON(pairingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, device)
+}
+
+// AcceptPairing is called by a device redeeming an invite of this one
+func (s *DeviceAPIService) AcceptPairing(c *gin.Context) {
+	var req PairRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	paired, err := s.pairing.Accept(c.Request.Context(), &req, deviceauth.PeerFingerprint(c.Request.TLS))
+	if err != nil {
+		c.JSON(pairingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, paired)
+}
+
+// Unpair forgets a paired device
+func (s *DeviceAPIService) Unpair(c *gin.Context) {
+	if err := s.pairing.Unpair(c.Param("id")); err != nil {
+		c.JSON(pairingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	s.disconnect(c.Param("id"))
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// Revoke stops trusting a paired device, for example a lost one
+func (s *DeviceAPIService) Revoke(c *gin.Context) {
+	device, err := s.pairing.Revoke(c.Param("id"))
+	if err != nil {
+		c.JSON(pairingErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	s.disconnect(device.ID)
+
+	c.JSON(http.StatusOK, device)
+}
+
+// pairingErrorStatus maps pairing errors to HTTP status codes
+func pairingErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, database.ErrDeviceNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrInvalidInviteCode):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrClientCertificateRequired):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrDeviceAlreadyPaired):
+		return http.StatusConflict
+	case errors.Is(err, ErrInvalidInvite), errors.Is(err, database.ErrDeviceRevoked):
+		return http.StatusForbidden
+	}
+	var peerErr *peerError
+	if errors.As(err, &peerErr) {
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
+
+// RegisterRoutes registers device API routes. Pairing and unpairing change
+// which devices may reach the server, so only its admin may.
+func (s *DeviceAPIService) RegisterRoutes(router *gin.Engine) {
+	api := router.Group("/api/v1/devices")
+	{
+		api.GET("", s.ListDevices)
+		api.POST("/discover", s.Discover)
+		api.POST("/invites", s.access.RequireAdmin(), s.CreateInvite)
+		api.POST("/pair", s.access.RequireAdmin(), s.Pair)
+		api.POST("/:id/revoke", s.access.RequireAdmin(), s.Revoke)
+		api.DELETE("/:id", s.access.RequireAdmin(), s.Unpair)
+	}
+}
+
+// RegisterPeerRoutes registers the routes other devices call on the mutual TLS
+// listener. Both take unpaired callers: probes get no sessions, and pairing
+// needs an invite token.
+func (s *DeviceAPIService) RegisterPeerRoutes(router gin.IRouter) {
+	api := router.Group("/api/v1/devices")
+	{
+		api.GET("/self", s.Identity)
+		api.POST("/pair/accept", s.AcceptPairing)
+	}
+}
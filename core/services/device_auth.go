@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/majiayu000/anywhere-ai/core/database"
+	"github.com/majiayu000/anywhere-ai/core/deviceauth"
+)
+
+// deviceContextKey is where RequirePairedDevice stores the calling device
+const deviceContextKey = "device"
+
+// ErrWrongDevice is returned when a paired device acts on behalf of another
+var ErrWrongDevice = errors.New("request does not come from the device it concerns")
+
+// DeviceClients makes the HTTP clients this device calls its paired devices
+// with: mutual TLS, presenting this device's certificate and accepting only
+// the certificate pinned for the peer at pairing
+type DeviceClients struct {
+	devices  *database.DeviceRepository
+	identity *deviceauth.Identity
+
+	// Agents connected to this device as their hub are reached through their tunnel
+	hub *HubService
+
+	// Transports by pinned fingerprint, so connections to a device are reused
+	transports map[string]*http.Transport
+	mu         sync.Mutex
+}
+
+// NewDeviceClients creates the clients for paired devices
+func NewDeviceClients(devices *database.DeviceRepository, identity *deviceauth.Identity) *DeviceClients {
+	return &DeviceClients{
+		devices:    devices,
+		identity:   identity,
+		transports: make(map[string]*http.Transport),
+	}
+}
+
+// SetHubService sets the hub whose agents are dialed through their tunnels
+func (c *DeviceClients) SetHubService(hub *HubService) {
+	c.hub = hub
+}
+
+// Resolve finds a paired, unrevoked device by ID or by URL
+func (c *DeviceClients) Resolve(target string) (*database.Device, error) {
+	device, err := c.devices.GetDevice(target)
+	if errors.Is(err, database.ErrDeviceNotFound) {
+		devices, listErr := c.devices.AllDevices()
+		if listErr != nil {
+			return nil, listErr
+		}
+		for i := range devices {
+			if devices[i].URL == strings.TrimRight(target, "/") {
+				device, err = &devices[i], nil
+				break
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if device.RevokedAt != nil {
+		return nil, fmt.Errorf("%w: %s", database.ErrDeviceRevoked, device.ID)
+	}
+	if device.CertFingerprint == "" {
+		return nil, fmt.Errorf("%w: %s was paired without a certificate; pair it again", database.ErrDeviceNotFound, device.ID)
+	}
+	return device, nil
+}
+
+// Client returns the client for a paired device
+func (c *DeviceClients) Client(device *database.Device, timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: c.Transport(device)}
+}
+
+// Transport returns the transport for a paired device, shared by its clients
+func (c *DeviceClients) Transport(device *database.Device) *http.Transport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	transport, exists := c.transports[device.CertFingerprint]
+	if !exists {
+		transport = &http.Transport{
+			DialContext:     c.dialer(device.ID),
+			TLSClientConfig: c.identity.ClientTLSConfig(device.CertFingerprint),
+		}
+		c.transports[device.CertFingerprint] = transport
+	}
+	return transport
+}
+
+// DialWebSocket opens a WebSocket to path on a paired device
+func (c *DeviceClients) DialWebSocket(ctx context.Context, device *database.Device, path string, header http.Header) (*websocket.Conn, error) {
+	target, err := url.Parse(device.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid device URL %s: %w", device.URL, err)
+	}
+	target.Scheme = "wss"
+	target.Path = strings.TrimRight(target.Path, "/") + path
+
+	dialer := websocket.Dialer{
+		NetDialContext:   c.dialer(device.ID),
+		TLSClientConfig:  c.identity.ClientTLSConfig(device.CertFingerprint),
+		HandshakeTimeout: 10 * time.Second,
+	}
+	conn, _, err := dialer.DialContext(ctx, target.String(), header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", device.ID, err)
+	}
+	return conn, nil
+}
+
+// DialDevice connects to a device through its tunnel when it has one, and to
+// addr otherwise
+func (c *DeviceClients) DialDevice(ctx context.Context, deviceID, network, addr string) (net.Conn, error) {
+	if c.hub != nil {
+		if conn, tunneled, err := c.hub.Dial(deviceID); tunneled {
+			return conn, err
+		}
+	}
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
+	return dialer.DialContext(ctx, network, addr)
+}
+
+// dialer returns DialDevice for one device
+func (c *DeviceClients) dialer(deviceID string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return c.DialDevice(ctx, deviceID, network, addr)
+	}
+}
+
+// RequirePairedDevice only lets through requests whose client certificate is
+// pinned to a paired device that has not been revoked. Use it on the mutual TLS
+// listener for inter-device endpoints.
+func RequirePairedDevice(devices *database.DeviceRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fingerprint := deviceauth.PeerFingerprint(c.Request.TLS)
+		if fingerprint == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Client certificate required"})
+			return
+		}
+
+		device, err := devices.GetDeviceByFingerprint(fingerprint)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Unknown or revoked device"})
+			return
+		}
+
+		c.Set(deviceContextKey, device)
+		c.Next()
+	}
+}
+
+// pairedDevice returns the device RequirePairedDevice authenticated, if any
+func pairedDevice(c *gin.Context) *database.Device {
+	if value, exists := c.Get(deviceContextKey); exists {
+		if device, ok := value.(*database.Device); ok {
+			return device
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/majiayu000/anywhere-ai/core/database"
+	"github.com/majiayu000/anywhere-ai/core/encryption"
+)
+
+// EncryptionAPIService exposes encryption at rest status and the re-encryption job
+type EncryptionAPIService struct {
+	reencryptor *Reencryptor
+	access      *SessionAccessService
+}
+
+// EncryptionStatusResponse describes the encryption configuration
+type EncryptionStatusResponse struct {
+	Enabled     bool            `json:"enabled"`
+	ActiveKeyID string          `json:"active_key_id,omitempty"`
+	SearchIndex bool            `json:"search_index"`
+	Reencrypt   ReencryptStatus `json:"reencrypt"`
+}
+
+// NewEncryptionAPIService creates a new encryption API service
+func NewEncryptionAPIService(reencryptor *Reencryptor) *EncryptionAPIService {
+	return &EncryptionAPIService{reencryptor: reencryptor}
+}
+
+// SetSessionAccess sets the service that decides who administers the server
+func (s *EncryptionAPIService) SetSessionAccess(access *SessionAccessService) {
+	s.access = access
+}
+
+// GetStatus reports whether encryption is enabled and the re-encryption progress
+func (s *EncryptionAPIService) GetStatus(c *gin.Context) {
+	response := EncryptionStatusResponse{
+		SearchIndex: database.SearchIndexEnabled(),
+		Reencrypt:   s.reencryptor.Status(),
+	}
+	if keyring := encryption.Active(); keyring != nil {
+		response.Enabled = true
+		response.ActiveKeyID = keyring.ActiveKeyID()
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// StartReencrypt starts moving stored data to the active key
+func (s *EncryptionAPIService) StartReencrypt(c *gin.Context) {
+	if err := s.reencryptor.Start(); err != nil {
+		switch {
+		case errors.Is(err, ErrEncryptionDisabled):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrReencryptRunning):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, s.reencryptor.Status())
+}
+
+// RegisterRoutes registers encryption API routes
+func (s *EncryptionAPIService) RegisterRoutes(router *gin.Engine) {
+	api := router.Group("/api/v1/encryption")
+	{
+		api.GET("/status", s.GetStatus)
+		api.POST("/reencrypt", s.access.RequireAdmin(), s.StartReencrypt)
+	}
+}
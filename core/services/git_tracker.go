@@ -0,0 +1,276 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/majiayu000/anywhere-ai/core/database"
+	"github.com/majiayu000/anywhere-ai/core/git"
+	"github.com/majiayu000/anywhere-ai/core/tmux"
+	"gorm.io/gorm"
+)
+
+// GitTracker attributes working tree changes and commits to agent turns
+type GitTracker struct {
+	db          *gorm.DB
+	tmuxManager *tmux.Manager
+	wsService   *TerminalWebSocketService
+	redaction   *RedactionService
+	locks       map[string]*sync.Mutex // Serializes captures per session
+	mu          sync.Mutex
+}
+
+// SessionGitChanges summarizes what a session has changed so far
+type SessionGitChanges struct {
+	SessionID      string       `json:"session_id"`
+	RepoDir        string       `json:"repo_dir"`
+	InitialGitHash string       `json:"initial_git_hash"`
+	CurrentGitHash string       `json:"current_git_hash"`
+	Diff           string       `json:"diff"`
+	Commits        []git.Commit `json:"commits"`
+	CapturedAt     time.Time    `json:"captured_at"`
+}
+
+// NewGitTracker creates a new git tracker
+func NewGitTracker(db *gorm.DB, tmuxManager *tmux.Manager, wsService *TerminalWebSocketService) *GitTracker {
+	return &GitTracker{
+		db:          db,
+		tmuxManager: tmuxManager,
+		wsService:   wsService,
+		locks:       make(map[string]*sync.Mutex),
+	}
+}
+
+// SetRedactionService sets the service that masks secrets in diffs
+func (t *GitTracker) SetRedactionService(redaction *RedactionService) {
+	t.redaction = redaction
+}
+
+// StartSession records the initial repository state of a session.
+// Sessions outside a git repository are silently ignored.
+func (t *GitTracker) StartSession(ctx context.Context, sessionID string) error {
+	dir, err := t.tmuxManager.GetWorkingDir(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	repo, err := git.Open(ctx, dir)
+	if err != nil {
+		log.Printf("Session %s is not in a git repository, skipping git tracking", sessionID)
+		return nil
+	}
+
+	head, err := repo.Head(ctx)
+	if err != nil {
+		return err
+	}
+	tree, err := repo.SnapshotTree(ctx)
+	if err != nil {
+		return err
+	}
+
+	state := &database.SessionGitState{
+		SessionID:       sessionID,
+		RepoDir:         repo.Dir,
+		InitialGitHash:  head,
+		InitialTreeHash: tree,
+		LastGitHash:     head,
+		LastTreeHash:    tree,
+		CreatedAt:       time.Now(),
+		UpdatedAt:       time.Now(),
+	}
+	if err := t.db.WithContext(ctx).Save(state).Error; err != nil {
+		return fmt.Errorf("failed to save git state: %w", err)
+	}
+
+	return nil
+}
+
+// CaptureTurn snapshots the repository after an agent turn and attaches the
+// turn diff to the message that ended the turn
+func (t *GitTracker) CaptureTurn(ctx context.Context, sessionID string, message *database.TerminalMessage) (*database.GitTurnSnapshot, error) {
+	lock := t.sessionLock(sessionID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	var state database.SessionGitState
+	if err := t.db.WithContext(ctx).Where("session_id = ?", sessionID).First(&state).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			// Session is not tracked
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to load git state: %w", err)
+	}
+
+	repo := &git.Repo{Dir: state.RepoDir}
+	head, err := repo.Head(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := repo.SnapshotTree(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if tree == state.LastTreeHash && head == state.LastGitHash {
+		// Nothing changed during this turn
+		return nil, nil
+	}
+
+	turnDiff, err := repo.Diff(ctx, state.LastTreeHash, tree)
+	if err != nil {
+		return nil, err
+	}
+	cumulativeDiff, err := repo.Diff(ctx, state.InitialTreeHash, tree)
+	if err != nil {
+		return nil, err
+	}
+	commits, err := repo.CommitsBetween(ctx, state.LastGitHash, head)
+	if err != nil {
+		return nil, err
+	}
+	commitsJSON, _ := json.Marshal(commits)
+
+	snapshot := &database.GitTurnSnapshot{
+		SessionID:      sessionID,
+		GitHash:        head,
+		TreeHash:       tree,
+		TurnDiff:       turnDiff,
+		CumulativeDiff: cumulativeDiff,
+		NewCommits:     string(commitsJSON),
+		CreatedAt:      time.Now(),
+	}
+	if message != nil {
+		snapshot.MessageID = &message.ID
+	}
+	if t.redaction != nil {
+		t.redaction.RedactSnapshot(ctx, snapshot)
+	}
+
+	err = t.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(snapshot).Error; err != nil {
+			return fmt.Errorf("failed to save git snapshot: %w", err)
+		}
+
+		if message != nil {
+			update := database.TerminalMessage{
+				GitDiff:           snapshot.TurnDiff,
+				UnredactedGitDiff: snapshot.UnredactedTurnDiff,
+				Redacted:          true,
+			}
+			columns := []string{"git_diff"}
+			if snapshot.Redacted {
+				// Never clears a flag set by redacting the message content
+				columns = append(columns, "unredacted_git_diff", "redacted")
+			}
+
+			// Updated from a struct so the diff goes through the encrypted serializer
+			if err := tx.Model(&database.TerminalMessage{}).
+				Where("id = ?", message.ID).
+				Select(columns).
+				Updates(&update).Error; err != nil {
+				return fmt.Errorf("failed to attach git diff: %w", err)
+			}
+			message.GitDiff = update.GitDiff
+			if snapshot.Redacted {
+				message.UnredactedGitDiff = update.UnredactedGitDiff
+				message.Redacted = true
+			}
+		}
+
+		state.LastGitHash = head
+		state.LastTreeHash = tree
+		state.UpdatedAt = time.Now()
+		if err := tx.Save(&state).Error; err != nil {
+			return fmt.Errorf("failed to update git state: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if t.wsService != nil {
+		t.wsService.BroadcastGitSnapshot(sessionID, snapshot)
+	}
+
+	return snapshot, nil
+}
+
+// CaptureTurnAsync captures a turn in the background, logging failures
+func (t *GitTracker) CaptureTurnAsync(sessionID string, message *database.TerminalMessage) {
+	go func() {
+		if _, err := t.CaptureTurn(context.Background(), sessionID, message); err != nil {
+			log.Printf("Failed to capture git changes for session %s: %v", sessionID, err)
+		}
+	}()
+}
+
+// GetTurns returns the per-turn snapshots of a session, oldest first
+func (t *GitTracker) GetTurns(ctx context.Context, sessionID string) ([]database.GitTurnSnapshot, error) {
+	var snapshots []database.GitTurnSnapshot
+	if err := t.db.WithContext(ctx).
+		Where("session_id = ?", sessionID).
+		Order("created_at ASC").
+		Find(&snapshots).Error; err != nil {
+		return nil, fmt.Errorf("failed to get git snapshots: %w", err)
+	}
+
+	return snapshots, nil
+}
+
+// GetChanges computes the live cumulative diff and commits since the session started
+func (t *GitTracker) GetChanges(ctx context.Context, sessionID string) (*SessionGitChanges, error) {
+	var state database.SessionGitState
+	if err := t.db.WithContext(ctx).Where("session_id = ?", sessionID).First(&state).Error; err != nil {
+		return nil, fmt.Errorf("session %s has no git tracking: %w", sessionID, err)
+	}
+
+	repo := &git.Repo{Dir: state.RepoDir}
+	head, err := repo.Head(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := repo.SnapshotTree(ctx)
+	if err != nil {
+		return nil, err
+	}
+	diff, err := repo.Diff(ctx, state.InitialTreeHash, tree)
+	if err != nil {
+		return nil, err
+	}
+	commits, err := repo.CommitsBetween(ctx, state.InitialGitHash, head)
+	if err != nil {
+		return nil, err
+	}
+	if t.redaction != nil {
+		diff = t.redaction.RedactDiff(ctx, sessionID, diff)
+	}
+
+	return &SessionGitChanges{
+		SessionID:      sessionID,
+		RepoDir:        state.RepoDir,
+		InitialGitHash: state.InitialGitHash,
+		CurrentGitHash: head,
+		Diff:           diff,
+		Commits:        commits,
+		CapturedAt:     time.Now(),
+	}, nil
+}
+
+// sessionLock returns the capture lock of a session
+func (t *GitTracker) sessionLock(sessionID string) *sync.Mutex {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	lock, exists := t.locks[sessionID]
+	if !exists {
+		lock = &sync.Mutex{}
+		t.locks[sessionID] = lock
+	}
+	return lock
+}
@@ -0,0 +1,256 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/majiayu000/anywhere-ai/core/database"
+	"github.com/majiayu000/anywhere-ai/core/deviceauth"
+	"github.com/majiayu000/anywhere-ai/core/tunnel"
+)
+
+// HubAgentPath is where agents connect to their hub on its mutual TLS listener
+const HubAgentPath = "/api/v1/agents/connect"
+
+// ConnectedAgent is an agent with an open tunnel to this hub
+type ConnectedAgent struct {
+	DeviceID    string    `json:"device_id"`
+	DeviceName  string    `json:"device_name"`
+	RemoteAddr  string    `json:"remote_addr"`
+	ConnectedAt time.Time `json:"connected_at"`
+}
+
+// hubTunnel is the tunnel of one connected agent
+type hubTunnel struct {
+	agent   ConnectedAgent
+	session *tunnel.Session
+}
+
+// HubService is the hub side of hub-and-agent federation. Paired agents that
+// cannot be reached, for example behind NAT, dial out to the hub and keep a
+// tunnel open; the hub then reaches their mutual TLS peer API through it, so
+// their sessions are listed and proxied like those of any paired device.
+type HubService struct {
+	remote *RemoteSessionService
+
+	tunnels map[string]*hubTunnel
+	mu      sync.RWMutex
+}
+
+// NewHubService creates a new hub service
+func NewHubService() *HubService {
+	return &HubService{
+		tunnels: make(map[string]*hubTunnel),
+	}
+}
+
+// SetRemoteSessionService sets the service whose session listing is refreshed
+// when an agent connects
+func (h *HubService) SetRemoteSessionService(remote *RemoteSessionService) {
+	h.remote = remote
+}
+
+// Connect accepts the tunnel of a paired agent and holds it until it closes.
+// A new tunnel from the same agent replaces the old one.
+func (h *HubService) Connect(c *gin.Context) {
+	device := pairedDevice(c)
+	if device == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Client certificate required"})
+		return
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("Agent %s tunnel upgrade failed: %v", device.ID, err)
+		return
+	}
+
+	t := &hubTunnel{
+		agent: ConnectedAgent{
+			DeviceID:    device.ID,
+			DeviceName:  device.Name,
+			RemoteAddr:  c.Request.RemoteAddr,
+			ConnectedAt: time.Now(),
+		},
+		session: tunnel.NewSession(conn, true),
+	}
+	h.mu.Lock()
+	previous := h.tunnels[device.ID]
+	h.tunnels[device.ID] = t
+	h.mu.Unlock()
+	if previous != nil {
+		previous.session.Close()
+	}
+	log.Printf("Agent %s (%s) connected from %s", device.Name, device.ID, c.Request.RemoteAddr)
+
+	// Register the agent's sessions
+	if h.remote != nil {
+		go h.remote.ListSessions(context.Background(), database.Reader{UserID: defaultReaderUserID, DeviceID: defaultReaderDeviceID})
+	}
+
+	<-t.session.Done()
+	h.mu.Lock()
+	if h.tunnels[device.ID] == t {
+		delete(h.tunnels, device.ID)
+	}
+	h.mu.Unlock()
+	log.Printf("Agent %s (%s) disconnected", device.Name, device.ID)
+}
+
+// Dial opens a connection to a device through its tunnel. It reports false
+// when the device has no tunnel to this hub.
+func (h *HubService) Dial(deviceID string) (net.Conn, bool, error) {
+	h.mu.RLock()
+	t, exists := h.tunnels[deviceID]
+	h.mu.RUnlock()
+	if !exists {
+		return nil, false, nil
+	}
+
+	conn, err := t.session.Open()
+	return conn, true, err
+}
+
+// Agents lists the connected agents
+func (h *HubService) Agents() []ConnectedAgent {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	agents := make([]ConnectedAgent, 0, len(h.tunnels))
+	for _, t := range h.tunnels {
+		agents = append(agents, t.agent)
+	}
+	sort.Slice(agents, func(i, j int) bool {
+		return agents[i].ConnectedAt.Before(agents[j].ConnectedAt)
+	})
+	return agents
+}
+
+// Disconnect closes the tunnel of an agent, for example one that was revoked
+func (h *HubService) Disconnect(deviceID string) bool {
+	h.mu.RLock()
+	t, exists := h.tunnels[deviceID]
+	h.mu.RUnlock()
+	if exists {
+		t.session.Close()
+	}
+	return exists
+}
+
+// Close closes every tunnel
+func (h *HubService) Close() {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, t := range h.tunnels {
+		t.session.Close()
+	}
+}
+
+// HubAgent is the agent side of hub-and-agent federation: it keeps a tunnel
+// open to its paired hub and serves the mutual TLS peer API through it, so the
+// hub can reach this device without any inbound port
+type HubAgent struct {
+	hub      string
+	clients  *DeviceClients
+	identity *deviceauth.Identity
+	handler  http.Handler
+
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+const (
+	// hubRetryMin and hubRetryMax bound the wait before reconnecting to the hub
+	hubRetryMin = time.Second
+	hubRetryMax = time.Minute
+)
+
+// NewHubAgent creates an agent for hub, a paired device ID or URL. handler
+// serves the peer API, as on the mutual TLS listener.
+func NewHubAgent(hub string, clients *DeviceClients, identity *deviceauth.Identity, handler http.Handler) *HubAgent {
+	return &HubAgent{
+		hub:      hub,
+		clients:  clients,
+		identity: identity,
+		handler:  handler,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start connects to the hub in the background, reconnecting when the tunnel
+// drops
+func (a *HubAgent) Start() {
+	go func() {
+		wait := hubRetryMin
+		for {
+			connected := time.Now()
+			if err := a.serve(); err != nil {
+				log.Printf("Hub %s: %v", a.hub, err)
+			}
+			if time.Since(connected) > hubRetryMax {
+				wait = hubRetryMin
+			}
+
+			select {
+			case <-a.stop:
+				return
+			case <-time.After(wait):
+			}
+			if wait *= 2; wait > hubRetryMax {
+				wait = hubRetryMax
+			}
+		}
+	}()
+}
+
+// serve opens a tunnel to the hub and serves it until it closes
+func (a *HubAgent) serve() error {
+	device, err := a.clients.Resolve(a.hub)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-a.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	conn, err := a.clients.DialWebSocket(ctx, device, HubAgentPath, nil)
+	if err != nil {
+		return err
+	}
+	session := tunnel.NewSession(conn, false)
+	defer session.Close()
+	log.Printf("Connected to hub %s (%s)", device.Name, device.ID)
+
+	// The hub authenticates to the peer API with its certificate, as on the listener
+	server := &http.Server{Handler: a.handler}
+	go server.Serve(tls.NewListener(session, a.identity.ServerTLSConfig()))
+	defer server.Close()
+
+	select {
+	case <-session.Done():
+		return tunnel.ErrClosed
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+// Close disconnects from the hub
+func (a *HubAgent) Close() {
+	a.closeOnce.Do(func() {
+		close(a.stop)
+	})
+}
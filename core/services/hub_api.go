@@ -0,0 +1,39 @@
+package services
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HubAPIService exposes the agents connected to this device as their hub
+type HubAPIService struct {
+	hub    *HubService
+	access *SessionAccessService
+}
+
+// NewHubAPIService creates a new hub API service
+func NewHubAPIService(hub *HubService) *HubAPIService {
+	return &HubAPIService{hub: hub}
+}
+
+// SetSessionAccess sets the service that decides who administers the server
+func (s *HubAPIService) SetSessionAccess(access *SessionAccessService) {
+	s.access = access
+}
+
+// ListAgents lists the agents with an open tunnel to this hub
+func (s *HubAPIService) ListAgents(c *gin.Context) {
+	c.JSON(http.StatusOK, s.hub.Agents())
+}
+
+// RegisterRoutes registers hub API routes
+func (s *HubAPIService) RegisterRoutes(router *gin.Engine) {
+	router.GET("/api/v1/agents", s.access.RequireAdmin(), s.ListAgents)
+}
+
+// RegisterPeerRoutes registers the route agents open their tunnel on, on the
+// mutual TLS listener. router must authenticate callers with RequirePairedDevice.
+func (s *HubAPIService) RegisterPeerRoutes(router gin.IRouter) {
+	router.GET(HubAgentPath, s.hub.Connect)
+}
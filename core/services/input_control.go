@@ -0,0 +1,344 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// ErrNotDriver is returned when a viewer acts as the driver of a session without being it
+	ErrNotDriver = errors.New("client does not drive this session")
+	// ErrNotViewer is returned for a client that does not view the session
+	ErrNotViewer = errors.New("client does not view this session")
+)
+
+// Viewer is a client viewing a session, as shown to the other viewers
+type Viewer struct {
+	ClientID string    `json:"client_id"`
+	UserID   string    `json:"user_id"`
+	DeviceID string    `json:"device_id"`
+	Since    time.Time `json:"since"`
+}
+
+// ControlState is who drives a session and who observes it
+type ControlState struct {
+	SessionID string   `json:"session_id"`
+	Driver    *Viewer  `json:"driver"`
+	Observers []Viewer `json:"observers"`
+	Requests  []Viewer `json:"requests"` // Observers asking for control, oldest first
+}
+
+// InputControl hands input control of each session to one of its viewers, the
+// driver; the others observe. Without a driver, the first viewer to send input
+// becomes it. Observers may ask the driver for control, or take it.
+type InputControl struct {
+	sessions map[string]*sessionControl
+	mu       sync.Mutex
+}
+
+// sessionControl is the control state of one session
+type sessionControl struct {
+	viewers  []*WebSocketClient // In the order they joined
+	since    map[*WebSocketClient]time.Time
+	driver   *WebSocketClient
+	requests []*WebSocketClient
+}
+
+// NewInputControl creates a new input control
+func NewInputControl() *InputControl {
+	return &InputControl{
+		sessions: make(map[string]*sessionControl),
+	}
+}
+
+// Join adds a viewer to a session
+func (ic *InputControl) Join(sessionID string, client *WebSocketClient) *ControlState {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	sc, exists := ic.sessions[sessionID]
+	if !exists {
+		sc = &sessionControl{since: make(map[*WebSocketClient]time.Time)}
+		ic.sessions[sessionID] = sc
+	}
+	if _, viewing := sc.since[client]; !viewing {
+		sc.viewers = append(sc.viewers, client)
+		sc.since[client] = time.Now()
+	}
+	return sc.state(sessionID)
+}
+
+// Leave removes a viewer from a session. Control left by the driver goes to
+// the oldest request, if any. It returns nil when the client did not view the
+// session.
+func (ic *InputControl) Leave(sessionID string, client *WebSocketClient) *ControlState {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	sc, exists := ic.sessions[sessionID]
+	if !exists {
+		return nil
+	}
+	if _, viewing := sc.since[client]; !viewing {
+		return nil
+	}
+	sc.viewers = removeClient(sc.viewers, client)
+	sc.requests = removeClient(sc.requests, client)
+	delete(sc.since, client)
+	if sc.driver == client {
+		sc.driver = nil
+		sc.promote()
+	}
+
+	if len(sc.viewers) == 0 {
+		delete(ic.sessions, sessionID)
+	}
+	return sc.state(sessionID)
+}
+
+// Drive reports whether a viewer may send input to a session, making it the
+// driver when there is none
+func (ic *InputControl) Drive(sessionID string, client *WebSocketClient) (bool, *ControlState) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	sc, exists := ic.sessions[sessionID]
+	if !exists || sc.since[client].IsZero() {
+		// Not viewing the session, so not competing with its viewers
+		return sc == nil || sc.driver == nil, nil
+	}
+	if sc.driver == nil {
+		sc.driver = client
+		sc.requests = removeClient(sc.requests, client)
+		return true, sc.state(sessionID)
+	}
+	return sc.driver == client, nil
+}
+
+// MayDrive reports whether input from a client that does not view a session,
+// such as a REST client, may reach it: the session has no driver, or the
+// driver was authenticated as the same device or user. Unauthenticated input
+// never passes a driver.
+func (ic *InputControl) MayDrive(sessionID string, identity string) bool {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	sc, exists := ic.sessions[sessionID]
+	if !exists || sc.driver == nil {
+		return true
+	}
+	return identity != "" && sc.driver.identity == identity
+}
+
+// inputIdentity returns who a request was authenticated as for input control:
+// the paired device it came over, else the user of its token or API key, or ""
+// when it was not authenticated. The X-Device-ID header is chosen by the
+// client, so it is never trusted here.
+func inputIdentity(c *gin.Context) string {
+	if device := pairedDevice(c); device != nil {
+		return "device:" + device.ID
+	}
+	if userID := requestUserID(c); userID != "" {
+		return "user:" + userID
+	}
+	return ""
+}
+
+// Request asks for control of a session. It is granted at once when nobody
+// drives the session; otherwise the request waits for the driver, which is
+// returned so it can be told.
+func (ic *InputControl) Request(sessionID string, client *WebSocketClient) (*ControlState, *WebSocketClient, error) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	sc, err := ic.viewed(sessionID, client)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch {
+	case sc.driver == nil:
+		sc.driver = client
+	case sc.driver == client:
+	default:
+		if !containsClient(sc.requests, client) {
+			sc.requests = append(sc.requests, client)
+		}
+		return sc.state(sessionID), sc.driver, nil
+	}
+	return sc.state(sessionID), nil, nil
+}
+
+// Grant passes control from the driver to another viewer, by client ID; an
+// empty ID picks the oldest request
+func (ic *InputControl) Grant(sessionID string, driver *WebSocketClient, clientID string) (*ControlState, error) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	sc, err := ic.driven(sessionID, driver)
+	if err != nil {
+		return nil, err
+	}
+	if clientID == "" {
+		if len(sc.requests) == 0 {
+			return sc.state(sessionID), nil
+		}
+		clientID = sc.requests[0].id
+	}
+	target := sc.viewer(clientID)
+	if target == nil {
+		return nil, ErrNotViewer
+	}
+	sc.driver = target
+	sc.requests = removeClient(sc.requests, target)
+	return sc.state(sessionID), nil
+}
+
+// Deny refuses the request of a viewer, by client ID, and returns that viewer
+func (ic *InputControl) Deny(sessionID string, driver *WebSocketClient, clientID string) (*ControlState, *WebSocketClient, error) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	sc, err := ic.driven(sessionID, driver)
+	if err != nil {
+		return nil, nil, err
+	}
+	requester := sc.viewer(clientID)
+	if requester == nil || !containsClient(sc.requests, requester) {
+		return nil, nil, ErrNotViewer
+	}
+	sc.requests = removeClient(sc.requests, requester)
+	return sc.state(sessionID), requester, nil
+}
+
+// Release gives up control of a session, passing it to the oldest request
+func (ic *InputControl) Release(sessionID string, driver *WebSocketClient) (*ControlState, error) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	sc, err := ic.driven(sessionID, driver)
+	if err != nil {
+		return nil, err
+	}
+	sc.driver = nil
+	sc.promote()
+	return sc.state(sessionID), nil
+}
+
+// Take makes a viewer the driver of a session without asking the driver
+func (ic *InputControl) Take(sessionID string, client *WebSocketClient) (*ControlState, error) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	sc, err := ic.viewed(sessionID, client)
+	if err != nil {
+		return nil, err
+	}
+	sc.driver = client
+	sc.requests = removeClient(sc.requests, client)
+	return sc.state(sessionID), nil
+}
+
+// State returns the control state of a session
+func (ic *InputControl) State(sessionID string) *ControlState {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+
+	sc, exists := ic.sessions[sessionID]
+	if !exists {
+		return &ControlState{SessionID: sessionID, Observers: []Viewer{}, Requests: []Viewer{}}
+	}
+	return sc.state(sessionID)
+}
+
+// viewed returns the control state of a session the client views
+func (ic *InputControl) viewed(sessionID string, client *WebSocketClient) (*sessionControl, error) {
+	sc, exists := ic.sessions[sessionID]
+	if !exists || sc.since[client].IsZero() {
+		return nil, ErrNotViewer
+	}
+	return sc, nil
+}
+
+// driven returns the control state of a session the client drives
+func (ic *InputControl) driven(sessionID string, client *WebSocketClient) (*sessionControl, error) {
+	sc, err := ic.viewed(sessionID, client)
+	if err != nil {
+		return nil, err
+	}
+	if sc.driver != client {
+		return nil, ErrNotDriver
+	}
+	return sc, nil
+}
+
+// promote hands control to the oldest request
+func (sc *sessionControl) promote() {
+	if len(sc.requests) > 0 {
+		sc.driver = sc.requests[0]
+		sc.requests = sc.requests[1:]
+	}
+}
+
+// viewer finds a viewer by client ID
+func (sc *sessionControl) viewer(clientID string) *WebSocketClient {
+	for _, client := range sc.viewers {
+		if client.id == clientID {
+			return client
+		}
+	}
+	return nil
+}
+
+// state describes the control state
+func (sc *sessionControl) state(sessionID string) *ControlState {
+	state := &ControlState{
+		SessionID: sessionID,
+		Observers: []Viewer{},
+		Requests:  []Viewer{},
+	}
+	for _, client := range sc.viewers {
+		viewer := sc.describe(client)
+		if client == sc.driver {
+			state.Driver = &viewer
+		} else {
+			state.Observers = append(state.Observers, viewer)
+		}
+	}
+	for _, client := range sc.requests {
+		state.Requests = append(state.Requests, sc.describe(client))
+	}
+	return state
+}
+
+// describe shows a viewer to the others
+func (sc *sessionControl) describe(client *WebSocketClient) Viewer {
+	return Viewer{
+		ClientID: client.id,
+		UserID:   client.reader.UserID,
+		DeviceID: client.reader.DeviceID,
+		Since:    sc.since[client],
+	}
+}
+
+// removeClient removes a client from a list
+func removeClient(clients []*WebSocketClient, client *WebSocketClient) []*WebSocketClient {
+	for i, c := range clients {
+		if c == client {
+			return append(clients[:i:i], clients[i+1:]...)
+		}
+	}
+	return clients
+}
+
+// containsClient reports whether a list holds a client
+func containsClient(clients []*WebSocketClient, client *WebSocketClient) bool {
+	for _, c := range clients {
+		if c == client {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,325 @@
+package services
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/majiayu000/anywhere-ai/core/database"
+	"github.com/majiayu000/anywhere-ai/core/tmux"
+	"github.com/majiayu000/anywhere-ai/core/tools"
+)
+
+const (
+	// inputPollInterval is how often a session with pending input is checked
+	inputPollInterval = 500 * time.Millisecond
+	// inputSettleDelay is the minimum gap between two deliveries, giving the
+	// tool time to render its "processing" state after receiving input
+	inputSettleDelay = 2 * time.Second
+)
+
+// InputQueue holds user messages until the tool in a session is ready for input
+type InputQueue struct {
+	tmuxManager     *tmux.Manager
+	messageService  *MessageService
+	attachmentStore *AttachmentStore
+	wsService       *TerminalWebSocketService
+	sessions        map[string]*SessionInputQueue
+	mu              sync.Mutex
+}
+
+// SessionInputQueue tracks pending input for a single session
+type SessionInputQueue struct {
+	SessionID  string
+	Pending    []*database.TerminalMessage
+	InFlight   *database.TerminalMessage // Sent but not yet acknowledged
+	SentAt     time.Time
+	SentOutput string // Pane content at the time InFlight was sent
+	adapter    tools.ToolAdapter
+	Context    context.Context
+	Cancel     context.CancelFunc
+}
+
+// NewInputQueue creates a new input queue
+func NewInputQueue(tmuxManager *tmux.Manager, messageService *MessageService, attachmentStore *AttachmentStore, wsService *TerminalWebSocketService) *InputQueue {
+	return &InputQueue{
+		tmuxManager:     tmuxManager,
+		messageService:  messageService,
+		attachmentStore: attachmentStore,
+		wsService:       wsService,
+		sessions:        make(map[string]*SessionInputQueue),
+	}
+}
+
+// Enqueue stores a user message with optional attachments and schedules it for delivery
+func (q *InputQueue) Enqueue(ctx context.Context, sender database.Reader, sessionID string, content string, attachmentIDs []uuid.UUID) (*database.TerminalMessage, error) {
+	tmuxSession, err := q.tmuxManager.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	attachments := make([]*database.Attachment, 0, len(attachmentIDs))
+	for _, id := range attachmentIDs {
+		attachment, err := q.attachmentStore.Get(ctx, sessionID, id)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+
+	message, err := q.messageService.QueueUserMessage(ctx, &sender, sessionID, content, q.attachmentStore.MessageMetadata(attachments))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := q.attachmentStore.Link(ctx, message.ID, attachments); err != nil {
+		return nil, err
+	}
+
+	q.push(tmuxSession, message)
+	return message, nil
+}
+
+// Restore rebuilds the queues after a restart from the messages left undelivered
+// in the database. Queued messages of running sessions are queued again. Sent
+// ones may or may not have reached the tool, and those of sessions that are
+// gone cannot be delivered, so both are marked failed for the user to resend.
+func (q *InputQueue) Restore(ctx context.Context) error {
+	messages, err := q.messageService.GetUndeliveredMessages(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := range messages {
+		message := &messages[i]
+		tmuxSession, err := q.tmuxManager.GetSession(message.SessionID)
+		if err != nil || message.DeliveryStatus != database.DeliveryStatusQueued {
+			q.setStatus(message, database.DeliveryStatusFailed)
+			continue
+		}
+		q.push(tmuxSession, message)
+	}
+	return nil
+}
+
+// push adds a message to the queue of its session, starting the session's worker if needed
+func (q *InputQueue) push(tmuxSession *tmux.Session, message *database.TerminalMessage) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	state, exists := q.sessions[message.SessionID]
+	if !exists {
+		adapter, err := tools.NewAdapter(tools.ToolType(tmuxSession.Tool))
+		if err != nil {
+			// Unknown tool: fall back to a shell-like adapter
+			adapter = &tools.CopilotAdapter{}
+		}
+
+		queueCtx, cancel := context.WithCancel(context.Background())
+		state = &SessionInputQueue{
+			SessionID: message.SessionID,
+			adapter:   adapter,
+			Context:   queueCtx,
+			Cancel:    cancel,
+		}
+		q.sessions[message.SessionID] = state
+		go q.run(state)
+	}
+
+	state.Pending = append(state.Pending, message)
+}
+
+// Acknowledge marks the in-flight message of a session as received by the tool
+func (q *InputQueue) Acknowledge(sessionID string) {
+	q.mu.Lock()
+	state, exists := q.sessions[sessionID]
+	if !exists || state.InFlight == nil {
+		q.mu.Unlock()
+		return
+	}
+	message := state.InFlight
+	state.InFlight = nil
+	q.mu.Unlock()
+
+	q.setStatus(message, database.DeliveryStatusAcknowledged)
+}
+
+// Pending returns the messages of a session that are queued or awaiting acknowledgement
+func (q *InputQueue) Pending(sessionID string) []database.TerminalMessage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	state, exists := q.sessions[sessionID]
+	if !exists {
+		return []database.TerminalMessage{}
+	}
+
+	messages := []database.TerminalMessage{}
+	if state.InFlight != nil {
+		messages = append(messages, *state.InFlight)
+	}
+	for _, message := range state.Pending {
+		messages = append(messages, *message)
+	}
+	return messages
+}
+
+// Clear drops all pending input for a session, e.g. when it is deleted
+func (q *InputQueue) Clear(sessionID string) {
+	q.mu.Lock()
+	state, exists := q.sessions[sessionID]
+	if exists {
+		state.Cancel()
+		delete(q.sessions, sessionID)
+	}
+	q.mu.Unlock()
+
+	if !exists {
+		return
+	}
+
+	for _, message := range state.Pending {
+		q.setStatus(message, database.DeliveryStatusFailed)
+	}
+}
+
+// run delivers queued input for a session until its queue drains
+func (q *InputQueue) run(state *SessionInputQueue) {
+	ticker := time.NewTicker(inputPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if done := q.process(state); done {
+			return
+		}
+
+		select {
+		case <-state.Context.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// process performs one delivery step and reports whether the queue is drained
+func (q *InputQueue) process(state *SessionInputQueue) bool {
+	output, err := q.tmuxManager.CaptureOutput(state.Context, state.SessionID)
+	if err != nil {
+		log.Printf("Input queue failed to capture output for session %s: %v", state.SessionID, err)
+		return false
+	}
+	sessionState := state.adapter.ParseOutput(output)
+
+	q.mu.Lock()
+
+	// An in-flight message counts as received once the tool starts working,
+	// or once its pane has changed and settled after the send
+	if inFlight := state.InFlight; inFlight != nil {
+		settled := time.Since(state.SentAt) > inputSettleDelay && output != state.SentOutput
+		if sessionState == tools.StateProcessing || settled {
+			state.InFlight = nil
+			q.mu.Unlock()
+			q.setStatus(inFlight, database.DeliveryStatusAcknowledged)
+			q.mu.Lock()
+		}
+	}
+
+	if state.InFlight == nil && len(state.Pending) == 0 {
+		// Drained: retire the worker; Enqueue starts a new one on demand
+		state.Cancel()
+		delete(q.sessions, state.SessionID)
+		q.mu.Unlock()
+		return true
+	}
+
+	ready := sessionState == tools.StateWaitingInput || sessionState == tools.StateReady
+	if state.InFlight != nil || !ready || time.Since(state.SentAt) < inputSettleDelay {
+		q.mu.Unlock()
+		return false
+	}
+
+	message := state.Pending[0]
+	state.Pending = state.Pending[1:]
+	state.InFlight = message
+	state.SentAt = time.Now()
+	state.SentOutput = output
+	q.mu.Unlock()
+
+	if err := q.deliver(state, message); err != nil {
+		log.Printf("Failed to deliver message %s to session %s: %v", message.ID, state.SessionID, err)
+		q.mu.Lock()
+		state.InFlight = nil
+		q.mu.Unlock()
+		q.setStatus(message, database.DeliveryStatusFailed)
+		return false
+	}
+
+	q.setStatus(message, database.DeliveryStatusSent)
+	return false
+}
+
+// deliver types a message into the tmux pane of a session
+func (q *InputQueue) deliver(state *SessionInputQueue, message *database.TerminalMessage) error {
+	content := message.Content
+
+	// Write attachments into the working directory and reference them in the prompt
+	if message.Metadata != "" {
+		attachments, err := q.attachmentStore.ForMessage(state.Context, message.ID)
+		if err != nil {
+			return err
+		}
+		if len(attachments) > 0 {
+			workDir, err := q.tmuxManager.GetWorkingDir(state.Context, state.SessionID)
+			if err != nil {
+				return err
+			}
+
+			paths := make([]string, 0, len(attachments))
+			for _, attachment := range attachments {
+				path, err := q.attachmentStore.Materialize(attachment, workDir)
+				if err != nil {
+					return err
+				}
+				paths = append(paths, path)
+			}
+			content = state.adapter.FormatAttachments(content, paths)
+		}
+	}
+
+	content = state.adapter.FormatInput(content)
+
+	if strings.HasPrefix(content, "/") {
+		// Remove the "/" prefix and send as command
+		command := strings.TrimPrefix(content, "/")
+		return q.tmuxManager.SendCommand(state.Context, state.SessionID, command)
+	}
+
+	// Send the message directly to the tool using literal input
+	return q.tmuxManager.SendLiteralInput(state.Context, state.SessionID, content)
+}
+
+// setStatus persists a delivery status change and notifies clients
+func (q *InputQueue) setStatus(message *database.TerminalMessage, status database.DeliveryStatus) {
+	// Work on a copy so Pending can read the queued message concurrently
+	q.mu.Lock()
+	if status == database.DeliveryStatusSent && message.DeliveryStatus == database.DeliveryStatusAcknowledged {
+		// The tool acknowledged the message before the send was recorded
+		q.mu.Unlock()
+		return
+	}
+	message.DeliveryStatus = status
+	snapshot := *message
+	q.mu.Unlock()
+
+	if err := q.messageService.UpdateDeliveryStatus(context.Background(), &snapshot, status); err != nil {
+		log.Printf("Failed to update delivery status of message %s: %v", message.ID, err)
+		return
+	}
+
+	if q.wsService != nil {
+		q.wsService.BroadcastDeliveryStatus(snapshot.SessionID, &snapshot)
+	}
+}
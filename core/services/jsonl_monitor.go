@@ -11,12 +11,18 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/majiayu000/anywhere-ai/core/database"
 )
 
 // JSONLMonitor monitors Claude's JSONL log files for precise message extraction
 type JSONLMonitor struct {
 	messageService *MessageService
 	wsService      *TerminalWebSocketService
+	inputQueue     *InputQueue
+	gitTracker     *GitTracker
+	checkpoints    *CheckpointService
+	usageTracker   *UsageTracker
 	sessions       map[string]*JSONLSessionState
 	mu             sync.RWMutex
 }
@@ -26,6 +32,7 @@ type JSONLSessionState struct {
 	SessionID    string
 	LogFilePath  string
 	LastPosition int64
+	Since        time.Time // Entries up to this time are already recorded
 	Context      context.Context
 	Cancel       context.CancelFunc
 }
@@ -40,8 +47,20 @@ type ClaudeLogEntry struct {
 
 // Message represents the message content in JSONL
 type Message struct {
-	Role    string      `json:"role"`
-	Content interface{} `json:"content"` // Can be string or []ContentBlock
+	ID         string      `json:"id,omitempty"`
+	Model      string      `json:"model,omitempty"`
+	Role       string      `json:"role"`
+	Content    interface{} `json:"content"` // Can be string or []ContentBlock
+	StopReason string      `json:"stop_reason,omitempty"`
+	Usage      *Usage      `json:"usage,omitempty"`
+}
+
+// Usage represents the token usage reported with an assistant message
+type Usage struct {
+	InputTokens              int64 `json:"input_tokens"`
+	OutputTokens             int64 `json:"output_tokens"`
+	CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
 }
 
 // ContentBlock represents a content block (text, tool_use, etc.)
@@ -61,6 +80,26 @@ func NewJSONLMonitor(messageService *MessageService, wsService *TerminalWebSocke
 	}
 }
 
+// SetInputQueue sets the queue notified when Claude receives a user message
+func (m *JSONLMonitor) SetInputQueue(inputQueue *InputQueue) {
+	m.inputQueue = inputQueue
+}
+
+// SetGitTracker sets the tracker that captures repository changes per turn
+func (m *JSONLMonitor) SetGitTracker(gitTracker *GitTracker) {
+	m.gitTracker = gitTracker
+}
+
+// SetCheckpointService sets the service that checkpoints sessions every few turns
+func (m *JSONLMonitor) SetCheckpointService(checkpoints *CheckpointService) {
+	m.checkpoints = checkpoints
+}
+
+// SetUsageTracker sets the tracker that records token usage
+func (m *JSONLMonitor) SetUsageTracker(usageTracker *UsageTracker) {
+	m.usageTracker = usageTracker
+}
+
 // StartMonitoring starts monitoring JSONL for a session
 func (m *JSONLMonitor) StartMonitoring(sessionID string) error {
 	m.mu.Lock()
@@ -71,19 +110,68 @@ func (m *JSONLMonitor) StartMonitoring(sessionID string) error {
 		state.Cancel()
 	}
 
+	// Get current working directory and convert to Claude's project name format
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	projectDir, err := claudeProjectDir(cwd)
+	if err != nil {
+		return err
+	}
+
 	// Wait for the new Claude session to create its own JSONL file
 	// Instead of finding the latest file, we'll wait for a new one
-	logPath, err := m.waitForNewClaudeLogFile(sessionID)
+	logPath, err := m.waitForNewClaudeLogFile(sessionID, projectDir)
 	if err != nil {
 		return fmt.Errorf("failed to find new Claude log file: %w", err)
 	}
 
+	m.monitor(sessionID, logPath, time.Time{})
+	return nil
+}
+
+// ResumeMonitoring monitors a Claude conversation resumed from the transcript at
+// logPath, such as one migrated from another device. Claude may continue the
+// transcript or copy it into a new file, so a new file in the same project is
+// preferred; entries up to since are skipped because they are already recorded.
+func (m *JSONLMonitor) ResumeMonitoring(sessionID string, logPath string, since time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if state, exists := m.sessions[sessionID]; exists {
+		state.Cancel()
+	}
+
+	newPath, err := m.waitForNewClaudeLogFile(sessionID, filepath.Dir(logPath))
+	if err == nil && newPath != "" {
+		logPath = newPath
+	}
+
+	m.monitor(sessionID, logPath, since)
+	return nil
+}
+
+// LogFile returns the transcript monitored for a session, or an empty string
+func (m *JSONLMonitor) LogFile(sessionID string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if state, exists := m.sessions[sessionID]; exists {
+		return state.LogFilePath
+	}
+	return ""
+}
+
+// monitor starts monitoring logPath from its beginning. Callers hold m.mu.
+func (m *JSONLMonitor) monitor(sessionID string, logPath string, since time.Time) {
 	// Create monitoring context
 	ctx, cancel := context.WithCancel(context.Background())
 	state := &JSONLSessionState{
 		SessionID:    sessionID,
 		LogFilePath:  logPath,
-		LastPosition: 0, // Start from beginning of the new file
+		LastPosition: 0, // Start from beginning of the file
+		Since:        since,
 		Context:      ctx,
 		Cancel:       cancel,
 	}
@@ -91,42 +179,38 @@ func (m *JSONLMonitor) StartMonitoring(sessionID string) error {
 
 	// Start monitoring in goroutine
 	go m.monitorJSONLFile(state)
-
-	return nil
 }
 
-// StopMonitoring stops monitoring JSONL for a session
-func (m *JSONLMonitor) StopMonitoring(sessionID string) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	if state, exists := m.sessions[sessionID]; exists {
-		state.Cancel()
-		delete(m.sessions, sessionID)
-	}
-}
-
-// waitForNewClaudeLogFile waits for a new Claude JSONL file to be created
-func (m *JSONLMonitor) waitForNewClaudeLogFile(sessionID string) (string, error) {
+// claudeProjectDir returns the directory holding Claude's transcripts for
+// conversations started in cwd
+func claudeProjectDir(cwd string) (string, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
 		return "", err
 	}
 
-	// Get current working directory and convert to Claude's project name format
-	cwd, err := os.Getwd()
-	if err != nil {
-		return "", err
-	}
-
 	// Convert path to Claude's format
 	projectName := strings.ReplaceAll(cwd, "/", "-")
 	projectName = strings.ReplaceAll(projectName, ".", "-")
 	projectName = strings.ReplaceAll(projectName, " ", "-")
 
 	// Claude logs are stored in ~/.claude/projects/{project-name}/
-	projectDir := filepath.Join(homeDir, ".claude", "projects", projectName)
+	return filepath.Join(homeDir, ".claude", "projects", projectName), nil
+}
+
+// StopMonitoring stops monitoring JSONL for a session
+func (m *JSONLMonitor) StopMonitoring(sessionID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if state, exists := m.sessions[sessionID]; exists {
+		state.Cancel()
+		delete(m.sessions, sessionID)
+	}
+}
 
+// waitForNewClaudeLogFile waits for a new Claude JSONL file to be created in projectDir
+func (m *JSONLMonitor) waitForNewClaudeLogFile(sessionID string, projectDir string) (string, error) {
 	// Record existing files before starting
 	existingFiles := make(map[string]bool)
 	if files, err := filepath.Glob(filepath.Join(projectDir, "*.jsonl")); err == nil {
@@ -158,30 +242,11 @@ func (m *JSONLMonitor) waitForNewClaudeLogFile(sessionID string) (string, error)
 	}
 
 	// Fallback: if no new file found, use the most recent one but from a specific position
-	return m.findClaudeLogFile()
+	return m.findClaudeLogFile(projectDir)
 }
 
-// findClaudeLogFile finds the most recent Claude JSONL log file (fallback)
-func (m *JSONLMonitor) findClaudeLogFile() (string, error) {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return "", err
-	}
-
-	// Get current working directory and convert to Claude's project name format
-	cwd, err := os.Getwd()
-	if err != nil {
-		return "", err
-	}
-
-	// Convert path to Claude's format
-	projectName := strings.ReplaceAll(cwd, "/", "-")
-	projectName = strings.ReplaceAll(projectName, ".", "-")
-	projectName = strings.ReplaceAll(projectName, " ", "-")
-
-	// Claude logs are stored in ~/.claude/projects/{project-name}/
-	projectDir := filepath.Join(homeDir, ".claude", "projects", projectName)
-
+// findClaudeLogFile finds the most recent Claude JSONL log file in projectDir (fallback)
+func (m *JSONLMonitor) findClaudeLogFile(projectDir string) (string, error) {
 	// Find the most recent JSONL file
 	files, err := filepath.Glob(filepath.Join(projectDir, "*.jsonl"))
 	if err != nil {
@@ -250,6 +315,9 @@ func (m *JSONLMonitor) processNewEntries(state *JSONLSessionState) {
 			log.Printf("Failed to parse JSONL entry: %v", err)
 			continue
 		}
+		if !state.Since.IsZero() && !entry.Timestamp.After(state.Since) {
+			continue
+		}
 
 		// Process the entry
 		m.processLogEntry(state.SessionID, &entry)
@@ -270,9 +338,17 @@ func (m *JSONLMonitor) processLogEntry(sessionID string, entry *ClaudeLogEntry)
 		// This means Claude has received the user message and is about to process it
 		log.Printf("User message detected in JSONL - Claude is about to respond: %s", sessionID)
 		m.wsService.BroadcastTypingIndicator(sessionID, true)
+		if m.inputQueue != nil {
+			m.inputQueue.Acknowledge(sessionID)
+		}
 
 	case "assistant":
 		// Extract Claude's response
+		var message *database.TerminalMessage
+		defer func() {
+			m.recordUsage(ctx, sessionID, entry, message)
+		}()
+
 		content := m.extractTextContent(entry.Message.Content)
 		if content != "" {
 			// Stop typing indicator when Claude responds
@@ -281,12 +357,25 @@ func (m *JSONLMonitor) processLogEntry(sessionID string, entry *ClaudeLogEntry)
 			// Check if this contains tool usage
 			requiresInput := m.containsToolUsage(entry.Message.Content)
 			
-			message, err := m.messageService.CreateAgentMessage(ctx, sessionID, content, requiresInput)
+			// Log entries hold the raw transcript; CreateAgentMessage masks
+			// secrets before the message is stored or broadcast
+			var err error
+			message, err = m.messageService.CreateAgentMessage(ctx, sessionID, content, requiresInput)
 			if err != nil {
 				log.Printf("Failed to create agent message: %v", err)
 				return
 			}
 			m.wsService.BroadcastMessage(sessionID, message)
+			
+			// A turn ends when Claude stops for any reason other than calling a tool
+			if entry.Message.StopReason != "tool_use" {
+				if m.gitTracker != nil {
+					m.gitTracker.CaptureTurnAsync(sessionID, message)
+				}
+				if m.checkpoints != nil {
+					m.checkpoints.TurnCompleted(sessionID)
+				}
+			}
 		}
 
 	case "thinking":
@@ -310,6 +399,32 @@ func (m *JSONLMonitor) processLogEntry(sessionID string, entry *ClaudeLogEntry)
 	}
 }
 
+// recordUsage records the token usage reported with an assistant entry
+func (m *JSONLMonitor) recordUsage(ctx context.Context, sessionID string, entry *ClaudeLogEntry, message *database.TerminalMessage) {
+	usage := entry.Message.Usage
+	if m.usageTracker == nil || usage == nil {
+		return
+	}
+
+	record := &database.TokenUsage{
+		SessionID:           sessionID,
+		ExternalID:          entry.Message.ID,
+		Model:               entry.Message.Model,
+		InputTokens:         usage.InputTokens,
+		OutputTokens:        usage.OutputTokens,
+		CacheCreationTokens: usage.CacheCreationInputTokens,
+		CacheReadTokens:     usage.CacheReadInputTokens,
+		CreatedAt:           entry.Timestamp,
+	}
+	if message != nil {
+		record.MessageID = &message.ID
+	}
+
+	if _, err := m.usageTracker.Record(ctx, record); err != nil {
+		log.Printf("Failed to record token usage for session %s: %v", sessionID, err)
+	}
+}
+
 // extractTextContent extracts text content from content (string or []ContentBlock)
 func (m *JSONLMonitor) extractTextContent(content interface{}) string {
 	switch v := content.(type) {
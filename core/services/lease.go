@@ -0,0 +1,236 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/majiayu000/anywhere-ai/core/database"
+	"github.com/majiayu000/anywhere-ai/core/terminal"
+	"github.com/majiayu000/anywhere-ai/core/tmux"
+)
+
+// ErrTakeoverUnavailable is returned when a session cannot be restarted on this device
+var ErrTakeoverUnavailable = errors.New("session cannot be taken over on this device")
+
+// LeaseResponse is the lease of a session in API responses and events
+type LeaseResponse struct {
+	SessionID string     `json:"session_id"`
+	DeviceID  string     `json:"device_id"` // Holder, or last holder
+	State     string     `json:"state"`     // held, expired or free
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Epoch     int64      `json:"epoch"`
+}
+
+// newLeaseResponse describes a lease as of now
+func newLeaseResponse(lease *terminal.SessionLease) *LeaseResponse {
+	response := &LeaseResponse{
+		SessionID: lease.SessionID,
+		DeviceID:  lease.DeviceID,
+		State:     lease.State(time.Now()),
+		Epoch:     lease.Epoch,
+	}
+	if !lease.ExpiresAt.IsZero() {
+		expires := lease.ExpiresAt
+		response.ExpiresAt = &expires
+	}
+	return response
+}
+
+// LeaseService keeps the ownership leases of the sessions running on this
+// device. The lease holder is the only device that runs a session's process and
+// writes to it. Leases are renewed by heartbeat; a session whose lease another
+// device took over after it expired is stopped here, and a session whose holder
+// went away can be taken over once its lease expires, so two devices never run
+// the same agent.
+type LeaseService struct {
+	store       *database.SessionRepository
+	tmuxManager *tmux.Manager
+	launcher    *ToolLauncher
+	gitTracker  *GitTracker
+	inputQueue  *InputQueue
+	wsService   *TerminalWebSocketService
+
+	deviceID string
+
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewLeaseService creates a new lease service
+func NewLeaseService(store *database.SessionRepository, tmuxManager *tmux.Manager, launcher *ToolLauncher, wsService *TerminalWebSocketService) *LeaseService {
+	deviceID, _ := terminal.LocalDevice()
+	return &LeaseService{
+		store:       store,
+		tmuxManager: tmuxManager,
+		launcher:    launcher,
+		wsService:   wsService,
+		deviceID:    deviceID,
+		stop:        make(chan struct{}),
+	}
+}
+
+// SetGitTracker sets the tracker that records the repository state of sessions taken over
+func (s *LeaseService) SetGitTracker(gitTracker *GitTracker) {
+	s.gitTracker = gitTracker
+}
+
+// SetInputQueue sets the queue whose pending input is dropped for sessions lost to another device
+func (s *LeaseService) SetInputQueue(inputQueue *InputQueue) {
+	s.inputQueue = inputQueue
+}
+
+// Start renews the leases of the sessions running here in the background,
+// three times per lease
+func (s *LeaseService) Start() {
+	go func() {
+		ticker := time.NewTicker(s.store.LeaseTTL() / 3)
+		defer ticker.Stop()
+
+		for {
+			s.renew(context.Background())
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Close stops renewing leases. They expire unless another process on this
+// device renews them.
+func (s *LeaseService) Close() {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+	})
+}
+
+// renew sends a heartbeat for every session running here
+func (s *LeaseService) renew(ctx context.Context) {
+	sessions, err := s.tmuxManager.ListSessions(ctx)
+	if err != nil {
+		log.Printf("Failed to list sessions to renew leases: %v", err)
+		return
+	}
+
+	for _, session := range sessions {
+		previous, _ := s.store.Lease(session.ID)
+		lease, err := s.store.AcquireLease(session.ID, s.deviceID, s.store.LeaseTTL())
+		switch {
+		case errors.Is(err, terminal.ErrLeaseHeld):
+			s.lost(ctx, session.ID, lease)
+		case errors.Is(err, database.ErrSessionNotFound):
+			// Not recorded yet
+		case err != nil:
+			log.Printf("Failed to renew lease of session %s: %v", session.ID, err)
+		case previous == nil || previous.Epoch != lease.Epoch:
+			s.wsService.BroadcastLease(session.ID, newLeaseResponse(lease))
+		}
+	}
+}
+
+// lost stops a session that another device took over after its lease here expired
+func (s *LeaseService) lost(ctx context.Context, sessionID string, lease *terminal.SessionLease) {
+	log.Printf("Session %s was taken over by %s, stopping it here", sessionID, lease.DeviceID)
+	s.launcher.Stop(sessionID)
+	if err := s.tmuxManager.KillSession(ctx, sessionID); err != nil {
+		log.Printf("Failed to stop session %s: %v", sessionID, err)
+	}
+	if s.inputQueue != nil {
+		s.inputQueue.Clear(sessionID)
+	}
+	s.wsService.BroadcastLease(sessionID, newLeaseResponse(lease))
+}
+
+// Lease returns the lease of a session
+func (s *LeaseService) Lease(sessionID string) (*terminal.SessionLease, error) {
+	return s.store.Lease(sessionID)
+}
+
+// Leases returns the leases of the given sessions that are stored, by session ID
+func (s *LeaseService) Leases(sessionIDs []string) map[string]*terminal.SessionLease {
+	leases, err := s.store.Leases(sessionIDs)
+	if err != nil {
+		log.Printf("Failed to load leases: %v", err)
+	}
+	return leases
+}
+
+// CheckWriter fails with terminal.ErrLeaseHeld when another device holds the
+// lease of a session, so input sent here would not reach the running agent
+func (s *LeaseService) CheckWriter(sessionID string) error {
+	lease, err := s.store.Lease(sessionID)
+	if err != nil {
+		// Sessions that are not stored have no lease
+		return nil
+	}
+	now := time.Now()
+	if lease.DeviceID != s.deviceID && lease.State(now) == terminal.LeaseStateHeld {
+		return fmt.Errorf("%w: %s holds session %s", terminal.ErrLeaseHeld, lease.DeviceID, sessionID)
+	}
+	return nil
+}
+
+// Takeover makes this device run a session whose lease is free or expired. A
+// session still running here is adopted; otherwise its tool is started again
+// in its working directory. It fails with terminal.ErrLeaseHeld while another
+// device holds the lease.
+func (s *LeaseService) Takeover(ctx context.Context, sessionID string) (*terminal.SessionLease, error) {
+	state, err := s.store.LoadSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.tmuxManager.HasSession(ctx, sessionID) {
+		lease, err := s.store.AcquireLease(sessionID, s.deviceID, s.store.LeaseTTL())
+		if err != nil {
+			return lease, err
+		}
+		if _, err := s.tmuxManager.GetSession(sessionID); err != nil {
+			if err := adoptSession(ctx, s.tmuxManager, state); err != nil {
+				return nil, err
+			}
+		}
+		if err := s.store.UpdateStatus(sessionID, terminal.SessionStatusRunning); err != nil {
+			return nil, err
+		}
+		s.wsService.BroadcastLease(sessionID, newLeaseResponse(lease))
+		return lease, nil
+	}
+
+	if info, err := os.Stat(state.WorkingDir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("%w: working directory %s does not exist", ErrTakeoverUnavailable, state.WorkingDir)
+	}
+
+	lease, err := s.store.AcquireLease(sessionID, s.deviceID, s.store.LeaseTTL())
+	if err != nil {
+		return lease, err
+	}
+	if _, err := s.tmuxManager.CreateSessionInDir(ctx, state.ToolName, sessionID, state.WorkingDir); err != nil {
+		s.store.ReleaseLease(sessionID, s.deviceID)
+		return nil, err
+	}
+	if err := s.launcher.Launch(ctx, sessionID, state.ToolName); err != nil {
+		s.launcher.Stop(sessionID)
+		s.tmuxManager.KillSession(ctx, sessionID)
+		s.store.ReleaseLease(sessionID, s.deviceID)
+		return nil, err
+	}
+	if s.gitTracker != nil {
+		if err := s.gitTracker.StartSession(ctx, sessionID); err != nil {
+			log.Printf("Failed to start git tracking for session %s: %v", sessionID, err)
+		}
+	}
+	if err := s.store.UpdateStatus(sessionID, terminal.SessionStatusRunning); err != nil {
+		log.Printf("Failed to mark session %s running: %v", sessionID, err)
+	}
+
+	s.wsService.BroadcastLease(sessionID, newLeaseResponse(lease))
+	log.Printf("Took over session %s from %s", sessionID, state.CurrentDeviceID)
+	return lease, nil
+}
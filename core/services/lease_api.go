@@ -0,0 +1,69 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/majiayu000/anywhere-ai/core/database"
+	"github.com/majiayu000/anywhere-ai/core/terminal"
+)
+
+// LeaseAPIService exposes who runs each session and lets this device take over
+// sessions whose lease expired
+type LeaseAPIService struct {
+	leases *LeaseService
+}
+
+// NewLeaseAPIService creates a new lease API service
+func NewLeaseAPIService(leases *LeaseService) *LeaseAPIService {
+	return &LeaseAPIService{leases: leases}
+}
+
+// GetLease returns the lease of a session
+func (s *LeaseAPIService) GetLease(c *gin.Context) {
+	lease, err := s.leases.Lease(c.Param("id"))
+	if err != nil {
+		c.JSON(leaseErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, newLeaseResponse(lease))
+}
+
+// Takeover runs a session on this device once its lease is free or expired
+func (s *LeaseAPIService) Takeover(c *gin.Context) {
+	lease, err := s.leases.Takeover(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		response := gin.H{"error": err.Error()}
+		if lease != nil {
+			response["lease"] = newLeaseResponse(lease)
+		}
+		c.JSON(leaseErrorStatus(err), response)
+		return
+	}
+
+	c.JSON(http.StatusOK, newLeaseResponse(lease))
+}
+
+// leaseErrorStatus maps lease errors to HTTP statuses
+func leaseErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, database.ErrSessionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, terminal.ErrLeaseHeld):
+		return http.StatusConflict
+	case errors.Is(err, ErrTakeoverUnavailable):
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+// RegisterRoutes registers lease API routes
+func (s *LeaseAPIService) RegisterRoutes(router *gin.Engine) {
+	api := router.Group("/api/v1/terminal/sessions/:id")
+	{
+		api.GET("/lease", s.GetLease)
+		api.POST("/takeover", s.Takeover)
+	}
+}
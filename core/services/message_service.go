@@ -2,17 +2,29 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/majiayu000/anywhere-ai/core/database"
+	"github.com/majiayu000/anywhere-ai/core/encryption"
 	"gorm.io/gorm"
 )
 
+// ErrSearchUnavailable is returned when messages are encrypted and the search index is disabled
+var ErrSearchUnavailable = errors.New("message content is encrypted; enable the search index to search it")
+
+// ErrStaleRead is returned when queued user messages were taken by another reader
+var ErrStaleRead = errors.New("queued messages were read by another process")
+
+// ErrMessageNotFound is returned when a message does not exist
+var ErrMessageNotFound = errors.New("message not found")
+
 // MessageService handles message operations
 type MessageService struct {
-	db *gorm.DB
+	db        *gorm.DB
+	redaction *RedactionService
 }
 
 // NewMessageService creates a new message service
@@ -20,6 +32,19 @@ func NewMessageService(db *gorm.DB) *MessageService {
 	return &MessageService{db: db}
 }
 
+// SetRedactionService sets the service that masks secrets in tool-produced messages
+func (s *MessageService) SetRedactionService(redaction *RedactionService) {
+	s.redaction = redaction
+}
+
+// redact masks secrets in a message before it is stored. Messages queued for the
+// tool are left alone, since they are typed into the session verbatim.
+func (s *MessageService) redact(ctx context.Context, message *database.TerminalMessage) {
+	if s.redaction != nil {
+		s.redaction.RedactMessage(ctx, message)
+	}
+}
+
 // CreateAgentMessage creates a new agent message
 func (s *MessageService) CreateAgentMessage(ctx context.Context, sessionID string, content string, requiresInput bool) (*database.TerminalMessage, error) {
 	message := &database.TerminalMessage{
@@ -31,21 +56,28 @@ func (s *MessageService) CreateAgentMessage(ctx context.Context, sessionID strin
 		CreatedAt:         time.Now(),
 		Metadata:          "", // Empty JSON string for SQLite
 	}
+	s.redact(ctx, message)
 
 	if err := s.db.WithContext(ctx).Create(message).Error; err != nil {
 		return nil, fmt.Errorf("failed to create agent message: %w", err)
 	}
 
-	// Update message session unread count
-	if err := s.incrementUnreadCount(ctx, sessionID); err != nil {
-		return nil, err
-	}
-
 	return message, nil
 }
 
-// CreateUserMessage creates a new user message
+// CreateUserMessage creates a new user message, optionally marking it as seen by the agent
 func (s *MessageService) CreateUserMessage(ctx context.Context, sessionID string, content string, markAsRead bool) (*database.TerminalMessage, error) {
+	return s.createUserMessage(ctx, nil, sessionID, content, "", "", markAsRead)
+}
+
+// QueueUserMessage creates a user message that still has to be delivered to the tool.
+// The sender's own read cursor is advanced past the message.
+func (s *MessageService) QueueUserMessage(ctx context.Context, sender *database.Reader, sessionID string, content string, metadata string) (*database.TerminalMessage, error) {
+	return s.createUserMessage(ctx, sender, sessionID, content, metadata, database.DeliveryStatusQueued, true)
+}
+
+// createUserMessage creates a user message with the given metadata and delivery status
+func (s *MessageService) createUserMessage(ctx context.Context, sender *database.Reader, sessionID string, content string, metadata string, status database.DeliveryStatus, markAsRead bool) (*database.TerminalMessage, error) {
 	message := &database.TerminalMessage{
 		ID:                uuid.New(),
 		SessionID:         sessionID,
@@ -53,7 +85,11 @@ func (s *MessageService) CreateUserMessage(ctx context.Context, sessionID string
 		Content:           content,
 		RequiresUserInput: false,
 		CreatedAt:         time.Now(),
-		Metadata:          "", // Empty JSON string for SQLite
+		Metadata:          metadata,
+		DeliveryStatus:    status,
+	}
+	if status != database.DeliveryStatusQueued {
+		s.redact(ctx, message)
 	}
 
 	tx := s.db.WithContext(ctx).Begin()
@@ -76,6 +112,14 @@ func (s *MessageService) CreateUserMessage(ctx context.Context, sessionID string
 		}
 	}
 
+	// The sender has obviously seen their own message
+	if sender != nil {
+		if _, err := s.advanceCursorTx(tx, *sender, message); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
 	if err := tx.Commit().Error; err != nil {
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
@@ -89,7 +133,7 @@ func (s *MessageService) GetMessages(ctx context.Context, sessionID string, limi
 	
 	query := s.db.WithContext(ctx).
 		Where("session_id = ?", sessionID).
-		Order("created_at ASC")
+		Order("created_at ASC, id ASC")
 	
 	if limit > 0 {
 		query = query.Limit(limit)
@@ -105,10 +149,89 @@ func (s *MessageService) GetMessages(ctx context.Context, sessionID string, limi
 	return messages, nil
 }
 
-// GetUnreadMessages retrieves unread messages for a session
-func (s *MessageService) GetUnreadMessages(ctx context.Context, sessionID string) ([]database.TerminalMessage, error) {
-	// Get or create message session
-	messageSession, err := s.getOrCreateMessageSession(ctx, sessionID)
+// GetMessagesAfter retrieves up to limit messages of a session created after one of them.
+// Messages are paged on (created_at, id), so ones sharing the cursor's timestamp are not skipped.
+func (s *MessageService) GetMessagesAfter(ctx context.Context, sessionID string, afterID uuid.UUID, limit int) ([]database.TerminalMessage, error) {
+	var after database.TerminalMessage
+	err := s.db.WithContext(ctx).Where("id = ? AND session_id = ?", afterID, sessionID).First(&after).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrMessageNotFound, afterID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+
+	var messages []database.TerminalMessage
+	query := s.db.WithContext(ctx).
+		Where("session_id = ? AND (created_at > ? OR (created_at = ? AND id > ?))", sessionID, after.CreatedAt, after.CreatedAt, after.ID).
+		Order("created_at ASC, id ASC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if err := query.Find(&messages).Error; err != nil {
+		return nil, fmt.Errorf("failed to get messages: %w", err)
+	}
+
+	return messages, nil
+}
+
+// SearchMessages finds messages containing every word of query, newest first.
+// An empty sessionID searches all sessions, or only sessionIDs unless it is nil. Encrypted content is searched through
+// the blinded search index, which matches whole words only.
+func (s *MessageService) SearchMessages(ctx context.Context, sessionID string, sessionIDs []string, query string, limit int) ([]database.TerminalMessage, error) {
+	messages := []database.TerminalMessage{}
+	terms := encryption.SearchTerms(query)
+	if len(terms) == 0 {
+		return messages, nil
+	}
+
+	db := s.db.WithContext(ctx)
+	search := db.Model(&database.TerminalMessage{})
+	if keyring := encryption.Active(); keyring == nil {
+		for _, term := range terms {
+			search = search.Where("LOWER(content) LIKE ?", "%"+term+"%")
+		}
+	} else {
+		if !database.SearchIndexEnabled() {
+			return nil, ErrSearchUnavailable
+		}
+
+		tokens := make([]string, 0, len(terms))
+		for _, term := range terms {
+			tokens = append(tokens, keyring.SearchToken(term))
+		}
+		matches := db.Model(&database.MessageSearchToken{}).
+			Select("message_id").
+			Where("token IN ? AND key_id = ?", tokens, keyring.ActiveKeyID())
+		if sessionID != "" {
+			matches = matches.Where("session_id = ?", sessionID)
+		}
+		if sessionIDs != nil {
+			matches = matches.Where("session_id IN ?", sessionIDs)
+		}
+		matches = matches.Group("message_id").Having("COUNT(DISTINCT token) = ?", len(tokens))
+		search = search.Where("id IN (?)", matches)
+	}
+
+	if sessionID != "" {
+		search = search.Where("session_id = ?", sessionID)
+	}
+	if sessionIDs != nil {
+		search = search.Where("session_id IN ?", sessionIDs)
+	}
+	if limit > 0 {
+		search = search.Limit(limit)
+	}
+
+	if err := search.Order("created_at DESC").Find(&messages).Error; err != nil {
+		return nil, fmt.Errorf("failed to search messages: %w", err)
+	}
+	return messages, nil
+}
+
+// GetUnreadMessages retrieves the messages of a session a reader has not read yet
+func (s *MessageService) GetUnreadMessages(ctx context.Context, reader database.Reader, sessionID string) ([]database.TerminalMessage, error) {
+	cursor, err := s.getReadCursor(ctx, reader, sessionID)
 	if err != nil {
 		return nil, err
 	}
@@ -118,14 +241,9 @@ func (s *MessageService) GetUnreadMessages(ctx context.Context, sessionID string
 		Where("session_id = ?", sessionID).
 		Order("created_at ASC")
 
-	// If there's a last read message, get messages after it
-	if messageSession.LastReadMessageID != nil {
-		var lastReadMessage database.TerminalMessage
-		if err := s.db.WithContext(ctx).
-			Where("id = ?", messageSession.LastReadMessageID).
-			First(&lastReadMessage).Error; err == nil {
-			query = query.Where("created_at > ?", lastReadMessage.CreatedAt)
-		}
+	// If the reader has read anything, get messages after it
+	if cursor != nil {
+		query = query.Where("created_at > ?", cursor.LastReadAt)
 	}
 
 	if err := query.Find(&messages).Error; err != nil {
@@ -135,12 +253,138 @@ func (s *MessageService) GetUnreadMessages(ctx context.Context, sessionID string
 	return messages, nil
 }
 
-// MarkAsRead marks messages as read up to a specific message ID
-func (s *MessageService) MarkAsRead(ctx context.Context, sessionID string, messageID uuid.UUID) error {
-	return s.markAsReadTx(ctx, s.db.WithContext(ctx), sessionID, messageID)
+// MarkAsRead marks messages as read by a reader up to a specific message ID.
+// Cursors only move forward, so a stale device cannot unread newer messages.
+func (s *MessageService) MarkAsRead(ctx context.Context, reader database.Reader, sessionID string, messageID uuid.UUID) (*database.ReadCursor, error) {
+	var message database.TerminalMessage
+	if err := s.db.WithContext(ctx).
+		Where("id = ? AND session_id = ?", messageID, sessionID).
+		First(&message).Error; err != nil {
+		return nil, fmt.Errorf("message %s not found: %w", messageID, err)
+	}
+
+	return s.advanceCursorTx(s.db.WithContext(ctx), reader, &message)
+}
+
+// CountUnread counts the agent messages of a session a reader has not read yet
+func (s *MessageService) CountUnread(ctx context.Context, reader database.Reader, sessionID string) (int64, error) {
+	cursor, err := s.getReadCursor(ctx, reader, sessionID)
+	if err != nil {
+		return 0, err
+	}
+
+	query := s.db.WithContext(ctx).
+		Model(&database.TerminalMessage{}).
+		Where("session_id = ? AND sender_type = ?", sessionID, database.SenderTypeAgent)
+	if cursor != nil {
+		query = query.Where("created_at > ?", cursor.LastReadAt)
+	}
+
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("failed to count unread messages: %w", err)
+	}
+
+	return count, nil
+}
+
+// GetReadCursors retrieves the read cursors of all readers of a session
+func (s *MessageService) GetReadCursors(ctx context.Context, sessionID string) ([]database.ReadCursor, error) {
+	var cursors []database.ReadCursor
+	if err := s.db.WithContext(ctx).
+		Where("session_id = ?", sessionID).
+		Order("updated_at DESC").
+		Find(&cursors).Error; err != nil {
+		return nil, fmt.Errorf("failed to get read cursors: %w", err)
+	}
+
+	return cursors, nil
 }
 
-// markAsReadTx marks messages as read within a transaction
+// GetInboxSummary summarizes unread messages and sessions waiting for input
+// across the given sessions for a reader
+func (s *MessageService) GetInboxSummary(ctx context.Context, reader database.Reader, sessionIDs []string) (*database.InboxSummary, error) {
+	summary := &database.InboxSummary{
+		UserID:   reader.UserID,
+		DeviceID: reader.DeviceID,
+		Sessions: make([]database.SessionReadSummary, 0, len(sessionIDs)),
+	}
+
+	for _, sessionID := range sessionIDs {
+		unread, err := s.CountUnread(ctx, reader, sessionID)
+		if err != nil {
+			return nil, err
+		}
+
+		session := database.SessionReadSummary{
+			SessionID:      sessionID,
+			UnreadMessages: unread,
+		}
+
+		var lastMessage database.TerminalMessage
+		if err := s.db.WithContext(ctx).
+			Where("session_id = ?", sessionID).
+			Order("created_at DESC").
+			First(&lastMessage).Error; err == nil {
+			session.LastMessageTime = &lastMessage.CreatedAt
+			session.RequiresUserInput = lastMessage.RequiresUserInput
+		}
+
+		summary.TotalUnread += unread
+		if session.RequiresUserInput {
+			summary.SessionsRequiringInput++
+		}
+		summary.Sessions = append(summary.Sessions, session)
+	}
+
+	return summary, nil
+}
+
+// getReadCursor retrieves the cursor of a reader, or nil if they have read nothing
+func (s *MessageService) getReadCursor(ctx context.Context, reader database.Reader, sessionID string) (*database.ReadCursor, error) {
+	var cursor database.ReadCursor
+	err := s.db.WithContext(ctx).
+		Where("session_id = ? AND user_id = ? AND device_id = ?", sessionID, reader.UserID, reader.DeviceID).
+		First(&cursor).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get read cursor: %w", err)
+	}
+
+	return &cursor, nil
+}
+
+// advanceCursorTx moves a reader's cursor to a message unless it is already past it
+func (s *MessageService) advanceCursorTx(tx *gorm.DB, reader database.Reader, message *database.TerminalMessage) (*database.ReadCursor, error) {
+	var cursor database.ReadCursor
+	err := tx.Where("session_id = ? AND user_id = ? AND device_id = ?", message.SessionID, reader.UserID, reader.DeviceID).
+		First(&cursor).Error
+	if err == gorm.ErrRecordNotFound {
+		cursor = database.ReadCursor{
+			SessionID: message.SessionID,
+			UserID:    reader.UserID,
+			DeviceID:  reader.DeviceID,
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get read cursor: %w", err)
+	} else if !message.CreatedAt.After(cursor.LastReadAt) {
+		return &cursor, nil
+	}
+
+	cursor.LastReadMessageID = &message.ID
+	cursor.LastReadAt = message.CreatedAt
+	cursor.UpdatedAt = time.Now()
+
+	if err := tx.Save(&cursor).Error; err != nil {
+		return nil, fmt.Errorf("failed to update read cursor: %w", err)
+	}
+
+	return &cursor, nil
+}
+
+// markAsReadTx marks messages as seen by the agent within a transaction
 func (s *MessageService) markAsReadTx(ctx context.Context, tx *gorm.DB, sessionID string, messageID uuid.UUID) error {
 	messageSession, err := s.getOrCreateMessageSessionTx(ctx, tx, sessionID)
 	if err != nil {
@@ -149,7 +393,6 @@ func (s *MessageService) markAsReadTx(ctx context.Context, tx *gorm.DB, sessionI
 
 	// Update last read message ID
 	messageSession.LastReadMessageID = &messageID
-	messageSession.UnreadCount = 0
 	messageSession.UpdatedAt = time.Now()
 
 	if err := tx.Save(messageSession).Error; err != nil {
@@ -159,8 +402,8 @@ func (s *MessageService) markAsReadTx(ctx context.Context, tx *gorm.DB, sessionI
 	return nil
 }
 
-// GetMessageStatus retrieves the status of a message session
-func (s *MessageService) GetMessageStatus(ctx context.Context, sessionID string) (*database.MessageStatus, error) {
+// GetMessageStatus retrieves the status of a message session as seen by a reader
+func (s *MessageService) GetMessageStatus(ctx context.Context, reader database.Reader, sessionID string) (*database.MessageStatus, error) {
 	var totalMessages int64
 	if err := s.db.WithContext(ctx).
 		Model(&database.TerminalMessage{}).
@@ -183,20 +426,79 @@ func (s *MessageService) GetMessageStatus(ctx context.Context, sessionID string)
 	}
 
 	// Get unread count
-	messageSession, err := s.getOrCreateMessageSession(ctx, sessionID)
+	unreadMessages, err := s.CountUnread(ctx, reader, sessionID)
 	if err != nil {
 		return nil, err
 	}
 
+	// Count user messages still waiting for delivery
+	var queuedMessages int64
+	if err := s.db.WithContext(ctx).
+		Model(&database.TerminalMessage{}).
+		Where("session_id = ? AND delivery_status = ?", sessionID, database.DeliveryStatusQueued).
+		Count(&queuedMessages).Error; err != nil {
+		return nil, fmt.Errorf("failed to count queued messages: %w", err)
+	}
+
 	return &database.MessageStatus{
 		SessionID:         sessionID,
 		TotalMessages:     totalMessages,
-		UnreadMessages:    messageSession.UnreadCount,
+		UnreadMessages:    unreadMessages,
 		LastMessageTime:   lastMessageTime,
 		RequiresUserInput: requiresInput,
+		QueuedMessages:    queuedMessages,
 	}, nil
 }
 
+// UpdateDeliveryStatus records a delivery status change for a user message
+func (s *MessageService) UpdateDeliveryStatus(ctx context.Context, message *database.TerminalMessage, status database.DeliveryStatus) error {
+	updates := map[string]interface{}{
+		"delivery_status": status,
+	}
+	if status == database.DeliveryStatusSent {
+		now := time.Now()
+		updates["delivered_at"] = now
+		message.DeliveredAt = &now
+	}
+
+	if err := s.db.WithContext(ctx).
+		Model(&database.TerminalMessage{}).
+		Where("id = ?", message.ID).
+		Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to update delivery status: %w", err)
+	}
+
+	message.DeliveryStatus = status
+	return nil
+}
+
+// GetPendingDeliveries retrieves user messages that are queued or sent but not yet acknowledged
+func (s *MessageService) GetPendingDeliveries(ctx context.Context, sessionID string) ([]database.TerminalMessage, error) {
+	var messages []database.TerminalMessage
+	if err := s.db.WithContext(ctx).
+		Where("session_id = ? AND delivery_status IN ?", sessionID,
+			[]database.DeliveryStatus{database.DeliveryStatusQueued, database.DeliveryStatusSent}).
+		Order("created_at ASC").
+		Find(&messages).Error; err != nil {
+		return nil, fmt.Errorf("failed to get pending deliveries: %w", err)
+	}
+
+	return messages, nil
+}
+
+// GetUndeliveredMessages retrieves the user messages of every session that are queued or sent but not yet acknowledged
+func (s *MessageService) GetUndeliveredMessages(ctx context.Context) ([]database.TerminalMessage, error) {
+	var messages []database.TerminalMessage
+	if err := s.db.WithContext(ctx).
+		Where("delivery_status IN ?", []database.DeliveryStatus{database.DeliveryStatusQueued, database.DeliveryStatusSent}).
+		Order("created_at ASC, id ASC").
+		Find(&messages).Error; err != nil {
+		return nil, fmt.Errorf("failed to get undelivered messages: %w", err)
+	}
+
+	return messages, nil
+}
+
 // getOrCreateMessageSession gets or creates a message session
 func (s *MessageService) getOrCreateMessageSession(ctx context.Context, sessionID string) (*database.MessageSession, error) {
 	return s.getOrCreateMessageSessionTx(ctx, s.db.WithContext(ctx), sessionID)
@@ -223,23 +525,6 @@ func (s *MessageService) getOrCreateMessageSessionTx(ctx context.Context, tx *go
 	return &messageSession, nil
 }
 
-// incrementUnreadCount increments the unread count for a session
-func (s *MessageService) incrementUnreadCount(ctx context.Context, sessionID string) error {
-	messageSession, err := s.getOrCreateMessageSession(ctx, sessionID)
-	if err != nil {
-		return err
-	}
-
-	messageSession.UnreadCount++
-	messageSession.UpdatedAt = time.Now()
-
-	if err := s.db.WithContext(ctx).Save(messageSession).Error; err != nil {
-		return fmt.Errorf("failed to update unread count: %w", err)
-	}
-
-	return nil
-}
-
 // GetQueuedUserMessages retrieves queued user messages since last read
 func (s *MessageService) GetQueuedUserMessages(ctx context.Context, sessionID string) ([]database.TerminalMessage, error) {
 	messageSession, err := s.getOrCreateMessageSession(ctx, sessionID)
@@ -247,16 +532,19 @@ func (s *MessageService) GetQueuedUserMessages(ctx context.Context, sessionID st
 		return nil, err
 	}
 
+	return s.queuedUserMessagesTx(s.db.WithContext(ctx), messageSession)
+}
+
+// queuedUserMessagesTx retrieves the user messages after the last one the agent read
+func (s *MessageService) queuedUserMessagesTx(tx *gorm.DB, messageSession *database.MessageSession) ([]database.TerminalMessage, error) {
 	var messages []database.TerminalMessage
-	query := s.db.WithContext(ctx).
-		Where("session_id = ? AND sender_type = ?", sessionID, database.SenderTypeUser).
+	query := tx.Where("session_id = ? AND sender_type = ?", messageSession.SessionID, database.SenderTypeUser).
 		Order("created_at ASC")
 
 	// Get messages after last read
 	if messageSession.LastReadMessageID != nil {
 		var lastReadMessage database.TerminalMessage
-		if err := s.db.WithContext(ctx).
-			Where("id = ?", messageSession.LastReadMessageID).
+		if err := tx.Where("id = ?", messageSession.LastReadMessageID).
 			First(&lastReadMessage).Error; err == nil {
 			query = query.Where("created_at > ?", lastReadMessage.CreatedAt)
 		}
@@ -270,14 +558,7 @@ func (s *MessageService) GetQueuedUserMessages(ctx context.Context, sessionID st
 }
 
 // SendAgentMessageWithQueue sends an agent message and returns queued user messages
-func (s *MessageService) SendAgentMessageWithQueue(ctx context.Context, sessionID string, content string, requiresInput bool) (*database.TerminalMessage, []database.TerminalMessage, error) {
-	tx := s.db.WithContext(ctx).Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
-
+func (s *MessageService) SendAgentMessageWithQueue(ctx context.Context, sessionID string, content string, requiresInput bool, gitDiff string) (*database.TerminalMessage, []database.TerminalMessage, error) {
 	// Create agent message
 	message := &database.TerminalMessage{
 		ID:                uuid.New(),
@@ -287,7 +568,16 @@ func (s *MessageService) SendAgentMessageWithQueue(ctx context.Context, sessionI
 		RequiresUserInput: requiresInput,
 		CreatedAt:         time.Now(),
 		Metadata:          "", // Empty JSON string for SQLite
+		GitDiff:           gitDiff,
 	}
+	s.redact(ctx, message)
+
+	tx := s.db.WithContext(ctx).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
 
 	if err := tx.Create(message).Error; err != nil {
 		tx.Rollback()
@@ -301,26 +591,14 @@ func (s *MessageService) SendAgentMessageWithQueue(ctx context.Context, sessionI
 		return nil, nil, err
 	}
 
-	var queuedMessages []database.TerminalMessage
-	query := tx.Where("session_id = ? AND sender_type = ?", sessionID, database.SenderTypeUser).
-		Order("created_at ASC")
-
-	if messageSession.LastReadMessageID != nil {
-		var lastReadMessage database.TerminalMessage
-		if err := tx.Where("id = ?", messageSession.LastReadMessageID).
-			First(&lastReadMessage).Error; err == nil {
-			query = query.Where("created_at > ?", lastReadMessage.CreatedAt)
-		}
-	}
-
-	if err := query.Find(&queuedMessages).Error; err != nil {
+	queuedMessages, err := s.queuedUserMessagesTx(tx, messageSession)
+	if err != nil {
 		tx.Rollback()
-		return nil, nil, fmt.Errorf("failed to get queued messages: %w", err)
+		return nil, nil, err
 	}
 
 	// Mark this message as the last read
 	messageSession.LastReadMessageID = &message.ID
-	messageSession.UnreadCount = 0
 	messageSession.UpdatedAt = time.Now()
 	
 	if err := tx.Save(messageSession).Error; err != nil {
@@ -333,4 +611,77 @@ func (s *MessageService) SendAgentMessageWithQueue(ctx context.Context, sessionI
 	}
 
 	return message, queuedMessages, nil
-}
\ No newline at end of file
+}
+
+// TakeQueuedUserMessages returns the user messages queued for the agent and
+// marks them read. When lastReadMessageID is set and the agent's last read
+// message is another one, someone else took the messages first and
+// ErrStaleRead is returned.
+func (s *MessageService) TakeQueuedUserMessages(ctx context.Context, sessionID string, lastReadMessageID *uuid.UUID) ([]database.TerminalMessage, error) {
+	tx := s.db.WithContext(ctx).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	messageSession, err := s.getOrCreateMessageSessionTx(ctx, tx, sessionID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if lastReadMessageID != nil && (messageSession.LastReadMessageID == nil || *messageSession.LastReadMessageID != *lastReadMessageID) {
+		tx.Rollback()
+		return nil, ErrStaleRead
+	}
+
+	messages, err := s.queuedUserMessagesTx(tx, messageSession)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if len(messages) == 0 {
+		tx.Rollback()
+		return messages, nil
+	}
+
+	messageSession.LastReadMessageID = &messages[len(messages)-1].ID
+	messageSession.UpdatedAt = time.Now()
+	if err := tx.Save(messageSession).Error; err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to update message session: %w", err)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return messages, nil
+}
+
+// GetMessage retrieves a message by ID
+func (s *MessageService) GetMessage(ctx context.Context, messageID uuid.UUID) (*database.TerminalMessage, error) {
+	var message database.TerminalMessage
+	err := s.db.WithContext(ctx).Where("id = ?", messageID).First(&message).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrMessageNotFound, messageID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+
+	return &message, nil
+}
+
+// RequestUserInput marks a message as waiting for the user
+func (s *MessageService) RequestUserInput(ctx context.Context, message *database.TerminalMessage) error {
+	if err := s.db.WithContext(ctx).
+		Model(&database.TerminalMessage{}).
+		Where("id = ?", message.ID).
+		Update("requires_user_input", true).Error; err != nil {
+		return fmt.Errorf("failed to request user input: %w", err)
+	}
+
+	message.RequiresUserInput = true
+	return nil
+}
@@ -0,0 +1,841 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/majiayu000/anywhere-ai/core/database"
+	"github.com/majiayu000/anywhere-ai/core/git"
+	"github.com/majiayu000/anywhere-ai/core/terminal"
+	"github.com/majiayu000/anywhere-ai/core/tmux"
+	"gorm.io/gorm"
+)
+
+const (
+	migrationLease       = 2 * time.Minute  // How long the target holds a prepared session
+	migrationScrollback  = 10000            // Lines of scrollback carried over
+	migrationPeerTimeout = 60 * time.Second // Per request to the other host
+)
+
+var (
+	// ErrMigrationInProgress is returned while a session is being handed over
+	ErrMigrationInProgress = errors.New("session is being migrated")
+	// ErrUndeliveredInput is returned when queued input would be lost by a migration
+	ErrUndeliveredInput = errors.New("session has undelivered input")
+	// ErrMigrationNotFound is returned for an unknown migration
+	ErrMigrationNotFound = errors.New("migration not found")
+	// ErrMigrationCommitted is returned when aborting a migration the target has committed
+	ErrMigrationCommitted = errors.New("migration already committed")
+	// ErrInvalidLease is returned for a wrong or expired lease token
+	ErrInvalidLease = errors.New("invalid or expired lease")
+	// ErrInvalidMigration is returned when a checkpoint cannot be applied on this host
+	ErrInvalidMigration = errors.New("invalid migration")
+)
+
+// MigrationGitRef is the repository state a migrated session works on
+type MigrationGitRef struct {
+	RepoDir string `json:"repo_dir"`
+	Branch  string `json:"branch,omitempty"`
+	Head    string `json:"head,omitempty"`
+}
+
+// MigrationBundle is the checkpoint of a session sent to the target host. The
+// lease token authorizes the later commit or abort of the same migration.
+type MigrationBundle struct {
+	MigrationID      uuid.UUID                  `json:"migration_id"`
+	LeaseToken       string                     `json:"lease_token"`
+	LeaseExpiresAt   time.Time                  `json:"lease_expires_at"`
+	SourceDeviceID   string                     `json:"source_device_id"`
+	SourceDeviceName string                     `json:"source_device_name"`
+	CreatedAt        time.Time                  `json:"created_at"`
+	Session          *terminal.SessionState     `json:"session"`
+	Messages         []database.TerminalMessage `json:"messages"`
+	ReadCursors      []database.ReadCursor      `json:"read_cursors,omitempty"`
+	AgentLastReadID  *uuid.UUID                 `json:"agent_last_read_id,omitempty"`
+	Git              *MigrationGitRef           `json:"git,omitempty"`
+	ClaudeSessionID  string                     `json:"claude_session_id,omitempty"`
+	ClaudeTranscript []byte                     `json:"claude_transcript,omitempty"`
+}
+
+// PrepareMigrationResponse is the target's answer to a prepared migration
+type PrepareMigrationResponse struct {
+	MigrationID uuid.UUID `json:"migration_id"`
+	DeviceID    string    `json:"device_id"`
+	DeviceName  string    `json:"device_name"`
+}
+
+// CommitMigrationRequest completes a migration once the source has stopped the
+// session. It carries what the session produced since the checkpoint.
+type CommitMigrationRequest struct {
+	LeaseToken       string                     `json:"lease_token" binding:"required"`
+	Messages         []database.TerminalMessage `json:"messages,omitempty"`
+	Scrollback       []byte                     `json:"scrollback,omitempty"`
+	ClaudeTranscript []byte                     `json:"claude_transcript,omitempty"`
+}
+
+// incomingMigration is a session prepared on this host, with what preparing it
+// changed so an abort can undo it
+type incomingMigration struct {
+	record *database.SessionMigration
+	bundle *MigrationBundle
+
+	previous          *terminal.SessionState // Stored row replaced by the bundle, if any
+	insertedMessages  []uuid.UUID
+	insertedCursors   []uuid.UUID
+	hadMessageSession bool
+	previousLastRead  *uuid.UUID
+	transcriptPath    string
+	createdTranscript bool
+
+	timer      *time.Timer
+	committing bool
+	done       chan struct{} // Closed when a commit finishes
+	err        error         // Result of the commit
+}
+
+// MigrationService moves sessions between hosts. The source checkpoints the
+// session and prepares it on the target, which holds it under a lease; the
+// source then stops the session and commits, and the target resumes the tool.
+// A failure before the commit leaves the session running on the source, and a
+// failed commit is aborted on the target and resumed on the source.
+type MigrationService struct {
+	db           *gorm.DB
+	tmuxManager  *tmux.Manager
+	sessionStore *database.SessionRepository
+	launcher     *ToolLauncher
+	jsonlMonitor *JSONLMonitor
+	inputQueue   *InputQueue
+	gitTracker   *GitTracker
+	wsService    *TerminalWebSocketService
+	devices      *DeviceClients
+
+	deviceID   string
+	deviceName string
+
+	outgoing map[string]bool // Sessions this host is handing over
+	incoming map[uuid.UUID]*incomingMigration
+	mu       sync.Mutex
+}
+
+// NewMigrationService creates a new migration service
+func NewMigrationService(db *gorm.DB, tmuxManager *tmux.Manager, sessionStore *database.SessionRepository, launcher *ToolLauncher, jsonlMonitor *JSONLMonitor, inputQueue *InputQueue, gitTracker *GitTracker, wsService *TerminalWebSocketService, devices *DeviceClients) *MigrationService {
+	deviceID, deviceName := terminal.LocalDevice()
+	return &MigrationService{
+		db:           db,
+		tmuxManager:  tmuxManager,
+		sessionStore: sessionStore,
+		launcher:     launcher,
+		jsonlMonitor: jsonlMonitor,
+		inputQueue:   inputQueue,
+		gitTracker:   gitTracker,
+		wsService:    wsService,
+		devices:      devices,
+		deviceID:     deviceID,
+		deviceName:   deviceName,
+		outgoing:     make(map[string]bool),
+		incoming:     make(map[uuid.UUID]*incomingMigration),
+	}
+}
+
+// InProgress reports whether this host is handing a session over. Input is
+// refused meanwhile, since it would be lost.
+func (s *MigrationService) InProgress(sessionID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.outgoing[sessionID]
+}
+
+// ListMigrations returns the migrations recorded on this host, newest first
+func (s *MigrationService) ListMigrations(ctx context.Context, sessionID string) ([]database.SessionMigration, error) {
+	query := s.db.WithContext(ctx).Order("created_at DESC")
+	if sessionID != "" {
+		query = query.Where("session_id = ?", sessionID)
+	}
+
+	var migrations []database.SessionMigration
+	if err := query.Find(&migrations).Error; err != nil {
+		return nil, fmt.Errorf("failed to list migrations: %w", err)
+	}
+	return migrations, nil
+}
+
+// MigrateSession hands a session running on this host over to a paired device,
+// given by ID or URL. The returned record is set even when the migration fails.
+func (s *MigrationService) MigrateSession(ctx context.Context, sessionID string, target string) (*database.SessionMigration, error) {
+	if _, err := s.tmuxManager.GetSession(sessionID); err != nil {
+		return nil, fmt.Errorf("%w: %s", database.ErrSessionNotFound, sessionID)
+	}
+	device, err := s.devices.Resolve(target)
+	if err != nil {
+		return nil, err
+	}
+	peerURL := device.URL
+	client := s.devices.Client(device, migrationPeerTimeout)
+	if pending := s.inputQueue.Pending(sessionID); len(pending) > 0 {
+		return nil, fmt.Errorf("%w: %d queued messages", ErrUndeliveredInput, len(pending))
+	}
+	// Only the lease holder may hand the session over
+	if err := s.sessionStore.UpdateHeartbeat(sessionID, s.deviceID); err != nil && !errors.Is(err, database.ErrSessionNotFound) {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if s.outgoing[sessionID] {
+		s.mu.Unlock()
+		return nil, ErrMigrationInProgress
+	}
+	s.outgoing[sessionID] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.outgoing, sessionID)
+		s.mu.Unlock()
+	}()
+
+	bundle, err := s.checkpoint(ctx, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to checkpoint session: %w", err)
+	}
+
+	record := &database.SessionMigration{
+		ID:             bundle.MigrationID,
+		SessionID:      sessionID,
+		Direction:      database.MigrationOutgoing,
+		SourceDeviceID: s.deviceID,
+		TargetDeviceID: device.ID,
+		PeerURL:        peerURL,
+		LeaseTokenHash: hashLeaseToken(bundle.LeaseToken),
+		LeaseExpiresAt: bundle.LeaseExpiresAt,
+		Status:         database.MigrationStatusPreparing,
+	}
+	if err := s.db.WithContext(ctx).Create(record).Error; err != nil {
+		return nil, fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	// Until the target holds the checkpoint, the session keeps running here
+	var prepared PrepareMigrationResponse
+	if err := callPeer(ctx, client, peerURL, "/api/v1/migrations/incoming", bundle, &prepared); err != nil {
+		return s.finish(ctx, record, database.MigrationStatusFailed, fmt.Errorf("failed to prepare migration on %s: %w", peerURL, err))
+	}
+	s.finish(ctx, record, database.MigrationStatusPrepared, nil)
+	if err := s.sessionStore.UpdateStatus(sessionID, terminal.SessionStatusMigrating); err != nil {
+		log.Printf("Failed to mark session %s migrating: %v", sessionID, err)
+	}
+
+	// Stop the session, then collect what it produced since the checkpoint
+	commit := CommitMigrationRequest{LeaseToken: bundle.LeaseToken}
+	commit.Scrollback, _ = s.captureScrollback(ctx, sessionID)
+	if err := s.tmuxManager.KillSession(ctx, sessionID); err != nil {
+		s.abortPeer(ctx, client, record, bundle.LeaseToken)
+		s.sessionStore.UpdateStatus(sessionID, terminal.SessionStatusRunning)
+		return s.finish(ctx, record, database.MigrationStatusFailed, fmt.Errorf("failed to stop session: %w", err))
+	}
+	transcriptPath := s.jsonlMonitor.LogFile(sessionID)
+	s.launcher.Stop(sessionID)
+	commit.Messages, commit.ClaudeTranscript = s.delta(ctx, bundle, transcriptPath)
+
+	if err := callPeer(ctx, client, peerURL, "/api/v1/migrations/incoming/"+record.ID.String()+"/commit", commit, nil); err != nil {
+		// The commit may have succeeded with its answer lost; the target knows
+		if abortErr := s.abortPeer(ctx, client, record, bundle.LeaseToken); !errors.Is(abortErr, ErrMigrationCommitted) {
+			if resumeErr := s.resumeLocally(ctx, bundle, transcriptPath); resumeErr != nil {
+				return s.finish(ctx, record, database.MigrationStatusFailed, fmt.Errorf("failed to commit migration: %v; failed to resume session: %w", err, resumeErr))
+			}
+			return s.finish(ctx, record, database.MigrationStatusRolledBack, fmt.Errorf("failed to commit migration: %w", err))
+		}
+	}
+
+	if err := s.sessionStore.HandOver(sessionID, record.TargetDeviceID, terminal.SessionStatusMigrated); err != nil {
+		log.Printf("Failed to record handover of session %s: %v", sessionID, err)
+	}
+	s.inputQueue.Clear(sessionID)
+	s.finish(ctx, record, database.MigrationStatusCommitted, nil)
+	s.wsService.BroadcastMigration(sessionID, record)
+
+	log.Printf("Migrated session %s to %s (%s)", sessionID, record.TargetDeviceID, peerURL)
+	return record, nil
+}
+
+// checkpoint captures the state of a running session
+func (s *MigrationService) checkpoint(ctx context.Context, sessionID string) (*MigrationBundle, error) {
+	state, err := storedSession(s.sessionStore, s.tmuxManager, sessionID, s.deviceID, s.deviceName)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	token, err := newLeaseToken()
+	if err != nil {
+		return nil, err
+	}
+	bundle := &MigrationBundle{
+		MigrationID:      uuid.New(),
+		LeaseToken:       token,
+		LeaseExpiresAt:   now.Add(migrationLease),
+		SourceDeviceID:   s.deviceID,
+		SourceDeviceName: s.deviceName,
+		CreatedAt:        now,
+		Session:          state,
+	}
+
+	if workingDir, err := s.tmuxManager.GetWorkingDir(ctx, sessionID); err == nil {
+		state.WorkingDir = workingDir
+	}
+	if state.WorkingDir == "" {
+		return nil, fmt.Errorf("working directory of session %s is unknown", sessionID)
+	}
+	if scrollback, err := s.captureScrollback(ctx, sessionID); err == nil {
+		state.BufferContent = scrollback
+	}
+
+	if err := s.db.WithContext(ctx).Where("session_id = ?", sessionID).Order("created_at ASC").Find(&bundle.Messages).Error; err != nil {
+		return nil, fmt.Errorf("failed to load messages: %w", err)
+	}
+	if err := s.db.WithContext(ctx).Where("session_id = ?", sessionID).Find(&bundle.ReadCursors).Error; err != nil {
+		return nil, fmt.Errorf("failed to load read cursors: %w", err)
+	}
+	var messageSession database.MessageSession
+	if err := s.db.WithContext(ctx).Where("session_id = ?", sessionID).First(&messageSession).Error; err == nil {
+		bundle.AgentLastReadID = messageSession.LastReadMessageID
+	}
+
+	if repo, err := git.Open(ctx, state.WorkingDir); err == nil {
+		bundle.Git = &MigrationGitRef{RepoDir: repo.Dir}
+		bundle.Git.Branch, _ = repo.Branch(ctx)
+		bundle.Git.Head, _ = repo.Head(ctx)
+	}
+
+	if transcriptPath := s.jsonlMonitor.LogFile(sessionID); transcriptPath != "" {
+		transcript, err := os.ReadFile(transcriptPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Claude transcript: %w", err)
+		}
+		bundle.ClaudeSessionID = strings.TrimSuffix(filepath.Base(transcriptPath), ".jsonl")
+		bundle.ClaudeTranscript = transcript
+		if state.ToolState == nil {
+			state.ToolState = make(map[string]interface{})
+		}
+		state.ToolState["claude_session_id"] = bundle.ClaudeSessionID
+	}
+
+	return bundle, nil
+}
+
+// delta returns the messages created since the checkpoint and the final transcript
+func (s *MigrationService) delta(ctx context.Context, bundle *MigrationBundle, transcriptPath string) ([]database.TerminalMessage, []byte) {
+	known := make(map[uuid.UUID]bool, len(bundle.Messages))
+	for _, message := range bundle.Messages {
+		known[message.ID] = true
+	}
+
+	var messages []database.TerminalMessage
+	var all []database.TerminalMessage
+	if err := s.db.WithContext(ctx).Where("session_id = ?", bundle.Session.ID).Order("created_at ASC").Find(&all).Error; err != nil {
+		log.Printf("Failed to load messages of session %s: %v", bundle.Session.ID, err)
+	}
+	for _, message := range all {
+		if !known[message.ID] {
+			messages = append(messages, message)
+		}
+	}
+
+	var transcript []byte
+	if transcriptPath != "" {
+		transcript, _ = os.ReadFile(transcriptPath)
+	}
+	return messages, transcript
+}
+
+// resumeLocally restarts a session stopped for a migration that failed, unless
+// another device took its lease over meanwhile
+func (s *MigrationService) resumeLocally(ctx context.Context, bundle *MigrationBundle, transcriptPath string) error {
+	state := bundle.Session
+	if err := s.sessionStore.UpdateHeartbeat(state.ID, s.deviceID); err != nil {
+		return err
+	}
+	if _, err := s.tmuxManager.CreateSessionInDir(ctx, state.ToolName, state.ID, state.WorkingDir); err != nil {
+		return err
+	}
+	if err := s.launcher.Resume(ctx, state.ID, state.ToolName, bundle.ClaudeSessionID, transcriptPath, time.Now()); err != nil {
+		return err
+	}
+	return s.sessionStore.UpdateStatus(state.ID, terminal.SessionStatusRunning)
+}
+
+// abortPeer asks the target to discard a prepared migration
+func (s *MigrationService) abortPeer(ctx context.Context, client *http.Client, record *database.SessionMigration, token string) error {
+	err := callPeer(ctx, client, record.PeerURL, "/api/v1/migrations/incoming/"+record.ID.String()+"/abort", map[string]string{"lease_token": token}, nil)
+	var peerErr *peerError
+	if errors.As(err, &peerErr) && peerErr.StatusCode == http.StatusConflict {
+		return ErrMigrationCommitted
+	}
+	if err != nil {
+		log.Printf("Failed to abort migration %s on %s: %v", record.ID, record.PeerURL, err)
+	}
+	return err
+}
+
+// Prepare stores the checkpoint of a session migrating to this host from the
+// paired device sourceDeviceID and holds it until the source commits or
+// aborts, or the lease expires
+func (s *MigrationService) Prepare(ctx context.Context, sourceDeviceID string, bundle *MigrationBundle) (*database.SessionMigration, error) {
+	if bundle.SourceDeviceID != sourceDeviceID {
+		return nil, fmt.Errorf("%w: checkpoint from %s sent by %s", ErrWrongDevice, bundle.SourceDeviceID, sourceDeviceID)
+	}
+	if err := s.validate(ctx, bundle); err != nil {
+		return nil, err
+	}
+	state := bundle.Session
+
+	in := &incomingMigration{
+		bundle: bundle,
+		record: &database.SessionMigration{
+			ID:             bundle.MigrationID,
+			SessionID:      state.ID,
+			Direction:      database.MigrationIncoming,
+			SourceDeviceID: bundle.SourceDeviceID,
+			TargetDeviceID: s.deviceID,
+			LeaseTokenHash: hashLeaseToken(bundle.LeaseToken),
+			LeaseExpiresAt: bundle.LeaseExpiresAt,
+			Status:         database.MigrationStatusPreparing,
+		},
+		done: make(chan struct{}),
+	}
+
+	s.mu.Lock()
+	for _, other := range s.incoming {
+		if other.record.SessionID == state.ID {
+			s.mu.Unlock()
+			return nil, fmt.Errorf("%w: session %s", ErrMigrationInProgress, state.ID)
+		}
+	}
+	s.incoming[in.record.ID] = in
+	s.mu.Unlock()
+
+	if err := s.db.WithContext(ctx).Create(in.record).Error; err != nil {
+		s.mu.Lock()
+		delete(s.incoming, in.record.ID)
+		s.mu.Unlock()
+		return nil, fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	if err := s.apply(ctx, in); err != nil {
+		s.mu.Lock()
+		delete(s.incoming, in.record.ID)
+		s.mu.Unlock()
+		s.undo(ctx, in)
+		_, err = s.finish(ctx, in.record, database.MigrationStatusAborted, err)
+		return nil, err
+	}
+
+	s.mu.Lock()
+	in.timer = time.AfterFunc(time.Until(bundle.LeaseExpiresAt), func() {
+		s.expire(in.record.ID)
+	})
+	s.mu.Unlock()
+
+	return s.finish(ctx, in.record, database.MigrationStatusPrepared, nil)
+}
+
+// validate checks that a checkpoint can be resumed on this host
+func (s *MigrationService) validate(ctx context.Context, bundle *MigrationBundle) error {
+	if bundle.Session == nil || bundle.Session.ID == "" || bundle.MigrationID == uuid.Nil || bundle.LeaseToken == "" {
+		return fmt.Errorf("%w: incomplete checkpoint", ErrInvalidMigration)
+	}
+	if !time.Now().Before(bundle.LeaseExpiresAt) {
+		return ErrInvalidLease
+	}
+	state := bundle.Session
+
+	if previous, err := s.sessionStore.LoadSession(state.ID); err == nil &&
+		previous.CurrentDeviceID == s.deviceID && previous.Status == terminal.SessionStatusRunning &&
+		s.tmuxManager.HasSession(ctx, state.ID) {
+		return fmt.Errorf("%w: session %s already runs on this device", ErrInvalidMigration, state.ID)
+	}
+
+	if info, err := os.Stat(state.WorkingDir); err != nil || !info.IsDir() {
+		return fmt.Errorf("%w: working directory %s does not exist on this device", ErrInvalidMigration, state.WorkingDir)
+	}
+
+	if bundle.Git != nil && bundle.Git.Head != "" {
+		repo, err := git.Open(ctx, state.WorkingDir)
+		if err != nil {
+			return fmt.Errorf("%w: %s is not a git repository on this device", ErrInvalidMigration, state.WorkingDir)
+		}
+		if !repo.HasCommit(ctx, bundle.Git.Head) {
+			return fmt.Errorf("%w: commit %s is missing from %s, fetch it first", ErrInvalidMigration, bundle.Git.Head, repo.Dir)
+		}
+		if branch, _ := repo.Branch(ctx); branch != bundle.Git.Branch {
+			log.Printf("Session %s was on branch %q, %s is on %q", state.ID, bundle.Git.Branch, repo.Dir, branch)
+		}
+	}
+
+	if bundle.ClaudeSessionID != "" {
+		// The ID names the transcript file, so it must not be a path
+		if _, err := uuid.Parse(bundle.ClaudeSessionID); err != nil {
+			return fmt.Errorf("%w: malformed Claude session ID", ErrInvalidMigration)
+		}
+	}
+	return nil
+}
+
+// apply stores a checkpoint, recording what it changed
+func (s *MigrationService) apply(ctx context.Context, in *incomingMigration) error {
+	bundle := in.bundle
+	state := bundle.Session
+
+	if previous, err := s.sessionStore.LoadSession(state.ID); err == nil {
+		in.previous = previous
+	}
+	state.Status = terminal.SessionStatusMigrating
+	state.CurrentDeviceID = bundle.SourceDeviceID
+	if err := s.sessionStore.SaveSession(state); err != nil {
+		return err
+	}
+
+	if err := s.importMessages(ctx, in, bundle.Messages); err != nil {
+		return err
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, cursor := range bundle.ReadCursors {
+			var count int64
+			if err := tx.Model(&database.ReadCursor{}).
+				Where("session_id = ? AND user_id = ? AND device_id = ?", state.ID, cursor.UserID, cursor.DeviceID).
+				Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				continue
+			}
+			cursor.ID = uuid.Nil
+			if err := tx.Create(&cursor).Error; err != nil {
+				return err
+			}
+			in.insertedCursors = append(in.insertedCursors, cursor.ID)
+		}
+
+		var messageSession database.MessageSession
+		err := tx.Where("session_id = ?", state.ID).First(&messageSession).Error
+		switch {
+		case err == nil:
+			in.hadMessageSession = true
+			in.previousLastRead = messageSession.LastReadMessageID
+			return tx.Model(&messageSession).Updates(map[string]interface{}{
+				"last_read_message_id": bundle.AgentLastReadID,
+				"updated_at":           time.Now(),
+			}).Error
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			return tx.Create(&database.MessageSession{SessionID: state.ID, LastReadMessageID: bundle.AgentLastReadID}).Error
+		default:
+			return err
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to import read state: %w", err)
+	}
+
+	if bundle.ClaudeSessionID != "" {
+		projectDir, err := claudeProjectDir(state.WorkingDir)
+		if err != nil {
+			return err
+		}
+		in.transcriptPath = filepath.Join(projectDir, bundle.ClaudeSessionID+".jsonl")
+		if _, err := os.Stat(in.transcriptPath); os.IsNotExist(err) {
+			if err := os.MkdirAll(projectDir, 0700); err != nil {
+				return fmt.Errorf("failed to create Claude project directory: %w", err)
+			}
+			if err := os.WriteFile(in.transcriptPath, bundle.ClaudeTranscript, 0600); err != nil {
+				return fmt.Errorf("failed to write Claude transcript: %w", err)
+			}
+			in.createdTranscript = true
+		}
+	}
+
+	return nil
+}
+
+// importMessages inserts the messages this host does not have yet
+func (s *MigrationService) importMessages(ctx context.Context, in *incomingMigration, messages []database.TerminalMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(messages))
+	for _, message := range messages {
+		ids = append(ids, message.ID)
+	}
+	var existing []uuid.UUID
+	if err := s.db.WithContext(ctx).Model(&database.TerminalMessage{}).Where("id IN ?", ids).Pluck("id", &existing).Error; err != nil {
+		return fmt.Errorf("failed to import messages: %w", err)
+	}
+	skip := make(map[uuid.UUID]bool, len(existing))
+	for _, id := range existing {
+		skip[id] = true
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for i := range messages {
+			message := messages[i]
+			if message.ID == uuid.Nil || skip[message.ID] || message.SessionID != in.bundle.Session.ID {
+				continue
+			}
+			message.Session = nil
+			if err := tx.Create(&message).Error; err != nil {
+				return fmt.Errorf("failed to import messages: %w", err)
+			}
+			in.insertedMessages = append(in.insertedMessages, message.ID)
+		}
+		return nil
+	})
+}
+
+// Commit starts a prepared session on this host, at the request of its source device
+func (s *MigrationService) Commit(ctx context.Context, sourceDeviceID string, migrationID uuid.UUID, req *CommitMigrationRequest) (*database.SessionMigration, error) {
+	s.mu.Lock()
+	in, exists := s.incoming[migrationID]
+	if !exists || in.timer == nil {
+		s.mu.Unlock()
+		return nil, ErrMigrationNotFound
+	}
+	if in.record.SourceDeviceID != sourceDeviceID {
+		s.mu.Unlock()
+		return nil, ErrWrongDevice
+	}
+	if !in.holds(req.LeaseToken) || in.committing || !in.timer.Stop() {
+		s.mu.Unlock()
+		return nil, ErrInvalidLease
+	}
+	in.committing = true
+	s.mu.Unlock()
+
+	in.err = s.start(ctx, in, req)
+
+	s.mu.Lock()
+	delete(s.incoming, migrationID)
+	s.mu.Unlock()
+	defer close(in.done)
+
+	if in.err != nil {
+		s.undo(ctx, in)
+		return s.finish(ctx, in.record, database.MigrationStatusAborted, in.err)
+	}
+
+	s.finish(ctx, in.record, database.MigrationStatusCommitted, nil)
+	s.wsService.BroadcastMigration(in.record.SessionID, in.record)
+	log.Printf("Resumed session %s migrated from %s", in.record.SessionID, in.record.SourceDeviceID)
+	return in.record, nil
+}
+
+// start recreates a prepared session and resumes its tool
+func (s *MigrationService) start(ctx context.Context, in *incomingMigration, req *CommitMigrationRequest) error {
+	state := in.bundle.Session
+
+	if err := s.importMessages(ctx, in, req.Messages); err != nil {
+		return err
+	}
+	if in.createdTranscript && len(req.ClaudeTranscript) > 0 {
+		if err := os.WriteFile(in.transcriptPath, req.ClaudeTranscript, 0600); err != nil {
+			return fmt.Errorf("failed to write Claude transcript: %w", err)
+		}
+	}
+	if len(req.Scrollback) > 0 {
+		state.BufferContent = req.Scrollback
+	}
+
+	if s.tmuxManager.HasSession(ctx, state.ID) {
+		return fmt.Errorf("tmux session %s already exists on this device", state.ID)
+	}
+	// The source stopped the session, so the lease moves here before it restarts
+	if err := s.sessionStore.HandOver(state.ID, s.deviceID, terminal.SessionStatusMigrating); err != nil {
+		return err
+	}
+	if _, err := s.tmuxManager.CreateSessionInDir(ctx, state.ToolName, state.ID, state.WorkingDir); err != nil {
+		return err
+	}
+	if err := s.launcher.Resume(ctx, state.ID, state.ToolName, in.bundle.ClaudeSessionID, in.transcriptPath, time.Now()); err != nil {
+		s.launcher.Stop(state.ID)
+		s.tmuxManager.KillSession(ctx, state.ID)
+		return err
+	}
+
+	if err := s.gitTracker.StartSession(ctx, state.ID); err != nil {
+		log.Printf("Failed to start git tracking for session %s: %v", state.ID, err)
+	}
+
+	state.CurrentDeviceID = s.deviceID
+	state.Status = terminal.SessionStatusRunning
+	state.LastHeartbeat = time.Now()
+	if err := s.sessionStore.SaveSession(state); err != nil {
+		s.launcher.Stop(state.ID)
+		s.tmuxManager.KillSession(ctx, state.ID)
+		return err
+	}
+	return nil
+}
+
+// Abort discards a prepared migration. Aborting a migration that is being
+// committed waits for the commit, and fails with ErrMigrationCommitted if it
+// went through.
+func (s *MigrationService) Abort(ctx context.Context, sourceDeviceID string, migrationID uuid.UUID, token string) (*database.SessionMigration, error) {
+	s.mu.Lock()
+	in, exists := s.incoming[migrationID]
+	if !exists || in.timer == nil {
+		// Still being prepared, or no longer held
+		s.mu.Unlock()
+		return s.ended(ctx, sourceDeviceID, migrationID, token)
+	}
+	if in.record.SourceDeviceID != sourceDeviceID {
+		s.mu.Unlock()
+		return nil, ErrWrongDevice
+	}
+	if !in.holds(token) {
+		s.mu.Unlock()
+		return nil, ErrInvalidLease
+	}
+	if in.committing {
+		s.mu.Unlock()
+		<-in.done
+		return s.ended(ctx, sourceDeviceID, migrationID, token)
+	}
+	in.timer.Stop()
+	delete(s.incoming, migrationID)
+	s.mu.Unlock()
+
+	s.undo(ctx, in)
+	return s.finish(ctx, in.record, database.MigrationStatusAborted, nil)
+}
+
+// ended answers an abort of a migration no longer held on this host
+func (s *MigrationService) ended(ctx context.Context, sourceDeviceID string, migrationID uuid.UUID, token string) (*database.SessionMigration, error) {
+	var record database.SessionMigration
+	if err := s.db.WithContext(ctx).First(&record, "id = ? AND direction = ?", migrationID, database.MigrationIncoming).Error; err != nil {
+		return nil, ErrMigrationNotFound
+	}
+	if record.SourceDeviceID != sourceDeviceID {
+		return nil, ErrWrongDevice
+	}
+	if subtle.ConstantTimeCompare([]byte(hashLeaseToken(token)), []byte(record.LeaseTokenHash)) != 1 {
+		return nil, ErrInvalidLease
+	}
+	if record.Status == database.MigrationStatusCommitted {
+		return &record, ErrMigrationCommitted
+	}
+	return &record, nil
+}
+
+// expire aborts a prepared migration whose lease ran out
+func (s *MigrationService) expire(migrationID uuid.UUID) {
+	s.mu.Lock()
+	in, exists := s.incoming[migrationID]
+	if !exists || in.committing {
+		s.mu.Unlock()
+		return
+	}
+	delete(s.incoming, migrationID)
+	s.mu.Unlock()
+
+	ctx := context.Background()
+	s.undo(ctx, in)
+	s.finish(ctx, in.record, database.MigrationStatusAborted, ErrInvalidLease)
+	log.Printf("Lease of migration %s expired, discarded session %s", migrationID, in.record.SessionID)
+}
+
+// undo reverts what preparing a migration changed on this host
+func (s *MigrationService) undo(ctx context.Context, in *incomingMigration) {
+	sessionID := in.bundle.Session.ID
+	db := s.db.WithContext(ctx)
+
+	if len(in.insertedMessages) > 0 {
+		if err := db.Where("id IN ?", in.insertedMessages).Delete(&database.TerminalMessage{}).Error; err != nil {
+			log.Printf("Failed to remove messages of migration %s: %v", in.record.ID, err)
+		}
+	}
+	if len(in.insertedCursors) > 0 {
+		if err := db.Where("id IN ?", in.insertedCursors).Delete(&database.ReadCursor{}).Error; err != nil {
+			log.Printf("Failed to remove read cursors of migration %s: %v", in.record.ID, err)
+		}
+	}
+
+	var err error
+	if in.hadMessageSession {
+		err = db.Model(&database.MessageSession{}).Where("session_id = ?", sessionID).
+			Update("last_read_message_id", in.previousLastRead).Error
+	} else {
+		err = db.Where("session_id = ?", sessionID).Delete(&database.MessageSession{}).Error
+	}
+	if err != nil {
+		log.Printf("Failed to restore read state of session %s: %v", sessionID, err)
+	}
+
+	if in.previous != nil {
+		err = s.sessionStore.SaveSession(in.previous)
+		if releaseErr := s.sessionStore.ReleaseLease(sessionID, s.deviceID); releaseErr != nil {
+			log.Printf("Failed to release lease of session %s: %v", sessionID, releaseErr)
+		}
+	} else {
+		err = s.sessionStore.DeleteSession(sessionID)
+	}
+	if err != nil {
+		log.Printf("Failed to restore session %s: %v", sessionID, err)
+	}
+
+	if in.createdTranscript {
+		if err := os.Remove(in.transcriptPath); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove Claude transcript %s: %v", in.transcriptPath, err)
+		}
+	}
+}
+
+// finish saves the status of a migration and passes err through
+func (s *MigrationService) finish(ctx context.Context, record *database.SessionMigration, status database.MigrationStatus, err error) (*database.SessionMigration, error) {
+	record.Status = status
+	if err != nil {
+		record.Error = err.Error()
+	}
+	if saveErr := s.db.WithContext(ctx).Save(record).Error; saveErr != nil {
+		log.Printf("Failed to save migration %s: %v", record.ID, saveErr)
+	}
+	return record, err
+}
+
+// captureScrollback captures the scrollback of a session
+func (s *MigrationService) captureScrollback(ctx context.Context, sessionID string) ([]byte, error) {
+	output, err := s.tmuxManager.CaptureScrollback(ctx, sessionID, migrationScrollback)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(output), nil
+}
+
+// holds reports whether token is the lease token of the migration
+func (in *incomingMigration) holds(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(hashLeaseToken(token)), []byte(in.record.LeaseTokenHash)) == 1
+}
+
+// newLeaseToken returns a random lease token
+func newLeaseToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate lease token: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// hashLeaseToken returns the stored form of a lease token
+func hashLeaseToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
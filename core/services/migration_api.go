@@ -0,0 +1,206 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/majiayu000/anywhere-ai/core/database"
+	"github.com/majiayu000/anywhere-ai/core/terminal"
+)
+
+// MigrationAPIService exposes session migration: starting a handover from this
+// host, and the endpoints the source host calls on the target
+type MigrationAPIService struct {
+	migrations *MigrationService
+	access     *SessionAccessService
+}
+
+// NewMigrationAPIService creates a new migration API service
+func NewMigrationAPIService(migrations *MigrationService) *MigrationAPIService {
+	return &MigrationAPIService{migrations: migrations}
+}
+
+// SetSessionAccess sets the service that decides who may migrate sessions
+func (s *MigrationAPIService) SetSessionAccess(access *SessionAccessService) {
+	s.access = access
+}
+
+// role returns the caller's role in a session, or "" when they may not see it
+func (s *MigrationAPIService) role(c *gin.Context, sessionID string) string {
+	if !sessionVisible(c, sessionID) {
+		return ""
+	}
+	if s.access == nil {
+		return database.SessionRoleOwner
+	}
+	return s.access.RequestRole(c, sessionID)
+}
+
+// MigrateSession hands a session over to another host; only its owner may
+func (s *MigrationAPIService) MigrateSession(c *gin.Context) {
+	var req struct {
+		SessionID      string `json:"session_id" binding:"required"`
+		TargetDeviceID string `json:"target_device_id"`
+		TargetURL      string `json:"target_url"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	target := req.TargetDeviceID
+	if target == "" {
+		target = req.TargetURL
+	}
+	if target == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "target_device_id or target_url is required"})
+		return
+	}
+	if err := checkRole(s.role(c, req.SessionID), database.SessionRoleOwner); err != nil {
+		c.JSON(accessErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	migration, err := s.migrations.MigrateSession(c.Request.Context(), req.SessionID, target)
+	if err != nil {
+		c.JSON(migrationErrorStatus(err), gin.H{"error": err.Error(), "migration": migration})
+		return
+	}
+
+	c.JSON(http.StatusOK, migration)
+}
+
+// ListMigrations lists migrations recorded on this host of the sessions the
+// caller has a role in, optionally for session_id
+func (s *MigrationAPIService) ListMigrations(c *gin.Context) {
+	migrations, err := s.migrations.ListMigrations(c.Request.Context(), c.Query("session_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	visible := make([]database.SessionMigration, 0, len(migrations))
+	roles := make(map[string]string)
+	for _, migration := range migrations {
+		role, known := roles[migration.SessionID]
+		if !known {
+			role = s.role(c, migration.SessionID)
+			roles[migration.SessionID] = role
+		}
+		if role != "" {
+			visible = append(visible, migration)
+		}
+	}
+
+	c.JSON(http.StatusOK, visible)
+}
+
+// PrepareIncoming receives the checkpoint of a session migrating to this host
+func (s *MigrationAPIService) PrepareIncoming(c *gin.Context) {
+	var bundle MigrationBundle
+	if err := c.ShouldBindJSON(&bundle); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	migration, err := s.migrations.Prepare(c.Request.Context(), pairedDevice(c).ID, &bundle)
+	if err != nil {
+		c.JSON(migrationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, PrepareMigrationResponse{
+		MigrationID: migration.ID,
+		DeviceID:    s.migrations.deviceID,
+		DeviceName:  s.migrations.deviceName,
+	})
+}
+
+// CommitIncoming starts a prepared session on this host
+func (s *MigrationAPIService) CommitIncoming(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid migration ID"})
+		return
+	}
+
+	var req CommitMigrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	migration, err := s.migrations.Commit(c.Request.Context(), pairedDevice(c).ID, id, &req)
+	if err != nil {
+		c.JSON(migrationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, migration)
+}
+
+// AbortIncoming discards a prepared session
+func (s *MigrationAPIService) AbortIncoming(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid migration ID"})
+		return
+	}
+
+	var req struct {
+		LeaseToken string `json:"lease_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	migration, err := s.migrations.Abort(c.Request.Context(), pairedDevice(c).ID, id, req.LeaseToken)
+	if err != nil {
+		c.JSON(migrationErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, migration)
+}
+
+// migrationErrorStatus maps migration errors to HTTP status codes. A conflict on
+// abort tells the source that the target has committed.
+func migrationErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, database.ErrSessionNotFound), errors.Is(err, ErrMigrationNotFound), errors.Is(err, database.ErrDeviceNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrMigrationCommitted), errors.Is(err, ErrMigrationInProgress), errors.Is(err, ErrUndeliveredInput), errors.Is(err, terminal.ErrLeaseHeld):
+		return http.StatusConflict
+	case errors.Is(err, ErrInvalidLease), errors.Is(err, ErrWrongDevice), errors.Is(err, database.ErrDeviceRevoked):
+		return http.StatusForbidden
+	case errors.Is(err, ErrInvalidMigration):
+		return http.StatusUnprocessableEntity
+	}
+	var peerErr *peerError
+	if errors.As(err, &peerErr) {
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
+
+// RegisterRoutes registers migration API routes
+func (s *MigrationAPIService) RegisterRoutes(router *gin.Engine) {
+	api := router.Group("/api/v1/migrations")
+	{
+		api.POST("", s.MigrateSession)
+		api.GET("", s.ListMigrations)
+	}
+}
+
+// RegisterPeerRoutes registers the routes a source device calls on the mutual
+// TLS listener. router must authenticate callers with RequirePairedDevice.
+func (s *MigrationAPIService) RegisterPeerRoutes(router gin.IRouter) {
+	api := router.Group("/api/v1/migrations")
+	{
+		api.POST("/incoming", s.PrepareIncoming)
+		api.POST("/incoming/:id/commit", s.CommitIncoming)
+		api.POST("/incoming/:id/abort", s.AbortIncoming)
+	}
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/majiayu000/anywhere-ai/core/database"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidPushToken is returned when registering a push token without a token or platform
+var ErrInvalidPushToken = errors.New("invalid push token")
+
+// Notification is an alert about a session for its user's devices
+type Notification struct {
+	SessionID string `json:"session_id"`
+	Title     string `json:"title"`
+	Body      string `json:"body"`
+}
+
+// PushSender delivers a notification to the app behind one push token
+type PushSender interface {
+	Send(ctx context.Context, token database.PushToken, notification Notification) error
+}
+
+// WebhookPushSender hands notifications to a push gateway, which talks to
+// APNs or FCM, by posting them as JSON to its URL
+type WebhookPushSender struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookPushSender creates a sender posting to a push gateway
+func NewWebhookPushSender(url string) *WebhookPushSender {
+	return &WebhookPushSender{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Send posts a notification for one push token to the gateway
+func (s *WebhookPushSender) Send(ctx context.Context, token database.PushToken, notification Notification) error {
+	data, err := json.Marshal(map[string]interface{}{
+		"token":        token.Token,
+		"platform":     token.Platform,
+		"notification": notification,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach push gateway: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("push gateway returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Notifier pushes notifications about sessions to their users' devices,
+// skipping devices that already have the session in the foreground
+type Notifier struct {
+	db        *gorm.DB
+	sender    PushSender
+	wsService *TerminalWebSocketService
+}
+
+// NewNotifier creates a notifier delivering through sender
+func NewNotifier(db *gorm.DB, sender PushSender, wsService *TerminalWebSocketService) *Notifier {
+	return &Notifier{db: db, sender: sender, wsService: wsService}
+}
+
+// Notify pushes a notification to every active push token of a user, unless
+// the user turned push notifications off. It returns how many were sent.
+func (n *Notifier) Notify(ctx context.Context, userID uuid.UUID, notification Notification) (int, error) {
+	var user database.User
+	if err := n.db.WithContext(ctx).First(&user, "id = ?", userID).Error; err != nil {
+		return 0, fmt.Errorf("failed to get user: %w", err)
+	}
+	if !user.PushNotificationsEnabled {
+		return 0, nil
+	}
+
+	var tokens []database.PushToken
+	if err := n.db.WithContext(ctx).Where("user_id = ? AND is_active = ?", userID, true).Find(&tokens).Error; err != nil {
+		return 0, fmt.Errorf("failed to get push tokens: %w", err)
+	}
+
+	sent := 0
+	for _, token := range tokens {
+		if token.DeviceID != "" && n.wsService != nil && n.wsService.Viewing(notification.SessionID, token.DeviceID) {
+			// The session is already on screen there
+			continue
+		}
+		if err := n.sender.Send(ctx, token, notification); err != nil {
+			log.Printf("Failed to push notification to %s token %s: %v", token.Platform, token.ID, err)
+			continue
+		}
+		sent++
+
+		now := time.Now()
+		n.db.WithContext(ctx).Model(&token).Update("last_used_at", &now)
+	}
+	return sent, nil
+}
+
+// NotifyAsync pushes a notification in the background, logging failures
+func (n *Notifier) NotifyAsync(userID uuid.UUID, notification Notification) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if _, err := n.Notify(ctx, userID, notification); err != nil {
+			log.Printf("Failed to notify user %s about session %s: %v", userID, notification.SessionID, err)
+		}
+	}()
+}
+
+// RegisterToken records the push token of a user's app, moving it to the user
+// and device that register it if it was known before
+func (n *Notifier) RegisterToken(userID uuid.UUID, token string, platform string, deviceID string) (*database.PushToken, error) {
+	token = strings.TrimSpace(token)
+	if token == "" || (platform != "ios" && platform != "android") {
+		return nil, fmt.Errorf("%w: a token and a platform of ios or android are required", ErrInvalidPushToken)
+	}
+
+	var pushToken database.PushToken
+	err := n.db.Where("token = ?", token).First(&pushToken).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to get push token: %w", err)
+	}
+	pushToken.UserID = userID
+	pushToken.Token = token
+	pushToken.Platform = platform
+	pushToken.DeviceID = deviceID
+	pushToken.IsActive = true
+	if err := n.db.Save(&pushToken).Error; err != nil {
+		return nil, fmt.Errorf("failed to save push token: %w", err)
+	}
+	return &pushToken, nil
+}
+
+// UnregisterToken stops pushing to one of a user's tokens
+func (n *Notifier) UnregisterToken(userID uuid.UUID, token string) error {
+	if err := n.db.Model(&database.PushToken{}).
+		Where("user_id = ? AND token = ?", userID, token).
+		Update("is_active", false).Error; err != nil {
+		return fmt.Errorf("failed to unregister push token: %w", err)
+	}
+	return nil
+}
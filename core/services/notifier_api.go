@@ -0,0 +1,85 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// NotifierAPIService provides REST API for apps to register for push notifications
+type NotifierAPIService struct {
+	notifier *Notifier
+}
+
+// NewNotifierAPIService creates a new notifier API service
+func NewNotifierAPIService(notifier *Notifier) *NotifierAPIService {
+	return &NotifierAPIService{notifier: notifier}
+}
+
+// RegisterPushToken registers the push token of the signed in user's app. The
+// device ID defaults to the X-Device-ID of the request, the one the app shows
+// as its presence, so it is not notified about sessions it has on screen.
+func (s *NotifierAPIService) RegisterPushToken(c *gin.Context) {
+	userID, err := uuid.Parse(requestUserID(c))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	var req struct {
+		Token    string `json:"token" binding:"required"`
+		Platform string `json:"platform" binding:"required"`
+		DeviceID string `json:"device_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.DeviceID == "" {
+		req.DeviceID = readerFromRequest(c).DeviceID
+	}
+
+	token, err := s.notifier.RegisterToken(userID, req.Token, req.Platform, req.DeviceID)
+	if errors.Is(err, ErrInvalidPushToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, token)
+}
+
+// UnregisterPushToken stops push notifications to a token of the signed in user
+func (s *NotifierAPIService) UnregisterPushToken(c *gin.Context) {
+	userID, err := uuid.Parse(requestUserID(c))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	var req struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := s.notifier.UnregisterToken(userID, req.Token); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// RegisterRoutes registers notifier API routes. Tokens travel in the body so
+// they stay out of request logs.
+func (s *NotifierAPIService) RegisterRoutes(router *gin.Engine) {
+	api := router.Group("/api/v1/push-tokens")
+	{
+		api.POST("", s.RegisterPushToken)
+		api.DELETE("", s.UnregisterPushToken)
+	}
+}
@@ -0,0 +1,339 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/majiayu000/anywhere-ai/core/database"
+	"github.com/majiayu000/anywhere-ai/core/deviceauth"
+	"github.com/majiayu000/anywhere-ai/core/terminal"
+	"gorm.io/gorm"
+)
+
+const (
+	// inviteCodePrefix marks an invite code, as typed or scanned from a QR code
+	inviteCodePrefix = "anywhere-invite:"
+	// DefaultInviteTTL is how long an invite can be redeemed
+	DefaultInviteTTL = 15 * time.Minute
+	// MaxInviteTTL caps the lifetime of an invite
+	MaxInviteTTL = 24 * time.Hour
+)
+
+var (
+	// ErrInvalidInvite is returned for an unknown, expired or used invite
+	ErrInvalidInvite = errors.New("invite is invalid, expired or already used")
+	// ErrInvalidInviteCode is returned for a code that cannot be decoded
+	ErrInvalidInviteCode = errors.New("invalid invite code")
+	// ErrClientCertificateRequired is returned when pairing without a client certificate
+	ErrClientCertificateRequired = errors.New("client certificate required")
+	// ErrDeviceAlreadyPaired is returned when an invite is redeemed under the ID of a paired device
+	ErrDeviceAlreadyPaired = errors.New("device is already paired")
+)
+
+// InvitePayload is what an invite code carries: how to reach the inviting
+// device, the certificate it will present and the one-time token it accepts
+type InvitePayload struct {
+	DeviceID    string `json:"device_id"`
+	DeviceName  string `json:"device_name"`
+	URL         string `json:"url"`
+	Fingerprint string `json:"fingerprint"`
+	Token       string `json:"token"`
+}
+
+// Invite is a pairing invite to show as a code or QR payload
+type Invite struct {
+	*database.DeviceInvite
+	Code string `json:"code"`
+}
+
+// PairRequest is sent by the device redeeming an invite to the inviting device
+type PairRequest struct {
+	Token      string `json:"token" binding:"required"`
+	DeviceID   string `json:"device_id" binding:"required"`
+	DeviceName string `json:"device_name"`
+	DeviceType string `json:"device_type"`
+	URL        string `json:"url" binding:"required"`
+}
+
+// PairResponse is the inviting device's identity and the secret both devices now share
+type PairResponse struct {
+	DeviceID   string `json:"device_id"`
+	DeviceName string `json:"device_name"`
+	DeviceType string `json:"device_type"`
+	Secret     string `json:"secret"`
+}
+
+// PairingService pairs this device with others through one-time invites. The
+// inviting device issues a code carrying its certificate fingerprint; the other
+// device redeems it over mutual TLS, and both pin each other's certificate and
+// store a fresh shared secret.
+type PairingService struct {
+	db       *gorm.DB
+	devices  *database.DeviceRepository
+	identity *deviceauth.Identity
+
+	// This device, and the URL peers reach it at
+	deviceID   string
+	deviceName string
+	deviceType string
+	publicURL  string
+}
+
+// NewPairingService creates a new pairing service. publicURL is the mutual
+// TLS listener peers reach this device at.
+func NewPairingService(db *gorm.DB, devices *database.DeviceRepository, identity *deviceauth.Identity, publicURL string) *PairingService {
+	deviceID, deviceName := terminal.LocalDevice()
+	return &PairingService{
+		db:         db,
+		devices:    devices,
+		identity:   identity,
+		deviceID:   deviceID,
+		deviceName: deviceName,
+		deviceType: runtime.GOOS,
+		publicURL:  strings.TrimRight(publicURL, "/"),
+	}
+}
+
+// CreateInvite issues a one-time invite valid for ttl. The device that
+// redeems it acts for userID on this device.
+func (s *PairingService) CreateInvite(ctx context.Context, userID string, ttl time.Duration) (*Invite, error) {
+	if ttl <= 0 {
+		ttl = DefaultInviteTTL
+	}
+	if ttl > MaxInviteTTL {
+		ttl = MaxInviteTTL
+	}
+
+	token, err := randomHex(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate invite token: %w", err)
+	}
+
+	invite := &database.DeviceInvite{
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(ttl),
+		CreatedBy: parseUserID(userID),
+	}
+	if err := s.db.WithContext(ctx).Create(invite).Error; err != nil {
+		return nil, fmt.Errorf("failed to save invite: %w", err)
+	}
+
+	payload, err := json.Marshal(InvitePayload{
+		DeviceID:    s.deviceID,
+		DeviceName:  s.deviceName,
+		URL:         s.publicURL,
+		Fingerprint: s.identity.Fingerprint,
+		Token:       token,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Invite{
+		DeviceInvite: invite,
+		Code:         inviteCodePrefix + base64.RawURLEncoding.EncodeToString(payload),
+	}, nil
+}
+
+// ParseInviteCode decodes an invite code
+func ParseInviteCode(code string) (*InvitePayload, error) {
+	encoded := strings.TrimPrefix(strings.TrimSpace(code), inviteCodePrefix)
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidInviteCode
+	}
+
+	var payload InvitePayload
+	if err := json.Unmarshal(data, &payload); err != nil || payload.DeviceID == "" || payload.URL == "" || payload.Fingerprint == "" || payload.Token == "" {
+		return nil, ErrInvalidInviteCode
+	}
+	return &payload, nil
+}
+
+// Redeem pairs with the device that issued an invite code. The issuing device
+// acts for userID on this device.
+func (s *PairingService) Redeem(ctx context.Context, userID string, code string) (*database.Device, error) {
+	payload, err := ParseInviteCode(code)
+	if err != nil {
+		return nil, err
+	}
+	if payload.DeviceID == s.deviceID {
+		return nil, fmt.Errorf("%w: the invite was issued by this device", ErrInvalidInviteCode)
+	}
+
+	// Only the device that issued the invite can present its certificate
+	client := s.identity.Client(payload.Fingerprint, 30*time.Second)
+	var paired PairResponse
+	err = callPeer(ctx, client, payload.URL, "/api/v1/devices/pair/accept", PairRequest{
+		Token:      payload.Token,
+		DeviceID:   s.deviceID,
+		DeviceName: s.deviceName,
+		DeviceType: s.deviceType,
+		URL:        s.publicURL,
+	}, &paired)
+	if err != nil {
+		return nil, fmt.Errorf("failed to pair with %s: %w", payload.URL, err)
+	}
+	if paired.DeviceID != payload.DeviceID || paired.Secret == "" {
+		return nil, fmt.Errorf("%s answered as device %s, the invite names %s", payload.URL, paired.DeviceID, payload.DeviceID)
+	}
+
+	device := &database.Device{
+		ID:              paired.DeviceID,
+		Name:            paired.DeviceName,
+		Type:            paired.DeviceType,
+		URL:             strings.TrimRight(payload.URL, "/"),
+		Secret:          paired.Secret,
+		CertFingerprint: payload.Fingerprint,
+		UserID:          parseUserID(userID),
+		PairedAt:        time.Now(),
+	}
+	if err := s.devices.SaveDevice(device); err != nil {
+		return nil, err
+	}
+	return device, nil
+}
+
+// Accept consumes an invite presented by another device and pairs with it,
+// pinning the client certificate it connected with
+func (s *PairingService) Accept(ctx context.Context, req *PairRequest, fingerprint string) (*PairResponse, error) {
+	if fingerprint == "" {
+		return nil, ErrClientCertificateRequired
+	}
+	if req.DeviceID == s.deviceID || fingerprint == s.identity.Fingerprint {
+		return nil, ErrInvalidInvite
+	}
+	if s.devices.FingerprintRevoked(fingerprint) {
+		return nil, fmt.Errorf("%w: certificate %s", database.ErrDeviceRevoked, fingerprint)
+	}
+
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate device secret: %w", err)
+	}
+
+	now := time.Now()
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// An invite pairs a new device; it must not replace the secret and pinned
+		// certificate of one already paired. Re-pairing needs an unpair first.
+		devices := database.NewDeviceRepository(tx)
+		if _, err := devices.GetDevice(req.DeviceID); err == nil {
+			return fmt.Errorf("%w: %s", ErrDeviceAlreadyPaired, req.DeviceID)
+		} else if !errors.Is(err, database.ErrDeviceNotFound) {
+			return err
+		}
+
+		var invite database.DeviceInvite
+		err := tx.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hashToken(req.Token), now).First(&invite).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidInvite
+		}
+		if err != nil {
+			return fmt.Errorf("failed to load invite: %w", err)
+		}
+
+		// Claim the invite; a concurrent redemption of the same token finds it used
+		result := tx.Model(&database.DeviceInvite{}).
+			Where("id = ? AND used_at IS NULL", invite.ID).
+			Updates(map[string]interface{}{"used_at": now, "used_by_device_id": req.DeviceID})
+		if result.Error != nil {
+			return fmt.Errorf("failed to claim invite: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidInvite
+		}
+
+		return devices.SaveDevice(&database.Device{
+			ID:              req.DeviceID,
+			Name:            req.DeviceName,
+			Type:            req.DeviceType,
+			URL:             strings.TrimRight(req.URL, "/"),
+			Secret:          secret,
+			CertFingerprint: fingerprint,
+			UserID:          invite.CreatedBy,
+			PairedAt:        now,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &PairResponse{
+		DeviceID:   s.deviceID,
+		DeviceName: s.deviceName,
+		DeviceType: s.deviceType,
+		Secret:     secret,
+	}, nil
+}
+
+// parseUserID returns the user a device is bound to, or nil for none
+func parseUserID(userID string) *uuid.UUID {
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return nil
+	}
+	return &id
+}
+
+// ListDevices lists paired devices
+func (s *PairingService) ListDevices() ([]database.Device, error) {
+	return s.devices.AllDevices()
+}
+
+// Unpair forgets a paired device on this side
+func (s *PairingService) Unpair(deviceID string) error {
+	return s.devices.DeleteDevice(deviceID)
+}
+
+// Revoke stops trusting a device, for example a lost one. Its certificate is
+// refused on every inter-device endpoint and cannot pair again until the
+// device is unpaired.
+func (s *PairingService) Revoke(deviceID string) (*database.Device, error) {
+	return s.devices.RevokeDevice(deviceID)
+}
+
+// Identity describes this device to a peer probing it over mutual TLS. Only a
+// paired caller, known by its certificate, sees the sessions and gets a proof
+// of identity for its nonce.
+func (s *PairingService) Identity(fingerprint, nonce string, sessions []string) *terminal.DeviceIdentity {
+	identity := &terminal.DeviceIdentity{
+		DeviceID:   s.deviceID,
+		DeviceName: s.deviceName,
+		DeviceType: s.deviceType,
+		Sessions:   []string{},
+	}
+	device, err := s.devices.GetDeviceByFingerprint(fingerprint)
+	if err != nil {
+		return identity
+	}
+
+	identity.Sessions = sessions
+	if nonce != "" && device.Secret != "" {
+		identity.Proof = terminal.DeviceProof(device.Secret, nonce, s.deviceID)
+	}
+	return identity
+}
+
+// randomHex returns n random bytes, hex encoded
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// hashToken returns the stored form of a one-time token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// peerError is an error answer of another host
+type peerError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *peerError) Error() string {
+	return fmt.Sprintf("peer returned %d: %s", e.StatusCode, e.Message)
+}
+
+// callPeer posts body as JSON to another host and decodes its answer into out
+func callPeer(ctx context.Context, client *http.Client, baseURL string, path string, body interface{}, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(baseURL, "/")+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var answer struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&answer)
+		return &peerError{StatusCode: resp.StatusCode, Message: answer.Error}
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Presence states of a viewer
+const (
+	PresenceForeground = "foreground" // The session is on screen
+	PresenceBackground = "background" // The app is open but hidden
+)
+
+// Presence is a client viewing a session
+type Presence struct {
+	ClientID     string    `json:"client_id"`
+	UserID       string    `json:"user_id"`
+	DeviceID     string    `json:"device_id"`
+	DeviceName   string    `json:"device_name,omitempty"`
+	DeviceType   string    `json:"device_type,omitempty"` // e.g. phone, tablet, desktop, web
+	ConnectedAt  time.Time `json:"connected_at"`
+	LastActivity time.Time `json:"last_activity"`
+	State        string    `json:"state"`
+}
+
+// SessionPresence is who is viewing a session
+type SessionPresence struct {
+	SessionID string     `json:"session_id"`
+	Viewers   []Presence `json:"viewers"`
+}
+
+// PresenceTracker tracks which users and devices are viewing each session
+type PresenceTracker struct {
+	sessions map[string]map[*WebSocketClient]*Presence
+	mu       sync.RWMutex
+}
+
+// NewPresenceTracker creates a new presence tracker
+func NewPresenceTracker() *PresenceTracker {
+	return &PresenceTracker{
+		sessions: make(map[string]map[*WebSocketClient]*Presence),
+	}
+}
+
+// Join records a client viewing a session, in the foreground
+func (pt *PresenceTracker) Join(sessionID string, client *WebSocketClient) *SessionPresence {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	viewers, exists := pt.sessions[sessionID]
+	if !exists {
+		viewers = make(map[*WebSocketClient]*Presence)
+		pt.sessions[sessionID] = viewers
+	}
+	if _, viewing := viewers[client]; !viewing {
+		viewers[client] = &Presence{
+			ClientID:     client.id,
+			UserID:       client.reader.UserID,
+			DeviceID:     client.reader.DeviceID,
+			DeviceName:   client.deviceName,
+			DeviceType:   client.deviceType,
+			ConnectedAt:  client.connectedAt,
+			LastActivity: time.Now(),
+			State:        PresenceForeground,
+		}
+	}
+	return pt.session(sessionID)
+}
+
+// Leave removes a client from the viewers of a session. It returns nil when the
+// client did not view the session.
+func (pt *PresenceTracker) Leave(sessionID string, client *WebSocketClient) *SessionPresence {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	viewers, exists := pt.sessions[sessionID]
+	if !exists {
+		return nil
+	}
+	if _, viewing := viewers[client]; !viewing {
+		return nil
+	}
+	delete(viewers, client)
+	if len(viewers) == 0 {
+		delete(pt.sessions, sessionID)
+	}
+	return pt.session(sessionID)
+}
+
+// Touch records activity of a client viewing a session
+func (pt *PresenceTracker) Touch(sessionID string, client *WebSocketClient) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	if presence, viewing := pt.sessions[sessionID][client]; viewing {
+		presence.LastActivity = time.Now()
+	}
+}
+
+// SetState moves a client viewing a session to the foreground or background.
+// It returns nil when nothing changed.
+func (pt *PresenceTracker) SetState(sessionID string, client *WebSocketClient, state string) *SessionPresence {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	presence, viewing := pt.sessions[sessionID][client]
+	if !viewing {
+		return nil
+	}
+	presence.LastActivity = time.Now()
+	if presence.State == state {
+		return nil
+	}
+	presence.State = state
+	return pt.session(sessionID)
+}
+
+// Session returns who is viewing a session
+func (pt *PresenceTracker) Session(sessionID string) *SessionPresence {
+	pt.mu.RLock()
+	defer pt.mu.RUnlock()
+
+	return pt.session(sessionID)
+}
+
+// Viewing reports whether a device has a session in the foreground, so
+// notifications about it need not be pushed there
+func (pt *PresenceTracker) Viewing(sessionID string, deviceID string) bool {
+	pt.mu.RLock()
+	defer pt.mu.RUnlock()
+
+	for _, presence := range pt.sessions[sessionID] {
+		if presence.DeviceID == deviceID && presence.State == PresenceForeground {
+			return true
+		}
+	}
+	return false
+}
+
+// session describes the viewers of a session, longest connected first
+func (pt *PresenceTracker) session(sessionID string) *SessionPresence {
+	result := &SessionPresence{SessionID: sessionID, Viewers: []Presence{}}
+	for _, presence := range pt.sessions[sessionID] {
+		result.Viewers = append(result.Viewers, *presence)
+	}
+	sort.Slice(result.Viewers, func(i, j int) bool {
+		return result.Viewers[i].ConnectedAt.Before(result.Viewers[j].ConnectedAt)
+	})
+	return result
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/majiayu000/anywhere-ai/core/database"
+)
+
+const (
+	// defaultReaderUserID is used when a client does not identify its user
+	defaultReaderUserID = "local"
+	// defaultReaderDeviceID is used when a client does not identify its device
+	defaultReaderDeviceID = "default"
+)
+
+// readerFromRequest identifies the user and device behind a request from the
+// X-User-ID / X-Device-ID headers or the user_id / device_id query parameters.
+// The user of an authenticated request is the one its token or key was issued to.
+func readerFromRequest(c *gin.Context) database.Reader {
+	reader := database.Reader{
+		UserID:   c.GetHeader("X-User-ID"),
+		DeviceID: c.GetHeader("X-Device-ID"),
+	}
+	if userID := requestUserID(c); userID != "" {
+		reader.UserID = userID
+	}
+	if reader.UserID == "" {
+		reader.UserID = c.DefaultQuery("user_id", defaultReaderUserID)
+	}
+	if reader.DeviceID == "" {
+		reader.DeviceID = c.DefaultQuery("device_id", defaultReaderDeviceID)
+	}
+	return reader
+}
+
+// deviceDetailsFromRequest describes the device behind a request from the
+// X-Device-Name / X-Device-Type headers or the device_name / device_type query
+// parameters
+func deviceDetailsFromRequest(c *gin.Context) (name string, deviceType string) {
+	name = c.GetHeader("X-Device-Name")
+	if name == "" {
+		name = c.Query("device_name")
+	}
+	deviceType = c.GetHeader("X-Device-Type")
+	if deviceType == "" {
+		deviceType = c.Query("device_type")
+	}
+	return name, deviceType
+}
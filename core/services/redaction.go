@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/majiayu000/anywhere-ai/core/database"
+	"github.com/majiayu000/anywhere-ai/core/redact"
+	"gorm.io/gorm"
+)
+
+// RedactionService masks secrets in tool output and messages before they are
+// stored or broadcast, and keeps an audit count of what was masked
+type RedactionService struct {
+	db       *gorm.DB
+	redactor *redact.Redactor
+	retain   bool
+	seen     *redact.Seen
+}
+
+// NewRedactionService creates a redaction service. With retain set, the original
+// content of redacted messages is stored for the privileged unredacted view.
+func NewRedactionService(db *gorm.DB, redactor *redact.Redactor, retain bool) *RedactionService {
+	return &RedactionService{
+		db:       db,
+		redactor: redactor,
+		retain:   retain,
+		seen:     redact.NewSeen(),
+	}
+}
+
+// RetainsUnredacted reports whether original message content is kept
+func (s *RedactionService) RetainsUnredacted() bool {
+	return s.retain
+}
+
+// RedactMessage masks secrets in the content and git diff of a message that
+// is about to be stored
+func (s *RedactionService) RedactMessage(ctx context.Context, message *database.TerminalMessage) {
+	redacted, counts := s.redactor.Redact(message.Content)
+	if counts.Total() > 0 {
+		if s.retain {
+			message.UnredactedContent = message.Content
+		}
+		message.Content = redacted
+		message.Redacted = true
+		s.record(ctx, message.SessionID, database.RedactionSourceMessage, counts)
+	}
+
+	redacted, counts = s.redactor.Redact(message.GitDiff)
+	if counts.Total() > 0 {
+		if s.retain {
+			message.UnredactedGitDiff = message.GitDiff
+		}
+		message.GitDiff = redacted
+		message.Redacted = true
+		s.record(ctx, message.SessionID, database.RedactionSourceDiff, counts)
+	}
+}
+
+// RedactSnapshot masks secrets in the diffs of a git turn snapshot that is
+// about to be stored. Only the turn diff is counted, as the cumulative diff
+// repeats what earlier turns already counted.
+func (s *RedactionService) RedactSnapshot(ctx context.Context, snapshot *database.GitTurnSnapshot) {
+	turnDiff, counts := s.redactor.Redact(snapshot.TurnDiff)
+	cumulativeDiff, cumulativeCounts := s.redactor.Redact(snapshot.CumulativeDiff)
+	if counts.Total() == 0 && cumulativeCounts.Total() == 0 {
+		return
+	}
+
+	if s.retain {
+		snapshot.UnredactedTurnDiff = snapshot.TurnDiff
+		snapshot.UnredactedCumulativeDiff = snapshot.CumulativeDiff
+	}
+	snapshot.TurnDiff = turnDiff
+	snapshot.CumulativeDiff = cumulativeDiff
+	snapshot.Redacted = true
+	s.record(ctx, snapshot.SessionID, database.RedactionSourceDiff, counts)
+}
+
+// RedactDiff masks secrets in a live git diff. Like output, the same diff is
+// computed on every request, so only secrets not seen before are counted.
+func (s *RedactionService) RedactDiff(ctx context.Context, sessionID string, diff string) string {
+	redacted, matches := s.redactor.RedactMatches(diff)
+	if len(matches) > 0 {
+		s.record(ctx, sessionID, database.RedactionSourceDiff, s.seen.Count(sessionID, matches))
+	}
+	return redacted
+}
+
+// RedactOutput masks secrets in captured terminal output. The same screen is
+// captured many times, so only secrets not seen before in the session are counted.
+func (s *RedactionService) RedactOutput(ctx context.Context, sessionID string, output string) string {
+	redacted, matches := s.redactor.RedactMatches(output)
+	if len(matches) > 0 {
+		s.record(ctx, sessionID, database.RedactionSourceOutput, s.seen.Count(sessionID, matches))
+	}
+	return redacted
+}
+
+// GetAuditCounts returns what was masked, for one session or all sessions
+func (s *RedactionService) GetAuditCounts(ctx context.Context, sessionID string) ([]database.RedactionCount, error) {
+	query := s.db.WithContext(ctx).Order("session_id, source, rule")
+	if sessionID != "" {
+		query = query.Where("session_id = ?", sessionID)
+	}
+
+	var counts []database.RedactionCount
+	if err := query.Find(&counts).Error; err != nil {
+		return nil, fmt.Errorf("failed to get redaction counts: %w", err)
+	}
+	return counts, nil
+}
+
+// GetUnredactedMessage returns a message with its retained original content
+func (s *RedactionService) GetUnredactedMessage(ctx context.Context, messageID string) (*database.TerminalMessage, error) {
+	var message database.TerminalMessage
+	if err := s.db.WithContext(ctx).First(&message, "id = ?", messageID).Error; err != nil {
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+	return &message, nil
+}
+
+// Forget drops the secrets seen in a session's output
+func (s *RedactionService) Forget(sessionID string) {
+	s.seen.Forget(sessionID)
+}
+
+// record adds counts to the audit totals, logging failures
+func (s *RedactionService) record(ctx context.Context, sessionID string, source string, counts redact.Counts) {
+	if counts.Total() == 0 {
+		return
+	}
+	if err := database.RecordRedactions(s.db.WithContext(ctx), sessionID, source, counts); err != nil {
+		log.Printf("Failed to record redactions for session %s: %v", sessionID, err)
+	}
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/majiayu000/anywhere-ai/core/database"
+)
+
+// RedactionAPIService exposes the redaction audit and the privileged unredacted view
+type RedactionAPIService struct {
+	redaction  *RedactionService
+	access     *SessionAccessService
+	adminToken string
+}
+
+// NewRedactionAPIService creates a new redaction API service. The unredacted view
+// requires the X-Admin-Token header to match ANYWHERE_ADMIN_TOKEN and is disabled
+// when it is not set.
+func NewRedactionAPIService(redaction *RedactionService) *RedactionAPIService {
+	return &RedactionAPIService{
+		redaction:  redaction,
+		adminToken: os.Getenv("ANYWHERE_ADMIN_TOKEN"),
+	}
+}
+
+// SetSessionAccess sets the service that decides who may see a session's audit
+func (s *RedactionAPIService) SetSessionAccess(access *SessionAccessService) {
+	s.access = access
+}
+
+// GetAudit returns how many values were masked, per session, source and rule.
+// The audit of one session needs a viewer of it; that of every session needs
+// the admin token.
+func (s *RedactionAPIService) GetAudit(c *gin.Context) {
+	sessionID := c.Query("session_id")
+	if sessionID == "" {
+		if !s.authorized(c) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Admin token required"})
+			return
+		}
+	} else if err := checkRole(s.role(c, sessionID), database.SessionRoleViewer); err != nil {
+		c.JSON(accessErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	counts, err := s.redaction.GetAuditCounts(c.Request.Context(), sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"counts": counts})
+}
+
+// GetUnredactedMessage returns the original content and git diff of a redacted message
+func (s *RedactionAPIService) GetUnredactedMessage(c *gin.Context) {
+	if !s.authorized(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin token required"})
+		return
+	}
+
+	message, err := s.redaction.GetUnredactedMessage(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+
+	content, gitDiff := message.Content, message.GitDiff
+	if message.Redacted {
+		if message.UnredactedContent == "" && message.UnredactedGitDiff == "" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Unredacted content was not retained"})
+			return
+		}
+		// Only the parts that were masked have a retained original
+		if message.UnredactedContent != "" {
+			content = message.UnredactedContent
+		}
+		if message.UnredactedGitDiff != "" {
+			gitDiff = message.UnredactedGitDiff
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":         message.ID,
+		"session_id": message.SessionID,
+		"redacted":   message.Redacted,
+		"content":    content,
+		"git_diff":   gitDiff,
+	})
+}
+
+// role returns the role of the caller in a session, or "" when they may not see it
+func (s *RedactionAPIService) role(c *gin.Context, sessionID string) string {
+	if !sessionVisible(c, sessionID) {
+		return ""
+	}
+	if s.access == nil {
+		return database.SessionRoleOwner
+	}
+	return s.access.RequestRole(c, sessionID)
+}
+
+// authorized reports whether the request carries the admin token
+func (s *RedactionAPIService) authorized(c *gin.Context) bool {
+	if s.adminToken == "" {
+		return false
+	}
+	token := c.GetHeader("X-Admin-Token")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) == 1
+}
+
+// RegisterRoutes registers redaction API routes
+func (s *RedactionAPIService) RegisterRoutes(router *gin.Engine) {
+	api := router.Group("/api/v1/redaction")
+	{
+		api.GET("/audit", s.GetAudit)
+		api.GET("/messages/:id/unredacted", s.GetUnredactedMessage)
+	}
+}
@@ -0,0 +1,281 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/majiayu000/anywhere-ai/core/database"
+	"github.com/majiayu000/anywhere-ai/core/encryption"
+	"gorm.io/gorm"
+)
+
+// reencryptBatchSize is how many rows the re-encryption job reads at a time
+const reencryptBatchSize = 200
+
+// encryptedColumn is a column written through the encrypted serializers
+type encryptedColumn struct {
+	table  string
+	column string
+	binary bool // BLOB/BYTEA rather than TEXT
+}
+
+// encryptedColumns lists every column the re-encryption job rewrites
+var encryptedColumns = []encryptedColumn{
+	{table: "terminal_messages", column: "content"},
+	{table: "terminal_messages", column: "unredacted_content"},
+	{table: "terminal_messages", column: "git_diff"},
+	{table: "git_turn_snapshots", column: "turn_diff"},
+	{table: "git_turn_snapshots", column: "cumulative_diff"},
+	{table: "git_turn_snapshots", column: "new_commits"},
+	{table: "terminal_messages", column: "unredacted_git_diff"},
+	{table: "git_turn_snapshots", column: "unredacted_turn_diff"},
+	{table: "git_turn_snapshots", column: "unredacted_cumulative_diff"},
+	{table: "terminal_sessions", column: "buffer_content", binary: true},
+	{table: "terminal_sessions", column: "environment"},
+	{table: "terminal_sessions", column: "input_history"},
+	{table: "terminal_sessions", column: "output_history"},
+	{table: "session_checkpoints", column: "input_history"},
+	{table: "session_checkpoints", column: "output_history"},
+	{table: "session_checkpoints", column: "state_snapshot"},
+	{table: "devices", column: "secret"},
+}
+
+// ErrReencryptRunning is returned when a re-encryption job is already running
+var ErrReencryptRunning = errors.New("re-encryption is already running")
+
+// ErrEncryptionDisabled is returned when no encryption key is configured
+var ErrEncryptionDisabled = errors.New("encryption at rest is not enabled")
+
+// ReencryptStatus reports the progress of the re-encryption job
+type ReencryptStatus struct {
+	Running     bool       `json:"running"`
+	ActiveKeyID string     `json:"active_key_id"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	Scanned     int64      `json:"scanned"`
+	Rewritten   int64      `json:"rewritten"`
+	Reindexed   int64      `json:"reindexed"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// Reencryptor moves stored data to the active encryption key. It encrypts rows
+// written before encryption was enabled, re-encrypts rows under rotated keys and
+// rebuilds the search index when it is enabled.
+type Reencryptor struct {
+	db     *gorm.DB
+	mu     sync.Mutex
+	status ReencryptStatus
+}
+
+// NewReencryptor creates a new re-encryption job
+func NewReencryptor(db *gorm.DB) *Reencryptor {
+	return &Reencryptor{db: db}
+}
+
+// Start runs the job in the background
+func (r *Reencryptor) Start() error {
+	keyring := encryption.Active()
+	if keyring == nil {
+		return ErrEncryptionDisabled
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.status.Running {
+		return ErrReencryptRunning
+	}
+
+	now := time.Now()
+	r.status = ReencryptStatus{
+		Running:     true,
+		ActiveKeyID: keyring.ActiveKeyID(),
+		StartedAt:   &now,
+	}
+
+	go r.run(context.Background(), keyring)
+	return nil
+}
+
+// Status returns the progress of the current or last run
+func (r *Reencryptor) Status() ReencryptStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+// run re-encrypts every encrypted column and then rebuilds the search index
+func (r *Reencryptor) run(ctx context.Context, keyring *encryption.Keyring) {
+	err := func() error {
+		for _, col := range encryptedColumns {
+			if err := r.rotateColumn(ctx, keyring, col); err != nil {
+				return err
+			}
+		}
+		if database.SearchIndexEnabled() {
+			return r.reindexMessages(ctx, keyring)
+		}
+		return nil
+	}()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	r.status.Running = false
+	r.status.FinishedAt = &now
+	if err != nil {
+		r.status.Error = err.Error()
+		log.Printf("Re-encryption failed: %v", err)
+		return
+	}
+	log.Printf("🔐 Re-encryption finished: %d rows scanned, %d rewritten, %d reindexed",
+		r.status.Scanned, r.status.Rewritten, r.status.Reindexed)
+}
+
+// rotateColumn rewrites every value of a column that is not under the active key
+func (r *Reencryptor) rotateColumn(ctx context.Context, keyring *encryption.Keyring, col encryptedColumn) error {
+	db := r.db.WithContext(ctx)
+	selectSQL := fmt.Sprintf("SELECT id, %s FROM %s", col.column, col.table)
+	updateSQL := fmt.Sprintf("UPDATE %s SET %s = ? WHERE id = ? AND %s = ?", col.table, col.column, col.column)
+
+	lastID := ""
+	for {
+		rows, err := r.batch(db, selectSQL, lastID)
+		if err != nil {
+			return fmt.Errorf("failed to read %s.%s: %w", col.table, col.column, err)
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+
+		var rewritten int64
+		for _, row := range rows {
+			if !keyring.NeedsRotation(row.value) {
+				continue
+			}
+
+			plaintext, err := keyring.Decrypt(row.value)
+			if err != nil {
+				return fmt.Errorf("failed to decrypt %s.%s of %s: %w", col.table, col.column, row.id, err)
+			}
+			sealed, err := keyring.Encrypt(plaintext)
+			if err != nil {
+				return err
+			}
+
+			// Only replace the value that was read; a concurrent write already used the active key
+			var newValue, oldValue interface{} = string(sealed), string(row.value)
+			if col.binary {
+				newValue, oldValue = sealed, row.value
+			}
+			result := db.Exec(updateSQL, newValue, row.id, oldValue)
+			if result.Error != nil {
+				return fmt.Errorf("failed to rewrite %s.%s of %s: %w", col.table, col.column, row.id, result.Error)
+			}
+			rewritten += result.RowsAffected
+		}
+
+		r.mu.Lock()
+		r.status.Scanned += int64(len(rows))
+		r.status.Rewritten += rewritten
+		r.mu.Unlock()
+
+		lastID = rows[len(rows)-1].id
+	}
+}
+
+// reindexMessages indexes messages that have no tokens under the active key and
+// drops tokens derived from rotated keys
+func (r *Reencryptor) reindexMessages(ctx context.Context, keyring *encryption.Keyring) error {
+	db := r.db.WithContext(ctx)
+
+	lastID := ""
+	for {
+		var messages []database.TerminalMessage
+		query := db.Select("id", "session_id", "content").Order("id").Limit(reencryptBatchSize)
+		if lastID != "" {
+			query = query.Where("id > ?", lastID)
+		}
+		if err := query.Find(&messages).Error; err != nil {
+			return fmt.Errorf("failed to read messages: %w", err)
+		}
+		if len(messages) == 0 {
+			break
+		}
+
+		ids := make([]uuid.UUID, 0, len(messages))
+		for _, message := range messages {
+			ids = append(ids, message.ID)
+		}
+		var indexed []uuid.UUID
+		err := db.Model(&database.MessageSearchToken{}).
+			Distinct("message_id").
+			Where("key_id = ? AND message_id IN ?", keyring.ActiveKeyID(), ids).
+			Pluck("message_id", &indexed).Error
+		if err != nil {
+			return fmt.Errorf("failed to read search index: %w", err)
+		}
+		done := make(map[uuid.UUID]bool, len(indexed))
+		for _, id := range indexed {
+			done[id] = true
+		}
+
+		var reindexed int64
+		for i := range messages {
+			if done[messages[i].ID] {
+				continue
+			}
+			if err := database.IndexMessage(db, &messages[i]); err != nil {
+				return err
+			}
+			reindexed++
+		}
+
+		r.mu.Lock()
+		r.status.Reindexed += reindexed
+		r.mu.Unlock()
+
+		lastID = messages[len(messages)-1].ID.String()
+	}
+
+	if err := db.Where("key_id <> ?", keyring.ActiveKeyID()).Delete(&database.MessageSearchToken{}).Error; err != nil {
+		return fmt.Errorf("failed to drop stale search tokens: %w", err)
+	}
+	return nil
+}
+
+// storedValue is a raw column value as read by the re-encryption job
+type storedValue struct {
+	id    string
+	value []byte
+}
+
+// batch reads the next rows of a keyset-paginated query
+func (r *Reencryptor) batch(db *gorm.DB, selectSQL string, lastID string) ([]storedValue, error) {
+	query := selectSQL + " ORDER BY id LIMIT ?"
+	args := []interface{}{reencryptBatchSize}
+	if lastID != "" {
+		query = selectSQL + " WHERE id > ? ORDER BY id LIMIT ?"
+		args = []interface{}{lastID, reencryptBatchSize}
+	}
+
+	rows, err := db.Raw(query, args...).Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []storedValue
+	for rows.Next() {
+		var v storedValue
+		if err := rows.Scan(&v.id, &v.value); err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, rows.Err()
+}
@@ -0,0 +1,274 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/majiayu000/anywhere-ai/core/database"
+	"github.com/majiayu000/anywhere-ai/core/tmux"
+)
+
+// remoteListTimeout bounds how long listing waits for a paired device
+const remoteListTimeout = 5 * time.Second
+
+// RemoteSessionService shows and drives sessions running on paired devices.
+// It lists their sessions over the mutual TLS peer API, and proxies requests
+// and WebSocket traffic for a session to the device that runs it.
+type RemoteSessionService struct {
+	devices     *database.DeviceRepository
+	clients     *DeviceClients
+	tmuxManager *tmux.Manager
+
+	// Device running each remote session, as of the last listing
+	owners map[string]string
+	mu     sync.RWMutex
+}
+
+// NewRemoteSessionService creates a new remote session service
+func NewRemoteSessionService(devices *database.DeviceRepository, clients *DeviceClients, tmuxManager *tmux.Manager) *RemoteSessionService {
+	return &RemoteSessionService{
+		devices:     devices,
+		clients:     clients,
+		tmuxManager: tmuxManager,
+		owners:      make(map[string]string),
+	}
+}
+
+// ListSessions lists the sessions of every paired device that answers, tagged
+// with their host. Unread counts are those of reader.
+func (s *RemoteSessionService) ListSessions(ctx context.Context, reader database.Reader) []SessionResponse {
+	devices, err := s.devices.AllDevices()
+	if err != nil {
+		log.Printf("Failed to list paired devices: %v", err)
+		return nil
+	}
+
+	results := make([][]SessionResponse, len(devices))
+	answered := make([]bool, len(devices))
+	var wg sync.WaitGroup
+	for i := range devices {
+		device := &devices[i]
+		if device.RevokedAt != nil || device.CertFingerprint == "" {
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sessions, err := s.listDevice(ctx, device, reader)
+			if err != nil {
+				log.Printf("Failed to list sessions of %s: %v", device.ID, err)
+				return
+			}
+			results[i], answered[i] = sessions, true
+		}(i)
+	}
+	wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sessionID, deviceID := range s.owners {
+		for i := range devices {
+			if devices[i].ID == deviceID && answered[i] {
+				delete(s.owners, sessionID)
+			}
+		}
+	}
+	response := []SessionResponse{}
+	for i, sessions := range results {
+		for _, session := range sessions {
+			session.DeviceID = devices[i].ID
+			session.DeviceName = devices[i].Name
+			session.Remote = true
+			s.owners[session.ID] = devices[i].ID
+			response = append(response, session)
+		}
+	}
+	return response
+}
+
+// listDevice lists the sessions running on one paired device
+func (s *RemoteSessionService) listDevice(ctx context.Context, device *database.Device, reader database.Reader) ([]SessionResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, remoteListTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(device.URL, "/")+"/api/v1/terminal/sessions", nil)
+	if err != nil {
+		return nil, err
+	}
+	setReaderHeaders(req.Header, reader)
+
+	resp, err := s.clients.Client(device, remoteListTimeout).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &peerError{StatusCode: resp.StatusCode, Message: resp.Status}
+	}
+	var sessions []SessionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&sessions); err != nil {
+		return nil, fmt.Errorf("failed to decode sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// Owner returns the paired device running a session, or nil when the session
+// runs here or nowhere known. Sessions missing from the last listing trigger a
+// new one.
+func (s *RemoteSessionService) Owner(ctx context.Context, sessionID string, reader database.Reader) *database.Device {
+	if sessionID == "" {
+		return nil
+	}
+	if _, err := s.tmuxManager.GetSession(sessionID); err == nil {
+		return nil
+	}
+
+	deviceID, exists := s.owner(sessionID)
+	if !exists {
+		if s.tmuxManager.HasSession(ctx, sessionID) {
+			return nil
+		}
+		s.ListSessions(ctx, reader)
+		if deviceID, exists = s.owner(sessionID); !exists {
+			return nil
+		}
+	}
+
+	device, err := s.clients.Resolve(deviceID)
+	if err != nil {
+		log.Printf("Session %s is on %s, which cannot be reached: %v", sessionID, deviceID, err)
+		return nil
+	}
+	return device
+}
+
+// Device resolves a paired device to start sessions on, by ID or URL
+func (s *RemoteSessionService) Device(target string) (*database.Device, error) {
+	return s.clients.Resolve(target)
+}
+
+// owner returns the device a session was last listed on
+func (s *RemoteSessionService) owner(sessionID string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	deviceID, exists := s.owners[sessionID]
+	return deviceID, exists
+}
+
+// Proxy forwards a request to the same path on device and writes its answer.
+// Credentials of this server are not passed on; the reader is.
+func (s *RemoteSessionService) Proxy(c *gin.Context, device *database.Device) {
+	target, err := url.Parse(device.URL)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("Invalid URL for device %s", device.ID)})
+		return
+	}
+
+	reader := readerFromRequest(c)
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(target)
+			r.Out.Header.Del("Authorization")
+			r.Out.Header.Del("Cookie")
+			setReaderHeaders(r.Out.Header, reader)
+		},
+		Transport: s.clients.Transport(device),
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("Failed to proxy %s to %s: %v", r.URL.Path, device.ID, err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadGateway)
+			json.NewEncoder(w).Encode(gin.H{"error": fmt.Sprintf("Device %s is unreachable", device.ID)})
+		},
+	}
+	proxy.ServeHTTP(c.Writer, c.Request)
+}
+
+// ProxySession is middleware for routes with a session :id that hands requests
+// for sessions running on a paired device over to it
+func (s *RemoteSessionService) ProxySession(c *gin.Context) {
+	device := s.Owner(c.Request.Context(), c.Param("id"), readerFromRequest(c))
+	if device == nil {
+		c.Next()
+		return
+	}
+
+	s.Proxy(c, device)
+	c.Abort()
+}
+
+// Relay opens a WebSocket to the device running a session, for a client of
+// this server to reach it through
+func (s *RemoteSessionService) Relay(ctx context.Context, device *database.Device, sessionID string, reader database.Reader) (*remoteRelay, error) {
+	header := http.Header{}
+	setReaderHeaders(header, reader)
+	conn, err := s.clients.DialWebSocket(ctx, device, "/api/v1/ws", header)
+	if err != nil {
+		return nil, err
+	}
+	return &remoteRelay{
+		sessionID: sessionID,
+		deviceID:  device.ID,
+		conn:      conn,
+		done:      make(chan struct{}),
+	}, nil
+}
+
+// remoteRelay carries one client's WebSocket traffic for a remote session
+type remoteRelay struct {
+	sessionID string
+	deviceID  string
+	conn      *websocket.Conn
+	done      chan struct{}
+}
+
+// forward sends a client frame on to the device
+func (r *remoteRelay) forward(frame []byte) error {
+	r.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return r.conn.WriteMessage(websocket.TextMessage, frame)
+}
+
+// pump passes the device's frames about the session to the client until the
+// relay is closed
+func (r *remoteRelay) pump(client *WebSocketClient) {
+	defer close(r.done)
+	for {
+		_, frame, err := r.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var msg WebSocketMessage
+		if err := json.Unmarshal(frame, &msg); err != nil || msg.SessionID != r.sessionID {
+			continue
+		}
+		select {
+		case client.send <- frame:
+		default:
+			// Client buffer full, skip
+		}
+	}
+}
+
+// close closes the relay and waits for its pump to stop
+func (r *remoteRelay) close() {
+	r.conn.Close()
+	<-r.done
+}
+
+// setReaderHeaders identifies the reader to a paired device
+func setReaderHeaders(header http.Header, reader database.Reader) {
+	header.Set("X-User-ID", reader.UserID)
+	header.Set("X-Device-ID", reader.DeviceID)
+}
@@ -0,0 +1,415 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/majiayu000/anywhere-ai/core/database"
+)
+
+// sessionACLTTL is how long who may do what in a session is cached; servers
+// sharing the session store see each other's changes within it
+const sessionACLTTL = 30 * time.Second
+
+var (
+	// ErrNoSessionAccess is returned for a session the caller may not see. It
+	// reads like a missing session, so sessions of others are not revealed.
+	ErrNoSessionAccess = errors.New("session not found")
+	// ErrRoleRequired is returned when the caller's role in a session is too low
+	ErrRoleRequired = errors.New("a higher role in this session is required")
+	// ErrInvalidRole is returned when sharing a session with an unknown role
+	ErrInvalidRole = errors.New("invalid role")
+	// ErrInvalidShare is returned when a session cannot be shared as asked
+	ErrInvalidShare = errors.New("invalid share")
+	// ErrAdminRequired is returned when someone but the server's admin manages the server
+	ErrAdminRequired = errors.New("only the server's admin may do this")
+)
+
+// sessionRouteRoles are the roles callers need in a session, by method and
+// route; every other session route needs the owner
+var sessionRouteRoles = map[string]string{
+	"GET /api/v1/terminal/sessions/:id/output":                    database.SessionRoleViewer,
+	"GET /api/v1/terminal/sessions/:id/control":                   database.SessionRoleViewer,
+	"GET /api/v1/terminal/sessions/:id/presence":                  database.SessionRoleViewer,
+	"GET /api/v1/terminal/sessions/:id/lease":                     database.SessionRoleViewer,
+	"GET /api/v1/terminal/sessions/:id/usage":                     database.SessionRoleViewer,
+	"GET /api/v1/terminal/sessions/:id/checkpoints":               database.SessionRoleViewer,
+	"GET /api/v1/terminal/sessions/:id/messages":                  database.SessionRoleViewer,
+	"GET /api/v1/terminal/sessions/:id/messages/status":           database.SessionRoleViewer,
+	"GET /api/v1/terminal/sessions/:id/messages/queue":            database.SessionRoleViewer,
+	"GET /api/v1/terminal/sessions/:id/messages/unread":           database.SessionRoleViewer,
+	"GET /api/v1/terminal/sessions/:id/messages/cursors":          database.SessionRoleViewer,
+	"POST /api/v1/terminal/sessions/:id/messages/read":            database.SessionRoleViewer,
+	"GET /api/v1/terminal/sessions/:id/attachments/:attachmentId": database.SessionRoleViewer,
+	"GET /api/v1/terminal/sessions/:id/git/turns":                 database.SessionRoleViewer,
+	"GET /api/v1/terminal/sessions/:id/git/diff":                  database.SessionRoleViewer,
+
+	"POST /api/v1/terminal/sessions/:id/messages":    database.SessionRoleCommenter,
+	"POST /api/v1/terminal/sessions/:id/attachments": database.SessionRoleCommenter,
+
+	// Permission prompts are answered with raw input
+	"POST /api/v1/terminal/sessions/:id/input":       database.SessionRoleOperator,
+	"POST /api/v1/terminal/sessions/:id/keys":        database.SessionRoleOperator,
+	"POST /api/v1/terminal/sessions/:id/checkpoints": database.SessionRoleOperator,
+}
+
+// sessionACL is who may do what in a session
+type sessionACL struct {
+	owner    *uuid.UUID
+	shares   map[uuid.UUID]string
+	loadedAt time.Time
+}
+
+// SessionAccessService decides what users may do in sessions: owners may do
+// everything, users a session is shared with what their role allows, and
+// others nothing. Sessions nobody owns, such as ones started from the CLI,
+// belong to the server's admin.
+type SessionAccessService struct {
+	sessions *database.SessionRepository
+	shares   *database.ShareRepository
+	users    *database.UserRepository
+
+	adminEmail string
+
+	mu             sync.Mutex
+	acls           map[string]*sessionACL
+	adminID        *uuid.UUID // Resolved from adminEmail once the admin has signed in
+	adminCheckedAt time.Time  // Last failed lookup of the admin, retried after sessionACLTTL
+
+	// Called with each session whose access changed
+	listeners []func(sessionID string)
+}
+
+// NewSessionAccessService creates a new session access service
+func NewSessionAccessService(sessions *database.SessionRepository, shares *database.ShareRepository, users *database.UserRepository) *SessionAccessService {
+	return &SessionAccessService{
+		sessions: sessions,
+		shares:   shares,
+		users:    users,
+		acls:     make(map[string]*sessionACL),
+	}
+}
+
+// SetAdmin sets the email address of the server's admin, who owns the
+// sessions nobody else does
+func (s *SessionAccessService) SetAdmin(email string) {
+	s.adminEmail = strings.ToLower(strings.TrimSpace(email))
+}
+
+// OnChange registers a function called with each session whose access
+// changed, so roles cached elsewhere can be dropped
+func (s *SessionAccessService) OnChange(listener func(sessionID string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listeners = append(s.listeners, listener)
+}
+
+// admin reports whether a user is the server's admin. Until the admin has
+// signed in, the lookup is retried at most once per sessionACLTTL.
+func (s *SessionAccessService) admin(userID uuid.UUID) bool {
+	if s.adminEmail == "" {
+		return false
+	}
+	s.mu.Lock()
+	adminID, checkedAt := s.adminID, s.adminCheckedAt
+	s.mu.Unlock()
+	if adminID == nil {
+		if time.Since(checkedAt) < sessionACLTTL {
+			return false
+		}
+		user, err := s.users.FindUserByEmail(s.adminEmail)
+		s.mu.Lock()
+		if err != nil {
+			s.adminCheckedAt = time.Now()
+			s.mu.Unlock()
+			return false
+		}
+		adminID = &user.ID
+		s.adminID = adminID
+		s.mu.Unlock()
+	}
+	return userID == *adminID
+}
+
+// accessUserID returns the user whose access to sessions a request is checked
+// against: the signed in user, or the one a paired device was bound to at
+// pairing. A device bound to nobody gets a user who may reach no session.
+// Requests without either, made while authentication is off, may reach every
+// session.
+func accessUserID(c *gin.Context) string {
+	if userID := requestUserID(c); userID != "" {
+		return userID
+	}
+	if device := pairedDevice(c); device != nil {
+		if device.UserID == nil {
+			return uuid.Nil.String()
+		}
+		return device.UserID.String()
+	}
+	return ""
+}
+
+// Role returns the role of a user in a session, or "" when they may not see it
+func (s *SessionAccessService) Role(userID string, sessionID string) string {
+	if userID == "" {
+		return database.SessionRoleOwner
+	}
+	acl, err := s.acl(sessionID)
+	if err != nil {
+		log.Printf("Failed to load access to session %s: %v", sessionID, err)
+		return ""
+	}
+
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return ""
+	}
+	if acl.owner != nil && id == *acl.owner {
+		return database.SessionRoleOwner
+	}
+	if acl.owner == nil && s.admin(id) {
+		return database.SessionRoleOwner
+	}
+	return acl.shares[id]
+}
+
+// VisibleSessions returns the IDs of the sessions a user has a role in, for
+// queries across sessions. It returns nil, meaning every session, when
+// authentication is off.
+func (s *SessionAccessService) VisibleSessions(userID string) ([]string, error) {
+	if userID == "" {
+		return nil, nil
+	}
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return []string{}, nil
+	}
+
+	ids, err := s.sessions.OwnedSessionIDs(id)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := s.shares.SharedSessionIDs(id)
+	if err != nil {
+		return nil, err
+	}
+	ids = append(ids, shared...)
+	if s.admin(id) {
+		unowned, err := s.sessions.UnownedSessionIDs()
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, unowned...)
+	}
+	if ids == nil {
+		ids = []string{}
+	}
+	return ids, nil
+}
+
+// requestVisibleSessions returns the IDs of the sessions the caller of a
+// request may see across sessions, narrowed to those its API key may reach;
+// nil means every session
+func requestVisibleSessions(c *gin.Context, access *SessionAccessService) ([]string, error) {
+	var ids []string
+	if access != nil {
+		var err error
+		if ids, err = access.VisibleSessions(accessUserID(c)); err != nil {
+			return nil, err
+		}
+	}
+
+	key := requestAPIKey(c)
+	if key == nil || len(key.SessionIDs) == 0 {
+		return ids, nil
+	}
+	if ids == nil {
+		return key.SessionIDs, nil
+	}
+	allowed := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if key.AllowsSession(id) {
+			allowed = append(allowed, id)
+		}
+	}
+	return allowed, nil
+}
+
+// RequestRole returns the role of the caller of a request in a session
+func (s *SessionAccessService) RequestRole(c *gin.Context, sessionID string) string {
+	return s.Role(accessUserID(c), sessionID)
+}
+
+// acl returns who may do what in a session, loading it when not cached
+func (s *SessionAccessService) acl(sessionID string) (*sessionACL, error) {
+	s.mu.Lock()
+	acl, exists := s.acls[sessionID]
+	s.mu.Unlock()
+	if exists && time.Since(acl.loadedAt) < sessionACLTTL {
+		return acl, nil
+	}
+
+	owners, err := s.sessions.Owners([]string{sessionID})
+	if err != nil {
+		return nil, err
+	}
+	shares, err := s.shares.SessionRoles(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	acl = &sessionACL{shares: shares, loadedAt: time.Now()}
+	if owner, exists := owners[sessionID]; exists {
+		acl.owner = &owner
+	}
+
+	s.mu.Lock()
+	s.acls[sessionID] = acl
+	s.mu.Unlock()
+	return acl, nil
+}
+
+// forget drops the cached access to a session after it changed
+func (s *SessionAccessService) forget(sessionID string) {
+	s.mu.Lock()
+	delete(s.acls, sessionID)
+	listeners := s.listeners
+	s.mu.Unlock()
+
+	for _, listener := range listeners {
+		listener(sessionID)
+	}
+}
+
+// SetOwner records the user who started a session. userID is ignored unless it
+// is a user of this server.
+func (s *SessionAccessService) SetOwner(sessionID string, userID string) {
+	owner, err := uuid.Parse(userID)
+	if err != nil || owner == uuid.Nil {
+		return
+	}
+	if err := s.sessions.SetOwner(sessionID, owner); err != nil {
+		log.Printf("Failed to record owner of session %s: %v", sessionID, err)
+	}
+	s.forget(sessionID)
+}
+
+// Share gives the user with an email address a role in a session. Sharing
+// never changes who owns the session.
+func (s *SessionAccessService) Share(sessionID string, ownerID string, email string, role string) (*database.SessionShare, error) {
+	if !database.ValidShareRole(role) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidRole, role)
+	}
+	owner, err := uuid.Parse(ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: sharing needs a signed in user", ErrInvalidShare)
+	}
+	user, err := s.users.FindUserByEmail(email)
+	if err != nil {
+		return nil, err
+	}
+	if user.ID == owner {
+		return nil, fmt.Errorf("%w: sessions cannot be shared with their owner", ErrInvalidShare)
+	}
+
+	if _, err := s.sessions.LoadSession(sessionID); err != nil {
+		return nil, err
+	}
+	defer s.forget(sessionID)
+	return s.shares.ShareSession(sessionID, user.ID, role, &owner)
+}
+
+// Unshare takes a user's role in a session away; it applies at once
+func (s *SessionAccessService) Unshare(sessionID string, userID uuid.UUID) error {
+	defer s.forget(sessionID)
+	return s.shares.UnshareSession(sessionID, userID)
+}
+
+// Shares returns the owner of a session and who it is shared with
+func (s *SessionAccessService) Shares(sessionID string) (*uuid.UUID, []database.SessionShare, error) {
+	acl, err := s.acl(sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	shares, err := s.shares.ListShares(sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return acl.owner, shares, nil
+}
+
+// RequestAdmin reports whether the caller of a request is the server's admin.
+// Requests made while authentication is off act as the admin.
+func (s *SessionAccessService) RequestAdmin(c *gin.Context) bool {
+	userID := accessUserID(c)
+	if userID == "" {
+		return true
+	}
+	id, err := uuid.Parse(userID)
+	return err == nil && s.admin(id)
+}
+
+// RequireAdmin refuses requests from anyone but the server's admin, for routes
+// that manage the server rather than a session. API keys need the admin scope
+// on top, see authorizeKey. Without an access service every caller passes.
+func (s *SessionAccessService) RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s != nil && !s.RequestAdmin(c) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": ErrAdminRequired.Error()})
+			return
+		}
+		c.Next()
+	}
+}
+
+// Authorize refuses requests to sessions the caller has too low a role in.
+// Sessions the caller may not see at all look missing.
+func (s *SessionAccessService) Authorize() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if !strings.HasPrefix(route, "/api/v1/terminal/sessions/:id") {
+			c.Next()
+			return
+		}
+		required, listed := sessionRouteRoles[c.Request.Method+" "+route]
+		if !listed {
+			required = database.SessionRoleOwner
+		}
+		if err := checkRole(s.RequestRole(c, c.Param("id")), required); err != nil {
+			c.AbortWithStatusJSON(accessErrorStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.Next()
+	}
+}
+
+// checkRole fails unless role may do what required may
+func checkRole(role string, required string) error {
+	switch {
+	case role == "":
+		return ErrNoSessionAccess
+	case !database.RoleAtLeast(role, required):
+		return fmt.Errorf("%w: %s", ErrRoleRequired, required)
+	}
+	return nil
+}
+
+// accessErrorStatus maps session access errors to HTTP status codes
+func accessErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrNoSessionAccess), errors.Is(err, database.ErrSessionNotFound),
+		errors.Is(err, database.ErrShareNotFound), errors.Is(err, database.ErrUserNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrRoleRequired):
+		return http.StatusForbidden
+	case errors.Is(err, ErrInvalidRole), errors.Is(err, ErrInvalidShare):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
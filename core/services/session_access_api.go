@@ -0,0 +1,72 @@
+package services
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// SessionAccessAPIService provides REST API for sharing sessions
+type SessionAccessAPIService struct {
+	access *SessionAccessService
+}
+
+// NewSessionAccessAPIService creates a new session access API service
+func NewSessionAccessAPIService(access *SessionAccessService) *SessionAccessAPIService {
+	return &SessionAccessAPIService{access: access}
+}
+
+// ListShares returns the owner of a session and who it is shared with
+func (s *SessionAccessAPIService) ListShares(c *gin.Context) {
+	owner, shares, err := s.access.Shares(c.Param("id"))
+	if err != nil {
+		c.JSON(accessErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"owner_id": owner, "shares": shares})
+}
+
+// ShareSession gives a user, by email address, a role in a session
+func (s *SessionAccessAPIService) ShareSession(c *gin.Context) {
+	var req struct {
+		Email string `json:"email" binding:"required"`
+		Role  string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	share, err := s.access.Share(c.Param("id"), accessUserID(c), req.Email, req.Role)
+	if err != nil {
+		c.JSON(accessErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, share)
+}
+
+// UnshareSession takes a user's role in a session away
+func (s *SessionAccessAPIService) UnshareSession(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	if err := s.access.Unshare(c.Param("id"), userID); err != nil {
+		c.JSON(accessErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// RegisterRoutes registers session sharing API routes. Only owners reach them.
+func (s *SessionAccessAPIService) RegisterRoutes(router *gin.Engine) {
+	api := router.Group("/api/v1/terminal/sessions/:id/shares")
+	{
+		api.GET("", s.ListShares)
+		api.POST("", s.ShareSession)
+		api.DELETE("/:userId", s.UnshareSession)
+	}
+}
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/majiayu000/anywhere-ai/core/database"
+)
+
+func TestAuthorizeRoles(t *testing.T) {
+	s := newTestServer(t)
+	s.handle(http.MethodGet, "/api/v1/terminal/sessions/:id/output")
+	s.handle(http.MethodPost, "/api/v1/terminal/sessions/:id/messages")
+	s.handle(http.MethodPost, "/api/v1/terminal/sessions/:id/input")
+	s.handle(http.MethodDelete, "/api/v1/terminal/sessions/:id")
+	owner, ownerToken := s.user(t, "owner@example.com")
+	s.session(t, "shared", owner.ID)
+
+	tokens := map[string]string{database.SessionRoleOwner: ownerToken}
+	for _, role := range []string{database.SessionRoleViewer, database.SessionRoleCommenter, database.SessionRoleOperator} {
+		email := role + "@example.com"
+		_, token := s.user(t, email)
+		if _, err := s.access.Share("shared", owner.ID.String(), email, role); err != nil {
+			t.Fatalf("share with %s: %v", role, err)
+		}
+		tokens[role] = token
+	}
+	_, stranger := s.user(t, "stranger@example.com")
+	tokens[""] = stranger
+
+	routes := []struct {
+		method string
+		path   string
+		needs  string
+	}{
+		{http.MethodGet, "/api/v1/terminal/sessions/shared/output", database.SessionRoleViewer},
+		{http.MethodPost, "/api/v1/terminal/sessions/shared/messages", database.SessionRoleCommenter},
+		{http.MethodPost, "/api/v1/terminal/sessions/shared/input", database.SessionRoleOperator},
+		{http.MethodDelete, "/api/v1/terminal/sessions/shared", database.SessionRoleOwner},
+	}
+	for _, route := range routes {
+		for role, token := range tokens {
+			want := http.StatusOK
+			switch {
+			case role == "":
+				want = http.StatusNotFound
+			case !database.RoleAtLeast(role, route.needs):
+				want = http.StatusForbidden
+			}
+			if got := s.do(route.method, route.path, token); got != want {
+				t.Errorf("%s %s as %q: status = %d, want %d", route.method, route.path, role, got, want)
+			}
+		}
+	}
+}
+
+func TestAuthorizeUnshare(t *testing.T) {
+	s := newTestServer(t)
+	s.handle(http.MethodGet, "/api/v1/terminal/sessions/:id/output")
+	owner, _ := s.user(t, "owner@example.com")
+	viewer, token := s.user(t, "viewer@example.com")
+	s.session(t, "shared", owner.ID)
+
+	if _, err := s.access.Share("shared", owner.ID.String(), "viewer@example.com", database.SessionRoleViewer); err != nil {
+		t.Fatalf("share: %v", err)
+	}
+	if got := s.do(http.MethodGet, "/api/v1/terminal/sessions/shared/output", token); got != http.StatusOK {
+		t.Fatalf("shared: status = %d, want %d", got, http.StatusOK)
+	}
+	if err := s.access.Unshare("shared", viewer.ID); err != nil {
+		t.Fatalf("unshare: %v", err)
+	}
+	if got := s.do(http.MethodGet, "/api/v1/terminal/sessions/shared/output", token); got != http.StatusNotFound {
+		t.Errorf("unshared: status = %d, want %d", got, http.StatusNotFound)
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	s := newTestServer(t)
+	s.router.POST("/api/v1/devices/invites", s.access.RequireAdmin(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	_, admin := s.user(t, "admin@example.com")
+	_, other := s.user(t, "other@example.com")
+	s.access.SetAdmin("admin@example.com")
+
+	if got := s.do(http.MethodPost, "/api/v1/devices/invites", admin); got != http.StatusOK {
+		t.Errorf("admin: status = %d, want %d", got, http.StatusOK)
+	}
+	if got := s.do(http.MethodPost, "/api/v1/devices/invites", other); got != http.StatusForbidden {
+		t.Errorf("other user: status = %d, want %d", got, http.StatusForbidden)
+	}
+}
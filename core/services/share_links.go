@@ -0,0 +1,393 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/majiayu000/anywhere-ai/core/auth"
+	"github.com/majiayu000/anywhere-ai/core/database"
+	"github.com/majiayu000/anywhere-ai/core/redact"
+)
+
+// Lifetimes of share links
+const (
+	DefaultShareLinkTTL = 24 * time.Hour
+	MaxShareLinkTTL     = 7 * 24 * time.Hour
+)
+
+// ErrInvalidShareLink is returned when a share link cannot be created as asked
+var ErrInvalidShareLink = errors.New("invalid share link")
+
+// shareOpenTimeout is how long a share viewer has to send its token once connected
+const shareOpenTimeout = 10 * time.Second
+
+// shareOpenFrame is the first frame a share viewer sends. The token comes in
+// it rather than in the URL, so it never shows up in request logs.
+type shareOpenFrame struct {
+	Action string `json:"action"`
+	Token  string `json:"token"`
+}
+
+// shareLinkActions are the only WebSocket actions share link viewers receive
+var shareLinkActions = map[string]bool{
+	"messages":   true,
+	"newMessage": true,
+	"output":     true,
+	"typing":     true,
+	"stopTyping": true,
+}
+
+// ShareLinkService issues expiring read-only links to watch a session without
+// an account, and serves their viewers
+type ShareLinkService struct {
+	links     *database.ShareRepository
+	sessions  *database.SessionRepository
+	wsService *TerminalWebSocketService
+	strict    *redact.Redactor
+}
+
+// NewShareLinkService creates a new share link service
+func NewShareLinkService(links *database.ShareRepository, sessions *database.SessionRepository, wsService *TerminalWebSocketService) *ShareLinkService {
+	return &ShareLinkService{
+		links:     links,
+		sessions:  sessions,
+		wsService: wsService,
+		strict:    redact.Strict(),
+	}
+}
+
+// Create issues a share link to a session. The token is returned only here;
+// only its hash is stored.
+func (s *ShareLinkService) Create(sessionID string, userID string, ttl time.Duration, level string) (*database.ShareLink, string, error) {
+	if ttl == 0 {
+		ttl = DefaultShareLinkTTL
+	}
+	if ttl < 0 || ttl > MaxShareLinkTTL {
+		return nil, "", fmt.Errorf("%w: links expire after at most %s", ErrInvalidShareLink, MaxShareLinkTTL)
+	}
+	if level == "" {
+		level = database.ShareRedactionSecrets
+	}
+	if !validRedactionLevel(level) {
+		return nil, "", fmt.Errorf("%w: unknown redaction level %s", ErrInvalidShareLink, level)
+	}
+	if _, err := s.sessions.LoadSession(sessionID); err != nil {
+		return nil, "", err
+	}
+
+	token, err := auth.GenerateShareToken()
+	if err != nil {
+		return nil, "", err
+	}
+	link := &database.ShareLink{
+		SessionID:      sessionID,
+		TokenHash:      auth.HashAPIKey(token),
+		TokenPrefix:    auth.APIKeyPrefix(token),
+		RedactionLevel: level,
+		ExpiresAt:      time.Now().Add(ttl),
+	}
+	if creator, err := uuid.Parse(userID); err == nil {
+		link.CreatedBy = &creator
+	}
+	if err := s.links.CreateShareLink(link); err != nil {
+		return nil, "", err
+	}
+	return link, token, nil
+}
+
+// List returns the share links of a session
+func (s *ShareLinkService) List(sessionID string) ([]database.ShareLink, error) {
+	return s.links.ListShareLinks(sessionID)
+}
+
+// Revoke revokes a share link, disconnecting its viewers at once
+func (s *ShareLinkService) Revoke(sessionID string, linkID uuid.UUID) (*database.ShareLink, error) {
+	link, err := s.links.RevokeShareLink(sessionID, linkID)
+	if err != nil {
+		return nil, err
+	}
+	s.wsService.CloseShareLink(link.ID)
+	return link, nil
+}
+
+// Open returns the usable share link behind a token
+func (s *ShareLinkService) Open(token string) (*database.ShareLink, error) {
+	return s.links.FindShareLink(auth.HashAPIKey(token))
+}
+
+// Session returns the name of the session a link shares
+func (s *ShareLinkService) Session(link *database.ShareLink) (string, error) {
+	state, err := s.sessions.LoadSession(link.SessionID)
+	if err != nil {
+		return "", err
+	}
+	return state.Name, nil
+}
+
+// Serve streams the session of a share link to a WebSocket viewer, once it
+// sent the link's token in an open frame. Unknown, revoked and expired links
+// all close the connection the same way.
+func (s *ShareLinkService) Serve(c *gin.Context) {
+	conn, err := s.wsService.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("WebSocket upgrade failed: %v", err)
+		return
+	}
+
+	link, err := s.openFrame(conn)
+	if err != nil {
+		code, reason := websocket.ClosePolicyViolation, "Share link not found or expired"
+		if shareLinkErrorStatus(err) == http.StatusInternalServerError {
+			log.Printf("Failed to open share link: %v", err)
+			code, reason = websocket.CloseInternalServerErr, "Internal error"
+		}
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(time.Second))
+		conn.Close()
+		return
+	}
+
+	view := &shareView{link: link}
+	if link.RedactionLevel != database.ShareRedactionSecrets {
+		view.redactor = s.strict
+	}
+	s.wsService.serveShareView(conn, view)
+}
+
+// openFrame reads the open frame of a share viewer and returns its link
+func (s *ShareLinkService) openFrame(conn *websocket.Conn) (*database.ShareLink, error) {
+	conn.SetReadDeadline(time.Now().Add(shareOpenTimeout))
+	var frame shareOpenFrame
+	if err := conn.ReadJSON(&frame); err != nil || frame.Action != "open" || frame.Token == "" {
+		return nil, fmt.Errorf("%w: expected an open frame with the token", ErrInvalidShareLink)
+	}
+	return s.Open(frame.Token)
+}
+
+// validRedactionLevel reports whether a share link redaction level exists
+func validRedactionLevel(level string) bool {
+	for _, known := range database.ShareRedactionLevels {
+		if level == known {
+			return true
+		}
+	}
+	return false
+}
+
+// shareView is what the viewer of a share link may see
+type shareView struct {
+	link     *database.ShareLink
+	redactor *redact.Redactor // Applied on top of secret redaction; nil for none
+}
+
+// frame returns a WebSocket frame as the viewer may see it, or false when the
+// viewer may not see it at all
+func (v *shareView) frame(message []byte) ([]byte, bool) {
+	var msg map[string]interface{}
+	if err := json.Unmarshal(message, &msg); err != nil {
+		return nil, false
+	}
+	action, _ := msg["action"].(string)
+	sessionID, _ := msg["sessionId"].(string)
+	if !shareLinkActions[action] || sessionID != v.link.SessionID {
+		return nil, false
+	}
+	if action == "output" && v.link.RedactionLevel == database.ShareRedactionConversation {
+		return nil, false
+	}
+
+	if output, ok := msg["output"].(string); ok && v.redactor != nil {
+		msg["output"], _ = v.redactor.Redact(output)
+	}
+	switch data := msg["data"].(type) {
+	case map[string]interface{}:
+		v.redactMessage(data)
+	case []interface{}:
+		for _, item := range data {
+			if message, ok := item.(map[string]interface{}); ok {
+				v.redactMessage(message)
+			}
+		}
+	}
+	framed, err := json.Marshal(msg)
+	if err != nil {
+		return nil, false
+	}
+	return framed, true
+}
+
+// redactMessage masks a message as the viewer may see it. Diffs and metadata
+// are left out rather than masked, at every level: secret redaction cannot
+// tell what else a diff of the working tree or tool metadata reveals.
+func (v *shareView) redactMessage(message map[string]interface{}) {
+	if content, ok := message["content"].(string); ok && v.redactor != nil {
+		message["content"], _ = v.redactor.Redact(content)
+	}
+	delete(message, "git_diff")
+	delete(message, "metadata")
+}
+
+// serveShareView upgrades a request to a WebSocket that streams a shared
+// session read-only. Share viewers never join input control and nothing they
+// send reaches the session.
+func (s *TerminalWebSocketService) serveShareView(conn *websocket.Conn, view *shareView) {
+	client := &WebSocketClient{
+		id:          uuid.New().String(),
+		hub:         s.hub,
+		conn:        conn,
+		send:        make(chan []byte, 256),
+		sessionID:   view.link.SessionID,
+		share:       view,
+		connectedAt: time.Now(),
+		deviceName:  "Share link " + view.link.TokenPrefix,
+		deviceType:  "share",
+	}
+	client.reader = database.Reader{UserID: "share:" + view.link.ID.String(), DeviceID: client.id}
+	client.hub.register <- client
+
+	s.sendTo(client, WebSocketMessage{
+		Action:    "connected",
+		SessionID: view.link.SessionID,
+		Type:      "status",
+		Data: gin.H{
+			"client_id":       client.id,
+			"redaction_level": view.link.RedactionLevel,
+			"expires_at":      view.link.ExpiresAt,
+		},
+	})
+	s.BroadcastPresence(s.presence.Join(view.link.SessionID, client))
+	s.sendShareMessages(client)
+
+	go client.writePump()
+	go client.sharePump(s)
+}
+
+// sendShareMessages sends a share viewer the messages of its session
+func (s *TerminalWebSocketService) sendShareMessages(client *WebSocketClient) {
+	messages, err := s.messageService.GetMessages(context.Background(), client.sessionID, 100, 0)
+	if err != nil {
+		log.Printf("Failed to get messages: %v", err)
+		return
+	}
+	data, _ := json.Marshal(WebSocketMessage{
+		Action:    "messages",
+		SessionID: client.sessionID,
+		Type:      "message",
+		Data:      messages,
+	})
+	if framed, ok := client.share.frame(data); ok {
+		select {
+		case client.send <- framed:
+		default:
+			// Client buffer full
+		}
+	}
+}
+
+// sharePump reads from a share viewer until it leaves or its link expires,
+// streaming terminal output to it meanwhile. Viewers may only ask for the
+// messages again.
+func (c *WebSocketClient) sharePump(s *TerminalWebSocketService) {
+	ctx, cancel := context.WithCancel(context.Background())
+	expiry := time.AfterFunc(time.Until(c.share.link.ExpiresAt), func() {
+		c.conn.Close()
+	})
+	defer func() {
+		expiry.Stop()
+		cancel()
+		if presence := s.presence.Leave(c.sessionID, c); presence != nil {
+			s.BroadcastPresence(presence)
+		}
+		c.hub.unregister <- c
+		c.conn.Close()
+	}()
+
+	if c.share.link.RedactionLevel != database.ShareRedactionConversation {
+		go s.streamShareOutput(ctx, c)
+	}
+
+	c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	c.conn.SetPongHandler(func(string) error {
+		c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		return nil
+	})
+
+	for {
+		_, message, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				log.Printf("WebSocket error: %v", err)
+			}
+			return
+		}
+
+		var msg WebSocketMessage
+		if err := json.Unmarshal(message, &msg); err != nil {
+			continue
+		}
+		switch msg.Action {
+		case "getMessages", "selectSession":
+			s.sendShareMessages(c)
+		default:
+			s.sendTo(c, WebSocketMessage{
+				Action:    "forbidden",
+				SessionID: c.sessionID,
+				Type:      "status",
+				Data:      gin.H{"error": "Share links are read-only"},
+			})
+		}
+	}
+}
+
+// streamShareOutput sends a share viewer the terminal output of its session
+// whenever it changes. Each viewer polls on its own, so watching through a
+// link never disturbs the output stream of the session's other viewers.
+func (s *TerminalWebSocketService) streamShareOutput(ctx context.Context, c *WebSocketClient) {
+	lastOutput := ""
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			output, err := s.CaptureOutput(ctx, c.sessionID)
+			if err != nil || output == lastOutput {
+				continue
+			}
+			lastOutput = output
+
+			data, _ := json.Marshal(WebSocketMessage{
+				Action:    "output",
+				SessionID: c.sessionID,
+				Output:    output,
+			})
+			if framed, ok := c.share.frame(data); ok {
+				select {
+				case c.send <- framed:
+				default:
+					// Client buffer full, skip
+				}
+			}
+		}
+	}
+}
+
+// CloseShareLink disconnects every viewer of a share link
+func (s *TerminalWebSocketService) CloseShareLink(linkID uuid.UUID) {
+	s.hub.mu.RLock()
+	defer s.hub.mu.RUnlock()
+	for client := range s.hub.clients {
+		if client.share != nil && client.share.link.ID == linkID {
+			client.conn.Close()
+		}
+	}
+}
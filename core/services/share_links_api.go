@@ -0,0 +1,176 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/majiayu000/anywhere-ai/core/database"
+)
+
+// ShareTokenHeader carries the token of a share link to the share routes
+const ShareTokenHeader = "X-Share-Token"
+
+// ShareLinkAPIService provides REST API for share links, and the endpoints
+// their viewers reach without an account
+type ShareLinkAPIService struct {
+	links     *ShareLinkService
+	auth      *AuthService
+	publicURL string
+}
+
+// NewShareLinkAPIService creates a new share link API service
+func NewShareLinkAPIService(links *ShareLinkService, authService *AuthService) *ShareLinkAPIService {
+	return &ShareLinkAPIService{links: links, auth: authService}
+}
+
+// SetPublicURL sets the URL share links point to; by default, the one the
+// link was created through
+func (s *ShareLinkAPIService) SetPublicURL(publicURL string) {
+	s.publicURL = strings.TrimRight(publicURL, "/")
+}
+
+// CreateShareLink issues a share link to a session. The response is the only
+// time the link is shown.
+func (s *ShareLinkAPIService) CreateShareLink(c *gin.Context) {
+	var req struct {
+		ExpiresIn      string `json:"expires_in"` // Duration such as "2h"; a day by default
+		RedactionLevel string `json:"redaction_level"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var ttl time.Duration
+	if req.ExpiresIn != "" {
+		parsed, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid expires_in"})
+			return
+		}
+		ttl = parsed
+	}
+
+	link, token, err := s.links.Create(c.Param("id"), accessUserID(c), ttl, req.RedactionLevel)
+	if err != nil {
+		c.JSON(shareLinkErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"link": link, "token": token, "url": s.linkURL(c, token)})
+}
+
+// linkURL returns the page that watches a share link. The token is in the
+// fragment, so browsers never send it to servers or in referrers.
+func (s *ShareLinkAPIService) linkURL(c *gin.Context, token string) string {
+	base := s.publicURL
+	if base == "" {
+		scheme := "http"
+		if c.Request.TLS != nil {
+			scheme = "https"
+		}
+		base = scheme + "://" + c.Request.Host
+	}
+	return base + "/share#" + token
+}
+
+// ListShareLinks lists the share links of a session; tokens are never shown again
+func (s *ShareLinkAPIService) ListShareLinks(c *gin.Context) {
+	links, err := s.links.List(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"links": links})
+}
+
+// RevokeShareLink revokes a share link; its viewers are disconnected at once
+func (s *ShareLinkAPIService) RevokeShareLink(c *gin.Context) {
+	linkID, err := uuid.Parse(c.Param("linkId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid link ID"})
+		return
+	}
+
+	link, err := s.links.Revoke(c.Param("id"), linkID)
+	if err != nil {
+		c.JSON(shareLinkErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, link)
+}
+
+// GetSharedSession describes the session behind a share link to its viewer
+func (s *ShareLinkAPIService) GetSharedSession(c *gin.Context) {
+	link, ok := s.open(c)
+	if !ok {
+		return
+	}
+	name, err := s.links.Session(link)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found or expired"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"session_id":      link.SessionID,
+		"name":            name,
+		"redaction_level": link.RedactionLevel,
+		"expires_at":      link.ExpiresAt,
+	})
+}
+
+// WatchSharedSession streams the session behind a share link over a WebSocket.
+// Browsers cannot set headers on WebSockets, so the token comes in the first frame.
+func (s *ShareLinkAPIService) WatchSharedSession(c *gin.Context) {
+	s.links.Serve(c)
+}
+
+// open returns the usable share link of a request, from its X-Share-Token
+// header. Unknown, revoked and expired links all look the same to viewers.
+func (s *ShareLinkAPIService) open(c *gin.Context) (*database.ShareLink, bool) {
+	link, err := s.links.Open(c.GetHeader(ShareTokenHeader))
+	if err != nil {
+		status := shareLinkErrorStatus(err)
+		if status == http.StatusInternalServerError {
+			c.JSON(status, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Share link not found or expired"})
+		}
+		return nil, false
+	}
+	return link, true
+}
+
+// shareLinkErrorStatus maps share link errors to HTTP status codes
+func shareLinkErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidShareLink):
+		return http.StatusBadRequest
+	case errors.Is(err, database.ErrShareLinkNotFound), errors.Is(err, database.ErrSessionNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, database.ErrShareLinkRevoked), errors.Is(err, database.ErrShareLinkExpired):
+		return http.StatusGone
+	}
+	return http.StatusInternalServerError
+}
+
+// RegisterRoutes registers share link API routes. Only owners of a session
+// manage its links; viewers reach the share routes without an account. The
+// token is never part of a share route, so it stays out of request logs.
+func (s *ShareLinkAPIService) RegisterRoutes(router *gin.Engine) {
+	links := router.Group("/api/v1/terminal/sessions/:id/links")
+	{
+		links.GET("", s.ListShareLinks)
+		links.POST("", s.CreateShareLink)
+		links.DELETE("/:linkId", s.RevokeShareLink)
+	}
+
+	share := router.Group("/api/v1/share")
+	{
+		share.GET("", s.GetSharedSession)
+		share.GET("/ws", s.WatchSharedSession)
+	}
+	s.auth.AllowAnonymous("/api/v1/share", "/api/v1/share/ws")
+}
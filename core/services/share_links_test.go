@@ -0,0 +1,105 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/majiayu000/anywhere-ai/core/database"
+)
+
+func TestSharedSessionTokens(t *testing.T) {
+	s := newTestServer(t)
+	owner, _ := s.user(t, "owner@example.com")
+	s.session(t, "shared", owner.ID)
+
+	links := NewShareLinkService(database.NewShareRepository(s.db), database.NewSessionRepository(s.db), NewTerminalWebSocketService(nil, nil))
+	NewShareLinkAPIService(links, s.auth).RegisterRoutes(s.router)
+
+	_, valid, err := links.Create("shared", owner.ID.String(), time.Hour, "")
+	if err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+	expired, expiredToken, err := links.Create("shared", owner.ID.String(), time.Hour, "")
+	if err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+	if err := s.db.Model(expired).Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatalf("expire link: %v", err)
+	}
+	revoked, revokedToken, err := links.Create("shared", owner.ID.String(), time.Hour, "")
+	if err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+	if _, err := links.Revoke("shared", revoked.ID); err != nil {
+		t.Fatalf("revoke link: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"valid", valid, http.StatusOK},
+		{"expired", expiredToken, http.StatusNotFound},
+		{"revoked", revokedToken, http.StatusNotFound},
+		{"wrong", valid[:len(valid)-4] + "0000", http.StatusNotFound},
+		{"missing", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/share", nil)
+			if tt.token != "" {
+				req.Header.Set(ShareTokenHeader, tt.token)
+			}
+			rec := httptest.NewRecorder()
+			s.router.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+
+	server := httptest.NewServer(s.router)
+	defer server.Close()
+	for _, tt := range tests {
+		if tt.want == http.StatusOK {
+			continue
+		}
+		t.Run("watch "+tt.name, func(t *testing.T) {
+			conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/v1/share/ws", nil)
+			if err != nil {
+				t.Fatalf("dial: %v", err)
+			}
+			defer conn.Close()
+			if err := conn.WriteJSON(shareOpenFrame{Action: "open", Token: tt.token}); err != nil {
+				t.Fatalf("send open frame: %v", err)
+			}
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			_, _, err = conn.ReadMessage()
+			if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+				t.Errorf("read = %v, want close %d", err, websocket.ClosePolicyViolation)
+			}
+		})
+	}
+}
+
+func TestShareLinkTokenIsNotASessionToken(t *testing.T) {
+	s := newTestServer(t)
+	s.handle(http.MethodGet, "/api/v1/terminal/sessions/:id/output")
+	owner, _ := s.user(t, "owner@example.com")
+	s.session(t, "shared", owner.ID)
+
+	links := NewShareLinkService(database.NewShareRepository(s.db), database.NewSessionRepository(s.db), NewTerminalWebSocketService(nil, nil))
+	_, token, err := links.Create("shared", owner.ID.String(), time.Hour, "")
+	if err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+
+	if got := s.do(http.MethodGet, "/api/v1/terminal/sessions/shared/output", token); got != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", got, http.StatusUnauthorized)
+	}
+}
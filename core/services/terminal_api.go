@@ -1,62 +1,188 @@
 package services
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"os/exec"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"github.com/majiayu000/anywhere-ai/core/database"
+	"github.com/majiayu000/anywhere-ai/core/terminal"
 	"github.com/majiayu000/anywhere-ai/core/tmux"
 )
 
+// maxMessagesPage is the most messages returned by one request
+const maxMessagesPage = 500
+
 // TerminalAPIService provides REST API for terminal management
 type TerminalAPIService struct {
-	tmuxManager    *tmux.Manager
-	wsService      *TerminalWebSocketService
-	claudeMonitor  *ClaudeMonitor
-	jsonlMonitor   *JSONLMonitor
-	messageService *MessageService
+	tmuxManager     *tmux.Manager
+	wsService       *TerminalWebSocketService
+	claudeMonitor   *ClaudeMonitor
+	jsonlMonitor    *JSONLMonitor
+	launcher        *ToolLauncher
+	messageService  *MessageService
+	inputQueue      *InputQueue
+	gitTracker      *GitTracker
+	attachmentStore *AttachmentStore
+	sessionStore    *database.SessionRepository
+	migrations      *MigrationService
+	checkpoints     *CheckpointService
+	remote          *RemoteSessionService
+	leases          *LeaseService
+	access          *SessionAccessService
+
+	// This host, as recorded in the session store
+	deviceID   string
+	deviceName string
 }
 
 // NewTerminalAPIService creates a new terminal API service
-func NewTerminalAPIService(tmuxManager *tmux.Manager, wsService *TerminalWebSocketService, claudeMonitor *ClaudeMonitor, jsonlMonitor *JSONLMonitor, messageService *MessageService) *TerminalAPIService {
+func NewTerminalAPIService(tmuxManager *tmux.Manager, wsService *TerminalWebSocketService, claudeMonitor *ClaudeMonitor, jsonlMonitor *JSONLMonitor, messageService *MessageService, inputQueue *InputQueue, gitTracker *GitTracker, attachmentStore *AttachmentStore, sessionStore *database.SessionRepository) *TerminalAPIService {
+	deviceID, deviceName := terminal.LocalDevice()
 	return &TerminalAPIService{
-		tmuxManager:    tmuxManager,
-		wsService:      wsService,
-		claudeMonitor:  claudeMonitor,
-		jsonlMonitor:   jsonlMonitor,
-		messageService: messageService,
+		tmuxManager:     tmuxManager,
+		wsService:       wsService,
+		claudeMonitor:   claudeMonitor,
+		jsonlMonitor:    jsonlMonitor,
+		launcher:        NewToolLauncher(tmuxManager, claudeMonitor, jsonlMonitor),
+		messageService:  messageService,
+		inputQueue:      inputQueue,
+		gitTracker:      gitTracker,
+		attachmentStore: attachmentStore,
+		sessionStore:    sessionStore,
+		deviceID:        deviceID,
+		deviceName:      deviceName,
+	}
+}
+
+// SetMigrationService sets the service whose handovers block input to a session
+func (s *TerminalAPIService) SetMigrationService(migrations *MigrationService) {
+	s.migrations = migrations
+}
+
+// SetCheckpointService sets the service that checkpoints sessions before
+// approvals and forgets their checkpoints on deletion
+func (s *TerminalAPIService) SetCheckpointService(checkpoints *CheckpointService) {
+	s.checkpoints = checkpoints
+}
+
+// SetRemoteSessionService sets the service that lists and proxies sessions of
+// paired devices
+func (s *TerminalAPIService) SetRemoteSessionService(remote *RemoteSessionService) {
+	s.remote = remote
+}
+
+// SetLeaseService sets the service that refuses input to sessions leased by
+// another device
+func (s *TerminalAPIService) SetLeaseService(leases *LeaseService) {
+	s.leases = leases
+}
+
+// SetSessionAccess sets the service that decides who may see sessions
+func (s *TerminalAPIService) SetSessionAccess(access *SessionAccessService) {
+	s.access = access
+}
+
+// role returns the caller's role in a session, or "" when they may not see it
+func (s *TerminalAPIService) role(c *gin.Context, sessionID string) string {
+	if !sessionVisible(c, sessionID) {
+		return ""
+	}
+	if s.access == nil {
+		return database.SessionRoleOwner
+	}
+	return s.access.RequestRole(c, sessionID)
+}
+
+// visibleSessions keeps the local sessions the caller may see
+func (s *TerminalAPIService) visibleSessions(c *gin.Context, sessions []*tmux.Session) []*tmux.Session {
+	visible := make([]*tmux.Session, 0, len(sessions))
+	for _, session := range sessions {
+		if s.role(c, session.ID) != "" {
+			visible = append(visible, session)
+		}
 	}
+	return visible
+}
+
+// migrating reports whether a session is being handed over to another host
+func (s *TerminalAPIService) migrating(sessionID string) bool {
+	return s.migrations != nil && s.migrations.InProgress(sessionID)
+}
+
+// leasedElsewhere fails when another device holds the lease of a session
+func (s *TerminalAPIService) leasedElsewhere(sessionID string) error {
+	if s.leases == nil {
+		return nil
+	}
+	return s.leases.CheckWriter(sessionID)
 }
 
 // CreateSessionRequest represents a session creation request
 type CreateSessionAPIRequest struct {
 	Tool string `json:"tool" binding:"required"`
 	Name string `json:"name"`
+	Host string `json:"host"` // Paired device to start the session on, this one by default
 }
 
 // SessionResponse represents a session in API responses
 type SessionResponse struct {
-	ID     string    `json:"id"`
-	Name   string    `json:"name"`
-	Tool   string    `json:"tool"`
-	Status string    `json:"status"`
-	Created time.Time `json:"created"`
+	ID                string    `json:"id"`
+	Name              string    `json:"name"`
+	Tool              string    `json:"tool"`
+	Status            string    `json:"status"`
+	Created           time.Time `json:"created"`
+	UnreadMessages    int64     `json:"unread_messages"`
+	RequiresUserInput bool      `json:"requires_user_input"`
+
+	// Host running the session
+	DeviceID   string `json:"device_id"`
+	DeviceName string `json:"device_name"`
+	Remote     bool   `json:"remote"`
+
+	// Ownership of the session, as recorded by its host
+	Lease *LeaseResponse `json:"lease,omitempty"`
+
+	// What the caller may do in the session: owner, operator, commenter or viewer
+	Role string `json:"role,omitempty"`
 }
 
 // CreateSession creates a new terminal session
 func (s *TerminalAPIService) CreateSession(c *gin.Context) {
 	var req CreateSessionAPIRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
 
+	// Start it on another device by handing the request over. A paired device
+	// handing it over already picked this one.
+	if req.Host != "" && req.Host != s.deviceID && pairedDevice(c) == nil {
+		if s.remote == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Cannot start sessions on %s from here", req.Host)})
+			return
+		}
+		device, err := s.remote.Device(req.Host)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		body, _ := c.Get(gin.BodyBytesKey)
+		c.Request.Body = io.NopCloser(bytes.NewReader(body.([]byte)))
+		s.remote.Proxy(c, device)
+		return
+	}
+
 	// Validate tool
 	validTools := map[string]bool{
 		"claude":  true,
@@ -89,96 +215,242 @@ func (s *TerminalAPIService) CreateSession(c *gin.Context) {
 		}
 	}
 
+	// Record the session so the CLI and other devices can see it
+	s.recordSession(ctx, session)
+	if s.access != nil {
+		s.access.SetOwner(session.ID, accessUserID(c))
+	}
+
+	// Record the repository state the session starts from
+	if err := s.gitTracker.StartSession(ctx, session.ID); err != nil {
+		log.Printf("Failed to start git tracking for session %s: %v", session.ID, err)
+	}
+
 	// Start the actual tool in the tmux session
-	toolCmd := ""
-	switch req.Tool {
-	case "claude":
-		// Start Claude Code CLI directly without proxy
-		toolCmd = `claude`
-	case "gemini":
-		// Try to start Gemini CLI
-		toolCmd = "gemini || echo 'Gemini not installed. Install Gemini CLI first.'"
-	case "cursor":
-		// Try to start Cursor CLI
-		toolCmd = "cursor --cli || echo 'Cursor not installed. Install Cursor IDE first.'"
-	case "copilot":
-		// Try to start GitHub Copilot CLI
-		toolCmd = "gh copilot || echo 'GitHub Copilot CLI not installed. Install with: gh extension install github/gh-copilot'"
-	default:
-		// Start a plain shell
-		toolCmd = "echo 'Starting shell session...'"
+	if err := s.launcher.Launch(ctx, session.ID, req.Tool); err != nil {
+		log.Printf("Failed to launch %s in session %s: %v", req.Tool, session.ID, err)
 	}
-	
-	// Send initial command to tmux session
-	if toolCmd != "" {
-		s.tmuxManager.SendCommand(ctx, session.ID, toolCmd)
-		
-		// For Claude, start JSONL monitoring only (more precise)
-		if req.Tool == "claude" {
-			// JSONL monitoring provides precise message extraction
-			if s.jsonlMonitor != nil {
-				go func() {
-					// Wait for Claude to create JSONL file
-					time.Sleep(2 * time.Second)
-					if err := s.jsonlMonitor.StartMonitoring(session.ID); err != nil {
-						log.Printf("Failed to start JSONL monitoring: %v", err)
-						// Fallback to tmux monitoring
-						if s.claudeMonitor != nil {
-							s.claudeMonitor.StartMonitoring(session.ID)
-							log.Printf("Started fallback tmux monitoring for session %s", session.ID)
-						}
-					} else {
-						log.Printf("Started JSONL monitoring for session %s", session.ID)
-					}
-				}()
+
+	c.JSON(http.StatusOK, SessionResponse{
+		ID:         session.ID,
+		Name:       session.Name,
+		Tool:       req.Tool,
+		Status:     session.Status,
+		Created:    session.Created,
+		DeviceID:   s.deviceID,
+		DeviceName: s.deviceName,
+		Role:       database.SessionRoleOwner,
+	})
+}
+
+// recordSession saves a session created by this server to the session store
+func (s *TerminalAPIService) recordSession(ctx context.Context, session *tmux.Session) {
+	workingDir, _ := s.tmuxManager.GetWorkingDir(ctx, session.ID)
+	now := time.Now()
+	state := &terminal.SessionState{
+		ID:              session.ID,
+		Name:            session.Name,
+		CreatedAt:       session.Created,
+		UpdatedAt:       now,
+		OwnerDeviceID:   s.deviceID,
+		OwnerDeviceName: s.deviceName,
+		CurrentDeviceID: s.deviceID,
+		LastHeartbeat:   now,
+		LeaseExpiresAt:  now.Add(s.sessionStore.LeaseTTL()),
+		WorkingDir:      workingDir,
+		ToolName:        session.Tool,
+		Status:          terminal.SessionStatusRunning,
+	}
+	if err := s.sessionStore.SaveSession(state); err != nil {
+		log.Printf("Failed to record session %s: %v", session.ID, err)
+	}
+}
+
+// storedSession loads the stored state of a session running on this host. A
+// session adopted from tmux without a stored state is recorded first, so rows
+// that reference it can be written.
+func storedSession(store *database.SessionRepository, tmuxManager *tmux.Manager, sessionID, deviceID, deviceName string) (*terminal.SessionState, error) {
+	state, err := store.LoadSession(sessionID)
+	if !errors.Is(err, database.ErrSessionNotFound) {
+		return state, err
+	}
+
+	session, err := tmuxManager.GetSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	state = &terminal.SessionState{
+		ID:              sessionID,
+		Name:            session.Name,
+		CreatedAt:       session.Created,
+		UpdatedAt:       now,
+		OwnerDeviceID:   deviceID,
+		OwnerDeviceName: deviceName,
+		CurrentDeviceID: deviceID,
+		LastHeartbeat:   now,
+		LeaseExpiresAt:  now.Add(store.LeaseTTL()),
+		ToolName:        session.Tool,
+		Status:          terminal.SessionStatusRunning,
+	}
+	if err := store.SaveSession(state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// syncStoredSessions reconciles the session store with tmux on this host. Live
+// sessions recorded by another entry point, such as the CLI, are adopted so the
+// rest of the API can reach them; recorded sessions whose tmux session has gone
+// are marked stopped. Sessions leased by another device run there and are left
+// alone.
+func (s *TerminalAPIService) syncStoredSessions(ctx context.Context) {
+	states, err := s.sessionStore.ListSessions(terminal.SessionFilter{
+		DeviceID:    s.deviceID,
+		IncludeDead: true,
+	})
+	if err != nil {
+		log.Printf("Failed to list stored sessions: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for _, state := range states {
+		// Migrated sessions run elsewhere, migrating ones are handled by MigrationService
+		switch state.Status {
+		case terminal.SessionStatusStopped, terminal.SessionStatusMigrating, terminal.SessionStatusMigrated:
+			continue
+		}
+		if lease := state.Lease(); lease.DeviceID != s.deviceID && lease.State(now) == terminal.LeaseStateHeld {
+			continue
+		}
+
+		if !s.tmuxManager.HasSession(ctx, state.ID) {
+			if err := s.sessionStore.UpdateStatus(state.ID, terminal.SessionStatusStopped); err != nil {
+				log.Printf("Failed to mark session %s stopped: %v", state.ID, err)
+			}
+			continue
+		}
+
+		// The heartbeat takes the lease before the session is adopted
+		if err := s.sessionStore.UpdateHeartbeat(state.ID, s.deviceID); err != nil {
+			log.Printf("Failed to update heartbeat for session %s: %v", state.ID, err)
+			continue
+		}
+		if _, err := s.tmuxManager.GetSession(state.ID); err != nil {
+			if err := adoptSession(ctx, s.tmuxManager, state); err != nil {
+				log.Printf("Failed to adopt session %s: %v", state.ID, err)
+				continue
 			}
-			
-			go func() {
-				time.Sleep(3 * time.Second) // Wait for Claude to start
-				// Send Tab key to bypass permissions
-				exec.Command("tmux", "send-keys", "-t", session.ID, "Tab").Run()
-			}()
+			log.Printf("Adopted session %s from the session store", state.ID)
 		}
 	}
+}
 
-	c.JSON(http.StatusOK, SessionResponse{
-		ID:      session.ID,
-		Name:    session.Name,
-		Tool:    req.Tool,
-		Status:  session.Status,
-		Created: session.Created,
+// adoptSession makes a manager track a live tmux session recorded in the store
+func adoptSession(ctx context.Context, tmuxManager *tmux.Manager, state *terminal.SessionState) error {
+	return tmuxManager.RestoreSession(ctx, &tmux.Session{
+		ID:         state.ID,
+		Name:       state.Name,
+		Tool:       state.ToolName,
+		Created:    state.CreatedAt,
+		LastActive: state.UpdatedAt,
+		Status:     "active",
+		DeviceID:   state.OwnerDeviceID,
+		DeviceName: state.OwnerDeviceName,
 	})
 }
 
 // ListSessions lists all active sessions
 func (s *TerminalAPIService) ListSessions(c *gin.Context) {
 	ctx := context.Background()
+	s.syncStoredSessions(ctx)
 	sessions, err := s.tmuxManager.ListSessions(ctx)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list sessions"})
 		return
 	}
 
-	response := []SessionResponse{}
+	sessions = s.visibleSessions(c, sessions)
+	sessionIDs := make([]string, 0, len(sessions))
 	for _, session := range sessions {
+		sessionIDs = append(sessionIDs, session.ID)
+	}
+	inbox, err := s.messageService.GetInboxSummary(ctx, readerFromRequest(c), sessionIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get read state: %v", err)})
+		return
+	}
+
+	leases, err := s.sessionStore.Leases(sessionIDs)
+	if err != nil {
+		log.Printf("Failed to load session leases: %v", err)
+	}
+
+	response := []SessionResponse{}
+	for i, session := range sessions {
+		var lease *LeaseResponse
+		if stored, exists := leases[session.ID]; exists {
+			lease = newLeaseResponse(stored)
+		}
 		response = append(response, SessionResponse{
-			ID:      session.ID,
-			Name:    session.Name,
-			Tool:    session.Tool,
-			Status:  session.Status,
-			Created: session.Created,
+			ID:                session.ID,
+			Name:              session.Name,
+			Tool:              session.Tool,
+			Status:            session.Status,
+			Created:           session.Created,
+			UnreadMessages:    inbox.Sessions[i].UnreadMessages,
+			RequiresUserInput: inbox.Sessions[i].RequiresUserInput,
+			DeviceID:          s.deviceID,
+			DeviceName:        s.deviceName,
+			Lease:             lease,
+			Role:              s.role(c, session.ID),
 		})
 	}
 
+	// Paired devices list only their own sessions to each other
+	if s.remote != nil && pairedDevice(c) == nil {
+		for _, session := range s.remote.ListSessions(ctx, readerFromRequest(c)) {
+			if s.role(c, session.ID) != "" {
+				response = append(response, session)
+			}
+		}
+	}
+
 	c.JSON(http.StatusOK, response)
 }
 
+// GetInbox summarizes unread messages and sessions waiting for input for the requesting reader
+func (s *TerminalAPIService) GetInbox(c *gin.Context) {
+	ctx := context.Background()
+	s.syncStoredSessions(ctx)
+	sessions, err := s.tmuxManager.ListSessions(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list sessions"})
+		return
+	}
+
+	sessions = s.visibleSessions(c, sessions)
+	sessionIDs := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		sessionIDs = append(sessionIDs, session.ID)
+	}
+
+	inbox, err := s.messageService.GetInboxSummary(ctx, readerFromRequest(c), sessionIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get inbox: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, inbox)
+}
+
 // GetSessionOutput gets the current output of a session
 func (s *TerminalAPIService) GetSessionOutput(c *gin.Context) {
 	sessionID := c.Param("id")
 	
 	ctx := context.Background()
-	output, err := s.tmuxManager.CaptureOutput(ctx, sessionID)
+	output, err := s.wsService.CaptureOutput(ctx, sessionID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
 		return
@@ -199,8 +471,23 @@ func (s *TerminalAPIService) SendSessionInput(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		return
 	}
+	if s.migrating(sessionID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Session is being migrated"})
+		return
+	}
+	if err := s.leasedElsewhere(sessionID); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if !s.wsService.MayDrive(sessionID, inputIdentity(c)) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Session is driven by another client"})
+		return
+	}
 
 	ctx := context.Background()
+	if s.checkpoints != nil {
+		s.checkpoints.BeforeInput(ctx, sessionID, req.Input)
+	}
 	if err := s.tmuxManager.SendCommand(ctx, sessionID, req.Input); err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
 		return
@@ -209,10 +496,65 @@ func (s *TerminalAPIService) SendSessionInput(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
 
+// sessionKeys are the keys that may be sent to sessions, by tmux key name
+var sessionKeys = map[string]bool{
+	"Enter": true, "Escape": true, "Tab": true, "BTab": true, "Space": true, "BSpace": true,
+	"Up": true, "Down": true, "Left": true, "Right": true,
+	"Home": true, "End": true, "PPage": true, "NPage": true,
+	"C-c": true, "C-d": true, "C-l": true, "C-r": true, "C-z": true,
+}
+
+// SendSessionKeys sends special keys, such as Escape or Ctrl-C, to a session
+func (s *TerminalAPIService) SendSessionKeys(c *gin.Context) {
+	sessionID := c.Param("id")
+
+	var req struct {
+		Keys []string `json:"keys" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.Keys) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	for _, key := range req.Keys {
+		if !sessionKeys[key] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unsupported key: %s", key)})
+			return
+		}
+	}
+	if s.migrating(sessionID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Session is being migrated"})
+		return
+	}
+	if err := s.leasedElsewhere(sessionID); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if !s.wsService.MayDrive(sessionID, inputIdentity(c)) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Session is driven by another client"})
+		return
+	}
+
+	ctx := context.Background()
+	if s.checkpoints != nil {
+		s.checkpoints.BeforeInput(ctx, sessionID, strings.Join(req.Keys, " "))
+	}
+	if err := s.tmuxManager.SendKeys(ctx, sessionID, req.Keys...); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
 // DeleteSession terminates a session
 func (s *TerminalAPIService) DeleteSession(c *gin.Context) {
 	sessionID := c.Param("id")
 	
+	if s.migrating(sessionID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Session is being migrated"})
+		return
+	}
+
 	ctx := context.Background()
 	
 	// Kill tmux session
@@ -221,6 +563,17 @@ func (s *TerminalAPIService) DeleteSession(c *gin.Context) {
 		return
 	}
 
+	// Drop input that can no longer be delivered
+	s.inputQueue.Clear(sessionID)
+
+	if s.checkpoints != nil {
+		s.checkpoints.Forget(ctx, sessionID)
+	}
+
+	if err := s.sessionStore.DeleteSession(sessionID); err != nil {
+		log.Printf("Failed to remove session %s from the store: %v", sessionID, err)
+	}
+
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
 
@@ -237,12 +590,47 @@ func (s *TerminalAPIService) AttachSession(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
 
-// GetSessionMessages gets all messages for a session
+// GetSessionMessages gets messages for a session, oldest first: a page of
+// limit messages from offset, or the ones after the message named by after
 func (s *TerminalAPIService) GetSessionMessages(c *gin.Context) {
 	sessionID := c.Param("id")
+
+	limit, offset := 100, 0
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > maxMessagesPage {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		limit = parsed
+	}
+	if value := c.Query("offset"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+			return
+		}
+		offset = parsed
+	}
 	
 	ctx := context.Background()
-	messages, err := s.messageService.GetMessages(ctx, sessionID, 100, 0)
+	var messages []database.TerminalMessage
+	var err error
+	if after := c.Query("after"); after != "" {
+		// Messages after one the caller has, to catch up after a disconnect
+		afterID, parseErr := uuid.Parse(after)
+		if parseErr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid after"})
+			return
+		}
+		messages, err = s.messageService.GetMessagesAfter(ctx, sessionID, afterID, limit)
+		if errors.Is(err, ErrMessageNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+	} else {
+		messages, err = s.messageService.GetMessages(ctx, sessionID, limit, offset)
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get messages: %v", err)})
 		return
@@ -256,8 +644,9 @@ func (s *TerminalAPIService) SendSessionMessage(c *gin.Context) {
 	sessionID := c.Param("id")
 	
 	var req struct {
-		Content string `json:"content" binding:"required"`
-		Type    string `json:"type"` // "user" or "agent"
+		Content       string   `json:"content" binding:"required"`
+		Type          string   `json:"type"` // "user" or "agent"
+		AttachmentIDs []string `json:"attachment_ids"`
 	}
 	
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -266,33 +655,98 @@ func (s *TerminalAPIService) SendSessionMessage(c *gin.Context) {
 		return
 	}
 
+	attachmentIDs := make([]uuid.UUID, 0, len(req.AttachmentIDs))
+	for _, rawID := range req.AttachmentIDs {
+		id, err := uuid.Parse(rawID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid attachment ID: %s", rawID)})
+			return
+		}
+		attachmentIDs = append(attachmentIDs, id)
+	}
+
 	ctx := context.Background()
 	
 	// Create user message by default
 	if req.Type == "" || req.Type == "user" {
-		message, err := s.messageService.CreateUserMessage(ctx, sessionID, req.Content, false)
+		if s.migrating(sessionID) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Session is being migrated"})
+			return
+		}
+		if err := s.leasedElsewhere(sessionID); err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if !s.wsService.MayDrive(sessionID, inputIdentity(c)) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Session is driven by another client"})
+			return
+		}
+
+		// Queue for delivery once the tool is ready for input
+		message, err := s.inputQueue.Enqueue(ctx, readerFromRequest(c), sessionID, req.Content, attachmentIDs)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to send message: %v", err)})
 			return
 		}
 		
-		// Send to tmux session as well
-		if err := s.tmuxManager.SendLiteralInput(ctx, sessionID, req.Content); err != nil {
-			log.Printf("Failed to send input to tmux: %v", err)
-		}
-		
+		s.wsService.BroadcastMessage(sessionID, message)
 		c.JSON(http.StatusOK, message)
 	} else {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Only user messages can be sent via API"})
 	}
 }
 
+// SearchMessages searches message content across sessions, or within session_id
+func (s *TerminalAPIService) SearchMessages(c *gin.Context) {
+	query := c.Query("q")
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+
+	limit := 50
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+		limit = parsed
+	}
+
+	sessionID := c.Query("session_id")
+	if sessionID != "" && s.role(c, sessionID) == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": ErrNoSessionAccess.Error()})
+		return
+	}
+
+	// Only sessions the caller may see are searched, so the limit counts
+	// visible messages
+	visible, err := requestVisibleSessions(c, s.access)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to search messages: %v", err)})
+		return
+	}
+
+	messages, err := s.messageService.SearchMessages(context.Background(), sessionID, visible, query, limit)
+	if err != nil {
+		if errors.Is(err, ErrSearchUnavailable) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to search messages: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"messages": messages})
+}
+
 // GetSessionMessageStatus gets message status for a session
 func (s *TerminalAPIService) GetSessionMessageStatus(c *gin.Context) {
 	sessionID := c.Param("id")
 	
 	ctx := context.Background()
-	status, err := s.messageService.GetMessageStatus(ctx, sessionID)
+	status, err := s.messageService.GetMessageStatus(ctx, readerFromRequest(c), sessionID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get message status: %v", err)})
 		return
@@ -301,6 +755,182 @@ func (s *TerminalAPIService) GetSessionMessageStatus(c *gin.Context) {
 	c.JSON(http.StatusOK, status)
 }
 
+// GetSessionUnreadMessages gets the messages the requesting reader has not read yet
+func (s *TerminalAPIService) GetSessionUnreadMessages(c *gin.Context) {
+	sessionID := c.Param("id")
+
+	ctx := context.Background()
+	messages, err := s.messageService.GetUnreadMessages(ctx, readerFromRequest(c), sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get unread messages: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, messages)
+}
+
+// MarkSessionMessagesRead marks messages as read up to a message for the requesting reader
+func (s *TerminalAPIService) MarkSessionMessagesRead(c *gin.Context) {
+	sessionID := c.Param("id")
+
+	var req struct {
+		MessageID string `json:"message_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+
+	messageID, err := uuid.Parse(req.MessageID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	ctx := context.Background()
+	cursor, err := s.messageService.MarkAsRead(ctx, readerFromRequest(c), sessionID, messageID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Failed to mark messages as read: %v", err)})
+		return
+	}
+
+	s.wsService.BroadcastReadState(sessionID, cursor)
+	c.JSON(http.StatusOK, cursor)
+}
+
+// GetSessionReadCursors lists how far each user and device has read in a session
+func (s *TerminalAPIService) GetSessionReadCursors(c *gin.Context) {
+	sessionID := c.Param("id")
+
+	ctx := context.Background()
+	cursors, err := s.messageService.GetReadCursors(ctx, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get read cursors: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, cursors)
+}
+
+// GetSessionQueue lists user messages that have not yet been acknowledged by the tool
+func (s *TerminalAPIService) GetSessionQueue(c *gin.Context) {
+	sessionID := c.Param("id")
+
+	ctx := context.Background()
+	messages, err := s.messageService.GetPendingDeliveries(ctx, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get queue: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, messages)
+}
+
+// GetSessionControl returns the client driving a session and its observers
+func (s *TerminalAPIService) GetSessionControl(c *gin.Context) {
+	c.JSON(http.StatusOK, s.wsService.ControlState(c.Param("id")))
+}
+
+// GetSessionPresence returns the users and devices viewing a session
+func (s *TerminalAPIService) GetSessionPresence(c *gin.Context) {
+	c.JSON(http.StatusOK, s.wsService.Presence(c.Param("id")))
+}
+
+// UploadAttachment stores a file to be sent with a later message
+func (s *TerminalAPIService) UploadAttachment(c *gin.Context) {
+	sessionID := c.Param("id")
+
+	if _, err := s.tmuxManager.GetSession(sessionID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	// Leave headroom for the multipart envelope
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, MaxAttachmentSize+1<<20)
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid upload: %v", err)})
+		return
+	}
+	if fileHeader.Size > MaxAttachmentSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": ErrAttachmentTooLarge.Error()})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid upload: %v", err)})
+		return
+	}
+	defer file.Close()
+
+	ctx := context.Background()
+	attachment, err := s.attachmentStore.Save(ctx, sessionID, fileHeader.Filename, fileHeader.Header.Get("Content-Type"), file)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrAttachmentTooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrAttachmentType):
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to store attachment: %v", err)})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, attachment)
+}
+
+// GetAttachment downloads a stored attachment
+func (s *TerminalAPIService) GetAttachment(c *gin.Context) {
+	sessionID := c.Param("id")
+
+	id, err := uuid.Parse(c.Param("attachmentId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment ID"})
+		return
+	}
+
+	ctx := context.Background()
+	attachment, err := s.attachmentStore.Get(ctx, sessionID, id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
+	}
+
+	c.Header("Content-Type", attachment.ContentType)
+	c.FileAttachment(attachment.StoragePath, attachment.FileName)
+}
+
+// GetSessionGitTurns lists the repository changes captured for each agent turn
+func (s *TerminalAPIService) GetSessionGitTurns(c *gin.Context) {
+	sessionID := c.Param("id")
+
+	ctx := context.Background()
+	turns, err := s.gitTracker.GetTurns(ctx, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get git turns: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, turns)
+}
+
+// GetSessionGitDiff shows everything a session has changed since it started
+func (s *TerminalAPIService) GetSessionGitDiff(c *gin.Context) {
+	sessionID := c.Param("id")
+
+	ctx := context.Background()
+	changes, err := s.gitTracker.GetChanges(ctx, sessionID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Failed to get git diff: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, changes)
+}
+
 // CommandInfo represents a Claude command with description
 type CommandInfo struct {
 	Command     string `json:"command"`
@@ -445,14 +1075,69 @@ func (s *TerminalAPIService) RegisterRoutes(router *gin.Engine) {
 	{
 		terminal.POST("/sessions", s.CreateSession)
 		terminal.GET("/sessions", s.ListSessions)
-		terminal.GET("/sessions/:id/output", s.GetSessionOutput)
-		terminal.POST("/sessions/:id/input", s.SendSessionInput)
-		terminal.DELETE("/sessions/:id", s.DeleteSession)
+		terminal.GET("/inbox", s.GetInbox)
+		terminal.GET("/search", s.SearchMessages)
 		terminal.POST("/sessions/:id/attach", s.AttachSession)
-		
-		// Message endpoints
-		terminal.GET("/sessions/:id/messages", s.GetSessionMessages)
-		terminal.POST("/sessions/:id/messages", s.SendSessionMessage)
-		terminal.GET("/sessions/:id/messages/status", s.GetSessionMessageStatus)
 	}
-}
\ No newline at end of file
+
+	// Sessions running on a paired device are handed over to it, once this
+	// server checked that the caller's API key may send them input
+	sessions := terminal.Group("")
+	sessions.Use(s.checkInputScope)
+	if s.remote != nil {
+		sessions.Use(s.remote.ProxySession)
+	}
+	s.registerSessionRoutes(sessions)
+}
+
+// checkInputScope refuses raw input and keys from API keys that may not answer
+// a permission prompt the session may be showing
+func (s *TerminalAPIService) checkInputScope(c *gin.Context) {
+	route := c.FullPath()
+	if c.Request.Method != http.MethodPost || (route != "/api/v1/terminal/sessions/:id/input" && route != "/api/v1/terminal/sessions/:id/keys") {
+		c.Next()
+		return
+	}
+	if err := checkInputKey(c.Request.Context(), s.tmuxManager, requestAPIKey(c), c.Param("id")); err != nil {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	c.Next()
+}
+
+// RegisterPeerRoutes registers the routes paired devices proxy sessions through
+// on the mutual TLS listener. router must authenticate callers with
+// RequirePairedDevice.
+func (s *TerminalAPIService) RegisterPeerRoutes(router gin.IRouter) {
+	terminal := router.Group("/api/v1/terminal")
+	terminal.POST("/sessions", s.CreateSession)
+	terminal.GET("/sessions", s.ListSessions)
+	s.registerSessionRoutes(terminal)
+}
+
+// registerSessionRoutes registers the routes of a single session
+func (s *TerminalAPIService) registerSessionRoutes(terminal gin.IRoutes) {
+	terminal.GET("/sessions/:id/output", s.GetSessionOutput)
+	terminal.POST("/sessions/:id/input", s.SendSessionInput)
+	terminal.POST("/sessions/:id/keys", s.SendSessionKeys)
+	terminal.GET("/sessions/:id/control", s.GetSessionControl)
+	terminal.GET("/sessions/:id/presence", s.GetSessionPresence)
+	terminal.DELETE("/sessions/:id", s.DeleteSession)
+
+	// Message endpoints
+	terminal.GET("/sessions/:id/messages", s.GetSessionMessages)
+	terminal.POST("/sessions/:id/messages", s.SendSessionMessage)
+	terminal.GET("/sessions/:id/messages/status", s.GetSessionMessageStatus)
+	terminal.GET("/sessions/:id/messages/queue", s.GetSessionQueue)
+	terminal.GET("/sessions/:id/messages/unread", s.GetSessionUnreadMessages)
+	terminal.POST("/sessions/:id/messages/read", s.MarkSessionMessagesRead)
+	terminal.GET("/sessions/:id/messages/cursors", s.GetSessionReadCursors)
+
+	// Attachment endpoints
+	terminal.POST("/sessions/:id/attachments", s.UploadAttachment)
+	terminal.GET("/sessions/:id/attachments/:attachmentId", s.GetAttachment)
+
+	// Git endpoints
+	terminal.GET("/sessions/:id/git/turns", s.GetSessionGitTurns)
+	terminal.GET("/sessions/:id/git/diff", s.GetSessionGitDiff)
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os/exec"
+	"time"
+
+	"github.com/majiayu000/anywhere-ai/core/tmux"
+)
+
+// ToolLauncher starts AI tools in tmux sessions and attaches the monitors that
+// turn their output into messages
+type ToolLauncher struct {
+	tmuxManager   *tmux.Manager
+	claudeMonitor *ClaudeMonitor
+	jsonlMonitor  *JSONLMonitor
+}
+
+// NewToolLauncher creates a new tool launcher
+func NewToolLauncher(tmuxManager *tmux.Manager, claudeMonitor *ClaudeMonitor, jsonlMonitor *JSONLMonitor) *ToolLauncher {
+	return &ToolLauncher{
+		tmuxManager:   tmuxManager,
+		claudeMonitor: claudeMonitor,
+		jsonlMonitor:  jsonlMonitor,
+	}
+}
+
+// toolCommand returns the shell command that starts tool. A non-empty resumeID
+// continues an earlier Claude conversation.
+func toolCommand(tool string, resumeID string) string {
+	switch tool {
+	case "claude":
+		// Start Claude Code CLI directly without proxy
+		if resumeID != "" {
+			return fmt.Sprintf("claude --resume %s", resumeID)
+		}
+		return `claude`
+	case "gemini":
+		// Try to start Gemini CLI
+		return "gemini || echo 'Gemini not installed. Install Gemini CLI first.'"
+	case "cursor":
+		// Try to start Cursor CLI
+		return "cursor --cli || echo 'Cursor not installed. Install Cursor IDE first.'"
+	case "copilot":
+		// Try to start GitHub Copilot CLI
+		return "gh copilot || echo 'GitHub Copilot CLI not installed. Install with: gh extension install github/gh-copilot'"
+	default:
+		// Start a plain shell
+		return "echo 'Starting shell session...'"
+	}
+}
+
+// Launch starts tool in a new session
+func (l *ToolLauncher) Launch(ctx context.Context, sessionID string, tool string) error {
+	if err := l.tmuxManager.SendCommand(ctx, sessionID, toolCommand(tool, "")); err != nil {
+		return fmt.Errorf("failed to start %s: %w", tool, err)
+	}
+
+	if tool == "claude" {
+		l.startClaude(sessionID, func() error {
+			return l.jsonlMonitor.StartMonitoring(sessionID)
+		})
+	}
+	return nil
+}
+
+// Resume starts tool in a session recreated on this host and continues the
+// Claude conversation whose transcript is at transcriptPath. Only transcript
+// entries after since become new messages.
+func (l *ToolLauncher) Resume(ctx context.Context, sessionID string, tool string, claudeSessionID string, transcriptPath string, since time.Time) error {
+	if err := l.tmuxManager.SendCommand(ctx, sessionID, toolCommand(tool, claudeSessionID)); err != nil {
+		return fmt.Errorf("failed to resume %s: %w", tool, err)
+	}
+
+	if tool == "claude" {
+		l.startClaude(sessionID, func() error {
+			if transcriptPath == "" {
+				return fmt.Errorf("no transcript to resume")
+			}
+			return l.jsonlMonitor.ResumeMonitoring(sessionID, transcriptPath, since)
+		})
+	}
+	return nil
+}
+
+// Stop detaches the monitors from a session
+func (l *ToolLauncher) Stop(sessionID string) {
+	if l.jsonlMonitor != nil {
+		l.jsonlMonitor.StopMonitoring(sessionID)
+	}
+	if l.claudeMonitor != nil {
+		l.claudeMonitor.StopMonitoring(sessionID)
+	}
+}
+
+// startClaude attaches a monitor to a Claude session once it is up
+func (l *ToolLauncher) startClaude(sessionID string, monitorJSONL func() error) {
+	// JSONL monitoring provides precise message extraction
+	if l.jsonlMonitor != nil {
+		go func() {
+			// Wait for Claude to create JSONL file
+			time.Sleep(2 * time.Second)
+			if err := monitorJSONL(); err != nil {
+				log.Printf("Failed to start JSONL monitoring: %v", err)
+				// Fallback to tmux monitoring
+				if l.claudeMonitor != nil {
+					l.claudeMonitor.StartMonitoring(sessionID)
+					log.Printf("Started fallback tmux monitoring for session %s", sessionID)
+				}
+			} else {
+				log.Printf("Started JSONL monitoring for session %s", sessionID)
+			}
+		}()
+	}
+
+	go func() {
+		time.Sleep(3 * time.Second) // Wait for Claude to start
+		// Send Tab key to bypass permissions
+		exec.Command("tmux", "send-keys", "-t", sessionID, "Tab").Run()
+	}()
+}
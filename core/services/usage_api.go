@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/majiayu000/anywhere-ai/core/database"
+)
+
+// UsageAPIService exposes token usage reports and session budgets
+type UsageAPIService struct {
+	usageTracker *UsageTracker
+	access       *SessionAccessService
+}
+
+// SessionUsageResponse is the usage of a single session
+type SessionUsageResponse struct {
+	SessionID string                  `json:"session_id"`
+	Totals    *database.UsageTotals   `json:"totals"`
+	Budget    *database.SessionBudget `json:"budget,omitempty"`
+	Responses []database.TokenUsage   `json:"responses"`
+}
+
+// SetBudgetRequest is the request to set a session budget
+type SetBudgetRequest struct {
+	LimitUSD float64               `json:"limit_usd" binding:"required,gt=0"`
+	Action   database.BudgetAction `json:"action"`
+}
+
+// NewUsageAPIService creates a new usage API service
+func NewUsageAPIService(usageTracker *UsageTracker) *UsageAPIService {
+	return &UsageAPIService{usageTracker: usageTracker}
+}
+
+// SetSessionAccess sets the service that decides whose usage callers may see
+func (s *UsageAPIService) SetSessionAccess(access *SessionAccessService) {
+	s.access = access
+}
+
+// GetReport aggregates usage per session, tool, model and day, over the
+// sessions the caller has a role in.
+// Supports session_id, tool, from and to (RFC 3339 or YYYY-MM-DD) query parameters.
+func (s *UsageAPIService) GetReport(c *gin.Context) {
+	filter := UsageFilter{
+		SessionID: c.Query("session_id"),
+		Tool:      c.Query("tool"),
+	}
+
+	visible, err := requestVisibleSessions(c, s.access)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to build usage report: %v", err)})
+		return
+	}
+	filter.SessionIDs = visible
+
+	for param, target := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		raw := c.Query(param)
+		if raw == "" {
+			continue
+		}
+		t, err := parseReportTime(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid %s: %v", param, err)})
+			return
+		}
+		*target = &t
+	}
+
+	ctx := context.Background()
+	report, err := s.usageTracker.Report(ctx, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to build usage report: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// GetPrices returns the price table in use
+func (s *UsageAPIService) GetPrices(c *gin.Context) {
+	c.JSON(http.StatusOK, s.usageTracker.Prices())
+}
+
+// GetSessionUsage returns the totals, budget and per-response usage of a session
+func (s *UsageAPIService) GetSessionUsage(c *gin.Context) {
+	sessionID := c.Param("id")
+
+	ctx := context.Background()
+	records, err := s.usageTracker.SessionRecords(ctx, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get usage: %v", err)})
+		return
+	}
+
+	totals := &database.UsageTotals{}
+	for i := range records {
+		totals.Add(&records[i])
+	}
+
+	budget, err := s.usageTracker.GetBudget(ctx, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to get budget: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, SessionUsageResponse{
+		SessionID: sessionID,
+		Totals:    totals,
+		Budget:    budget,
+		Responses: records,
+	})
+}
+
+// SetSessionBudget sets the budget of a session
+func (s *UsageAPIService) SetSessionBudget(c *gin.Context) {
+	sessionID := c.Param("id")
+
+	var req SetBudgetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid request: %v", err)})
+		return
+	}
+	if req.Action == "" {
+		req.Action = database.BudgetActionWarn
+	}
+
+	ctx := context.Background()
+	budget, err := s.usageTracker.SetBudget(ctx, sessionID, req.LimitUSD, req.Action)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to set budget: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, budget)
+}
+
+// DeleteSessionBudget removes the budget of a session
+func (s *UsageAPIService) DeleteSessionBudget(c *gin.Context) {
+	sessionID := c.Param("id")
+
+	ctx := context.Background()
+	if err := s.usageTracker.DeleteBudget(ctx, sessionID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to delete budget: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Budget removed"})
+}
+
+// RegisterRoutes registers usage API routes
+func (s *UsageAPIService) RegisterRoutes(router *gin.Engine) {
+	usage := router.Group("/api/v1/usage")
+	{
+		usage.GET("/report", s.GetReport)
+		usage.GET("/prices", s.GetPrices)
+	}
+
+	terminal := router.Group("/api/v1/terminal")
+	{
+		terminal.GET("/sessions/:id/usage", s.GetSessionUsage)
+		terminal.PUT("/sessions/:id/budget", s.SetSessionBudget)
+		terminal.DELETE("/sessions/:id/budget", s.DeleteSessionBudget)
+	}
+}
+
+// parseReportTime parses a report boundary given as RFC 3339 or a date
+func parseReportTime(raw string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", raw)
+}
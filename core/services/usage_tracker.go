@@ -0,0 +1,382 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/majiayu000/anywhere-ai/core/core"
+	"github.com/majiayu000/anywhere-ai/core/database"
+	"github.com/majiayu000/anywhere-ai/core/tmux"
+	"gorm.io/gorm"
+)
+
+// ModelPrice is the price of a model in USD per million tokens
+type ModelPrice struct {
+	Input      float64 `json:"input"`
+	Output     float64 `json:"output"`
+	CacheWrite float64 `json:"cache_write"`
+	CacheRead  float64 `json:"cache_read"`
+}
+
+// PriceTable maps model names, or model name prefixes, to prices
+type PriceTable map[string]ModelPrice
+
+// DefaultPriceTable contains list prices of common models
+var DefaultPriceTable = PriceTable{
+	"claude-opus-4":     {Input: 15, Output: 75, CacheWrite: 18.75, CacheRead: 1.5},
+	"claude-sonnet-4":   {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.3},
+	"claude-3-7-sonnet": {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.3},
+	"claude-3-5-sonnet": {Input: 3, Output: 15, CacheWrite: 3.75, CacheRead: 0.3},
+	"claude-3-5-haiku":  {Input: 0.8, Output: 4, CacheWrite: 1, CacheRead: 0.08},
+}
+
+// LoadPriceTable reads a JSON price table and merges it over the defaults
+func LoadPriceTable(path string) (PriceTable, error) {
+	prices := PriceTable{}
+	for model, price := range DefaultPriceTable {
+		prices[model] = price
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read price table: %w", err)
+	}
+
+	var overrides PriceTable
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("failed to parse price table: %w", err)
+	}
+	for model, price := range overrides {
+		prices[model] = price
+	}
+
+	return prices, nil
+}
+
+// Lookup finds the price of a model, matching the longest configured prefix
+// so that dated model names such as claude-sonnet-4-20250514 resolve
+func (p PriceTable) Lookup(model string) (ModelPrice, bool) {
+	if price, exists := p[model]; exists {
+		return price, true
+	}
+
+	best := ""
+	for name := range p {
+		if strings.HasPrefix(model, name) && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return ModelPrice{}, false
+	}
+	return p[best], true
+}
+
+// Cost computes the cost of a usage record in USD
+func (p PriceTable) Cost(usage *database.TokenUsage) float64 {
+	price, exists := p.Lookup(usage.Model)
+	if !exists {
+		return 0
+	}
+
+	return (float64(usage.InputTokens)*price.Input +
+		float64(usage.OutputTokens)*price.Output +
+		float64(usage.CacheCreationTokens)*price.CacheWrite +
+		float64(usage.CacheReadTokens)*price.CacheRead) / 1e6
+}
+
+// UsageFilter selects the usage records included in a report
+type UsageFilter struct {
+	SessionID  string
+	SessionIDs []string // Only these sessions, unless nil
+	Tool       string
+	From       *time.Time
+	To         *time.Time
+}
+
+// UsageTracker records token usage, prices it and enforces session budgets
+type UsageTracker struct {
+	db          *gorm.DB
+	tmuxManager *tmux.Manager
+	wsService   *TerminalWebSocketService
+	prices      PriceTable
+	mu          sync.Mutex // Serializes recording so budgets trigger once
+}
+
+// NewUsageTracker creates a new usage tracker
+func NewUsageTracker(db *gorm.DB, tmuxManager *tmux.Manager, wsService *TerminalWebSocketService, prices PriceTable) *UsageTracker {
+	if prices == nil {
+		prices = DefaultPriceTable
+	}
+
+	return &UsageTracker{
+		db:          db,
+		tmuxManager: tmuxManager,
+		wsService:   wsService,
+		prices:      prices,
+	}
+}
+
+// Prices returns the price table in use
+func (t *UsageTracker) Prices() PriceTable {
+	return t.prices
+}
+
+// Record stores a usage record and checks the session budget.
+// Tools may report the same response more than once while streaming, so
+// records with a known ExternalID update the existing row instead.
+func (t *UsageTracker) Record(ctx context.Context, usage *database.TokenUsage) (*database.TokenUsage, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if usage.Tool == "" {
+		if session, err := t.tmuxManager.GetSession(usage.SessionID); err == nil {
+			usage.Tool = session.Tool
+		}
+	}
+	usage.Cost = t.prices.Cost(usage)
+	if usage.ExternalID == "" {
+		// Unidentified responses cannot be deduplicated
+		usage.ExternalID = uuid.New().String()
+	}
+
+	var existing database.TokenUsage
+	err := t.db.WithContext(ctx).Where("external_id = ?", usage.ExternalID).First(&existing).Error
+	switch {
+	case err == nil:
+		existing.InputTokens = maxInt64(existing.InputTokens, usage.InputTokens)
+		existing.OutputTokens = maxInt64(existing.OutputTokens, usage.OutputTokens)
+		existing.CacheCreationTokens = maxInt64(existing.CacheCreationTokens, usage.CacheCreationTokens)
+		existing.CacheReadTokens = maxInt64(existing.CacheReadTokens, usage.CacheReadTokens)
+		existing.Cost = t.prices.Cost(&existing)
+		if existing.MessageID == nil {
+			existing.MessageID = usage.MessageID
+		}
+		if err := t.db.WithContext(ctx).Save(&existing).Error; err != nil {
+			return nil, fmt.Errorf("failed to update token usage: %w", err)
+		}
+		usage = &existing
+
+	case err == gorm.ErrRecordNotFound:
+		if err := t.db.WithContext(ctx).Create(usage).Error; err != nil {
+			return nil, fmt.Errorf("failed to save token usage: %w", err)
+		}
+
+	default:
+		return nil, fmt.Errorf("failed to get token usage: %w", err)
+	}
+
+	if err := t.checkBudget(ctx, usage.SessionID); err != nil {
+		log.Printf("Failed to check budget for session %s: %v", usage.SessionID, err)
+	}
+
+	return usage, nil
+}
+
+// SessionTotals sums the usage of a session
+func (t *UsageTracker) SessionTotals(ctx context.Context, sessionID string) (*database.UsageTotals, error) {
+	records, err := t.find(ctx, UsageFilter{SessionID: sessionID})
+	if err != nil {
+		return nil, err
+	}
+
+	totals := &database.UsageTotals{}
+	for i := range records {
+		totals.Add(&records[i])
+	}
+	return totals, nil
+}
+
+// SessionRecords lists the per-response usage of a session, oldest first
+func (t *UsageTracker) SessionRecords(ctx context.Context, sessionID string) ([]database.TokenUsage, error) {
+	return t.find(ctx, UsageFilter{SessionID: sessionID})
+}
+
+// Report aggregates usage per session, tool, model and day
+func (t *UsageTracker) Report(ctx context.Context, filter UsageFilter) (*database.UsageReport, error) {
+	records, err := t.find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	bySession := map[string]*database.UsageGroup{}
+	byTool := map[string]*database.UsageGroup{}
+	byModel := map[string]*database.UsageGroup{}
+	byDay := map[string]*database.UsageGroup{}
+
+	report := &database.UsageReport{From: filter.From, To: filter.To}
+	for i := range records {
+		record := &records[i]
+		report.Totals.Add(record)
+		addToGroup(bySession, record.SessionID, record)
+		addToGroup(byTool, record.Tool, record)
+		addToGroup(byModel, record.Model, record)
+		addToGroup(byDay, record.CreatedAt.UTC().Format("2006-01-02"), record)
+	}
+
+	report.BySession = sortedGroups(bySession)
+	report.ByTool = sortedGroups(byTool)
+	report.ByModel = sortedGroups(byModel)
+	report.ByDay = sortedGroups(byDay)
+	return report, nil
+}
+
+// FillSessionStats sets the cost and token fields of session statistics
+func (t *UsageTracker) FillSessionStats(ctx context.Context, sessionID string, stats *core.SessionStats) error {
+	totals, err := t.SessionTotals(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+
+	stats.Cost = totals.Cost
+	stats.TokensUsed = int(totals.TotalTokens)
+	return nil
+}
+
+// SetBudget sets or replaces the budget of a session
+func (t *UsageTracker) SetBudget(ctx context.Context, sessionID string, limitUSD float64, action database.BudgetAction) (*database.SessionBudget, error) {
+	if action != database.BudgetActionWarn && action != database.BudgetActionInterrupt {
+		return nil, fmt.Errorf("unknown budget action: %s", action)
+	}
+
+	budget := &database.SessionBudget{
+		SessionID: sessionID,
+		LimitUSD:  limitUSD,
+		Action:    action,
+		UpdatedAt: time.Now(),
+	}
+	if err := t.db.WithContext(ctx).Save(budget).Error; err != nil {
+		return nil, fmt.Errorf("failed to save budget: %w", err)
+	}
+
+	// A lowered limit may already be exceeded
+	if err := t.checkBudget(ctx, sessionID); err != nil {
+		return nil, err
+	}
+
+	return t.GetBudget(ctx, sessionID)
+}
+
+// GetBudget retrieves the budget of a session, or nil if it has none
+func (t *UsageTracker) GetBudget(ctx context.Context, sessionID string) (*database.SessionBudget, error) {
+	var budget database.SessionBudget
+	err := t.db.WithContext(ctx).Where("session_id = ?", sessionID).First(&budget).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get budget: %w", err)
+	}
+
+	return &budget, nil
+}
+
+// DeleteBudget removes the budget of a session
+func (t *UsageTracker) DeleteBudget(ctx context.Context, sessionID string) error {
+	if err := t.db.WithContext(ctx).Where("session_id = ?", sessionID).Delete(&database.SessionBudget{}).Error; err != nil {
+		return fmt.Errorf("failed to delete budget: %w", err)
+	}
+	return nil
+}
+
+// checkBudget warns or interrupts the agent the first time a session exceeds its budget
+func (t *UsageTracker) checkBudget(ctx context.Context, sessionID string) error {
+	budget, err := t.GetBudget(ctx, sessionID)
+	if err != nil || budget == nil || budget.ExceededAt != nil {
+		return err
+	}
+
+	totals, err := t.SessionTotals(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if totals.Cost < budget.LimitUSD {
+		return nil
+	}
+
+	now := time.Now()
+	budget.ExceededAt = &now
+	if err := t.db.WithContext(ctx).Save(budget).Error; err != nil {
+		return fmt.Errorf("failed to update budget: %w", err)
+	}
+
+	log.Printf("Session %s exceeded its budget: $%.4f of $%.4f", sessionID, totals.Cost, budget.LimitUSD)
+
+	if budget.Action == database.BudgetActionInterrupt {
+		// Escape interrupts the current response of Claude and similar tools
+		if err := t.tmuxManager.SendKeys(ctx, sessionID, "Escape"); err != nil {
+			log.Printf("Failed to interrupt session %s: %v", sessionID, err)
+		}
+	}
+
+	if t.wsService != nil {
+		t.wsService.BroadcastBudgetExceeded(sessionID, budget, totals)
+	}
+
+	return nil
+}
+
+// find retrieves the usage records matching a filter, oldest first
+func (t *UsageTracker) find(ctx context.Context, filter UsageFilter) ([]database.TokenUsage, error) {
+	query := t.db.WithContext(ctx).Order("created_at ASC")
+	if filter.SessionID != "" {
+		query = query.Where("session_id = ?", filter.SessionID)
+	}
+	if filter.SessionIDs != nil {
+		query = query.Where("session_id IN ?", filter.SessionIDs)
+	}
+	if filter.Tool != "" {
+		query = query.Where("tool = ?", filter.Tool)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at < ?", *filter.To)
+	}
+
+	var records []database.TokenUsage
+	if err := query.Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to get token usage: %w", err)
+	}
+
+	return records, nil
+}
+
+// addToGroup accumulates a usage record into the group with the given key
+func addToGroup(groups map[string]*database.UsageGroup, key string, usage *database.TokenUsage) {
+	group, exists := groups[key]
+	if !exists {
+		group = &database.UsageGroup{Key: key}
+		groups[key] = group
+	}
+	group.Add(usage)
+}
+
+// sortedGroups returns groups ordered by key
+func sortedGroups(groups map[string]*database.UsageGroup) []database.UsageGroup {
+	result := make([]database.UsageGroup, 0, len(groups))
+	for _, group := range groups {
+		result = append(result, *group)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Key < result[j].Key
+	})
+	return result
+}
+
+// maxInt64 returns the larger of two values
+func maxInt64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -3,8 +3,8 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
-	"net/http"
 	"strings"
 	"sync"
 	"time"
@@ -12,15 +12,14 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/majiayu000/anywhere-ai/core/auth"
+	"github.com/majiayu000/anywhere-ai/core/database"
 	"github.com/majiayu000/anywhere-ai/core/tmux"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		// Allow all origins for development
-		return true
-	},
-}
+// upgrader only accepts browsers on the server's own origin; clients without
+// an Origin header, such as paired devices, are not browsers
+var upgrader = websocket.Upgrader{}
 
 // WebSocketHub manages WebSocket connections
 type WebSocketHub struct {
@@ -33,10 +32,36 @@ type WebSocketHub struct {
 
 // WebSocketClient represents a WebSocket client
 type WebSocketClient struct {
+	id        string // Tells viewers of a session apart
 	hub       *WebSocketHub
 	conn      *websocket.Conn
 	send      chan []byte
 	sessionID string
+	reader    database.Reader  // User and device behind this connection
+	identity  string           // Authenticated device or user, see inputIdentity
+	apiKey    *database.APIKey // Key the connection was opened with, if any
+
+	// Decides which sessions the user behind the connection may see and do
+	// what in; accessUser is "" when authentication is off
+	access     *SessionAccessService
+	accessUser string
+
+	// Roles of the user in sessions, resolved when first needed, as on
+	// subscribe, and dropped when a session's access changes
+	roles   map[string]cachedRole
+	rolesMu sync.Mutex
+
+	// Set for viewers of a share link, who only ever receive frames of its
+	// session and never send anything to it
+	share *shareView
+
+	deviceName  string
+	deviceType  string
+	connectedAt time.Time
+
+	// Connections to paired devices for remote sessions, by session ID; only
+	// used by readPump
+	relays map[string]*remoteRelay
 }
 
 // WebSocketMessage represents a WebSocket message
@@ -54,6 +79,16 @@ type TerminalWebSocketService struct {
 	hub            *WebSocketHub
 	tmuxManager    *tmux.Manager
 	messageService *MessageService
+	inputQueue     *InputQueue
+	redaction      *RedactionService
+	migrations     *MigrationService
+	checkpoints    *CheckpointService
+	remote         *RemoteSessionService
+	leases         *LeaseService
+	access         *SessionAccessService
+	control        *InputControl
+	presence       *PresenceTracker
+	upgrader       websocket.Upgrader
 	monitors       map[string]context.CancelFunc
 	mu             sync.RWMutex
 }
@@ -71,6 +106,9 @@ func NewTerminalWebSocketService(tmuxManager *tmux.Manager, messageService *Mess
 		hub:            hub,
 		tmuxManager:    tmuxManager,
 		messageService: messageService,
+		control:        NewInputControl(),
+		presence:       NewPresenceTracker(),
+		upgrader:       upgrader,
 		monitors:       make(map[string]context.CancelFunc),
 	}
 
@@ -80,6 +118,79 @@ func NewTerminalWebSocketService(tmuxManager *tmux.Manager, messageService *Mess
 	return service
 }
 
+// SetInputQueue sets the queue used to deliver user messages to tools
+func (s *TerminalWebSocketService) SetInputQueue(inputQueue *InputQueue) {
+	s.inputQueue = inputQueue
+}
+
+// SetRedactionService sets the service that masks secrets in broadcast output
+func (s *TerminalWebSocketService) SetRedactionService(redaction *RedactionService) {
+	s.redaction = redaction
+}
+
+// SetMigrationService sets the service whose handovers block input to a session
+func (s *TerminalWebSocketService) SetMigrationService(migrations *MigrationService) {
+	s.migrations = migrations
+}
+
+// SetCheckpointService sets the service that checkpoints sessions before approvals
+func (s *TerminalWebSocketService) SetCheckpointService(checkpoints *CheckpointService) {
+	s.checkpoints = checkpoints
+}
+
+// SetRemoteSessionService sets the service that relays sessions of paired devices
+func (s *TerminalWebSocketService) SetRemoteSessionService(remote *RemoteSessionService) {
+	s.remote = remote
+}
+
+// SetLeaseService sets the service that refuses input to sessions leased by
+// another device
+func (s *TerminalWebSocketService) SetLeaseService(leases *LeaseService) {
+	s.leases = leases
+}
+
+// SetSessionAccess sets the service that decides who may see sessions
+func (s *TerminalWebSocketService) SetSessionAccess(access *SessionAccessService) {
+	s.access = access
+	access.OnChange(s.hub.forgetRole)
+}
+
+// SetOriginPolicy sets the browser origins WebSocket connections are accepted from
+func (s *TerminalWebSocketService) SetOriginPolicy(origins *auth.OriginPolicy) {
+	s.upgrader.CheckOrigin = origins.Allowed
+}
+
+// migrating reports whether a session is being handed over to another host
+func (s *TerminalWebSocketService) migrating(sessionID string) bool {
+	return s.migrations != nil && s.migrations.InProgress(sessionID)
+}
+
+// writable reports whether input to a session may be sent from this host: it is
+// not being migrated and no other device holds its lease
+func (s *TerminalWebSocketService) writable(sessionID string) bool {
+	if s.migrating(sessionID) {
+		return false
+	}
+	return s.leases == nil || s.leases.CheckWriter(sessionID) == nil
+}
+
+// CaptureOutput captures the current output of a session with secrets masked
+func (s *TerminalWebSocketService) CaptureOutput(ctx context.Context, sessionID string) (string, error) {
+	output, err := s.tmuxManager.CaptureOutput(ctx, sessionID)
+	if err != nil {
+		return "", err
+	}
+	return s.RedactOutput(ctx, sessionID, output), nil
+}
+
+// RedactOutput masks secrets in output that is about to be sent to clients
+func (s *TerminalWebSocketService) RedactOutput(ctx context.Context, sessionID string, output string) string {
+	if s.redaction == nil {
+		return output
+	}
+	return s.redaction.RedactOutput(ctx, sessionID, output)
+}
+
 // run runs the WebSocket hub
 func (h *WebSocketHub) run() {
 	for {
@@ -88,7 +199,7 @@ func (h *WebSocketHub) run() {
 			h.mu.Lock()
 			h.clients[client] = true
 			h.mu.Unlock()
-			log.Printf("Client registered: %v", client.sessionID)
+			log.Printf("Client registered: %s (user %s, device %s)", client.id, client.reader.UserID, client.reader.DeviceID)
 
 		case client := <-h.unregister:
 			h.mu.Lock()
@@ -97,13 +208,24 @@ func (h *WebSocketHub) run() {
 				close(client.send)
 			}
 			h.mu.Unlock()
-			log.Printf("Client unregistered: %v", client.sessionID)
+			log.Printf("Client unregistered: %s (session %s)", client.id, client.sessionID)
 
 		case message := <-h.broadcast:
+			sessionID := broadcastSessionID(message)
 			h.mu.RLock()
 			for client := range h.clients {
+				data := message
+				if client.share != nil {
+					var visible bool
+					if data, visible = client.share.frame(message); !visible {
+						continue
+					}
+				} else if sessionID != "" && client.role(sessionID) == "" {
+					// Clients that may not see the session never hear of it
+					continue
+				}
 				select {
-				case client.send <- message:
+				case client.send <- data:
 				default:
 					close(client.send)
 					delete(h.clients, client)
@@ -114,22 +236,57 @@ func (h *WebSocketHub) run() {
 	}
 }
 
+// forgetRole drops the roles clients cached in a session after its access changed
+func (h *WebSocketHub) forgetRole(sessionID string) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for client := range h.clients {
+		client.forgetRole(sessionID)
+	}
+}
+
+// broadcastSessionID returns the session a broadcast message is about
+func broadcastSessionID(message []byte) string {
+	var msg struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := json.Unmarshal(message, &msg); err != nil {
+		return ""
+	}
+	return msg.SessionID
+}
+
 // HandleWebSocket handles WebSocket connections
 func (s *TerminalWebSocketService) HandleWebSocket(c *gin.Context) {
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	conn, err := s.upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Printf("WebSocket upgrade failed: %v", err)
 		return
 	}
 
 	client := &WebSocketClient{
-		hub:  s.hub,
-		conn: conn,
-		send: make(chan []byte, 256),
+		id:          uuid.New().String(),
+		hub:         s.hub,
+		conn:        conn,
+		send:        make(chan []byte, 256),
+		reader:      readerFromRequest(c),
+		apiKey:      requestAPIKey(c),
+		access:      s.access,
+		accessUser:  accessUserID(c),
+		identity:    inputIdentity(c),
+		connectedAt: time.Now(),
 	}
+	client.deviceName, client.deviceType = deviceDetailsFromRequest(c)
 
 	client.hub.register <- client
 
+	// Tell the client its ID, so it can find itself in control states
+	s.sendTo(client, WebSocketMessage{
+		Action: "connected",
+		Type:   "status",
+		Data:   gin.H{"client_id": client.id},
+	})
+
 	// Start goroutines for reading and writing
 	go client.writePump()
 	go client.readPump(s)
@@ -138,6 +295,11 @@ func (s *TerminalWebSocketService) HandleWebSocket(c *gin.Context) {
 // readPump reads messages from the WebSocket connection
 func (c *WebSocketClient) readPump(s *TerminalWebSocketService) {
 	defer func() {
+		c.closeRelays()
+		// Hand control over before the client's channel is closed
+		if c.sessionID != "" {
+			s.leave(c, c.sessionID)
+		}
 		c.hub.unregister <- c
 		c.conn.Close()
 		// Stop monitoring if active
@@ -167,32 +329,56 @@ func (c *WebSocketClient) readPump(s *TerminalWebSocketService) {
 			continue
 		}
 
+		if err := s.permits(c, &msg); err != nil {
+			s.sendTo(c, WebSocketMessage{
+				Action:    "forbidden",
+				SessionID: msg.SessionID,
+				Type:      "status",
+				Data:      gin.H{"error": err.Error()},
+			})
+			continue
+		}
+
+		// Sessions running on a paired device are handled there
+		if s.relayRemote(c, &msg, message) {
+			continue
+		}
+		if c.sessionID != "" {
+			s.presence.Touch(c.sessionID, c)
+		}
+
 		switch msg.Action {
 		case "subscribe":
 			// Stop previous monitoring if any
 			if c.sessionID != "" {
 				s.stopMonitoring(c.sessionID)
+				c.closeRelay(c.sessionID)
+				if c.sessionID != msg.SessionID {
+					s.leave(c, c.sessionID)
+				}
 			}
 			c.sessionID = msg.SessionID
 			s.startMonitoring(c, msg.SessionID)
+			s.BroadcastControl(s.control.Join(msg.SessionID, c))
+			s.BroadcastPresence(s.presence.Join(msg.SessionID, c))
 			
 			// Send existing messages
 			s.sendExistingMessages(c, msg.SessionID)
 
 		case "unsubscribe":
 			s.stopMonitoring(msg.SessionID)
+			s.leave(c, msg.SessionID)
 			c.sessionID = ""
 
 		case "input":
-			if msg.SessionID != "" && msg.Input != "" {
+			if msg.SessionID != "" && msg.Input != "" && s.writable(msg.SessionID) && s.drive(c, msg.SessionID) {
 				s.sendInput(msg.SessionID, msg.Input)
 			}
 			
 		case "sendMessage":
 			// Handle user message
-			if msg.SessionID != "" && msg.Input != "" {
-				log.Printf("Received sendMessage: sessionID=%s, input=%s", msg.SessionID, msg.Input)
-				s.handleUserMessage(c, msg.SessionID, msg.Input)
+			if msg.SessionID != "" && msg.Input != "" && s.writable(msg.SessionID) && s.drive(c, msg.SessionID) {
+				s.handleUserMessage(c, msg.SessionID, msg.Input, parseAttachmentIDs(msg.Data))
 			}
 			
 		case "getMessages":
@@ -207,17 +393,172 @@ func (c *WebSocketClient) readPump(s *TerminalWebSocketService) {
 				s.sendExistingMessages(c, msg.SessionID)
 			}
 			
+		case "presence":
+			// The client went to the foreground or background
+			if state, ok := msg.Data.(string); ok && c.sessionID != "" && (state == PresenceForeground || state == PresenceBackground) {
+				if presence := s.presence.SetState(c.sessionID, c, state); presence != nil {
+					s.BroadcastPresence(presence)
+				}
+			}
+
+		case "requestControl", "grantControl", "denyControl", "releaseControl", "takeControl":
+			if msg.SessionID != "" {
+				s.handleControl(c, &msg)
+			}
+
 		case "markAsRead":
 			// Mark messages as read
 			if msg.SessionID != "" && msg.Data != nil {
 				if messageID, ok := msg.Data.(string); ok {
-					s.markMessagesAsRead(msg.SessionID, messageID)
+					s.markMessagesAsRead(c, msg.SessionID, messageID)
 				}
 			}
 		}
 	}
 }
 
+// cachedRole is a role of a client's user in a session
+type cachedRole struct {
+	role       string
+	resolvedAt time.Time
+}
+
+// role returns the role of the client's user in a session, or "" when they
+// may not see it. Roles are cached for as long as session access is, so
+// broadcasts do not look them up for every client.
+func (c *WebSocketClient) role(sessionID string) string {
+	if c.apiKey != nil && !c.apiKey.AllowsSession(sessionID) {
+		return ""
+	}
+	if c.access == nil {
+		return database.SessionRoleOwner
+	}
+
+	c.rolesMu.Lock()
+	cached, exists := c.roles[sessionID]
+	c.rolesMu.Unlock()
+	if exists && time.Since(cached.resolvedAt) < sessionACLTTL {
+		return cached.role
+	}
+
+	role := c.access.Role(c.accessUser, sessionID)
+	c.rolesMu.Lock()
+	if c.roles == nil {
+		c.roles = make(map[string]cachedRole)
+	}
+	c.roles[sessionID] = cachedRole{role: role, resolvedAt: time.Now()}
+	c.rolesMu.Unlock()
+	return role
+}
+
+// forgetRole drops the cached role of the client's user in a session
+func (c *WebSocketClient) forgetRole(sessionID string) {
+	c.rolesMu.Lock()
+	delete(c.roles, sessionID)
+	c.rolesMu.Unlock()
+}
+
+// permits checks a client message against the user's role in its session and
+// the API key the connection was opened with
+func (s *TerminalWebSocketService) permits(c *WebSocketClient, msg *WebSocketMessage) error {
+	if msg.SessionID == "" {
+		return nil
+	}
+
+	required := database.SessionRoleViewer
+	switch msg.Action {
+	case "input", "takeControl":
+		// Taking control overrides the driver, so it needs the right to drive
+		required = database.SessionRoleOperator
+	case "sendMessage", "requestControl", "grantControl", "denyControl", "releaseControl":
+		required = database.SessionRoleCommenter
+	}
+	if err := checkRole(c.role(msg.SessionID), required); err != nil {
+		return err
+	}
+
+	if c.apiKey == nil {
+		return nil
+	}
+	switch msg.Action {
+	case "input":
+		return checkInputKey(context.Background(), s.tmuxManager, c.apiKey, msg.SessionID)
+	case "sendMessage", "requestControl", "grantControl", "denyControl", "releaseControl", "takeControl":
+		if !c.apiKey.HasScope(database.ScopeSendInput) {
+			return fmt.Errorf("%w: %s", ErrScopeRequired, database.ScopeSendInput)
+		}
+	}
+	return nil
+}
+
+// relayRemote passes a client message about a session running on a paired
+// device on to it, and reports whether it did
+func (s *TerminalWebSocketService) relayRemote(c *WebSocketClient, msg *WebSocketMessage, frame []byte) bool {
+	if s.remote == nil || msg.SessionID == "" {
+		return false
+	}
+	if msg.Action == "unsubscribe" {
+		if _, exists := c.relays[msg.SessionID]; !exists {
+			return false
+		}
+		c.closeRelay(msg.SessionID)
+		if c.sessionID == msg.SessionID {
+			c.sessionID = ""
+		}
+		return true
+	}
+
+	ctx := context.Background()
+	relay, exists := c.relays[msg.SessionID]
+	if !exists {
+		device := s.remote.Owner(ctx, msg.SessionID, c.reader)
+		if device == nil {
+			return false
+		}
+
+		var err error
+		relay, err = s.remote.Relay(ctx, device, msg.SessionID, c.reader)
+		if err != nil {
+			log.Printf("Failed to relay session %s: %v", msg.SessionID, err)
+			return true
+		}
+		if c.relays == nil {
+			c.relays = make(map[string]*remoteRelay)
+		}
+		c.relays[msg.SessionID] = relay
+		go relay.pump(c)
+	}
+
+	if msg.Action == "subscribe" && c.sessionID != msg.SessionID {
+		if c.sessionID != "" {
+			s.stopMonitoring(c.sessionID)
+			c.closeRelay(c.sessionID)
+			s.leave(c, c.sessionID)
+		}
+		c.sessionID = msg.SessionID
+	}
+	if err := relay.forward(frame); err != nil {
+		log.Printf("Failed to relay to %s for session %s: %v", relay.deviceID, msg.SessionID, err)
+		c.closeRelay(msg.SessionID)
+	}
+	return true
+}
+
+// closeRelay closes the relay of a remote session, if any
+func (c *WebSocketClient) closeRelay(sessionID string) {
+	if relay, exists := c.relays[sessionID]; exists {
+		relay.close()
+		delete(c.relays, sessionID)
+	}
+}
+
+// closeRelays closes every relay of the client
+func (c *WebSocketClient) closeRelays() {
+	for sessionID := range c.relays {
+		c.closeRelay(sessionID)
+	}
+}
+
 // writePump writes messages to the WebSocket connection
 func (c *WebSocketClient) writePump() {
 	ticker := time.NewTicker(54 * time.Second)
@@ -269,7 +610,7 @@ func (s *TerminalWebSocketService) startMonitoring(client *WebSocketClient, sess
 			case <-ctx.Done():
 				return
 			case <-ticker.C:
-				output, err := s.tmuxManager.CaptureOutput(context.Background(), sessionID)
+				output, err := s.CaptureOutput(context.Background(), sessionID)
 				if err != nil {
 					log.Printf("Failed to capture output for session %s: %v", sessionID, err)
 					continue
@@ -310,6 +651,9 @@ func (s *TerminalWebSocketService) stopMonitoring(sessionID string) {
 // sendInput sends input to a session
 func (s *TerminalWebSocketService) sendInput(sessionID string, input string) {
 	ctx := context.Background()
+	if s.checkpoints != nil {
+		s.checkpoints.BeforeInput(ctx, sessionID, input)
+	}
 	if err := s.tmuxManager.SendCommand(ctx, sessionID, input); err != nil {
 		log.Printf("Failed to send input to session %s: %v", sessionID, err)
 	}
@@ -320,7 +664,7 @@ func (s *TerminalWebSocketService) BroadcastToSession(sessionID string, output s
 	msg := WebSocketMessage{
 		Action:    "output",
 		SessionID: sessionID,
-		Output:    output,
+		Output:    s.RedactOutput(context.Background(), sessionID, output),
 	}
 	data, _ := json.Marshal(msg)
 	s.hub.broadcast <- data
@@ -345,6 +689,141 @@ func (s *TerminalWebSocketService) BroadcastTypingIndicator(sessionID string, is
 }
 
 
+// leave removes a client from the viewers of a session
+func (s *TerminalWebSocketService) leave(c *WebSocketClient, sessionID string) {
+	if state := s.control.Leave(sessionID, c); state != nil {
+		s.BroadcastControl(state)
+	}
+	if presence := s.presence.Leave(sessionID, c); presence != nil {
+		s.BroadcastPresence(presence)
+	}
+}
+
+// Presence returns who is viewing a session
+func (s *TerminalWebSocketService) Presence(sessionID string) *SessionPresence {
+	return s.presence.Session(sessionID)
+}
+
+// Viewing reports whether a device has a session in the foreground, in which
+// case notifications about the session should not be pushed to it
+func (s *TerminalWebSocketService) Viewing(sessionID string, deviceID string) bool {
+	return s.presence.Viewing(sessionID, deviceID)
+}
+
+// BroadcastPresence notifies clients who is viewing a session
+func (s *TerminalWebSocketService) BroadcastPresence(presence *SessionPresence) {
+	msg := WebSocketMessage{
+		Action:    "presence",
+		SessionID: presence.SessionID,
+		Type:      "status",
+		Data:      presence,
+	}
+	data, _ := json.Marshal(msg)
+	s.hub.broadcast <- data
+}
+
+// drive reports whether a client may send input to a session, telling it who
+// drives the session when it may not
+func (s *TerminalWebSocketService) drive(c *WebSocketClient, sessionID string) bool {
+	allowed, state := s.control.Drive(sessionID, c)
+	if state != nil {
+		// Became the driver
+		s.BroadcastControl(state)
+	}
+	if !allowed {
+		s.sendTo(c, WebSocketMessage{
+			Action:    "inputRejected",
+			SessionID: sessionID,
+			Type:      "status",
+			Data:      s.control.State(sessionID),
+		})
+	}
+	return allowed
+}
+
+// MayDrive reports whether input sent outside the WebSocket, by an
+// authenticated device or user, may reach a session, given who drives it
+func (s *TerminalWebSocketService) MayDrive(sessionID string, identity string) bool {
+	return s.control.MayDrive(sessionID, identity)
+}
+
+// ControlState returns who drives a session and who observes it
+func (s *TerminalWebSocketService) ControlState(sessionID string) *ControlState {
+	return s.control.State(sessionID)
+}
+
+// handleControl handles requests to hand input control of a session over. The
+// client ID of the viewer to grant control to, or deny it, is the data.
+func (s *TerminalWebSocketService) handleControl(c *WebSocketClient, msg *WebSocketMessage) {
+	clientID, _ := msg.Data.(string)
+
+	var state *ControlState
+	var err error
+	switch msg.Action {
+	case "requestControl":
+		var driver *WebSocketClient
+		state, driver, err = s.control.Request(msg.SessionID, c)
+		if driver != nil {
+			s.sendTo(driver, WebSocketMessage{
+				Action:    "controlRequested",
+				SessionID: msg.SessionID,
+				Type:      "status",
+				Data:      state.Requests,
+			})
+		}
+	case "grantControl":
+		state, err = s.control.Grant(msg.SessionID, c, clientID)
+	case "denyControl":
+		var requester *WebSocketClient
+		state, requester, err = s.control.Deny(msg.SessionID, c, clientID)
+		if requester != nil {
+			s.sendTo(requester, WebSocketMessage{
+				Action:    "controlDenied",
+				SessionID: msg.SessionID,
+				Type:      "status",
+				Data:      state,
+			})
+		}
+	case "releaseControl":
+		state, err = s.control.Release(msg.SessionID, c)
+	case "takeControl":
+		state, err = s.control.Take(msg.SessionID, c)
+	}
+
+	if err != nil {
+		s.sendTo(c, WebSocketMessage{
+			Action:    "controlError",
+			SessionID: msg.SessionID,
+			Type:      "status",
+			Data:      gin.H{"error": err.Error(), "state": s.control.State(msg.SessionID)},
+		})
+		return
+	}
+	s.BroadcastControl(state)
+}
+
+// BroadcastControl notifies the viewers of a session who drives it and who observes it
+func (s *TerminalWebSocketService) BroadcastControl(state *ControlState) {
+	msg := WebSocketMessage{
+		Action:    "controlState",
+		SessionID: state.SessionID,
+		Type:      "status",
+		Data:      state,
+	}
+	data, _ := json.Marshal(msg)
+	s.hub.broadcast <- data
+}
+
+// sendTo sends a message to one client
+func (s *TerminalWebSocketService) sendTo(client *WebSocketClient, msg WebSocketMessage) {
+	data, _ := json.Marshal(msg)
+	select {
+	case client.send <- data:
+	default:
+		// Client buffer full
+	}
+}
+
 // sendExistingMessages sends existing messages to the client
 func (s *TerminalWebSocketService) sendExistingMessages(client *WebSocketClient, sessionID string) {
 	ctx := context.Background()
@@ -370,19 +849,16 @@ func (s *TerminalWebSocketService) sendExistingMessages(client *WebSocketClient,
 }
 
 // handleUserMessage handles a user message
-func (s *TerminalWebSocketService) handleUserMessage(client *WebSocketClient, sessionID string, content string) {
-	log.Printf("handleUserMessage called: sessionID=%s, content=%s", sessionID, content)
+func (s *TerminalWebSocketService) handleUserMessage(client *WebSocketClient, sessionID string, content string, attachmentIDs []uuid.UUID) {
 	ctx := context.Background()
 	
-	// Create user message immediately for UI feedback
-	message, err := s.messageService.CreateUserMessage(ctx, sessionID, content, true)
+	// Queue the message; it is typed into tmux once the tool is ready for input
+	message, err := s.inputQueue.Enqueue(ctx, client.reader, sessionID, content, attachmentIDs)
 	if err != nil {
-		log.Printf("Failed to create user message: %v", err)
+		log.Printf("Failed to queue user message: %v", err)
 		return
 	}
 
-	log.Printf("Created user message: %+v", message)
-
 	// Broadcast the user message to all clients immediately
 	msg := WebSocketMessage{
 		Action:    "newMessage",
@@ -391,22 +867,117 @@ func (s *TerminalWebSocketService) handleUserMessage(client *WebSocketClient, se
 		Data:      message,
 	}
 	data, _ := json.Marshal(msg)
-	log.Printf("Broadcasting message: %s", string(data))
 	s.hub.broadcast <- data
-	
-	// Send the input to tmux
-	if strings.HasPrefix(content, "/") {
-		// Remove the "/" prefix and send as command
-		command := strings.TrimPrefix(content, "/")
-		s.tmuxManager.SendCommand(ctx, sessionID, command)
-	} else {
-		// Send the message directly to Claude using literal input
-		s.tmuxManager.SendLiteralInput(ctx, sessionID, content)
+}
+
+// BroadcastGitSnapshot broadcasts the repository changes captured for an agent turn
+func (s *TerminalWebSocketService) BroadcastGitSnapshot(sessionID string, snapshot *database.GitTurnSnapshot) {
+	msg := WebSocketMessage{
+		Action:    "gitSnapshot",
+		SessionID: sessionID,
+		Type:      "status",
+		Data:      snapshot,
+	}
+	data, _ := json.Marshal(msg)
+	s.hub.broadcast <- data
+}
+
+// BroadcastBudgetExceeded notifies clients that a session went over its budget
+func (s *TerminalWebSocketService) BroadcastBudgetExceeded(sessionID string, budget *database.SessionBudget, totals *database.UsageTotals) {
+	msg := WebSocketMessage{
+		Action:    "budgetExceeded",
+		SessionID: sessionID,
+		Type:      "status",
+		Data: map[string]interface{}{
+			"budget": budget,
+			"totals": totals,
+		},
+	}
+	data, _ := json.Marshal(msg)
+	s.hub.broadcast <- data
+}
+
+// BroadcastMigration notifies clients that a session moved to another device
+func (s *TerminalWebSocketService) BroadcastMigration(sessionID string, migration *database.SessionMigration) {
+	msg := WebSocketMessage{
+		Action:    "sessionMigrated",
+		SessionID: sessionID,
+		Type:      "status",
+		Data:      migration,
 	}
+	data, _ := json.Marshal(msg)
+	s.hub.broadcast <- data
 }
 
-// markMessagesAsRead marks messages as read
-func (s *TerminalWebSocketService) markMessagesAsRead(sessionID string, messageID string) {
+// BroadcastCheckpoint notifies clients that a checkpoint was taken
+func (s *TerminalWebSocketService) BroadcastCheckpoint(sessionID string, checkpoint *database.SessionCheckpoint) {
+	msg := WebSocketMessage{
+		Action:    "checkpointCreated",
+		SessionID: sessionID,
+		Type:      "status",
+		Data:      checkpoint,
+	}
+	data, _ := json.Marshal(msg)
+	s.hub.broadcast <- data
+}
+
+// BroadcastCheckpointRestored notifies clients that a session was rolled back
+// to a checkpoint, so they reload its messages
+func (s *TerminalWebSocketService) BroadcastCheckpointRestored(sessionID string, checkpoint *database.SessionCheckpoint) {
+	msg := WebSocketMessage{
+		Action:    "checkpointRestored",
+		SessionID: sessionID,
+		Type:      "status",
+		Data:      checkpoint,
+	}
+	data, _ := json.Marshal(msg)
+	s.hub.broadcast <- data
+}
+
+// BroadcastLease notifies clients that the lease of a session changed hands
+func (s *TerminalWebSocketService) BroadcastLease(sessionID string, lease *LeaseResponse) {
+	msg := WebSocketMessage{
+		Action:    "leaseChanged",
+		SessionID: sessionID,
+		Type:      "status",
+		Data:      lease,
+	}
+	data, _ := json.Marshal(msg)
+	s.hub.broadcast <- data
+}
+
+// BroadcastDeliveryStatus broadcasts a delivery status change of a queued user message
+func (s *TerminalWebSocketService) BroadcastDeliveryStatus(sessionID string, message *database.TerminalMessage) {
+	msg := WebSocketMessage{
+		Action:    "messageStatus",
+		SessionID: sessionID,
+		Type:      "message",
+		Data:      message,
+	}
+	data, _ := json.Marshal(msg)
+	s.hub.broadcast <- data
+}
+
+// parseAttachmentIDs extracts attachment IDs sent as the data of a sendMessage action
+func parseAttachmentIDs(data interface{}) []uuid.UUID {
+	items, ok := data.([]interface{})
+	if !ok {
+		return nil
+	}
+
+	var ids []uuid.UUID
+	for _, item := range items {
+		if str, ok := item.(string); ok {
+			if id, err := uuid.Parse(str); err == nil {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// markMessagesAsRead marks messages as read for the client's user and device
+func (s *TerminalWebSocketService) markMessagesAsRead(client *WebSocketClient, sessionID string, messageID string) {
 	ctx := context.Background()
 	
 	id, err := uuid.Parse(messageID)
@@ -415,9 +986,26 @@ func (s *TerminalWebSocketService) markMessagesAsRead(sessionID string, messageI
 		return
 	}
 	
-	if err := s.messageService.MarkAsRead(ctx, sessionID, id); err != nil {
+	cursor, err := s.messageService.MarkAsRead(ctx, client.reader, sessionID, id)
+	if err != nil {
 		log.Printf("Failed to mark messages as read: %v", err)
+		return
 	}
+
+	s.BroadcastReadState(sessionID, cursor)
+}
+
+// BroadcastReadState broadcasts a reader's updated cursor so their other
+// connections on the same device can clear badges
+func (s *TerminalWebSocketService) BroadcastReadState(sessionID string, cursor *database.ReadCursor) {
+	msg := WebSocketMessage{
+		Action:    "readState",
+		SessionID: sessionID,
+		Type:      "status",
+		Data:      cursor,
+	}
+	data, _ := json.Marshal(msg)
+	s.hub.broadcast <- data
 }
 
 // monitorAndConvertOutput monitors tmux output and converts to messages
@@ -431,7 +1019,7 @@ func (s *TerminalWebSocketService) monitorAndConvertOutput(ctx context.Context,
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			output, err := s.tmuxManager.CaptureOutput(ctx, sessionID)
+			output, err := s.CaptureOutput(ctx, sessionID)
 			if err != nil {
 				log.Printf("Failed to capture output for session %s: %v", sessionID, err)
 				continue
@@ -11,6 +11,7 @@ import (
 	"time"
 	
 	"github.com/hashicorp/mdns"
+	"github.com/majiayu000/anywhere-ai/core/deviceauth"
 )
 
 // MDNSDiscoveryService implements device discovery using mDNS (Bonjour/Zeroconf)
@@ -32,6 +33,10 @@ type MDNSDiscoveryService struct {
 	
 	// HTTP client for inter-device communication
 	httpClient *http.Client
+	
+	// Certificate presented to peers, and the paired devices they must be
+	identity *deviceauth.Identity
+	store    DeviceStore
 }
 
 // DiscoveryEvent represents a discovery event
@@ -78,6 +83,34 @@ func NewMDNSDiscoveryService(deviceID, deviceName, deviceType string, port int)
 	}
 }
 
+// SetTLS sets the certificate this device presents and the store of paired
+// devices. Without it the inter-device HTTP server is not started, and
+// ConnectToDevice refuses, since neither side could authenticate the other.
+func (d *MDNSDiscoveryService) SetTLS(identity *deviceauth.Identity, store DeviceStore) {
+	d.identity = identity
+	d.store = store
+}
+
+// pairedDevice returns the paired device with deviceID, or with a certificate fingerprint
+func (d *MDNSDiscoveryService) pairedDevice(deviceID, fingerprint string) (*PairedDevice, error) {
+	if d.store == nil {
+		return nil, fmt.Errorf("no paired devices")
+	}
+	devices, err := d.store.ListDevices()
+	if err != nil {
+		return nil, err
+	}
+	for _, device := range devices {
+		if device.CertFingerprint == "" {
+			continue
+		}
+		if (deviceID != "" && device.ID == deviceID) || (fingerprint != "" && device.CertFingerprint == fingerprint) {
+			return device, nil
+		}
+	}
+	return nil, fmt.Errorf("device is not paired")
+}
+
 // Announce announces this device and its sessions
 func (d *MDNSDiscoveryService) Announce(device DeviceInfo, sessions []string) error {
 	// Create mDNS service info
@@ -177,12 +210,22 @@ func (d *MDNSDiscoveryService) ConnectToDevice(deviceID string) (RemoteConnectio
 		return RemoteConnection{}, fmt.Errorf("device %s not found", deviceID)
 	}
 	
-	baseURL := fmt.Sprintf("http://%s:%d", device.IPAddress, device.Port)
+	// mDNS records are not authenticated: only talk to the pinned certificate
+	// of a paired device
+	if d.identity == nil {
+		return RemoteConnection{}, fmt.Errorf("no device identity to connect with")
+	}
+	paired, err := d.pairedDevice(deviceID, "")
+	if err != nil {
+		return RemoteConnection{}, fmt.Errorf("device %s: %w", deviceID, err)
+	}
+	
+	baseURL := fmt.Sprintf("https://%s:%d", device.IPAddress, device.Port)
 	
 	return RemoteConnection{
 		deviceID:   deviceID,
 		baseURL:    baseURL,
-		httpClient: d.httpClient,
+		httpClient: d.identity.Client(paired.CertFingerprint, d.httpClient.Timeout),
 	}, nil
 }
 
@@ -214,8 +257,14 @@ func (d *MDNSDiscoveryService) parseServiceEntry(entry *mdns.ServiceEntry) *Devi
 	return device
 }
 
-// startHTTPServer starts HTTP server for inter-device communication
+// startHTTPServer starts the mutual TLS server for inter-device communication.
+// Every endpoint but /health requires the certificate of a paired device.
 func (d *MDNSDiscoveryService) startHTTPServer() {
+	if d.identity == nil {
+		fmt.Printf("Not serving inter-device endpoints: no device identity\n")
+		return
+	}
+	
 	mux := http.NewServeMux()
 	
 	// Health check endpoint
@@ -229,14 +278,15 @@ func (d *MDNSDiscoveryService) startHTTPServer() {
 	})
 	
 	// Session migration endpoint
-	mux.HandleFunc("/migrate", d.handleMigrationRequest)
+	mux.HandleFunc("/migrate", d.requirePairedDevice(d.handleMigrationRequest))
 	
 	// Session info endpoint
-	mux.HandleFunc("/sessions", d.handleSessionInfo)
+	mux.HandleFunc("/sessions", d.requirePairedDevice(d.handleSessionInfo))
 	
 	server := &http.Server{
-		Addr:    fmt.Sprintf(":%d", d.port),
-		Handler: mux,
+		Addr:      fmt.Sprintf(":%d", d.port),
+		Handler:   mux,
+		TLSConfig: d.identity.ServerTLSConfig(),
 	}
 	
 	// Start server
@@ -246,7 +296,18 @@ func (d *MDNSDiscoveryService) startHTTPServer() {
 		return
 	}
 	
-	server.Serve(ln)
+	server.ServeTLS(ln, "", "")
+}
+
+// requirePairedDevice rejects requests from clients without the certificate of a paired device
+func (d *MDNSDiscoveryService) requirePairedDevice(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, err := d.pairedDevice("", deviceauth.PeerFingerprint(r.TLS)); err != nil {
+			http.Error(w, "Unknown device", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
 }
 
 // handleMigrationRequest handles session migration requests
@@ -262,23 +323,17 @@ func (d *MDNSDiscoveryService) handleMigrationRequest(w http.ResponseWriter, r *
 		return
 	}
 	
-	// TODO: Implement actual migration logic
-	// This would involve:
-	// 1. Creating a checkpoint of the session
-	// 2. Stopping the local session
-	// 3. Returning the checkpoint data
-	
+	// Sessions are handed over by the host running them, which checkpoints the
+	// session, leases it to the target and stops it (POST /api/v1/migrations on
+	// the anywhere server). Answering here with an empty checkpoint would let the
+	// caller start a second copy of a session that is still running.
 	resp := MigrationResponse{
-		Success: true,
-		Checkpoint: &SessionCheckpoint{
-			ID:        fmt.Sprintf("checkpoint-%d", time.Now().Unix()),
-			SessionID: req.SessionID,
-			Timestamp: time.Now(),
-			// TODO: Add actual checkpoint data
-		},
+		Success: false,
+		Error:   fmt.Sprintf("session %s must be migrated by its host through /api/v1/migrations", req.SessionID),
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotImplemented)
 	json.NewEncoder(w).Encode(resp)
 }
 
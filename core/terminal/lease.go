@@ -0,0 +1,57 @@
+package terminal
+
+import (
+	"errors"
+	"time"
+)
+
+// DefaultLeaseTTL is how long a session lease lasts without a heartbeat
+const DefaultLeaseTTL = 30 * time.Second
+
+// ErrLeaseHeld is returned when another device holds the lease of a session
+var ErrLeaseHeld = errors.New("session is leased by another device")
+
+// Lease states
+const (
+	LeaseStateHeld    = "held"    // A device holds the lease
+	LeaseStateExpired = "expired" // The last holder stopped renewing it
+	LeaseStateFree    = "free"    // Released, or never taken
+)
+
+// SessionLease is the right of one device to run a session's process and write
+// to it. The holder renews it by heartbeat; once it expires another device may
+// take the session over. Epoch grows each time the lease changes hands, so a
+// device can tell that it lost the session in between.
+type SessionLease struct {
+	SessionID string    `json:"session_id"`
+	DeviceID  string    `json:"device_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Epoch     int64     `json:"epoch"`
+}
+
+// State returns the state of the lease at now
+func (l *SessionLease) State(now time.Time) string {
+	switch {
+	case l.DeviceID == "" || l.ExpiresAt.IsZero():
+		return LeaseStateFree
+	case now.Before(l.ExpiresAt):
+		return LeaseStateHeld
+	default:
+		return LeaseStateExpired
+	}
+}
+
+// HeldBy reports whether deviceID holds the lease at now
+func (l *SessionLease) HeldBy(deviceID string, now time.Time) bool {
+	return l.DeviceID == deviceID && l.State(now) == LeaseStateHeld
+}
+
+// Lease returns the lease recorded with a session
+func (s *SessionState) Lease() *SessionLease {
+	return &SessionLease{
+		SessionID: s.ID,
+		DeviceID:  s.CurrentDeviceID,
+		ExpiresAt: s.LeaseExpiresAt,
+		Epoch:     s.LeaseEpoch,
+	}
+}
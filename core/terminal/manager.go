@@ -81,6 +81,9 @@ func (m *Manager) CreateSession(name string) (*Session, error) {
 		AutoRestart:      m.config.AutoRestart,
 		RestartDelay:     m.config.RestartDelay,
 	})
+	if err := session.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start session: %w", err)
+	}
 	
 	// Store session
 	m.sessions[sessionID] = session
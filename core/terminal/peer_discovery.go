@@ -0,0 +1,460 @@
+package terminal
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/majiayu000/anywhere-ai/core/deviceauth"
+)
+
+// DeviceIdentityPath is where a device describes itself to peers
+const DeviceIdentityPath = "/api/v1/devices/self"
+
+// PeerPollInterval is how often PeerDiscoveryService probes its peers
+const PeerPollInterval = 30 * time.Second
+
+// PairedDevice is a device this one has paired with through an invite
+type PairedDevice struct {
+	ID     string
+	Name   string
+	Type   string
+	URL    string
+	Secret string // Shared at pairing; proves the device's identity
+
+	CertFingerprint string // Certificate pinned at pairing
+}
+
+// DeviceStore persists paired devices
+type DeviceStore interface {
+	// List paired devices
+	ListDevices() ([]*PairedDevice, error)
+
+	// Record that a device answered a probe
+	MarkDeviceSeen(deviceID string, seen time.Time) error
+}
+
+// StaticPeer is a configured peer address, optionally pinned to a device ID
+type StaticPeer struct {
+	DeviceID string
+	URL      string
+}
+
+// DeviceIdentity is what a device reports at DeviceIdentityPath. Sessions and
+// Proof are only set when the caller is paired with it.
+type DeviceIdentity struct {
+	DeviceID   string   `json:"device_id"`
+	DeviceName string   `json:"device_name"`
+	DeviceType string   `json:"device_type"`
+	Sessions   []string `json:"sessions"`
+	Proof      string   `json:"proof,omitempty"`
+}
+
+// DeviceProof answers a probe nonce with the secret shared by two paired devices
+func DeviceProof(secret, nonce, deviceID string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(nonce + "\n" + deviceID))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ParseStaticPeers parses a comma separated peer list. Each entry is a base
+// URL, or device_id=URL to reject a peer reporting another identity.
+func ParseStaticPeers(list string) ([]StaticPeer, error) {
+	peers := []StaticPeer{}
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		peer := StaticPeer{URL: entry}
+		if i := strings.Index(entry, "="); i > 0 && !strings.Contains(entry[:i], "/") {
+			peer.DeviceID, peer.URL = entry[:i], entry[i+1:]
+		}
+		parsed, err := url.Parse(peer.URL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, fmt.Errorf("invalid peer URL %q", peer.URL)
+		}
+		peer.URL = strings.TrimSuffix(peer.URL, "/")
+		peers = append(peers, peer)
+	}
+	return peers, nil
+}
+
+// PeerDiscoveryService implements device discovery over a configured peer list
+// and the devices paired through invites, for networks mDNS does not reach.
+// Peers are probed over mutual TLS once SetIdentity is called; a paired device
+// must present its pinned certificate and prove its identity with the shared
+// secret, and a static peer pinned to a device ID must report that ID.
+type PeerDiscoveryService struct {
+	deviceID   string
+	deviceName string
+	deviceType string
+
+	peers []StaticPeer
+	store DeviceStore
+
+	// Devices that answered the last probe, their base URLs and pinned certificates
+	devices      map[string]*DeviceInfo
+	urls         map[string]string
+	fingerprints map[string]string
+	devicesMutex sync.RWMutex
+
+	// Event channel
+	eventChan chan DiscoveryEvent
+
+	// HTTP client for probes and inter-device communication, and the identity
+	// that replaces it with mutual TLS
+	httpClient *http.Client
+	identity   *deviceauth.Identity
+	dial       DeviceDialer
+
+	stop      chan struct{}
+	startOnce sync.Once
+	closeOnce sync.Once
+}
+
+var _ DiscoveryService = (*PeerDiscoveryService)(nil)
+
+// NewPeerDiscoveryService creates a new peer list discovery service
+func NewPeerDiscoveryService(deviceID, deviceName, deviceType string, peers []StaticPeer, store DeviceStore) *PeerDiscoveryService {
+	return &PeerDiscoveryService{
+		deviceID:     deviceID,
+		deviceName:   deviceName,
+		deviceType:   deviceType,
+		peers:        peers,
+		store:        store,
+		devices:      make(map[string]*DeviceInfo),
+		urls:         make(map[string]string),
+		fingerprints: make(map[string]string),
+		eventChan:    make(chan DiscoveryEvent, 100),
+		httpClient: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		stop: make(chan struct{}),
+	}
+}
+
+// DeviceDialer connects to a device some other way than by its URL, such as
+// through a tunnel it opened
+type DeviceDialer func(ctx context.Context, deviceID, network, addr string) (net.Conn, error)
+
+// SetDialer sets how paired devices are connected to
+func (d *PeerDiscoveryService) SetDialer(dial DeviceDialer) {
+	d.dial = dial
+}
+
+// SetIdentity sets the certificate presented to peers. Paired devices are then
+// only accepted with the certificate pinned at pairing.
+func (d *PeerDiscoveryService) SetIdentity(identity *deviceauth.Identity) {
+	d.identity = identity
+}
+
+// client returns the HTTP client for a peer with a pinned certificate fingerprint
+func (d *PeerDiscoveryService) client(deviceID, fingerprint string) *http.Client {
+	if d.identity == nil {
+		return d.httpClient
+	}
+
+	transport := &http.Transport{
+		TLSClientConfig:   d.identity.ClientTLSConfig(fingerprint),
+		DisableKeepAlives: true,
+	}
+	if d.dial != nil && deviceID != "" {
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return d.dial(ctx, deviceID, network, addr)
+		}
+	}
+	return &http.Client{Timeout: d.httpClient.Timeout, Transport: transport}
+}
+
+// Announce starts probing peers every PeerPollInterval. Peers learn about this
+// device and its sessions by probing it in turn.
+func (d *PeerDiscoveryService) Announce(device DeviceInfo, sessions []string) error {
+	d.startOnce.Do(func() {
+		go d.poll()
+	})
+	return nil
+}
+
+// poll probes peers until the service is closed
+func (d *PeerDiscoveryService) poll() {
+	ticker := time.NewTicker(PeerPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := d.Discover(); err != nil {
+			log.Printf("Peer discovery failed: %v", err)
+		}
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// peerTarget is a peer to probe
+type peerTarget struct {
+	url         string
+	deviceID    string // Expected device ID, if known
+	secret      string // Shared secret, if paired
+	fingerprint string // Pinned certificate, if paired
+}
+
+// Discover probes the paired devices and static peers
+func (d *PeerDiscoveryService) Discover() ([]DeviceInfo, error) {
+	targets, err := d.targets()
+	if err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		device      DeviceInfo
+		url         string
+		fingerprint string
+	}
+	results := make(chan *result, len(targets))
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		wg.Add(1)
+		go func(target peerTarget) {
+			defer wg.Done()
+			device, err := d.probe(target)
+			if err != nil {
+				log.Printf("Peer %s: %v", target.url, err)
+				results <- nil
+				return
+			}
+			results <- &result{device: *device, url: target.url, fingerprint: target.fingerprint}
+		}(target)
+	}
+	wg.Wait()
+	close(results)
+
+	paired := make(map[string]bool)
+	for _, target := range targets {
+		if target.secret != "" {
+			paired[target.deviceID] = true
+		}
+	}
+
+	found := make(map[string]*DeviceInfo)
+	urls := make(map[string]string)
+	fingerprints := make(map[string]string)
+	devices := []DeviceInfo{}
+	for r := range results {
+		if r == nil {
+			continue
+		}
+		if paired[r.device.ID] && !r.device.hasCapability("paired") {
+			// Only the paired device may use its ID
+			log.Printf("Peer %s claims paired device %s without proof", r.url, r.device.ID)
+			continue
+		}
+		if _, duplicate := found[r.device.ID]; duplicate {
+			continue
+		}
+		device := r.device
+		found[device.ID] = &device
+		urls[device.ID] = r.url
+		fingerprints[device.ID] = r.fingerprint
+		devices = append(devices, device)
+
+		if d.store != nil && device.hasCapability("paired") {
+			if err := d.store.MarkDeviceSeen(device.ID, device.LastSeen); err != nil {
+				log.Printf("Failed to record device %s as seen: %v", device.ID, err)
+			}
+		}
+	}
+
+	d.devicesMutex.Lock()
+	previous := d.devices
+	d.devices = found
+	d.urls = urls
+	d.fingerprints = fingerprints
+	d.devicesMutex.Unlock()
+
+	for id, device := range found {
+		d.emit(DiscoveryEvent{Type: "device_found", DeviceID: id, Device: *device, Sessions: device.Sessions})
+	}
+	for id, device := range previous {
+		if _, exists := found[id]; !exists {
+			d.emit(DiscoveryEvent{Type: "device_lost", DeviceID: id, Device: *device})
+		}
+	}
+
+	return devices, nil
+}
+
+// targets lists the paired devices followed by the static peers not paired
+func (d *PeerDiscoveryService) targets() ([]peerTarget, error) {
+	targets := []peerTarget{}
+	paired := make(map[string]bool)
+	if d.store != nil {
+		devices, err := d.store.ListDevices()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list paired devices: %w", err)
+		}
+		for _, device := range devices {
+			targets = append(targets, peerTarget{url: device.URL, deviceID: device.ID, secret: device.Secret, fingerprint: device.CertFingerprint})
+			paired[device.ID] = true
+			paired[device.URL] = true
+		}
+	}
+
+	for _, peer := range d.peers {
+		if paired[peer.URL] || (peer.DeviceID != "" && paired[peer.DeviceID]) {
+			continue
+		}
+		targets = append(targets, peerTarget{url: peer.URL, deviceID: peer.DeviceID})
+	}
+	return targets, nil
+}
+
+// probe asks a peer for its identity and checks it against what is expected
+func (d *PeerDiscoveryService) probe(target peerTarget) (*DeviceInfo, error) {
+	if d.identity != nil && target.secret != "" && target.fingerprint == "" {
+		return nil, fmt.Errorf("device %s was paired without a certificate; pair it again", target.deviceID)
+	}
+
+	nonceBytes := make([]byte, 16)
+	if _, err := rand.Read(nonceBytes); err != nil {
+		return nil, err
+	}
+	nonce := hex.EncodeToString(nonceBytes)
+
+	query := url.Values{"nonce": {nonce}}
+	resp, err := d.client(target.deviceID, target.fingerprint).Get(target.url + DeviceIdentityPath + "?" + query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("probe failed with status %d", resp.StatusCode)
+	}
+
+	var identity DeviceIdentity
+	if err := json.NewDecoder(resp.Body).Decode(&identity); err != nil {
+		return nil, fmt.Errorf("invalid identity: %w", err)
+	}
+
+	switch {
+	case identity.DeviceID == "":
+		return nil, fmt.Errorf("peer reported no device ID")
+	case identity.DeviceID == d.deviceID:
+		return nil, fmt.Errorf("peer is this device")
+	case target.deviceID != "" && identity.DeviceID != target.deviceID:
+		return nil, fmt.Errorf("peer reported device %s, expected %s", identity.DeviceID, target.deviceID)
+	}
+
+	capability := "unverified"
+	if target.secret != "" {
+		expected := DeviceProof(target.secret, nonce, identity.DeviceID)
+		if !hmac.Equal([]byte(identity.Proof), []byte(expected)) {
+			return nil, fmt.Errorf("device %s failed to prove its identity", identity.DeviceID)
+		}
+		capability = "paired"
+	}
+
+	device := &DeviceInfo{
+		ID:           identity.DeviceID,
+		Name:         identity.DeviceName,
+		Type:         identity.DeviceType,
+		Sessions:     identity.Sessions,
+		LastSeen:     time.Now(),
+		Capabilities: []string{capability},
+	}
+	if parsed, err := url.Parse(target.url); err == nil {
+		host, port, err := net.SplitHostPort(parsed.Host)
+		if err != nil {
+			host = parsed.Hostname()
+			port = "80"
+			if parsed.Scheme == "https" {
+				port = "443"
+			}
+		}
+		device.IPAddress = host
+		device.Port, _ = strconv.Atoi(port)
+	}
+	return device, nil
+}
+
+// hasCapability reports whether a device was discovered with capability
+func (device DeviceInfo) hasCapability(capability string) bool {
+	for _, c := range device.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// emit sends a discovery event unless the channel is full
+func (d *PeerDiscoveryService) emit(event DiscoveryEvent) {
+	select {
+	case <-d.stop:
+	case d.eventChan <- event:
+	default:
+		// Channel full, skip event
+	}
+}
+
+// Devices returns the devices that answered the last probe
+func (d *PeerDiscoveryService) Devices() []DeviceInfo {
+	d.devicesMutex.RLock()
+	defer d.devicesMutex.RUnlock()
+
+	devices := make([]DeviceInfo, 0, len(d.devices))
+	for _, device := range d.devices {
+		devices = append(devices, *device)
+	}
+	return devices
+}
+
+// Subscribe returns the event channel
+func (d *PeerDiscoveryService) Subscribe() <-chan DiscoveryEvent {
+	return d.eventChan
+}
+
+// ConnectToDevice connects to a device that answered the last probe
+func (d *PeerDiscoveryService) ConnectToDevice(deviceID string) (RemoteConnection, error) {
+	d.devicesMutex.RLock()
+	baseURL, exists := d.urls[deviceID]
+	fingerprint := d.fingerprints[deviceID]
+	d.devicesMutex.RUnlock()
+
+	if !exists {
+		return RemoteConnection{}, fmt.Errorf("device %s not found", deviceID)
+	}
+	if d.identity != nil && fingerprint == "" {
+		return RemoteConnection{}, fmt.Errorf("device %s is not paired", deviceID)
+	}
+
+	return RemoteConnection{
+		deviceID:   deviceID,
+		baseURL:    baseURL,
+		httpClient: d.client(deviceID, fingerprint),
+	}, nil
+}
+
+// Close stops probing peers
+func (d *PeerDiscoveryService) Close() error {
+	d.closeOnce.Do(func() {
+		close(d.stop)
+	})
+	return nil
+}
@@ -1,8 +1,9 @@
 package terminal
 
 import (
-	"context"
+	"errors"
 	"fmt"
+	"os"
 	"sync"
 	"time"
 	
@@ -29,7 +30,7 @@ type PersistentManagerConfig struct {
 	MaxSessions      int
 	SyncInterval     time.Duration // How often to sync state
 	HeartbeatInterval time.Duration // How often to send heartbeat
-	SessionTimeout   time.Duration // When to consider a session dead
+	SessionTimeout   time.Duration // Lease of the sessions this device runs; a session whose lease expired is dead
 	EnableDiscovery  bool          // Enable network discovery
 }
 
@@ -47,8 +48,15 @@ type SessionStore interface {
 	// Delete session
 	DeleteSession(sessionID string) error
 	
-	// Update session heartbeat
+	// Update session heartbeat, renewing the lease deviceID holds
 	UpdateHeartbeat(sessionID string, deviceID string) error
+	
+	// Take or renew the lease of a session for ttl; fails with ErrLeaseHeld
+	// while another device holds it
+	AcquireLease(sessionID string, deviceID string, ttl time.Duration) (*SessionLease, error)
+	
+	// Give up the lease of a session so another device can take it over
+	ReleaseLease(sessionID string, deviceID string) error
 }
 
 // DiscoveryService interface for discovering sessions across network
@@ -66,61 +74,17 @@ type DiscoveryService interface {
 	ConnectToDevice(deviceID string) (RemoteConnection, error)
 }
 
-// Session represents a basic terminal session (placeholder)
-type Session struct {
-	ID  string
-	ctx context.Context
-}
-
 // SessionStatus represents session status
 type SessionStatus string
 
 const (
-	SessionStatusCreated SessionStatus = "created"
-	SessionStatusRunning SessionStatus = "running"
-	SessionStatusStopped SessionStatus = "stopped"
+	SessionStatusCreated   SessionStatus = "created"
+	SessionStatusRunning   SessionStatus = "running"
+	SessionStatusStopped   SessionStatus = "stopped"
+	SessionStatusMigrating SessionStatus = "migrating" // Being handed over to another device
+	SessionStatusMigrated  SessionStatus = "migrated"  // Now running on CurrentDeviceID
 )
 
-// SessionConfig represents session configuration
-type SessionConfig struct {
-	Rows             int
-	Cols             int
-	ScrollbackBuffer int
-	AutoRestart      bool
-	RestartDelay     int
-}
-
-// NewSession creates a new session (placeholder implementation)
-func NewSession(id string, config SessionConfig) *Session {
-	return &Session{
-		ID:  id,
-		ctx: context.Background(),
-	}
-}
-
-// SessionInfo represents session information
-type SessionInfo struct {
-	ID        string `json:"id"`
-	Name      string `json:"name"`
-	Status    string `json:"status"`
-	CreatedAt string `json:"created_at"`
-}
-
-// Session methods (placeholder implementations)
-func (s *Session) RestoreBuffer(content []byte) {}
-func (s *Session) SetCursorPosition(row, col int) {}
-func (s *Session) SetEnvironment(env map[string]string) {}
-func (s *Session) SetWorkingDirectory(dir string) {}
-func (s *Session) SendInput(input string) {}
-func (s *Session) GetBuffer() []byte { return []byte{} }
-func (s *Session) GetCursorPosition() (int, int) { return 0, 0 }
-func (s *Session) GetInputHistory() []InputRecord { return []InputRecord{} }
-func (s *Session) GetOutputHistory() []OutputRecord { return []OutputRecord{} }
-func (s *Session) GetInfo() SessionInfo { return SessionInfo{ID: s.ID} }
-func (s *Session) Stop() error { return nil }
-func (s *Session) Restart() error { return nil }
-func (s *Session) IsRunning() bool { return true }
-
 // PersistentSession represents a session that can be persisted and restored
 type PersistentSession struct {
 	*Session // Embed base session
@@ -147,8 +111,10 @@ type SessionState struct {
 	// Device info
 	OwnerDeviceID   string    `json:"owner_device_id"`
 	OwnerDeviceName string    `json:"owner_device_name"`
-	CurrentDeviceID string    `json:"current_device_id"`
+	CurrentDeviceID string    `json:"current_device_id"` // Lease holder
 	LastHeartbeat   time.Time `json:"last_heartbeat"`
+	LeaseExpiresAt  time.Time `json:"lease_expires_at"`
+	LeaseEpoch      int64     `json:"lease_epoch"`
 	
 	// Terminal state
 	Command     string            `json:"command"`
@@ -162,6 +128,10 @@ type SessionState struct {
 	CursorCol     int    `json:"cursor_col"`
 	ScrollOffset  int    `json:"scroll_offset"`
 	
+	// Recent input and output, bounded by persistedHistory
+	InputHistory  []InputRecord  `json:"input_history,omitempty"`
+	OutputHistory []OutputRecord `json:"output_history,omitempty"`
+	
 	// Tool state
 	ToolName    string                 `json:"tool_name"`
 	ToolState   map[string]interface{} `json:"tool_state"`
@@ -186,6 +156,14 @@ type SessionCheckpoint struct {
 	StateSnapshot *SessionState `json:"state_snapshot"`
 }
 
+// SessionLog represents a session log entry
+type SessionLog struct {
+	Timestamp time.Time              `json:"timestamp"`
+	Type      string                 `json:"type"`
+	Content   string                 `json:"content"`
+	Metadata  map[string]interface{} `json:"metadata"`
+}
+
 // InputRecord represents a recorded input
 type InputRecord struct {
 	Timestamp time.Time `json:"timestamp"`
@@ -223,6 +201,42 @@ type SessionFilter struct {
 	IncludeDead   bool
 }
 
+// LocalDevice returns the ID and name of this host. Every entry point on the host
+// uses it, so sessions recorded by one can be adopted by another.
+// ANYWHERE_DEVICE_ID and ANYWHERE_DEVICE_NAME override them, for example to run
+// two servers on one machine.
+func LocalDevice() (id string, name string) {
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "unknown"
+	}
+	id, name = hostname, hostname
+	if v := os.Getenv("ANYWHERE_DEVICE_ID"); v != "" {
+		id = v
+	}
+	if v := os.Getenv("ANYWHERE_DEVICE_NAME"); v != "" {
+		name = v
+	}
+	return id, name
+}
+
+// sessionConfig returns the terminal configuration of persistent sessions
+func sessionConfig(state *SessionState) SessionConfig {
+	return SessionConfig{
+		Rows:             40,
+		Cols:             120,
+		ScrollbackBuffer: 10000,
+		Command:          state.Command,
+		Args:             state.Args,
+		Environment:      state.Environment,
+		WorkingDir:       state.WorkingDir,
+	}
+}
+
+// persistedHistory is how many input and output records are saved with a session;
+// checkpoints keep the full in-memory history
+const persistedHistory = 100
+
 // NewPersistentManager creates a new persistent terminal manager
 func NewPersistentManager(deviceID, deviceName, deviceType string, store SessionStore, discovery DiscoveryService) *PersistentManager {
 	return &PersistentManager{
@@ -258,13 +272,8 @@ func (pm *PersistentManager) CreatePersistentSession(name string, toolName strin
 		sessionID = fmt.Sprintf("%s-%s", name, sessionID[:8])
 	}
 	
-	// Create base session
-	baseSession := NewSession(sessionID, SessionConfig{
-		Rows: 40,
-		Cols: 120,
-	})
-	
-	// Create session state
+	// Create session state; the tool is started in the session's shell
+	workingDir, _ := os.Getwd()
 	state := &SessionState{
 		ID:              sessionID,
 		Name:            name,
@@ -274,12 +283,23 @@ func (pm *PersistentManager) CreatePersistentSession(name string, toolName strin
 		OwnerDeviceName: pm.deviceName,
 		CurrentDeviceID: pm.deviceID,
 		LastHeartbeat:   time.Now(),
+		Command:         toolName,
+		Args:            []string{},
+		Environment:     map[string]string{},
+		WorkingDir:      workingDir,
 		ToolName:        toolName,
 		Status:          SessionStatusCreated,
 		Tags:            []string{},
 		Metadata:        make(map[string]interface{}),
 	}
 	
+	// Create base session backed by tmux
+	baseSession := NewSession(sessionID, sessionConfig(state))
+	if err := baseSession.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start session: %w", err)
+	}
+	state.Status = SessionStatusRunning
+	
 	// Create persistent session
 	session := &PersistentSession{
 		Session:     baseSession,
@@ -290,8 +310,13 @@ func (pm *PersistentManager) CreatePersistentSession(name string, toolName strin
 	
 	// Save initial state
 	if err := pm.store.SaveSession(state); err != nil {
+		baseSession.Stop()
 		return nil, fmt.Errorf("failed to save session state: %w", err)
 	}
+	if _, err := pm.store.AcquireLease(sessionID, pm.deviceID, pm.config.SessionTimeout); err != nil {
+		baseSession.Stop()
+		return nil, fmt.Errorf("failed to lease session: %w", err)
+	}
 	
 	// Store locally
 	pm.sessions[sessionID] = session
@@ -328,7 +353,7 @@ func (pm *PersistentManager) DiscoverSessions() ([]*SessionState, error) {
 			}
 			
 			// Check if session is still alive
-			if time.Since(state.LastHeartbeat) < pm.config.SessionTimeout {
+			if state.Lease().State(time.Now()) == LeaseStateHeld {
 				allSessions = append(allSessions, state)
 			}
 		}
@@ -353,25 +378,20 @@ func (pm *PersistentManager) AttachToSession(sessionID string) (*PersistentSessi
 		return nil, fmt.Errorf("failed to load session: %w", err)
 	}
 	
-	// Check if session is alive
-	if time.Since(state.LastHeartbeat) > pm.config.SessionTimeout {
-		return nil, fmt.Errorf("session %s is dead (last heartbeat: %v ago)", 
-			sessionID, time.Since(state.LastHeartbeat))
-	}
-	
-	// Check if session is on another device
-	if state.CurrentDeviceID != pm.deviceID && state.CurrentDeviceID != "" {
-		// Try to migrate session
+	// A session leased by another device keeps running there: ask it to hand
+	// the session over, and take the session only once its lease is free
+	lease := state.Lease()
+	if lease.DeviceID != pm.deviceID && lease.State(time.Now()) == LeaseStateHeld {
 		if err := pm.migrateSession(state); err != nil {
 			return nil, fmt.Errorf("failed to migrate session: %w", err)
 		}
 	}
+	if lease, err = pm.store.AcquireLease(sessionID, pm.deviceID, pm.config.SessionTimeout); err != nil {
+		return nil, fmt.Errorf("failed to take over session: %w", err)
+	}
 	
 	// Create local session instance
-	baseSession := NewSession(sessionID, SessionConfig{
-		Rows: 40,
-		Cols: 120,
-	})
+	baseSession := NewSession(sessionID, sessionConfig(state))
 	
 	session := &PersistentSession{
 		Session:     baseSession,
@@ -382,12 +402,16 @@ func (pm *PersistentManager) AttachToSession(sessionID string) (*PersistentSessi
 	
 	// Restore session state
 	if err := pm.restoreSession(session); err != nil {
+		pm.store.ReleaseLease(sessionID, pm.deviceID)
 		return nil, fmt.Errorf("failed to restore session: %w", err)
 	}
 	
 	// Update ownership
 	state.CurrentDeviceID = pm.deviceID
 	state.LastHeartbeat = time.Now()
+	state.LeaseExpiresAt = lease.ExpiresAt
+	state.LeaseEpoch = lease.Epoch
+	state.Status = SessionStatusRunning
 	pm.store.SaveSession(state)
 	
 	// Store locally
@@ -404,7 +428,7 @@ func (pm *PersistentManager) migrateSession(state *SessionState) error {
 	// Connect to the current owner device
 	conn, err := pm.discovery.ConnectToDevice(state.CurrentDeviceID)
 	if err != nil {
-		// Device might be offline, proceed with recovery
+		// Device might be offline; its lease decides when the session can be recovered
 		return nil
 	}
 	defer conn.Close()
@@ -431,14 +455,19 @@ func (pm *PersistentManager) migrateSession(state *SessionState) error {
 	return nil
 }
 
-// restoreSession restores a session from saved state
+// restoreSession rebuilds a session from saved state. A tmux session that is
+// still running on this device is adopted as is; otherwise a new one is started
+// in the saved directory and environment, with the saved scrollback shown above it.
 func (pm *PersistentManager) restoreSession(session *PersistentSession) error {
 	state := session.state
 	
+	if session.IsRunning() {
+		session.RestoreHistory(state.InputHistory, state.OutputHistory)
+		return nil
+	}
+	
 	// Restore terminal buffer
 	if len(state.BufferContent) > 0 {
-		// Restore buffer content
-		// This would restore the visual state of the terminal
 		session.RestoreBuffer(state.BufferContent)
 	}
 	
@@ -452,15 +481,25 @@ func (pm *PersistentManager) restoreSession(session *PersistentSession) error {
 	
 	// Restore working directory
 	if state.WorkingDir != "" {
-		session.SetWorkingDirectory(state.WorkingDir)
+		if info, err := os.Stat(state.WorkingDir); err == nil && info.IsDir() {
+			session.SetWorkingDirectory(state.WorkingDir)
+		}
 	}
 	
+	// Start the shell and the tool
+	if err := session.Start(); err != nil {
+		return err
+	}
+	session.RestoreHistory(state.InputHistory, state.OutputHistory)
+	
 	// If we have checkpoint data, replay inputs
 	if session.checkpoint != nil {
 		for _, input := range session.checkpoint.InputHistory {
 			// Replay inputs with small delay to avoid overwhelming
 			time.Sleep(10 * time.Millisecond)
-			session.SendInput(input.Content)
+			if err := session.SendInput(input.Content); err != nil {
+				return fmt.Errorf("failed to replay input: %w", err)
+			}
 		}
 	}
 	
@@ -482,10 +521,17 @@ func (pm *PersistentManager) startSyncRoutine(session *PersistentSession) {
 			pm.syncSession(session)
 			
 		case <-heartbeatTicker.C:
-			// Update heartbeat
-			pm.store.UpdateHeartbeat(session.ID, pm.deviceID)
+			// Renew the lease; a device that took the session over runs it now
+			if _, err := pm.store.AcquireLease(session.ID, pm.deviceID, pm.config.SessionTimeout); errors.Is(err, ErrLeaseHeld) {
+				fmt.Printf("Lost session %s: %v\n", session.ID, err)
+				pm.mu.Lock()
+				delete(pm.sessions, session.ID)
+				pm.mu.Unlock()
+				session.Stop()
+				return
+			}
 			
-		case <-session.ctx.Done():
+		case <-session.Context().Done():
 			// Session stopped
 			return
 		}
@@ -503,6 +549,15 @@ func (pm *PersistentManager) syncSession(session *PersistentSession) {
 	state.LastHeartbeat = time.Now()
 	state.BufferContent = session.GetBuffer()
 	state.CursorRow, state.CursorCol = session.GetCursorPosition()
+	state.WorkingDir = session.GetWorkingDirectory()
+	state.Environment = session.GetEnvironment()
+	state.InputHistory = lastRecords(session.GetInputHistory(), persistedHistory)
+	state.OutputHistory = lastRecords(session.GetOutputHistory(), persistedHistory)
+	if session.IsRunning() {
+		state.Status = SessionStatusRunning
+	} else {
+		state.Status = SessionStatusStopped
+	}
 	
 	// Save to store
 	if err := pm.store.SaveSession(state); err != nil {
@@ -513,6 +568,14 @@ func (pm *PersistentManager) syncSession(session *PersistentSession) {
 	session.lastSync = time.Now()
 }
 
+// lastRecords returns the last n records
+func lastRecords[T any](records []T, n int) []T {
+	if len(records) > n {
+		return records[len(records)-n:]
+	}
+	return records
+}
+
 // CreateCheckpoint creates a checkpoint for recovery
 func (pm *PersistentManager) CreateCheckpoint(sessionID string) (*SessionCheckpoint, error) {
 	session, exists := pm.sessions[sessionID]
@@ -0,0 +1,436 @@
+package terminal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxHistoryRecords bounds the input and output history kept per session
+const maxHistoryRecords = 1000
+
+// Session is a terminal session backed by a tmux session of the same ID. The
+// tmux server owns the shell, so the session survives this process; Start adopts
+// a tmux session that is already running.
+type Session struct {
+	ID string
+
+	config    SessionConfig
+	createdAt time.Time
+	ctx       context.Context
+	cancel    context.CancelFunc
+
+	// Restored state, applied when the tmux session is created
+	environment map[string]string
+	workingDir  string
+	restored    []byte // Scrollback from a stored state, shown above the live pane
+	cursorRow   int
+	cursorCol   int
+
+	inputHistory  []InputRecord
+	outputHistory []OutputRecord
+	lastCapture   string
+
+	mu sync.Mutex
+}
+
+// SessionConfig represents session configuration
+type SessionConfig struct {
+	Rows             int
+	Cols             int
+	ScrollbackBuffer int
+	AutoRestart      bool
+	RestartDelay     int
+
+	// Command and Args are typed into the shell once the session starts, so the
+	// session keeps running when the command exits
+	Command     string
+	Args        []string
+	Environment map[string]string
+	WorkingDir  string
+}
+
+// SessionInfo represents session information
+type SessionInfo struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	CreatedAt string `json:"created_at"`
+}
+
+// NewSession creates a session. It does not touch tmux until Start is called.
+func NewSession(id string, config SessionConfig) *Session {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Session{
+		ID:          id,
+		config:      config,
+		createdAt:   time.Now(),
+		ctx:         ctx,
+		cancel:      cancel,
+		environment: make(map[string]string),
+		workingDir:  config.WorkingDir,
+	}
+	for k, v := range config.Environment {
+		s.environment[k] = v
+	}
+	return s
+}
+
+// Start creates the tmux session, or adopts it when it is already running
+func (s *Session) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ctx.Err() != nil {
+		s.ctx, s.cancel = context.WithCancel(context.Background())
+	}
+	if hasTmuxSession(s.ctx, s.ID) {
+		return nil
+	}
+
+	args := []string{"new-session", "-d", "-s", s.ID}
+	if s.config.Cols > 0 && s.config.Rows > 0 {
+		args = append(args, "-x", strconv.Itoa(s.config.Cols), "-y", strconv.Itoa(s.config.Rows))
+	}
+	if s.workingDir != "" {
+		args = append(args, "-c", s.workingDir)
+	}
+	for _, k := range sortedKeys(s.environment) {
+		args = append(args, "-e", k+"="+s.environment[k])
+	}
+	if _, err := runTmux(s.ctx, args...); err != nil {
+		return fmt.Errorf("failed to create tmux session: %w", err)
+	}
+	if s.config.ScrollbackBuffer > 0 {
+		// Applies to panes created from now on; the first pane keeps the server default
+		runTmux(s.ctx, "set-option", "-t", s.ID, "history-limit", strconv.Itoa(s.config.ScrollbackBuffer))
+	}
+
+	if s.config.Command != "" {
+		command := strings.Join(append([]string{s.config.Command}, s.config.Args...), " ")
+		if err := s.sendLocked(command + "\n"); err != nil {
+			return fmt.Errorf("failed to start %s: %w", s.config.Command, err)
+		}
+	}
+	return nil
+}
+
+// Stop kills the tmux session and cancels the session context
+func (s *Session) Stop() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	defer s.cancel()
+	return killTmuxSession(s.ID)
+}
+
+// Restart kills the tmux session and starts it again in its current directory.
+// The session context stays alive.
+func (s *Session) Restart() error {
+	if dir := s.GetWorkingDirectory(); dir != "" {
+		s.SetWorkingDirectory(dir)
+	}
+
+	s.mu.Lock()
+	err := killTmuxSession(s.ID)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return s.Start()
+}
+
+// IsRunning reports whether the tmux session exists
+func (s *Session) IsRunning() bool {
+	return hasTmuxSession(context.Background(), s.ID)
+}
+
+// Context is cancelled when the session is stopped
+func (s *Session) Context() context.Context {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ctx
+}
+
+// RestoreBuffer sets scrollback from a stored state. It is shown above the live
+// pane content, since tmux cannot replay it into a new shell.
+func (s *Session) RestoreBuffer(content []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.restored = append([]byte(nil), content...)
+}
+
+// SetCursorPosition records the cursor of a stored state. The live cursor
+// belongs to the program in the pane; this is reported until the session runs.
+func (s *Session) SetCursorPosition(row, col int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cursorRow, s.cursorCol = row, col
+}
+
+// SetEnvironment sets variables for the session. They are passed to the shell
+// when the session starts and to the tmux session environment when it runs.
+func (s *Session) SetEnvironment(env map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	running := hasTmuxSession(s.ctx, s.ID)
+	for k, v := range env {
+		s.environment[k] = v
+		if running {
+			runTmux(s.ctx, "set-environment", "-t", s.ID, k, v)
+		}
+	}
+}
+
+// SetWorkingDirectory sets the directory the shell starts in
+func (s *Session) SetWorkingDirectory(dir string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.workingDir = dir
+}
+
+// SendInput types input into the session; newlines press Enter
+func (s *Session) SendInput(input string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sendLocked(input)
+}
+
+// sendLocked types input and records it in the input history
+func (s *Session) sendLocked(input string) error {
+	lines := strings.Split(input, "\n")
+	for i, line := range lines {
+		if line != "" {
+			if _, err := runTmux(s.ctx, "send-keys", "-t", s.ID, "-l", line); err != nil {
+				return fmt.Errorf("failed to send input: %w", err)
+			}
+		}
+		if i < len(lines)-1 {
+			if _, err := runTmux(s.ctx, "send-keys", "-t", s.ID, "Enter"); err != nil {
+				return fmt.Errorf("failed to send input: %w", err)
+			}
+		}
+	}
+
+	s.inputHistory = appendBounded(s.inputHistory, InputRecord{
+		Timestamp: time.Now(),
+		Content:   input,
+		Source:    "user",
+	})
+	return nil
+}
+
+// GetBuffer returns the restored scrollback followed by the pane's scrollback
+// and screen. New output since the last call is added to the output history.
+func (s *Session) GetBuffer() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	args := []string{"capture-pane", "-p", "-J", "-t", s.ID}
+	if s.config.ScrollbackBuffer > 0 {
+		args = append(args, "-S", "-"+strconv.Itoa(s.config.ScrollbackBuffer))
+	}
+	output, err := runTmux(s.ctx, args...)
+	if err != nil {
+		return append([]byte(nil), s.restored...)
+	}
+
+	capture := strings.TrimRight(string(output), "\n")
+	s.recordOutputLocked(capture)
+
+	buffer := make([]byte, 0, len(s.restored)+len(capture)+1)
+	buffer = append(buffer, s.restored...)
+	if len(s.restored) > 0 && !bytes.HasSuffix(s.restored, []byte("\n")) {
+		buffer = append(buffer, '\n')
+	}
+	buffer = append(buffer, capture...)
+	return lastLines(buffer, s.config.ScrollbackBuffer)
+}
+
+// recordOutputLocked adds what changed since the previous capture to the output history
+func (s *Session) recordOutputLocked(capture string) {
+	if capture == s.lastCapture {
+		return
+	}
+	content := capture
+	if strings.HasPrefix(capture, s.lastCapture) {
+		content = capture[len(s.lastCapture):]
+	}
+	s.lastCapture = capture
+
+	s.outputHistory = appendBounded(s.outputHistory, OutputRecord{
+		Timestamp: time.Now(),
+		Content:   []byte(content),
+		Type:      "stdout",
+	})
+}
+
+// GetCursorPosition returns the cursor row and column of the pane
+func (s *Session) GetCursorPosition() (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	output, err := runTmux(s.ctx, "display-message", "-p", "-t", s.ID, "#{cursor_y} #{cursor_x}")
+	if err != nil {
+		return s.cursorRow, s.cursorCol
+	}
+	var row, col int
+	if _, err := fmt.Sscanf(string(output), "%d %d", &row, &col); err != nil {
+		return s.cursorRow, s.cursorCol
+	}
+	s.cursorRow, s.cursorCol = row, col
+	return row, col
+}
+
+// GetWorkingDirectory returns the current directory of the pane
+func (s *Session) GetWorkingDirectory() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	output, err := runTmux(s.ctx, "display-message", "-p", "-t", s.ID, "#{pane_current_path}")
+	if err != nil {
+		return s.workingDir
+	}
+	if dir := strings.TrimSpace(string(output)); dir != "" {
+		return dir
+	}
+	return s.workingDir
+}
+
+// GetEnvironment returns the session environment: the variables the session was
+// started with and those set in tmux since. Variables exported inside the shell
+// are not visible to tmux.
+func (s *Session) GetEnvironment() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	env := make(map[string]string, len(s.environment))
+	for k, v := range s.environment {
+		env[k] = v
+	}
+
+	output, err := runTmux(s.ctx, "show-environment", "-t", s.ID)
+	if err != nil {
+		return env
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.HasPrefix(line, "-") {
+			delete(env, line[1:]) // Removed from the session
+			continue
+		}
+		if k, v, ok := strings.Cut(line, "="); ok {
+			env[k] = v
+		}
+	}
+	return env
+}
+
+// RestoreHistory sets the input and output history from a stored state
+func (s *Session) RestoreHistory(inputs []InputRecord, outputs []OutputRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inputHistory = append([]InputRecord(nil), inputs...)
+	s.outputHistory = append([]OutputRecord(nil), outputs...)
+}
+
+// GetInputHistory returns the inputs sent to the session, oldest first
+func (s *Session) GetInputHistory() []InputRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]InputRecord(nil), s.inputHistory...)
+}
+
+// GetOutputHistory returns the output captured from the session, oldest first
+func (s *Session) GetOutputHistory() []OutputRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]OutputRecord(nil), s.outputHistory...)
+}
+
+// GetInfo returns information about the session
+func (s *Session) GetInfo() SessionInfo {
+	status := SessionStatusStopped
+	if s.IsRunning() {
+		status = SessionStatusRunning
+	}
+	return SessionInfo{
+		ID:        s.ID,
+		Name:      s.ID,
+		Status:    string(status),
+		CreatedAt: s.createdAt.Format(time.RFC3339),
+	}
+}
+
+// runTmux runs a tmux command and returns its output
+func runTmux(ctx context.Context, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "tmux", args...)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+	return output, nil
+}
+
+// hasTmuxSession reports whether a tmux session with this name exists
+func hasTmuxSession(ctx context.Context, id string) bool {
+	_, err := runTmux(ctx, "has-session", "-t", "="+id)
+	return err == nil
+}
+
+// killTmuxSession kills a tmux session if it exists
+func killTmuxSession(id string) error {
+	ctx := context.Background()
+	if !hasTmuxSession(ctx, id) {
+		return nil
+	}
+	if _, err := runTmux(ctx, "kill-session", "-t", "="+id); err != nil {
+		return fmt.Errorf("failed to kill tmux session: %w", err)
+	}
+	return nil
+}
+
+// appendBounded appends a record, dropping the oldest beyond maxHistoryRecords
+func appendBounded[T any](records []T, record T) []T {
+	records = append(records, record)
+	if len(records) > maxHistoryRecords {
+		records = records[len(records)-maxHistoryRecords:]
+	}
+	return records
+}
+
+// lastLines returns the last n lines of b, or all of it when n is not positive
+func lastLines(b []byte, n int) []byte {
+	if n <= 0 {
+		return b
+	}
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] == '\n' {
+			if n--; n == 0 {
+				return b[i+1:]
+			}
+		}
+	}
+	return b
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -38,6 +38,12 @@ func NewManager() *Manager {
 
 // CreateSession creates a new tmux session for an AI tool
 func (m *Manager) CreateSession(ctx context.Context, tool string, sessionName string) (*Session, error) {
+	return m.CreateSessionInDir(ctx, tool, sessionName, "")
+}
+
+// CreateSessionInDir creates a new tmux session whose shell starts in dir; an
+// empty dir uses the current directory
+func (m *Manager) CreateSessionInDir(ctx context.Context, tool string, sessionName string, dir string) (*Session, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -47,7 +53,11 @@ func (m *Manager) CreateSession(ctx context.Context, tool string, sessionName st
 	}
 
 	// Create tmux session
-	cmd := exec.CommandContext(ctx, "tmux", "new-session", "-d", "-s", sessionName, "-n", tool)
+	args := []string{"new-session", "-d", "-s", sessionName, "-n", tool}
+	if dir != "" {
+		args = append(args, "-c", dir)
+	}
+	cmd := exec.CommandContext(ctx, "tmux", args...)
 	if err := cmd.Run(); err != nil {
 		return nil, fmt.Errorf("failed to create tmux session: %w", err)
 	}
@@ -174,6 +184,29 @@ func (m *Manager) SendLiteralInput(ctx context.Context, sessionID string, input
 	return nil
 }
 
+// SendKeys sends named keys such as "Escape" or "C-c" to a tmux session
+func (m *Manager) SendKeys(ctx context.Context, sessionID string, keys ...string) error {
+	m.mu.RLock()
+	session, exists := m.sessions[sessionID]
+	m.mu.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("session %s not found", sessionID)
+	}
+
+	args := append([]string{"send-keys", "-t", session.PaneID}, keys...)
+	if err := exec.CommandContext(ctx, "tmux", args...).Run(); err != nil {
+		return fmt.Errorf("failed to send keys: %w", err)
+	}
+
+	// Update last active time
+	m.mu.Lock()
+	session.LastActive = time.Now()
+	m.mu.Unlock()
+
+	return nil
+}
+
 // CaptureOutput captures the current output from a tmux session
 func (m *Manager) CaptureOutput(ctx context.Context, sessionID string) (string, error) {
 	m.mu.RLock()
@@ -194,6 +227,64 @@ func (m *Manager) CaptureOutput(ctx context.Context, sessionID string) (string,
 	return string(output), nil
 }
 
+// CaptureScrollback captures up to lines lines of scrollback followed by the
+// visible screen, with wrapped lines joined
+func (m *Manager) CaptureScrollback(ctx context.Context, sessionID string, lines int) (string, error) {
+	m.mu.RLock()
+	session, exists := m.sessions[sessionID]
+	m.mu.RUnlock()
+
+	if !exists {
+		return "", fmt.Errorf("session %s not found", sessionID)
+	}
+
+	cmd := exec.CommandContext(ctx, "tmux", "capture-pane", "-t", session.PaneID, "-p", "-J", "-S", fmt.Sprintf("-%d", lines))
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to capture scrollback: %w", err)
+	}
+
+	return string(output), nil
+}
+
+// GetSession returns a tracked tmux session by ID
+func (m *Manager) GetSession(sessionID string) (*Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	session, exists := m.sessions[sessionID]
+	if !exists {
+		return nil, fmt.Errorf("session %s not found", sessionID)
+	}
+
+	return session, nil
+}
+
+// HasSession reports whether a tmux session with this ID is running, whether or
+// not this manager created it
+func (m *Manager) HasSession(ctx context.Context, sessionID string) bool {
+	return m.isSessionAlive(ctx, sessionID)
+}
+
+// GetWorkingDir returns the current working directory of a session's pane
+func (m *Manager) GetWorkingDir(ctx context.Context, sessionID string) (string, error) {
+	m.mu.RLock()
+	session, exists := m.sessions[sessionID]
+	m.mu.RUnlock()
+
+	if !exists {
+		return "", fmt.Errorf("session %s not found", sessionID)
+	}
+
+	cmd := exec.CommandContext(ctx, "tmux", "display-message", "-p", "-t", session.PaneID, "#{pane_current_path}")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get working directory: %w", err)
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
 // ListSessions lists all active tmux sessions
 func (m *Manager) ListSessions(ctx context.Context) ([]*Session, error) {
 	m.mu.RLock()
@@ -1,6 +1,7 @@
 package tools
 
 import (
+	"fmt"
 	"regexp"
 	"strings"
 	"time"
@@ -212,6 +213,11 @@ func (a *ClaudeAdapter) FormatInput(input string) string {
 	return input
 }
 
+// FormatAttachments uses Claude Code's @path file mentions, which also load images
+func (a *ClaudeAdapter) FormatAttachments(input string, paths []string) string {
+	return formatMentions(input, paths)
+}
+
 func (a *ClaudeAdapter) GetInitCommands() []string {
 	return []string{}
 }
@@ -257,6 +263,11 @@ func (a *GeminiAdapter) FormatInput(input string) string {
 	return input
 }
 
+// FormatAttachments uses Gemini CLI's @path file mentions
+func (a *GeminiAdapter) FormatAttachments(input string, paths []string) string {
+	return formatMentions(input, paths)
+}
+
 func (a *GeminiAdapter) GetInitCommands() []string {
 	return []string{}
 }
@@ -305,6 +316,10 @@ func (a *CursorAdapter) FormatInput(input string) string {
 	return input
 }
 
+func (a *CursorAdapter) FormatAttachments(input string, paths []string) string {
+	return formatFileList(input, paths)
+}
+
 func (a *CursorAdapter) GetInitCommands() []string {
 	// Initialize Cursor CLI if needed
 	return []string{}
@@ -354,6 +369,32 @@ func (a *CopilotAdapter) FormatInput(input string) string {
 	return input
 }
 
+func (a *CopilotAdapter) FormatAttachments(input string, paths []string) string {
+	return formatFileList(input, paths)
+}
+
 func (a *CopilotAdapter) GetInitCommands() []string {
 	return []string{}
+}
+
+// formatMentions prefixes the input with @path mentions
+func formatMentions(input string, paths []string) string {
+	if len(paths) == 0 {
+		return input
+	}
+
+	mentions := make([]string, len(paths))
+	for i, path := range paths {
+		mentions[i] = "@" + path
+	}
+	return strings.Join(mentions, " ") + " " + input
+}
+
+// formatFileList appends the attached paths as plain text on the same line,
+// since a newline would submit the input early
+func formatFileList(input string, paths []string) string {
+	if len(paths) == 0 {
+		return input
+	}
+	return fmt.Sprintf("%s (attached files: %s)", input, strings.Join(paths, ", "))
 }
\ No newline at end of file
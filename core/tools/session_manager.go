@@ -66,6 +66,10 @@ type ToolAdapter interface {
 	// FormatInput formats user input for the tool
 	FormatInput(input string) string
 	
+	// FormatAttachments references attached files (paths relative to the
+	// session working directory) in the user input
+	FormatAttachments(input string, paths []string) string
+	
 	// GetInitCommands returns commands to run after tool starts
 	GetInitCommands() []string
 }
@@ -86,6 +90,23 @@ func NewSessionManager(tmuxManager *tmux.Manager) *SessionManager {
 	return sm
 }
 
+// NewAdapter creates a fresh adapter for a tool. Adapters keep per-session
+// parsing state, so each monitored session should get its own instance.
+func NewAdapter(tool ToolType) (ToolAdapter, error) {
+	switch tool {
+	case ToolClaude:
+		return NewClaudeAdapter(), nil
+	case ToolGemini:
+		return &GeminiAdapter{}, nil
+	case ToolCursor:
+		return &CursorAdapter{}, nil
+	case ToolCopilot:
+		return &CopilotAdapter{}, nil
+	default:
+		return nil, fmt.Errorf("no adapter for tool: %s", tool)
+	}
+}
+
 // RegisterAdapter registers a tool adapter
 func (sm *SessionManager) RegisterAdapter(tool ToolType, adapter ToolAdapter) {
 	sm.mu.Lock()
@@ -0,0 +1,368 @@
+// Package tunnel multiplexes network streams over a single WebSocket, so a
+// device that can only dial out can still be reached: the side that accepted
+// the WebSocket opens streams, and the side that dialed serves them.
+package tunnel
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Frame types
+const (
+	frameOpen  byte = 1
+	frameData  byte = 2
+	frameClose byte = 3
+)
+
+const (
+	// headerSize is the frame type and stream ID
+	headerSize = 5
+	// maxPayload is the largest chunk of stream data sent in one frame
+	maxPayload = 32 * 1024
+	// pingInterval keeps NAT mappings and proxies from dropping an idle tunnel
+	pingInterval = 30 * time.Second
+	// readTimeout closes a tunnel whose peer stopped answering pings
+	readTimeout = 3 * pingInterval
+	// writeTimeout bounds a single frame write
+	writeTimeout = 10 * time.Second
+)
+
+// ErrClosed is returned when using a closed tunnel
+var ErrClosed = errors.New("tunnel closed")
+
+// Session is one end of a tunnel. It implements net.Listener for the streams
+// the other end opens.
+type Session struct {
+	conn    *websocket.Conn
+	writeMu sync.Mutex
+
+	streams map[uint32]*stream
+	nextID  uint32
+	mu      sync.Mutex
+
+	accept    chan *stream
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewSession starts a tunnel over conn. The two ends must pass different
+// values of opener so the IDs of the streams they open do not collide.
+func NewSession(conn *websocket.Conn, opener bool) *Session {
+	s := &Session{
+		conn:    conn,
+		streams: make(map[uint32]*stream),
+		nextID:  2,
+		accept:  make(chan *stream, 64),
+		done:    make(chan struct{}),
+	}
+	if opener {
+		s.nextID = 1
+	}
+
+	go s.readLoop()
+	go s.pingLoop()
+	return s
+}
+
+// Open opens a stream to the other end
+func (s *Session) Open() (net.Conn, error) {
+	s.mu.Lock()
+	select {
+	case <-s.done:
+		s.mu.Unlock()
+		return nil, ErrClosed
+	default:
+	}
+	id := s.nextID
+	s.nextID += 2
+	st := newStream(s, id)
+	s.streams[id] = st
+	s.mu.Unlock()
+
+	if err := s.write(frameOpen, id, nil); err != nil {
+		s.forget(id)
+		return nil, err
+	}
+	return st, nil
+}
+
+// Accept waits for a stream opened by the other end
+func (s *Session) Accept() (net.Conn, error) {
+	select {
+	case st := <-s.accept:
+		return st, nil
+	case <-s.done:
+		return nil, ErrClosed
+	}
+}
+
+// Addr returns the address of the WebSocket
+func (s *Session) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// RemoteAddr returns the address of the other end of the WebSocket
+func (s *Session) RemoteAddr() net.Addr {
+	return s.conn.RemoteAddr()
+}
+
+// Done is closed when the tunnel is closed
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close closes the tunnel and all its streams
+func (s *Session) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.conn.Close()
+
+		s.mu.Lock()
+		streams := s.streams
+		s.streams = make(map[uint32]*stream)
+		s.mu.Unlock()
+		for _, st := range streams {
+			st.remoteClose()
+		}
+	})
+	return nil
+}
+
+// readLoop dispatches frames to streams until the WebSocket fails
+func (s *Session) readLoop() {
+	defer s.Close()
+
+	s.conn.SetReadDeadline(time.Now().Add(readTimeout))
+	s.conn.SetPongHandler(func(string) error {
+		return s.conn.SetReadDeadline(time.Now().Add(readTimeout))
+	})
+
+	for {
+		kind, data, err := s.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		s.conn.SetReadDeadline(time.Now().Add(readTimeout))
+		if kind != websocket.BinaryMessage || len(data) < headerSize {
+			continue
+		}
+
+		id := binary.BigEndian.Uint32(data[1:headerSize])
+		switch data[0] {
+		case frameOpen:
+			st := newStream(s, id)
+			s.mu.Lock()
+			s.streams[id] = st
+			s.mu.Unlock()
+			select {
+			case s.accept <- st:
+			case <-s.done:
+				return
+			}
+		case frameData:
+			s.mu.Lock()
+			st := s.streams[id]
+			s.mu.Unlock()
+			if st != nil {
+				st.push(data[headerSize:])
+			}
+		case frameClose:
+			if st := s.forget(id); st != nil {
+				st.remoteClose()
+			}
+		}
+	}
+}
+
+// pingLoop pings the other end until the tunnel is closed
+func (s *Session) pingLoop() {
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				s.Close()
+				return
+			}
+		}
+	}
+}
+
+// write sends a frame
+func (s *Session) write(kind byte, id uint32, payload []byte) error {
+	frame := make([]byte, headerSize+len(payload))
+	frame[0] = kind
+	binary.BigEndian.PutUint32(frame[1:headerSize], id)
+	copy(frame[headerSize:], payload)
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if err := s.conn.WriteMessage(websocket.BinaryMessage, frame); err != nil {
+		s.Close()
+		return ErrClosed
+	}
+	return nil
+}
+
+// forget removes a stream
+func (s *Session) forget(id uint32) *stream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.streams[id]
+	delete(s.streams, id)
+	return st
+}
+
+// stream is a connection carried by a tunnel
+type stream struct {
+	session *Session
+	id      uint32
+
+	buf          []byte
+	closed       bool // Closed on this end
+	remoteClosed bool // Closed by the other end, or the tunnel failed
+	deadline     time.Time
+	timer        *time.Timer
+	mu           sync.Mutex
+	cond         *sync.Cond
+}
+
+func newStream(session *Session, id uint32) *stream {
+	st := &stream{session: session, id: id}
+	st.cond = sync.NewCond(&st.mu)
+	return st
+}
+
+// push queues data received from the other end
+func (st *stream) push(data []byte) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.buf = append(st.buf, data...)
+	st.cond.Broadcast()
+}
+
+// remoteClose marks the stream closed by the other end
+func (st *stream) remoteClose() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.remoteClosed = true
+	st.cond.Broadcast()
+}
+
+func (st *stream) Read(p []byte) (int, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	for len(st.buf) == 0 {
+		switch {
+		case st.closed:
+			return 0, net.ErrClosed
+		case st.remoteClosed:
+			return 0, io.EOF
+		case !st.deadline.IsZero() && !time.Now().Before(st.deadline):
+			return 0, os.ErrDeadlineExceeded
+		}
+		st.cond.Wait()
+	}
+
+	n := copy(p, st.buf)
+	st.buf = st.buf[n:]
+	if len(st.buf) == 0 {
+		st.buf = nil
+	}
+	return n, nil
+}
+
+func (st *stream) Write(p []byte) (int, error) {
+	st.mu.Lock()
+	closed := st.closed || st.remoteClosed
+	st.mu.Unlock()
+	if closed {
+		return 0, net.ErrClosed
+	}
+
+	written := 0
+	for written < len(p) {
+		end := written + maxPayload
+		if end > len(p) {
+			end = len(p)
+		}
+		if err := st.session.write(frameData, st.id, p[written:end]); err != nil {
+			return written, err
+		}
+		written = end
+	}
+	return written, nil
+}
+
+func (st *stream) Close() error {
+	st.mu.Lock()
+	if st.closed {
+		st.mu.Unlock()
+		return nil
+	}
+	st.closed = true
+	remoteClosed := st.remoteClosed
+	if st.timer != nil {
+		st.timer.Stop()
+	}
+	st.cond.Broadcast()
+	st.mu.Unlock()
+
+	st.session.forget(st.id)
+	if !remoteClosed {
+		st.session.write(frameClose, st.id, nil)
+	}
+	return nil
+}
+
+func (st *stream) LocalAddr() net.Addr {
+	return st.session.Addr()
+}
+
+func (st *stream) RemoteAddr() net.Addr {
+	return st.session.RemoteAddr()
+}
+
+func (st *stream) SetDeadline(t time.Time) error {
+	return st.SetReadDeadline(t)
+}
+
+// SetReadDeadline wakes up a blocked Read at t
+func (st *stream) SetReadDeadline(t time.Time) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.deadline = t
+	if st.timer != nil {
+		st.timer.Stop()
+		st.timer = nil
+	}
+	if !t.IsZero() {
+		st.timer = time.AfterFunc(time.Until(t), func() {
+			st.mu.Lock()
+			st.cond.Broadcast()
+			st.mu.Unlock()
+		})
+	}
+	st.cond.Broadcast()
+	return nil
+}
+
+// SetWriteDeadline is a no-op: writes are bounded by the tunnel's write timeout
+func (st *stream) SetWriteDeadline(t time.Time) error {
+	return nil
+}
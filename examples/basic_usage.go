@@ -4,11 +4,11 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"os"
 	"time"
 
 	"github.com/majiayu000/anywhere-ai/core/database"
 	"github.com/majiayu000/anywhere-ai/core/output"
+	"github.com/majiayu000/anywhere-ai/core/terminal"
 	"github.com/majiayu000/anywhere-ai/core/tmux"
 	"github.com/majiayu000/anywhere-ai/core/tools"
 )
@@ -19,12 +19,13 @@ func main() {
 	sessionManager := tools.NewSessionManager(tmuxManager)
 	outputProcessor := output.NewOutputProcessor()
 	
-	// Initialize SQLite database
-	db, err := database.NewSQLiteDB("anywhere.db")
+	// Open the session store shared with the CLI and the server
+	db, err := database.OpenGormDB(database.StoreDSN(database.DefaultSQLitePath()))
 	if err != nil {
 		log.Fatal("Failed to initialize database:", err)
 	}
-	defer db.Close()
+	store := database.NewSessionRepository(db)
+	deviceID, deviceName := terminal.LocalDevice()
 	
 	// Create a Claude session
 	ctx := context.Background()
@@ -36,17 +37,20 @@ func main() {
 	fmt.Printf("Created session: %s\n", session.ID)
 	
 	// Save session to database
-	dbSession := &database.Session{
-		ID:           session.ID,
-		Tool:         string(session.Tool),
-		DeviceID:     getDeviceID(),
-		DeviceName:   getDeviceName(),
-		Status:       string(session.State),
-		CreatedAt:    session.StartedAt,
-		LastActivity: session.LastActivity,
+	state := &terminal.SessionState{
+		ID:              session.ID,
+		Name:            session.ID,
+		CreatedAt:       session.StartedAt,
+		UpdatedAt:       session.LastActivity,
+		OwnerDeviceID:   deviceID,
+		OwnerDeviceName: deviceName,
+		CurrentDeviceID: deviceID,
+		LastHeartbeat:   time.Now(),
+		ToolName:        string(session.Tool),
+		Status:          terminal.SessionStatusRunning,
 	}
 	
-	if err := db.SaveSession(dbSession); err != nil {
+	if err := store.SaveSession(state); err != nil {
 		log.Printf("Failed to save session: %v", err)
 	}
 	
@@ -64,9 +68,9 @@ func main() {
 			}
 			
 			// Update database
-			dbSession.LastActivity = time.Now()
-			dbSession.Status = string(s.State)
-			db.SaveSession(dbSession)
+			state.UpdatedAt = time.Now()
+			state.LastHeartbeat = state.UpdatedAt
+			store.SaveSession(state)
 		})
 		if err != nil {
 			log.Printf("Monitor error: %v", err)
@@ -81,28 +85,16 @@ func main() {
 	}
 	
 	// List all sessions
-	sessions, err := db.ListSessions("", "")
+	sessions, err := store.ListSessions(terminal.SessionFilter{})
 	if err != nil {
 		log.Printf("Failed to list sessions: %v", err)
 	}
 	
 	fmt.Printf("\nActive sessions:\n")
 	for _, s := range sessions {
-		fmt.Printf("- %s (%s) on %s\n", s.ID, s.Tool, s.DeviceName)
+		fmt.Printf("- %s (%s) on %s\n", s.ID, s.ToolName, s.OwnerDeviceName)
 	}
 	
 	// Keep running for demo
 	select {}
 }
-
-func getDeviceID() string {
-	hostname, _ := os.Hostname()
-	return hostname
-}
-
-func getDeviceName() string {
-	if hostname, err := os.Hostname(); err == nil {
-		return hostname
-	}
-	return "unknown"
-}
\ No newline at end of file
@@ -2,4 +2,9 @@ module github.com/majiayu000/anywhere-ai
 
 go 1.21
 
-require github.com/google/uuid v1.4.0
+require (
+	github.com/google/uuid v1.4.0
+	github.com/gorilla/websocket v1.5.1
+)
+
+require golang.org/x/net v0.17.0 // indirect
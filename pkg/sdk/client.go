@@ -6,7 +6,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -24,7 +27,7 @@ type AnywhereClient struct {
 func NewAnywhereClient(apiKey, baseURL string) *AnywhereClient {
 	return &AnywhereClient{
 		apiKey:  apiKey,
-		baseURL: baseURL,
+		baseURL: strings.TrimRight(baseURL, "/"),
 		timeout: 30 * time.Second,
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
@@ -73,35 +76,11 @@ func (c *AnywhereClient) SendMessage(ctx context.Context, req *SendMessageReques
 	}
 
 	// 发送HTTP请求
-	respData, err := c.makeRequest(ctx, "POST", "/api/v1/messages/agent", requestData)
-	if err != nil {
+	response := &SendMessageResponse{}
+	if err := c.do(ctx, http.MethodPost, "/api/v1/messages/agent", nil, requestData, response); err != nil {
 		return nil, err
 	}
 
-	// 解析响应
-	response := &SendMessageResponse{
-		Success:         respData["success"].(bool),
-		AgentInstanceID: respData["agent_instance_id"].(string),
-		MessageID:       respData["message_id"].(string),
-	}
-
-	// 处理排队的用户消息
-	if queuedMsgs, exists := respData["queued_user_messages"]; exists && queuedMsgs != nil {
-		if msgs, ok := queuedMsgs.([]interface{}); ok {
-			for _, msg := range msgs {
-				if msgStr, ok := msg.(string); ok {
-					response.QueuedUserMessages = append(response.QueuedUserMessages, msgStr)
-				} else if msgMap, ok := msg.(map[string]interface{}); ok {
-					if content, exists := msgMap["content"]; exists {
-						if contentStr, ok := content.(string); ok {
-							response.QueuedUserMessages = append(response.QueuedUserMessages, contentStr)
-						}
-					}
-				}
-			}
-		}
-	}
-
 	// 如果需要用户输入，启动轮询
 	if req.RequiresUserInput {
 		return c.pollForUserInput(ctx, response, req.TimeoutMinutes, req.PollInterval)
@@ -112,89 +91,42 @@ func (c *AnywhereClient) SendMessage(ctx context.Context, req *SendMessageReques
 
 // GetPendingMessages 获取待处理消息
 func (c *AnywhereClient) GetPendingMessages(ctx context.Context, agentInstanceID string, lastReadMessageID string) (*PendingMessagesResponse, error) {
-	params := map[string]string{
-		"agent_instance_id": agentInstanceID,
-	}
+	params := url.Values{}
+	params.Set("agent_instance_id", agentInstanceID)
 	if lastReadMessageID != "" {
-		params["last_read_message_id"] = lastReadMessageID
+		params.Set("last_read_message_id", lastReadMessageID)
 	}
 
-	respData, err := c.makeRequestWithParams(ctx, "GET", "/api/v1/messages/pending", params)
-	if err != nil {
+	response := &PendingMessagesResponse{}
+	if err := c.do(ctx, http.MethodGet, "/api/v1/messages/pending", params, nil, response); err != nil {
 		return nil, err
 	}
-
-	response := &PendingMessagesResponse{
-		AgentInstanceID: respData["agent_instance_id"].(string),
-		Status:          respData["status"].(string),
-	}
-
-	// 解析消息
-	if messagesData, exists := respData["messages"]; exists && messagesData != nil {
-		if messages, ok := messagesData.([]interface{}); ok {
-			for _, msgData := range messages {
-				if msgMap, ok := msgData.(map[string]interface{}); ok {
-					msg := &Message{
-						ID:            msgMap["id"].(string),
-						Content:       msgMap["content"].(string),
-						SenderType:    msgMap["sender_type"].(string),
-						RequiresInput: msgMap["requires_user_input"].(bool),
-					}
-
-					if gitDiff, exists := msgMap["git_diff"]; exists && gitDiff != nil {
-						msg.GitDiff = gitDiff.(string)
-					}
-
-					if metadata, exists := msgMap["metadata"]; exists && metadata != nil {
-						msg.Metadata = metadata.(map[string]interface{})
-					}
-
-					if createdAt, exists := msgMap["created_at"]; exists && createdAt != nil {
-						if timeStr, ok := createdAt.(string); ok {
-							if parsedTime, err := time.Parse(time.RFC3339, timeStr); err == nil {
-								msg.CreatedAt = parsedTime
-							}
-						}
-					}
-
-					response.Messages = append(response.Messages, msg)
-				}
-			}
-		}
-	}
-
 	return response, nil
 }
 
 // RequestUserInput 请求用户输入
 func (c *AnywhereClient) RequestUserInput(ctx context.Context, messageID string, timeoutMinutes int) ([]string, error) {
 	// 更新消息以请求用户输入
-	respData, err := c.makeRequest(ctx, "PATCH", fmt.Sprintf("/api/v1/messages/%s/request-input", messageID), nil)
-	if err != nil {
+	var response struct {
+		AgentInstanceID string     `json:"agent_instance_id"`
+		Messages        []*Message `json:"messages"`
+	}
+	endpoint := fmt.Sprintf("/api/v1/messages/%s/request-input", url.PathEscape(messageID))
+	if err := c.do(ctx, http.MethodPatch, endpoint, nil, nil, &response); err != nil {
 		return nil, err
 	}
 
-	agentInstanceID := respData["agent_instance_id"].(string)
-
 	// 如果已经有消息，直接返回
-	if messages, exists := respData["messages"]; exists && messages != nil {
-		if msgs, ok := messages.([]interface{}); ok {
-			var contents []string
-			for _, msg := range msgs {
-				if msgMap, ok := msg.(map[string]interface{}); ok {
-					if content, exists := msgMap["content"]; exists {
-						contents = append(contents, content.(string))
-					}
-				}
-			}
-			if len(contents) > 0 {
-				return contents, nil
-			}
+	if len(response.Messages) > 0 {
+		contents := make([]string, 0, len(response.Messages))
+		for _, msg := range response.Messages {
+			contents = append(contents, msg.Content)
 		}
+		return contents, nil
 	}
 
 	// 轮询等待用户响应
-	return c.pollForUserResponse(ctx, agentInstanceID, messageID, timeoutMinutes)
+	return c.pollForUserResponse(ctx, response.AgentInstanceID, messageID, timeoutMinutes)
 }
 
 // EndSession 结束会话
@@ -203,129 +135,94 @@ func (c *AnywhereClient) EndSession(ctx context.Context, agentInstanceID string)
 		"agent_instance_id": agentInstanceID,
 	}
 
-	respData, err := c.makeRequest(ctx, "POST", "/api/v1/sessions/end", requestData)
-	if err != nil {
+	response := &EndSessionResponse{}
+	if err := c.do(ctx, http.MethodPost, "/api/v1/sessions/end", nil, requestData, response); err != nil {
 		return nil, err
 	}
-
-	return &EndSessionResponse{
-		Success:         respData["success"].(bool),
-		AgentInstanceID: respData["agent_instance_id"].(string),
-		FinalStatus:     respData["final_status"].(string),
-	}, nil
+	return response, nil
 }
 
 // SendUserMessage 发送用户消息
 func (c *AnywhereClient) SendUserMessage(ctx context.Context, agentInstanceID, content string, markAsRead bool) (*SendUserMessageResponse, error) {
 	requestData := map[string]interface{}{
 		"agent_instance_id": agentInstanceID,
-		"content":          content,
-		"mark_as_read":     markAsRead,
+		"content":           content,
+		"mark_as_read":      markAsRead,
 	}
 
-	respData, err := c.makeRequest(ctx, "POST", "/api/v1/messages/user", requestData)
-	if err != nil {
+	response := &SendUserMessageResponse{}
+	if err := c.do(ctx, http.MethodPost, "/api/v1/messages/user", nil, requestData, response); err != nil {
 		return nil, err
 	}
-
-	return &SendUserMessageResponse{
-		Success:      respData["success"].(bool),
-		MessageID:    respData["message_id"].(string),
-		MarkedAsRead: respData["marked_as_read"].(bool),
-	}, nil
+	return response, nil
 }
 
 // 私有辅助方法
 
-// makeRequest 发送HTTP请求
-func (c *AnywhereClient) makeRequest(ctx context.Context, method, endpoint string, data interface{}) (map[string]interface{}, error) {
-	url := c.baseURL + endpoint
-
-	var reqBody []byte
-	var err error
+// do 发送HTTP请求，并将JSON响应解码到out（为nil时忽略响应体）。
+// 状态码为4xx/5xx时返回*ClientError。
+func (c *AnywhereClient) do(ctx context.Context, method, endpoint string, params url.Values, data interface{}, out interface{}) error {
+	requestURL := c.baseURL + endpoint
+	if len(params) > 0 {
+		requestURL += "?" + params.Encode()
+	}
 
+	var body io.Reader
 	if data != nil {
-		reqBody, err = json.Marshal(data)
+		reqBody, err := json.Marshal(data)
 		if err != nil {
-			return nil, fmt.Errorf("failed to marshal request data: %w", err)
+			return fmt.Errorf("failed to marshal request data: %w", err)
 		}
+		body = bytes.NewReader(reqBody)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(reqBody))
+	req, err := http.NewRequestWithContext(ctx, method, requestURL, body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// 设置请求头
 	req.Header.Set("Authorization", "Bearer "+c.apiKey)
-	req.Header.Set("Content-Type", "application/json")
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
 
 	// 发送请求
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	// 检查响应状态
-	if resp.StatusCode == 401 {
-		return nil, fmt.Errorf("authentication failed: invalid API key")
-	}
-
 	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("API error: status %d", resp.StatusCode)
+		return newClientError(resp)
 	}
 
 	// 解析响应
-	var respData map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&respData); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
-	}
-
-	return respData, nil
-}
-
-// makeRequestWithParams 发送带查询参数的HTTP请求
-func (c *AnywhereClient) makeRequestWithParams(ctx context.Context, method, endpoint string, params map[string]string) (map[string]interface{}, error) {
-	url := c.baseURL + endpoint
-
-	req, err := http.NewRequestWithContext(ctx, method, url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	if out == nil {
+		return nil
 	}
-
-	// 添加查询参数
-	if len(params) > 0 {
-		q := req.URL.Query()
-		for key, value := range params {
-			q.Add(key, value)
-		}
-		req.URL.RawQuery = q.Encode()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
 	}
+	return nil
+}
 
-	// 设置请求头
-	req.Header.Set("Authorization", "Bearer "+c.apiKey)
-	req.Header.Set("Content-Type", "application/json")
-
-	// 发送请求
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+// newClientError 根据错误响应创建ClientError，服务端返回的错误信息放在Details中
+func newClientError(resp *http.Response) *ClientError {
+	clientErr := &ClientError{Code: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+	if resp.StatusCode == http.StatusUnauthorized {
+		clientErr.Message = "authentication failed: invalid API key"
 	}
-	defer resp.Body.Close()
 
-	// 检查响应状态
-	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("API error: status %d", resp.StatusCode)
+	var body struct {
+		Error string `json:"error"`
 	}
-
-	// 解析响应
-	var respData map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&respData); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body); err == nil {
+		clientErr.Details = body.Error
 	}
-
-	return respData, nil
+	return clientErr
 }
 
 // pollForUserInput 轮询用户输入
@@ -374,6 +271,9 @@ func (c *AnywhereClient) pollForUserInput(ctx context.Context, response *SendMes
 
 // pollForUserResponse 轮询用户响应
 func (c *AnywhereClient) pollForUserResponse(ctx context.Context, agentInstanceID, messageID string, timeoutMinutes int) ([]string, error) {
+	if timeoutMinutes <= 0 {
+		timeoutMinutes = 1440 // 默认24小时
+	}
 	timeout := time.Duration(timeoutMinutes) * time.Minute
 	interval := 3 * time.Second
 
@@ -0,0 +1,135 @@
+package sdk
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// StreamEvent 流式连接收到的事件，是下列*Event类型之一
+type StreamEvent interface {
+	streamEvent()
+}
+
+// ConnectedEvent 连接建立（或重连成功）并已订阅会话
+type ConnectedEvent struct {
+	ClientID    string // 服务端分配的连接ID，用于在控制状态中识别自己
+	Reconnected bool
+}
+
+// DisconnectedEvent 连接断开，流会自动重连
+type DisconnectedEvent struct {
+	Err error
+}
+
+// OutputEvent 会话终端输出有变化，Output为当前完整屏幕内容
+type OutputEvent struct {
+	SessionID string
+	Output    string
+}
+
+// MessageEvent 会话中的新消息。Replayed表示消息发送于断线期间，重连后补发。
+type MessageEvent struct {
+	SessionID string
+	Message   SessionMessage
+	Replayed  bool
+}
+
+// MessagesEvent 首次订阅时服务端发送的消息快照（最早的100条），重连后不再发送
+type MessagesEvent struct {
+	SessionID string
+	Messages  []SessionMessage
+}
+
+// MessageStatusEvent 排队的用户消息送达状态有变化
+type MessageStatusEvent struct {
+	SessionID string
+	Message   SessionMessage
+}
+
+// TypingEvent 工具开始或停止输出
+type TypingEvent struct {
+	SessionID string
+	Typing    bool
+}
+
+// ErrorEvent 服务端拒绝了请求（forbidden、inputRejected），
+// 或流因无法恢复的错误停止（此时Action为空，之后事件通道关闭）
+type ErrorEvent struct {
+	SessionID string
+	Action    string
+	Err       error
+	Data      json.RawMessage // 服务端附带的数据，如错误信息或控制状态
+}
+
+// RawEvent 没有专门类型的服务端事件，如presence、controlState、leaseChanged
+type RawEvent struct {
+	Action    string
+	SessionID string
+	Type      string
+	Output    string
+	Data      json.RawMessage
+}
+
+func (ConnectedEvent) streamEvent()     {}
+func (DisconnectedEvent) streamEvent()  {}
+func (OutputEvent) streamEvent()        {}
+func (MessageEvent) streamEvent()       {}
+func (MessagesEvent) streamEvent()      {}
+func (MessageStatusEvent) streamEvent() {}
+func (TypingEvent) streamEvent()        {}
+func (ErrorEvent) streamEvent()         {}
+func (RawEvent) streamEvent()           {}
+
+// wsMessage 与服务端交换的WebSocket消息
+type wsMessage struct {
+	Action    string          `json:"action"`
+	SessionID string          `json:"sessionId"`
+	Output    string          `json:"output,omitempty"`
+	Input     string          `json:"input,omitempty"`
+	Type      string          `json:"type,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+}
+
+// decodeEvent 将服务端消息转换为事件
+func decodeEvent(msg *wsMessage) StreamEvent {
+	raw := RawEvent{Action: msg.Action, SessionID: msg.SessionID, Type: msg.Type, Output: msg.Output, Data: msg.Data}
+
+	switch msg.Action {
+	case "connected":
+		var data struct {
+			ClientID string `json:"client_id"`
+		}
+		if json.Unmarshal(msg.Data, &data) == nil {
+			return ConnectedEvent{ClientID: data.ClientID}
+		}
+	case "output":
+		return OutputEvent{SessionID: msg.SessionID, Output: msg.Output}
+	case "newMessage":
+		var message SessionMessage
+		if json.Unmarshal(msg.Data, &message) == nil {
+			return MessageEvent{SessionID: msg.SessionID, Message: message}
+		}
+	case "messages":
+		var messages []SessionMessage
+		if json.Unmarshal(msg.Data, &messages) == nil {
+			return MessagesEvent{SessionID: msg.SessionID, Messages: messages}
+		}
+	case "messageStatus":
+		var message SessionMessage
+		if json.Unmarshal(msg.Data, &message) == nil {
+			return MessageStatusEvent{SessionID: msg.SessionID, Message: message}
+		}
+	case "typing", "stopTyping":
+		return TypingEvent{SessionID: msg.SessionID, Typing: msg.Action == "typing"}
+	case "forbidden":
+		var data struct {
+			Error string `json:"error"`
+		}
+		json.Unmarshal(msg.Data, &data)
+		return ErrorEvent{SessionID: msg.SessionID, Action: msg.Action, Err: fmt.Errorf("%w: %s", ErrForbidden, data.Error), Data: msg.Data}
+	case "inputRejected":
+		return ErrorEvent{SessionID: msg.SessionID, Action: msg.Action, Err: ErrInputRejected, Data: msg.Data}
+	}
+	// 无法解析的数据原样交给调用者
+	return raw
+}
@@ -0,0 +1,744 @@
+// Package sdktest 提供内存中的anywhere后端，用于测试使用sdk的代码
+package sdktest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/majiayu000/anywhere-ai/pkg/sdk"
+)
+
+// snapshotSize 订阅时发送的消息条数，与真实服务端一致
+const snapshotSize = 100
+
+// Server 内存中的anywhere后端，实现sdk使用的REST和WebSocket接口。
+// 会话和消息只保存在内存中，不运行真实的工具。
+type Server struct {
+	URL    string
+	APIKey string
+
+	server   *httptest.Server
+	upgrader websocket.Upgrader
+
+	mu       sync.Mutex
+	sessions map[string]*session
+	order    []string
+	conns    map[*conn]bool
+	reject   bool
+}
+
+// session 会话或agent实例
+type session struct {
+	info     sdk.Session
+	output   string
+	inputs   []string
+	keys     []sdk.Key
+	messages []sdk.SessionMessage
+	read     map[string]bool // agent已读取的用户消息
+	agent    bool
+	ended    bool
+}
+
+// conn WebSocket连接
+type conn struct {
+	id        string
+	ws        *websocket.Conn
+	mu        sync.Mutex // 保护写入
+	sessionID string
+}
+
+// NewServer 启动使用apiKey认证的测试服务端，用完后调用Close
+func NewServer(apiKey string) *Server {
+	s := &Server{
+		APIKey:   apiKey,
+		sessions: make(map[string]*session),
+		conns:    make(map[*conn]bool),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/terminal/sessions", s.handleSessions)
+	mux.HandleFunc("/api/v1/terminal/sessions/", s.handleSession)
+	mux.HandleFunc("/api/v1/messages/agent", s.handleAgentMessage)
+	mux.HandleFunc("/api/v1/messages/pending", s.handlePending)
+	mux.HandleFunc("/api/v1/messages/user", s.handleUserMessage)
+	mux.HandleFunc("/api/v1/messages/", s.handleRequestInput)
+	mux.HandleFunc("/api/v1/sessions/end", s.handleEnd)
+	mux.HandleFunc("/api/v1/ws", s.handleWebSocket)
+
+	s.server = httptest.NewServer(s.authenticate(mux))
+	s.URL = s.server.URL
+	return s
+}
+
+// Client 返回连接到测试服务端的客户端
+func (s *Server) Client() *sdk.AnywhereClient {
+	return sdk.NewAnywhereClient(s.APIKey, s.URL)
+}
+
+// Close 关闭所有连接并停止服务端
+func (s *Server) Close() {
+	s.DropConnections()
+	s.server.Close()
+}
+
+// AddSession 添加一个运行中的会话
+func (s *Server) AddSession(tool sdk.Tool, name string) sdk.Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addSession(uuid.New().String(), tool, name, false).info
+}
+
+// Session 返回会话的当前状态
+func (s *Server) Session(sessionID string) (sdk.Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, exists := s.sessions[sessionID]
+	if !exists {
+		return sdk.Session{}, false
+	}
+	return sess.info, true
+}
+
+// SetOutput 设置会话的终端输出，并推送给订阅者
+func (s *Server) SetOutput(sessionID string, output string) {
+	s.mu.Lock()
+	if sess, exists := s.sessions[sessionID]; exists {
+		sess.output = output
+	}
+	s.mu.Unlock()
+
+	s.broadcast(sessionID, map[string]interface{}{"action": "output", "sessionId": sessionID, "output": output})
+}
+
+// AddMessage 向会话添加消息并推送给订阅者。向agent实例添加的用户消息
+// 相当于用户的回复，agent可以通过GetPendingMessages读取。
+func (s *Server) AddMessage(sessionID string, sender sdk.SenderType, content string, requiresInput bool) sdk.SessionMessage {
+	s.mu.Lock()
+	message := s.addMessage(sessionID, sender, content, requiresInput)
+	s.mu.Unlock()
+
+	s.broadcastMessage("newMessage", message)
+	return message
+}
+
+// Messages 返回会话的全部消息
+func (s *Server) Messages(sessionID string) []sdk.SessionMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sess, exists := s.sessions[sessionID]; exists {
+		return append([]sdk.SessionMessage(nil), sess.messages...)
+	}
+	return nil
+}
+
+// Inputs 返回通过REST或WebSocket输入到会话的文本
+func (s *Server) Inputs(sessionID string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sess, exists := s.sessions[sessionID]; exists {
+		return append([]string(nil), sess.inputs...)
+	}
+	return nil
+}
+
+// Keys 返回发送到会话的按键
+func (s *Server) Keys(sessionID string) []sdk.Key {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sess, exists := s.sessions[sessionID]; exists {
+		return append([]sdk.Key(nil), sess.keys...)
+	}
+	return nil
+}
+
+// DropConnections 断开所有WebSocket连接，用于测试重连
+func (s *Server) DropConnections() {
+	s.mu.Lock()
+	conns := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+
+	for _, c := range conns {
+		c.ws.Close()
+	}
+}
+
+// RejectConnections 设置是否拒绝新的WebSocket连接（返回503），
+// 配合DropConnections模拟断线期间产生的消息
+func (s *Server) RejectConnections(reject bool) {
+	s.mu.Lock()
+	s.reject = reject
+	s.mu.Unlock()
+}
+
+// 私有辅助方法
+
+// authenticate 检查API密钥
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+s.APIKey {
+			writeError(w, http.StatusUnauthorized, "Invalid API key")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleSessions 列出或创建会话
+func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		sessions := make([]sdk.Session, 0, len(s.order))
+		for _, id := range s.order {
+			if sess := s.sessions[id]; !sess.agent {
+				sessions = append(sessions, sess.info)
+			}
+		}
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, sessions)
+
+	case http.MethodPost:
+		var req sdk.CreateSessionRequest
+		if !readJSON(w, r, &req) {
+			return
+		}
+		switch req.Tool {
+		case sdk.ToolClaude, sdk.ToolGemini, sdk.ToolCursor, sdk.ToolCopilot:
+		default:
+			writeError(w, http.StatusBadRequest, "Invalid tool")
+			return
+		}
+		s.mu.Lock()
+		sess := s.addSession(uuid.New().String(), req.Tool, req.Name, false)
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, sess.info)
+
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSession 处理/api/v1/terminal/sessions/:id下的路由
+func (s *Server) handleSession(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/api/v1/terminal/sessions/")
+	sessionID, action, _ := strings.Cut(rest, "/")
+
+	s.mu.Lock()
+	sess, exists := s.sessions[sessionID]
+	if !exists || sess.agent && action != "messages" {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, "Session not found")
+		return
+	}
+	s.mu.Unlock()
+
+	switch {
+	case action == "" && r.Method == http.MethodDelete:
+		s.mu.Lock()
+		delete(s.sessions, sessionID)
+		for i, id := range s.order {
+			if id == sessionID {
+				s.order = append(s.order[:i], s.order[i+1:]...)
+				break
+			}
+		}
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+
+	case action == "output" && r.Method == http.MethodGet:
+		s.mu.Lock()
+		output := sess.output
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, map[string]interface{}{"output": output})
+
+	case action == "input" && r.Method == http.MethodPost:
+		var req struct {
+			Input string `json:"input"`
+		}
+		if !readJSON(w, r, &req) {
+			return
+		}
+		if req.Input == "" {
+			writeError(w, http.StatusBadRequest, "input is required")
+			return
+		}
+		s.mu.Lock()
+		sess.inputs = append(sess.inputs, req.Input)
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+
+	case action == "keys" && r.Method == http.MethodPost:
+		var req struct {
+			Keys []sdk.Key `json:"keys"`
+		}
+		if !readJSON(w, r, &req) {
+			return
+		}
+		if len(req.Keys) == 0 {
+			writeError(w, http.StatusBadRequest, "keys is required")
+			return
+		}
+		s.mu.Lock()
+		sess.keys = append(sess.keys, req.Keys...)
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true})
+
+	case action == "messages" && r.Method == http.MethodGet:
+		s.listMessages(w, r, sessionID)
+
+	case action == "messages" && r.Method == http.MethodPost:
+		var req struct {
+			Content string `json:"content"`
+		}
+		if !readJSON(w, r, &req) {
+			return
+		}
+		if req.Content == "" {
+			writeError(w, http.StatusBadRequest, "content is required")
+			return
+		}
+		writeJSON(w, http.StatusOK, s.AddMessage(sessionID, sdk.SenderUser, req.Content, false))
+
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+// listMessages 分页返回会话消息，支持limit、offset和after
+func (s *Server) listMessages(w http.ResponseWriter, r *http.Request, sessionID string) {
+	query := r.URL.Query()
+	limit, offset := 100, 0
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > 500 {
+			writeError(w, http.StatusBadRequest, "Invalid limit")
+			return
+		}
+		limit = parsed
+	}
+	if value := query.Get("offset"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			writeError(w, http.StatusBadRequest, "Invalid offset")
+			return
+		}
+		offset = parsed
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, exists := s.sessions[sessionID]
+	if !exists {
+		writeError(w, http.StatusNotFound, "Session not found")
+		return
+	}
+	messages := sess.messages
+	if after := query.Get("after"); after != "" {
+		offset = -1
+		for i, message := range messages {
+			if message.ID == after {
+				offset = i + 1
+				break
+			}
+		}
+		if offset < 0 {
+			writeError(w, http.StatusNotFound, "message not found")
+			return
+		}
+	}
+
+	page := []sdk.SessionMessage{}
+	if offset < len(messages) {
+		end := offset + limit
+		if end > len(messages) {
+			end = len(messages)
+		}
+		page = append(page, messages[offset:end]...)
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// handleAgentMessage 处理agent发送的消息，首次发送时创建agent实例
+func (s *Server) handleAgentMessage(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Content           string `json:"content"`
+		AgentInstanceID   string `json:"agent_instance_id"`
+		AgentType         string `json:"agent_type"`
+		RequiresUserInput bool   `json:"requires_user_input"`
+		GitDiff           string `json:"git_diff"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.Content == "" || req.AgentInstanceID == "" {
+		writeError(w, http.StatusBadRequest, "content and agent_instance_id are required")
+		return
+	}
+
+	s.mu.Lock()
+	sess, exists := s.sessions[req.AgentInstanceID]
+	switch {
+	case !exists && req.AgentType == "":
+		s.mu.Unlock()
+		writeError(w, http.StatusBadRequest, "agent_type is required to start an agent instance")
+		return
+	case !exists:
+		sess = s.addSession(req.AgentInstanceID, sdk.Tool(req.AgentType), req.AgentType, true)
+	case !sess.agent || sess.ended:
+		s.mu.Unlock()
+		writeError(w, http.StatusConflict, "agent instance cannot receive messages")
+		return
+	}
+	message := s.addMessage(req.AgentInstanceID, sdk.SenderAgent, req.Content, req.RequiresUserInput)
+	message.GitDiff = req.GitDiff
+	sess.messages[len(sess.messages)-1] = message
+	queued := s.takeUnread(sess)
+	s.mu.Unlock()
+
+	s.broadcastMessage("newMessage", message)
+	contents := make([]string, 0, len(queued))
+	for _, queuedMessage := range queued {
+		contents = append(contents, queuedMessage.Content)
+	}
+	writeJSON(w, http.StatusOK, sdk.SendMessageResponse{
+		Success:            true,
+		AgentInstanceID:    req.AgentInstanceID,
+		MessageID:          message.ID,
+		QueuedUserMessages: contents,
+	})
+}
+
+// handlePending 返回agent未读的用户消息并标记为已读
+func (s *Server) handlePending(w http.ResponseWriter, r *http.Request) {
+	instanceID := r.URL.Query().Get("agent_instance_id")
+
+	s.mu.Lock()
+	sess, exists := s.sessions[instanceID]
+	if !exists || !sess.agent {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, "agent instance not found")
+		return
+	}
+	messages := s.takeUnread(sess)
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, sdk.PendingMessagesResponse{
+		AgentInstanceID: instanceID,
+		Messages:        agentMessages(messages),
+		Status:          "ok",
+	})
+}
+
+// handleRequestInput 处理PATCH /api/v1/messages/:id/request-input
+func (s *Server) handleRequestInput(w http.ResponseWriter, r *http.Request) {
+	messageID, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/messages/"), "/request-input")
+	if !ok || r.Method != http.MethodPatch {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+
+	s.mu.Lock()
+	var (
+		sess    *session
+		message sdk.SessionMessage
+	)
+	for _, candidate := range s.sessions {
+		for i := range candidate.messages {
+			if candidate.agent && candidate.messages[i].ID == messageID && candidate.messages[i].SenderType == sdk.SenderAgent {
+				candidate.messages[i].RequiresUserInput = true
+				sess, message = candidate, candidate.messages[i]
+			}
+		}
+	}
+	if sess == nil {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, "message not found")
+		return
+	}
+	queued := s.takeUnread(sess)
+	s.mu.Unlock()
+
+	s.broadcastMessage("newMessage", message)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":           true,
+		"agent_instance_id": sess.info.ID,
+		"message_id":        message.ID,
+		"messages":          agentMessages(queued),
+	})
+}
+
+// handleUserMessage 处理用户对agent实例的回复
+func (s *Server) handleUserMessage(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		AgentInstanceID string `json:"agent_instance_id"`
+		Content         string `json:"content"`
+		MarkAsRead      bool   `json:"mark_as_read"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.Content == "" {
+		writeError(w, http.StatusBadRequest, "content is required")
+		return
+	}
+
+	s.mu.Lock()
+	sess, exists := s.sessions[req.AgentInstanceID]
+	if !exists || !sess.agent {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, "agent instance not found")
+		return
+	}
+	message := s.addMessage(req.AgentInstanceID, sdk.SenderUser, req.Content, false)
+	if req.MarkAsRead {
+		sess.read[message.ID] = true
+	}
+	s.mu.Unlock()
+
+	s.broadcastMessage("newMessage", message)
+	writeJSON(w, http.StatusOK, sdk.SendUserMessageResponse{Success: true, MessageID: message.ID, MarkedAsRead: req.MarkAsRead})
+}
+
+// handleEnd 结束agent实例
+func (s *Server) handleEnd(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		AgentInstanceID string `json:"agent_instance_id"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	s.mu.Lock()
+	sess, exists := s.sessions[req.AgentInstanceID]
+	if !exists || !sess.agent {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, "agent instance not found")
+		return
+	}
+	if sess.ended {
+		s.mu.Unlock()
+		writeError(w, http.StatusConflict, "agent instance already ended")
+		return
+	}
+	sess.ended = true
+	sess.info.Status = "completed"
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, sdk.EndSessionResponse{Success: true, AgentInstanceID: req.AgentInstanceID, FinalStatus: "completed"})
+}
+
+// handleWebSocket 处理WebSocket连接，支持subscribe、unsubscribe、input、
+// sendMessage和getMessages
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	reject := s.reject
+	s.mu.Unlock()
+	if reject {
+		writeError(w, http.StatusServiceUnavailable, "Connections rejected")
+		return
+	}
+
+	ws, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	c := &conn{id: uuid.New().String(), ws: ws}
+	s.mu.Lock()
+	s.conns[c] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		ws.Close()
+	}()
+
+	c.write(map[string]interface{}{"action": "connected", "type": "status", "data": map[string]string{"client_id": c.id}})
+
+	for {
+		var msg struct {
+			Action    string `json:"action"`
+			SessionID string `json:"sessionId"`
+			Input     string `json:"input"`
+		}
+		if err := ws.ReadJSON(&msg); err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		sess, exists := s.sessions[msg.SessionID]
+		s.mu.Unlock()
+		if msg.SessionID != "" && !exists {
+			c.write(map[string]interface{}{"action": "forbidden", "sessionId": msg.SessionID, "type": "status", "data": map[string]string{"error": "session not found"}})
+			continue
+		}
+
+		switch msg.Action {
+		case "subscribe":
+			s.mu.Lock()
+			c.sessionID = msg.SessionID
+			s.mu.Unlock()
+			s.sendSnapshot(c, msg.SessionID)
+		case "unsubscribe":
+			s.mu.Lock()
+			c.sessionID = ""
+			s.mu.Unlock()
+		case "getMessages", "selectSession":
+			s.sendSnapshot(c, msg.SessionID)
+		case "input":
+			if msg.Input != "" {
+				s.mu.Lock()
+				sess.inputs = append(sess.inputs, msg.Input)
+				s.mu.Unlock()
+			}
+		case "sendMessage":
+			if msg.Input != "" {
+				s.AddMessage(msg.SessionID, sdk.SenderUser, msg.Input, false)
+			}
+		}
+	}
+}
+
+// sendSnapshot 发送会话最早的消息
+func (s *Server) sendSnapshot(c *conn, sessionID string) {
+	s.mu.Lock()
+	snapshot := []sdk.SessionMessage{}
+	if sess, exists := s.sessions[sessionID]; exists {
+		messages := sess.messages
+		if len(messages) > snapshotSize {
+			messages = messages[:snapshotSize]
+		}
+		snapshot = append(snapshot, messages...)
+	}
+	s.mu.Unlock()
+
+	c.write(map[string]interface{}{"action": "messages", "sessionId": sessionID, "type": "message", "data": snapshot})
+}
+
+// broadcastMessage 向订阅者推送消息
+func (s *Server) broadcastMessage(action string, message sdk.SessionMessage) {
+	s.broadcast(message.SessionID, map[string]interface{}{"action": action, "sessionId": message.SessionID, "type": "message", "data": message})
+}
+
+// broadcast 向订阅会话的连接发送数据
+func (s *Server) broadcast(sessionID string, msg interface{}) {
+	s.mu.Lock()
+	var targets []*conn
+	for c := range s.conns {
+		if c.sessionID == sessionID {
+			targets = append(targets, c)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, c := range targets {
+		c.write(msg)
+	}
+}
+
+// addSession 添加会话，调用者持有s.mu
+func (s *Server) addSession(id string, tool sdk.Tool, name string, agent bool) *session {
+	if name == "" {
+		name = string(tool) + "-" + id[:8]
+	}
+	sess := &session{
+		info: sdk.Session{
+			ID:         id,
+			Name:       name,
+			Tool:       tool,
+			Status:     "running",
+			Created:    time.Now(),
+			DeviceName: "sdktest",
+			Role:       sdk.RoleOwner,
+		},
+		read:  make(map[string]bool),
+		agent: agent,
+	}
+	s.sessions[id] = sess
+	s.order = append(s.order, id)
+	return sess
+}
+
+// addMessage 添加消息，调用者持有s.mu
+func (s *Server) addMessage(sessionID string, sender sdk.SenderType, content string, requiresInput bool) sdk.SessionMessage {
+	message := sdk.SessionMessage{
+		ID:                uuid.New().String(),
+		SessionID:         sessionID,
+		SenderType:        sender,
+		Content:           content,
+		RequiresUserInput: requiresInput,
+		CreatedAt:         time.Now(),
+	}
+	if sess, exists := s.sessions[sessionID]; exists {
+		sess.messages = append(sess.messages, message)
+		sess.info.RequiresUserInput = requiresInput
+	}
+	return message
+}
+
+// takeUnread 返回agent未读的用户消息并标记为已读，调用者持有s.mu
+func (s *Server) takeUnread(sess *session) []sdk.SessionMessage {
+	var unread []sdk.SessionMessage
+	for _, message := range sess.messages {
+		if message.SenderType == sdk.SenderUser && !sess.read[message.ID] {
+			sess.read[message.ID] = true
+			unread = append(unread, message)
+		}
+	}
+	return unread
+}
+
+// write 向连接写入JSON消息，连接已断开时忽略错误
+func (c *conn) write(msg interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ws.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	c.ws.WriteJSON(msg)
+}
+
+// agentMessages 将会话消息转换为agent接口的消息格式
+func agentMessages(messages []sdk.SessionMessage) []*sdk.Message {
+	result := make([]*sdk.Message, 0, len(messages))
+	for _, message := range messages {
+		result = append(result, &sdk.Message{
+			ID:            message.ID,
+			Content:       message.Content,
+			SenderType:    string(message.SenderType),
+			RequiresInput: message.RequiresUserInput,
+			GitDiff:       message.GitDiff,
+			CreatedAt:     message.CreatedAt,
+		})
+	}
+	return result
+}
+
+// readJSON 解码请求体，失败时返回400
+func readJSON(w http.ResponseWriter, r *http.Request, out interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(out); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+	return true
+}
+
+// writeJSON 写入JSON响应
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeError 以服务端的格式写入错误
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,431 @@
+package sdk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	// ErrStreamClosed 流已关闭
+	ErrStreamClosed = errors.New("stream closed")
+	// ErrNotConnected 流正在重连，暂时无法发送
+	ErrNotConnected = errors.New("stream not connected")
+	// ErrForbidden 调用者的角色或API密钥不允许该操作
+	ErrForbidden = errors.New("forbidden")
+	// ErrInputRejected 其他客户端正在控制会话，输入被拒绝
+	ErrInputRejected = errors.New("input rejected: another client controls the session")
+)
+
+const (
+	streamWriteWait   = 10 * time.Second
+	streamPongWait    = 90 * time.Second // 服务端每54秒ping一次
+	replayPageSize    = 500
+	seenMessagesLimit = 1000
+)
+
+// StreamOptions 流式连接选项
+type StreamOptions struct {
+	After        string        // 连接后先补发该消息之后的消息，为空时只接收新消息
+	ReconnectMin time.Duration // 首次重连前的等待时间，之后每次翻倍，默认500毫秒
+	ReconnectMax time.Duration // 重连等待时间的上限，默认30秒
+	Buffer       int           // 事件通道的缓冲大小，默认256
+}
+
+// Stream 订阅一个会话的WebSocket连接。断线后自动重连，并通过REST接口补发断线期间的消息。
+type Stream struct {
+	client    *AnywhereClient
+	sessionID string
+	opts      StreamOptions
+	events    chan StreamEvent
+	done      chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu   sync.Mutex // 保护conn及其写入
+	conn *websocket.Conn
+
+	// 以下字段只在run协程中访问
+	lastMessageID string
+	seen          map[string]bool
+	seenOrder     []string
+
+	err error // 流停止的原因，done关闭后可读
+}
+
+// Stream 连接并订阅会话，返回的流在ctx取消或调用Close后停止。
+// 首次连接失败时直接返回错误；之后的断线会自动重连，无法恢复的错误
+// （如API密钥失效、会话被删除）以ErrorEvent报告，然后关闭事件通道。
+func (c *AnywhereClient) Stream(ctx context.Context, sessionID string, opts *StreamOptions) (*Stream, error) {
+	s := &Stream{
+		client:    c,
+		sessionID: sessionID,
+		done:      make(chan struct{}),
+		seen:      make(map[string]bool),
+	}
+	if opts != nil {
+		s.opts = *opts
+	}
+	if s.opts.ReconnectMin <= 0 {
+		s.opts.ReconnectMin = 500 * time.Millisecond
+	}
+	if s.opts.ReconnectMax <= 0 {
+		s.opts.ReconnectMax = 30 * time.Second
+	}
+	if s.opts.ReconnectMax < s.opts.ReconnectMin {
+		s.opts.ReconnectMax = s.opts.ReconnectMin
+	}
+	if s.opts.Buffer <= 0 {
+		s.opts.Buffer = 256
+	}
+	s.events = make(chan StreamEvent, s.opts.Buffer)
+	s.lastMessageID = s.opts.After
+	s.ctx, s.cancel = context.WithCancel(ctx)
+
+	conn, clientID, err := s.connect()
+	if err != nil {
+		s.cancel()
+		return nil, err
+	}
+	go s.run(conn, clientID)
+	return s, nil
+}
+
+// Events 返回事件通道，流停止后关闭
+func (s *Stream) Events() <-chan StreamEvent {
+	return s.events
+}
+
+// SessionID 返回订阅的会话ID
+func (s *Stream) SessionID() string {
+	return s.sessionID
+}
+
+// Err 返回流停止的原因，流未停止或由调用者关闭时返回nil
+func (s *Stream) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+// Close 关闭流并等待后台协程退出
+func (s *Stream) Close() error {
+	s.cancel()
+	s.mu.Lock()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	s.mu.Unlock()
+	<-s.done
+	return nil
+}
+
+// SendInput 向会话输入一行文本，需要operator角色。
+// 其他客户端控制会话时，服务端以inputRejected的ErrorEvent回复。
+func (s *Stream) SendInput(input string) error {
+	return s.send(&wsMessage{Action: "input", SessionID: s.sessionID, Input: input})
+}
+
+// SendMessage 向会话发送用户消息，需要commenter角色
+func (s *Stream) SendMessage(content string) error {
+	return s.send(&wsMessage{Action: "sendMessage", SessionID: s.sessionID, Input: content})
+}
+
+// MarkAsRead 将该消息及之前的消息标记为已读
+func (s *Stream) MarkAsRead(messageID string) error {
+	data, err := json.Marshal(messageID)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message ID: %w", err)
+	}
+	return s.send(&wsMessage{Action: "markAsRead", SessionID: s.sessionID, Data: data})
+}
+
+// send 在当前连接上发送消息
+func (s *Stream) send(msg *wsMessage) error {
+	if s.ctx.Err() != nil {
+		return ErrStreamClosed
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return ErrNotConnected
+	}
+	return writeMessage(s.conn, msg)
+}
+
+// 私有辅助方法
+
+// run 读取连接上的事件，断线后重连，直到流停止
+func (s *Stream) run(conn *websocket.Conn, clientID string) {
+	defer close(s.done)
+	defer close(s.events)
+
+	reconnected := false
+	for {
+		err := s.serve(conn, clientID, reconnected)
+		s.setConn(nil)
+		conn.Close()
+		if s.ctx.Err() != nil {
+			return
+		}
+		if fatalStreamError(err) {
+			s.stop(err)
+			return
+		}
+		if !s.emit(DisconnectedEvent{Err: err}) {
+			return
+		}
+
+		conn, clientID, err = s.reconnect()
+		if err != nil {
+			if s.ctx.Err() == nil {
+				s.stop(err)
+			}
+			return
+		}
+		reconnected = true
+	}
+}
+
+// serve 处理一个连接，直到它断开
+func (s *Stream) serve(conn *websocket.Conn, clientID string, reconnected bool) error {
+	s.setConn(conn)
+	if !s.emit(ConnectedEvent{ClientID: clientID, Reconnected: reconnected}) {
+		return s.ctx.Err()
+	}
+	// 首次连接且未指定After时只定位最新消息，不补发
+	if err := s.catchUp(reconnected || s.opts.After != ""); err != nil {
+		return err
+	}
+
+	for {
+		var msg wsMessage
+		if err := conn.ReadJSON(&msg); err != nil {
+			if s.ctx.Err() != nil {
+				return s.ctx.Err()
+			}
+			return fmt.Errorf("failed to read from stream: %w", err)
+		}
+		conn.SetReadDeadline(time.Now().Add(streamPongWait))
+
+		switch event := decodeEvent(&msg).(type) {
+		case MessageEvent:
+			if !s.markSeen(event.Message.ID) {
+				continue
+			}
+			s.lastMessageID = event.Message.ID
+			if !s.emit(event) {
+				return s.ctx.Err()
+			}
+		case MessagesEvent:
+			// 重连后的快照已由补发的消息代替
+			if reconnected {
+				continue
+			}
+			for _, message := range event.Messages {
+				s.markSeen(message.ID)
+			}
+			if !s.emit(event) {
+				return s.ctx.Err()
+			}
+		default:
+			if !s.emit(event) {
+				return s.ctx.Err()
+			}
+		}
+	}
+}
+
+// catchUp 通过REST接口获取lastMessageID之后的消息。emit为false时只记录最新消息。
+func (s *Stream) catchUp(emit bool) error {
+	for {
+		messages, err := s.client.ListSessionMessages(s.ctx, s.sessionID, &ListMessagesOptions{Limit: replayPageSize, After: s.lastMessageID})
+		if err != nil {
+			var clientErr *ClientError
+			if s.lastMessageID != "" && errors.As(err, &clientErr) && clientErr.Code == http.StatusNotFound {
+				// 记录的消息已不存在，无法确定错过了哪些消息，重新定位最新消息
+				s.lastMessageID = ""
+				emit = false
+				continue
+			}
+			return fmt.Errorf("failed to replay messages: %w", err)
+		}
+
+		for _, message := range messages {
+			s.lastMessageID = message.ID
+			if !s.markSeen(message.ID) || !emit {
+				continue
+			}
+			if !s.emit(MessageEvent{SessionID: s.sessionID, Message: message, Replayed: true}) {
+				return s.ctx.Err()
+			}
+		}
+		if len(messages) < replayPageSize {
+			return nil
+		}
+	}
+}
+
+// reconnect 以指数退避重新连接，直到成功、遇到无法恢复的错误或流停止
+func (s *Stream) reconnect() (*websocket.Conn, string, error) {
+	delay := s.opts.ReconnectMin
+	for {
+		timer := time.NewTimer(delay)
+		select {
+		case <-s.ctx.Done():
+			timer.Stop()
+			return nil, "", s.ctx.Err()
+		case <-timer.C:
+		}
+
+		conn, clientID, err := s.connect()
+		if err == nil {
+			return conn, clientID, nil
+		}
+		if fatalStreamError(err) {
+			return nil, "", err
+		}
+
+		delay *= 2
+		if delay > s.opts.ReconnectMax {
+			delay = s.opts.ReconnectMax
+		}
+	}
+}
+
+// connect 建立WebSocket连接，读取服务端分配的连接ID并订阅会话
+func (s *Stream) connect() (*websocket.Conn, string, error) {
+	streamURL, err := s.client.streamURL()
+	if err != nil {
+		return nil, "", err
+	}
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+s.client.apiKey)
+
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: s.client.timeout,
+	}
+	conn, resp, err := dialer.DialContext(s.ctx, streamURL, header)
+	if err != nil {
+		if resp != nil && resp.StatusCode >= 400 {
+			return nil, "", newClientError(resp)
+		}
+		return nil, "", fmt.Errorf("failed to connect stream: %w", err)
+	}
+
+	// 服务端先发送connected消息
+	conn.SetReadDeadline(time.Now().Add(streamPongWait))
+	var hello wsMessage
+	if err := conn.ReadJSON(&hello); err != nil {
+		conn.Close()
+		return nil, "", fmt.Errorf("failed to read from stream: %w", err)
+	}
+	var clientID string
+	if event, ok := decodeEvent(&hello).(ConnectedEvent); ok {
+		clientID = event.ClientID
+	}
+
+	if err := writeMessage(conn, &wsMessage{Action: "subscribe", SessionID: s.sessionID}); err != nil {
+		conn.Close()
+		return nil, "", err
+	}
+	conn.SetPingHandler(func(data string) error {
+		conn.SetReadDeadline(time.Now().Add(streamPongWait))
+		err := conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(streamWriteWait))
+		if errors.Is(err, websocket.ErrCloseSent) {
+			return nil
+		}
+		return err
+	})
+	return conn, clientID, nil
+}
+
+// setConn 设置当前连接，nil表示正在重连
+func (s *Stream) setConn(conn *websocket.Conn) {
+	s.mu.Lock()
+	s.conn = conn
+	s.mu.Unlock()
+}
+
+// emit 发送事件，流停止时返回false
+func (s *Stream) emit(event StreamEvent) bool {
+	select {
+	case s.events <- event:
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
+
+// stop 记录无法恢复的错误并通知调用者
+func (s *Stream) stop(err error) {
+	s.err = err
+	s.emit(ErrorEvent{SessionID: s.sessionID, Err: err})
+}
+
+// markSeen 记录消息ID，已经见过时返回false。只保留最近的消息ID，
+// 足以去除重连前后WebSocket和REST重复返回的消息。
+func (s *Stream) markSeen(id string) bool {
+	if s.seen[id] {
+		return false
+	}
+	s.seen[id] = true
+	s.seenOrder = append(s.seenOrder, id)
+	if len(s.seenOrder) > seenMessagesLimit {
+		delete(s.seen, s.seenOrder[0])
+		s.seenOrder = s.seenOrder[1:]
+	}
+	return true
+}
+
+// writeMessage 写入一条JSON消息
+func writeMessage(conn *websocket.Conn, msg *wsMessage) error {
+	conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+	if err := conn.WriteJSON(msg); err != nil {
+		return fmt.Errorf("failed to write to stream: %w", err)
+	}
+	return nil
+}
+
+// fatalStreamError 判断错误是否无法通过重连恢复
+func fatalStreamError(err error) bool {
+	var clientErr *ClientError
+	if !errors.As(err, &clientErr) {
+		return false
+	}
+	switch clientErr.Code {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+		return true
+	}
+	return false
+}
+
+// streamURL 返回WebSocket地址
+func (c *AnywhereClient) streamURL() (string, error) {
+	u, err := url.Parse(c.baseURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid base URL: %w", err)
+	}
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	case "http":
+		u.Scheme = "ws"
+	}
+	u.Path = strings.TrimRight(u.Path, "/") + "/api/v1/ws"
+	return u.String(), nil
+}
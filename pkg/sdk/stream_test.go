@@ -0,0 +1,123 @@
+package sdk_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/majiayu000/anywhere-ai/pkg/sdk"
+	"github.com/majiayu000/anywhere-ai/pkg/sdk/sdktest"
+)
+
+// eventTimeout 等待单个事件的时间上限
+const eventTimeout = 5 * time.Second
+
+// TestStreamReplaysMissedMessages 断线期间的消息在重连后按顺序补发，不丢失也不重复
+func TestStreamReplaysMissedMessages(t *testing.T) {
+	srv := sdktest.NewServer("test-key")
+	defer srv.Close()
+
+	session := srv.AddSession(sdk.ToolClaude, "replay")
+	srv.AddMessage(session.ID, sdk.SenderAgent, "before", false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := srv.Client().Stream(ctx, session.ID, &sdk.StreamOptions{
+		ReconnectMin: 10 * time.Millisecond,
+		ReconnectMax: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	defer stream.Close()
+
+	seen := make(map[string]bool)
+	nextMessage := func() sdk.MessageEvent {
+		t.Helper()
+		event := waitFor[sdk.MessageEvent](t, stream)
+		if seen[event.Message.ID] {
+			t.Fatalf("message %q delivered twice", event.Message.Content)
+		}
+		seen[event.Message.ID] = true
+		return event
+	}
+
+	if connected := waitFor[sdk.ConnectedEvent](t, stream); connected.Reconnected {
+		t.Fatal("first connection reported as a reconnect")
+	}
+	snapshot := waitFor[sdk.MessagesEvent](t, stream)
+	if len(snapshot.Messages) != 1 || snapshot.Messages[0].Content != "before" {
+		t.Fatalf("snapshot = %+v, want the one message sent before connecting", snapshot.Messages)
+	}
+	seen[snapshot.Messages[0].ID] = true
+
+	srv.AddMessage(session.ID, sdk.SenderAgent, "live 1", false)
+	if event := nextMessage(); event.Message.Content != "live 1" || event.Replayed {
+		t.Fatalf("got %q (replayed %v), want live message %q", event.Message.Content, event.Replayed, "live 1")
+	}
+
+	// 断线并拒绝重连，期间产生的消息只能通过补发收到
+	srv.RejectConnections(true)
+	srv.DropConnections()
+	waitFor[sdk.DisconnectedEvent](t, stream)
+
+	missed := []string{"missed 1", "missed 2", "missed 3"}
+	for _, content := range missed {
+		srv.AddMessage(session.ID, sdk.SenderAgent, content, false)
+	}
+	srv.RejectConnections(false)
+
+	if connected := waitFor[sdk.ConnectedEvent](t, stream); !connected.Reconnected {
+		t.Fatal("reconnection not reported as a reconnect")
+	}
+	for _, want := range missed {
+		if event := nextMessage(); event.Message.Content != want || !event.Replayed {
+			t.Fatalf("got %q (replayed %v), want replayed message %q", event.Message.Content, event.Replayed, want)
+		}
+	}
+
+	srv.AddMessage(session.ID, sdk.SenderAgent, "live 2", false)
+	if event := nextMessage(); event.Message.Content != "live 2" || event.Replayed {
+		t.Fatalf("got %q (replayed %v), want live message %q", event.Message.Content, event.Replayed, "live 2")
+	}
+
+	// 之后不应再收到任何消息
+	timer := time.NewTimer(100 * time.Millisecond)
+	defer timer.Stop()
+	for {
+		select {
+		case event := <-stream.Events():
+			if message, ok := event.(sdk.MessageEvent); ok {
+				t.Fatalf("unexpected message %q after replay", message.Message.Content)
+			}
+		case <-timer.C:
+			if got, want := len(seen), len(srv.Messages(session.ID)); got != want {
+				t.Fatalf("received %d messages, server has %d", got, want)
+			}
+			return
+		}
+	}
+}
+
+// waitFor 返回流中下一个T类型的事件，跳过其他事件
+func waitFor[T sdk.StreamEvent](t *testing.T, stream *sdk.Stream) T {
+	t.Helper()
+	timer := time.NewTimer(eventTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case event, ok := <-stream.Events():
+			if !ok {
+				t.Fatalf("stream closed while waiting for %T: %v", *new(T), stream.Err())
+			}
+			if typed, ok := event.(T); ok {
+				return typed
+			}
+			if failed, ok := event.(sdk.ErrorEvent); ok && failed.Action == "" {
+				t.Fatalf("stream failed: %v", failed.Err)
+			}
+		case <-timer.C:
+			t.Fatalf("timed out waiting for %T", *new(T))
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package sdk
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// CreateSession 创建终端会话并启动工具
+func (c *AnywhereClient) CreateSession(ctx context.Context, req *CreateSessionRequest) (*Session, error) {
+	if req == nil || req.Tool == "" {
+		return nil, fmt.Errorf("tool is required")
+	}
+
+	session := &Session{}
+	if err := c.do(ctx, http.MethodPost, "/api/v1/terminal/sessions", nil, req, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// ListSessions 列出调用者可见的会话，包括已配对设备上的会话
+func (c *AnywhereClient) ListSessions(ctx context.Context) ([]Session, error) {
+	var sessions []Session
+	if err := c.do(ctx, http.MethodGet, "/api/v1/terminal/sessions", nil, nil, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// DeleteSession 终止并删除会话
+func (c *AnywhereClient) DeleteSession(ctx context.Context, sessionID string) error {
+	return c.do(ctx, http.MethodDelete, sessionPath(sessionID, ""), nil, nil, nil)
+}
+
+// GetOutput 获取会话当前的终端输出
+func (c *AnywhereClient) GetOutput(ctx context.Context, sessionID string) (string, error) {
+	var response struct {
+		Output string `json:"output"`
+	}
+	if err := c.do(ctx, http.MethodGet, sessionPath(sessionID, "/output"), nil, nil, &response); err != nil {
+		return "", err
+	}
+	return response.Output, nil
+}
+
+// SendInput 向会话输入一行文本（末尾自动回车）
+func (c *AnywhereClient) SendInput(ctx context.Context, sessionID string, input string) error {
+	requestData := map[string]interface{}{"input": input}
+	return c.do(ctx, http.MethodPost, sessionPath(sessionID, "/input"), nil, requestData, nil)
+}
+
+// SendKeys 向会话发送特殊按键，如Escape或Ctrl-C
+func (c *AnywhereClient) SendKeys(ctx context.Context, sessionID string, keys ...Key) error {
+	if len(keys) == 0 {
+		return fmt.Errorf("at least one key is required")
+	}
+	requestData := map[string]interface{}{"keys": keys}
+	return c.do(ctx, http.MethodPost, sessionPath(sessionID, "/keys"), nil, requestData, nil)
+}
+
+// AnswerPermission 回答工具的权限请求。使用API密钥时需要permissions:approve权限。
+func (c *AnywhereClient) AnswerPermission(ctx context.Context, sessionID string, answer PermissionAnswer) error {
+	switch answer {
+	case PermissionAllow:
+		return c.SendInput(ctx, sessionID, "1")
+	case PermissionAllowAlways:
+		return c.SendInput(ctx, sessionID, "2")
+	case PermissionDeny:
+		// 选项编号因提示而异，Escape总是取消
+		return c.SendKeys(ctx, sessionID, KeyEscape)
+	}
+	return fmt.Errorf("unknown permission answer: %s", answer)
+}
+
+// ListSessionMessages 分页获取会话消息，按时间从旧到新
+func (c *AnywhereClient) ListSessionMessages(ctx context.Context, sessionID string, opts *ListMessagesOptions) ([]SessionMessage, error) {
+	params := url.Values{}
+	if opts != nil {
+		if opts.Limit > 0 {
+			params.Set("limit", strconv.Itoa(opts.Limit))
+		}
+		if opts.After != "" {
+			params.Set("after", opts.After)
+		} else if opts.Offset > 0 {
+			params.Set("offset", strconv.Itoa(opts.Offset))
+		}
+	}
+
+	var messages []SessionMessage
+	if err := c.do(ctx, http.MethodGet, sessionPath(sessionID, "/messages"), params, nil, &messages); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// SendSessionMessage 向会话发送用户消息，工具空闲时送达
+func (c *AnywhereClient) SendSessionMessage(ctx context.Context, sessionID string, content string) (*SessionMessage, error) {
+	requestData := map[string]interface{}{"content": content}
+
+	message := &SessionMessage{}
+	if err := c.do(ctx, http.MethodPost, sessionPath(sessionID, "/messages"), nil, requestData, message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// sessionPath 返回会话的API路径
+func sessionPath(sessionID string, suffix string) string {
+	return "/api/v1/terminal/sessions/" + url.PathEscape(sessionID) + suffix
+}
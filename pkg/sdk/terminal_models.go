@@ -0,0 +1,127 @@
+package sdk
+
+import "time"
+
+// Tool 会话中运行的AI工具
+type Tool string
+
+// 支持的工具
+const (
+	ToolClaude  Tool = "claude"
+	ToolGemini  Tool = "gemini"
+	ToolCursor  Tool = "cursor"
+	ToolCopilot Tool = "copilot"
+)
+
+// Role 调用者在会话中的角色
+type Role string
+
+// 会话角色，后者拥有前者的全部权限
+const (
+	RoleViewer    Role = "viewer"
+	RoleCommenter Role = "commenter"
+	RoleOperator  Role = "operator"
+	RoleOwner     Role = "owner"
+)
+
+// Session 终端会话
+type Session struct {
+	ID                string    `json:"id"`
+	Name              string    `json:"name"`
+	Tool              Tool      `json:"tool"`
+	Status            string    `json:"status"`
+	Created           time.Time `json:"created"`
+	UnreadMessages    int64     `json:"unread_messages"`
+	RequiresUserInput bool      `json:"requires_user_input"`
+
+	// 运行会话的设备
+	DeviceID   string `json:"device_id"`
+	DeviceName string `json:"device_name"`
+	Remote     bool   `json:"remote"`
+
+	Lease *Lease `json:"lease,omitempty"`
+	Role  Role   `json:"role,omitempty"`
+}
+
+// Lease 会话租约，持有者才能向会话输入
+type Lease struct {
+	SessionID string     `json:"session_id"`
+	DeviceID  string     `json:"device_id"`
+	State     string     `json:"state"` // held、expired或free
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Epoch     int64      `json:"epoch"`
+}
+
+// CreateSessionRequest 创建会话请求
+type CreateSessionRequest struct {
+	Tool Tool   `json:"tool"`
+	Name string `json:"name,omitempty"`
+	Host string `json:"host,omitempty"` // 运行会话的已配对设备，默认为服务器本机
+}
+
+// SenderType 消息发送者类型
+type SenderType string
+
+// 消息发送者
+const (
+	SenderAgent SenderType = "AGENT"
+	SenderUser  SenderType = "USER"
+)
+
+// SessionMessage 终端会话中的消息
+type SessionMessage struct {
+	ID                string     `json:"id"`
+	SessionID         string     `json:"session_id"`
+	SenderType        SenderType `json:"sender_type"`
+	Content           string     `json:"content"`
+	RequiresUserInput bool       `json:"requires_user_input"`
+	Metadata          string     `json:"metadata,omitempty"` // JSON字符串
+	CreatedAt         time.Time  `json:"created_at"`
+	GitDiff           string     `json:"git_diff,omitempty"`
+	Redacted          bool       `json:"redacted,omitempty"`
+	DeliveryStatus    string     `json:"delivery_status,omitempty"`
+	DeliveredAt       *time.Time `json:"delivered_at,omitempty"`
+}
+
+// ListMessagesOptions 分页获取消息的选项
+type ListMessagesOptions struct {
+	Limit  int    // 每页条数，默认100，最多500
+	Offset int    // 从第几条开始（按时间从旧到新）
+	After  string // 只返回该消息之后的消息，设置时忽略Offset
+}
+
+// Key 可以发送给会话的特殊按键（tmux按键名）
+type Key string
+
+// 支持的按键
+const (
+	KeyEnter     Key = "Enter"
+	KeyEscape    Key = "Escape"
+	KeyTab       Key = "Tab"
+	KeyShiftTab  Key = "BTab"
+	KeySpace     Key = "Space"
+	KeyBackspace Key = "BSpace"
+	KeyUp        Key = "Up"
+	KeyDown      Key = "Down"
+	KeyLeft      Key = "Left"
+	KeyRight     Key = "Right"
+	KeyHome      Key = "Home"
+	KeyEnd       Key = "End"
+	KeyPageUp    Key = "PPage"
+	KeyPageDown  Key = "NPage"
+	KeyCtrlC     Key = "C-c"
+	KeyCtrlD     Key = "C-d"
+	KeyCtrlL     Key = "C-l"
+	KeyCtrlR     Key = "C-r"
+	KeyCtrlZ     Key = "C-z"
+)
+
+// PermissionAnswer 对工具权限请求的回答
+type PermissionAnswer string
+
+// 权限回答
+const (
+	PermissionAllow       PermissionAnswer = "allow"        // 允许本次操作
+	PermissionAllowAlways PermissionAnswer = "allow_always" // 允许且不再询问，仅当提示提供该选项时可用
+	PermissionDeny        PermissionAnswer = "deny"         // 拒绝
+)
@@ -11,6 +11,13 @@ let isComposing = false; // IME 输入状态
 let lastCompositionEnd = 0; // 最后一次composition结束时间
 let compositionData = ''; // 当前组合文本
 
+// 每个浏览器一个设备ID，用于按设备记录已读状态
+const DEVICE_ID = localStorage.getItem('anywhereDeviceId') || (() => {
+    const id = 'web-' + Math.random().toString(36).slice(2, 10);
+    localStorage.setItem('anywhereDeviceId', id);
+    return id;
+})();
+
 // Initialize
 document.addEventListener('DOMContentLoaded', () => {
     loadSessions();
@@ -31,7 +38,7 @@ document.addEventListener('DOMContentLoaded', () => {
 
 // WebSocket Connection
 function connectWebSocket() {
-    ws = new WebSocket(`ws://localhost:8080/api/v1/ws`);
+    ws = new WebSocket(`ws://localhost:8080/api/v1/ws?device_id=${DEVICE_ID}`);
     
     ws.onopen = () => {
         console.log('WebSocket连接成功');
@@ -76,6 +83,7 @@ function handleWebSocketMessage(data) {
             if (data.sessionId === currentSessionId) {
                 messages = data.data || [];
                 renderMessages();
+                markCurrentSessionRead();
             }
             break;
             
@@ -91,6 +99,26 @@ function handleWebSocketMessage(data) {
                 messages.push(message);
                 renderMessages();
                 scrollToBottom();
+                markCurrentSessionRead();
+            } else if (data.data && data.data.sender_type === 'AGENT') {
+                loadSessions();
+            }
+            break;
+            
+        case 'messageStatus':
+            if (data.sessionId === currentSessionId && data.data) {
+                const index = messages.findIndex(m => m.id === data.data.id);
+                if (index !== -1) {
+                    messages[index] = data.data;
+                    renderMessages();
+                }
+            }
+            break;
+            
+        case 'readState':
+            // 同一设备的其他窗口已读后刷新未读角标
+            if (data.data && data.data.device_id === DEVICE_ID) {
+                loadSessions();
             }
             break;
             
@@ -111,7 +139,13 @@ function handleWebSocketMessage(data) {
 // Load Sessions
 async function loadSessions() {
     try {
-        const response = await fetch(`${API_BASE}/api/v1/terminal/sessions`);
+        const response = await fetch(`${API_BASE}/api/v1/terminal/sessions`, {
+            headers: { 'X-Device-ID': DEVICE_ID }
+        });
+        if (response.status === 401) {
+            await login();
+            return;
+        }
         if (response.ok) {
             sessions = await response.json();
             renderSessions();
@@ -123,6 +157,29 @@ async function loadSessions() {
     }
 }
 
+// Login: 密码登录或跳转到 OAuth 登录页
+async function login() {
+    const response = await fetch(`${API_BASE}/api/v1/auth/providers`);
+    const options = await response.json();
+    if (options.password) {
+        const email = prompt('邮箱');
+        const password = prompt('密码');
+        if (!email || !password) return;
+        const result = await fetch(`${API_BASE}/api/v1/auth/login`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ email, password })
+        });
+        if (result.ok) {
+            location.reload();
+        } else {
+            alert('登录失败');
+        }
+    } else if (options.providers.length > 0) {
+        location.href = `${API_BASE}/api/v1/auth/${options.providers[0]}/login?redirect=/`;
+    }
+}
+
 // Render Sessions
 function renderSessions() {
     const container = document.getElementById('sessionsList');
@@ -137,6 +194,8 @@ function renderSessions() {
              onclick="selectSession('${session.id}')">
             <div class="session-name">
                 🤖 ${session.name || session.id}
+                ${session.requires_user_input ? '<span class="session-badge">⏳</span>' : ''}
+                ${session.unread_messages > 0 ? `<span class="session-badge">${session.unread_messages}</span>` : ''}
             </div>
             <div class="session-info">
                 ${session.tool} • ${session.status === 'active' ? '运行中' : '已停止'}
@@ -179,7 +238,30 @@ async function selectSession(sessionId) {
     }
 }
 
+// 将当前会话标记为已读（到最后一条消息）
+function markCurrentSessionRead() {
+    if (!ws || ws.readyState !== WebSocket.OPEN || messages.length === 0) {
+        return;
+    }
+    ws.send(JSON.stringify({
+        action: 'markAsRead',
+        sessionId: currentSessionId,
+        data: messages[messages.length - 1].id
+    }));
+}
+
 // Render Messages
+// 用户消息投递状态
+function deliveryStatusLabel(status) {
+    switch(status) {
+        case 'queued': return '排队中';
+        case 'sent': return '已发送';
+        case 'acknowledged': return '已接收';
+        case 'failed': return '发送失败';
+        default: return '';
+    }
+}
+
 function renderMessages() {
     const container = document.getElementById('messagesContainer');
     
@@ -201,6 +283,7 @@ function renderMessages() {
                     <div class="sender">
                         ${isAgent ? 'Claude' : '我'}
                         <span class="time">${time}</span>
+                        ${msg.delivery_status ? `<span class="time">${deliveryStatusLabel(msg.delivery_status)}</span>` : ''}
                     </div>
                     <div class="text">${formatMessage(msg.content)}</div>
                 </div>